@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WindowEvent is a single window/app usage sample from ActivityWatch or a similar tracker
+type WindowEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	Duration  float64   `json:"duration"`
+	Data      struct {
+		App   string `json:"app"`
+		Title string `json:"title"`
+	} `json:"data"`
+}
+
+// ActivityCandidate is a cluster of window events proposed as a time entry
+type ActivityCandidate struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	App         string    `json:"app"`
+	Titles      []string  `json:"titles"`
+	Description string    `json:"description"`
+	Timespan    string    `json:"timespan"`
+	EntryID     string    `json:"entry_id,omitempty"`
+	// DuplicateOf is the existing entry already covering this time, if any
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+}
+
+// activityWatchExport mirrors the bucket export produced by ActivityWatch
+type activityWatchExport struct {
+	Buckets map[string]struct {
+		Type   string        `json:"type"`
+		Events []WindowEvent `json:"events"`
+	} `json:"buckets"`
+}
+
+// parseWindowEvents accepts either a full ActivityWatch bucket export or a plain event array
+func parseWindowEvents(body []byte) ([]WindowEvent, error) {
+	trimmed := strings.TrimSpace(string(body))
+	if strings.HasPrefix(trimmed, "[") {
+		var events []WindowEvent
+		if err := json.Unmarshal(body, &events); err != nil {
+			return nil, fmt.Errorf("error parsing events: %v", err)
+		}
+		return events, nil
+	}
+
+	var export activityWatchExport
+	if err := json.Unmarshal(body, &export); err != nil {
+		return nil, fmt.Errorf("error parsing export: %v", err)
+	}
+
+	events := []WindowEvent{}
+	for _, bucket := range export.Buckets {
+		// Only window buckets carry app/title data, AFK and web buckets are skipped
+		if bucket.Type != "" && bucket.Type != "currentwindow" {
+			continue
+		}
+		events = append(events, bucket.Events...)
+	}
+
+	return events, nil
+}
+
+// clusterWindowEvents merges consecutive events for the same app into candidate entries
+func clusterWindowEvents(events []WindowEvent) []ActivityCandidate {
+	config := currentConfig().WindowImport
+	maxGap := time.Duration(config.MaxGapMinutes) * time.Minute
+	minDuration := time.Duration(config.MinMinutes) * time.Minute
+
+	ignored := make(map[string]bool)
+	for _, app := range config.IgnoredApps {
+		ignored[strings.ToLower(app)] = true
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+
+	type cluster struct {
+		candidate ActivityCandidate
+		active    time.Duration
+		titleTime map[string]time.Duration
+	}
+
+	clusters := []*cluster{}
+	var current *cluster
+
+	for _, event := range events {
+		app := strings.TrimSpace(event.Data.App)
+		if app == "" || ignored[strings.ToLower(app)] {
+			continue
+		}
+
+		duration := time.Duration(event.Duration * float64(time.Second))
+		end := event.Timestamp.Add(duration)
+
+		if current == nil || current.candidate.App != app || event.Timestamp.Sub(current.candidate.End) > maxGap {
+			current = &cluster{
+				candidate: ActivityCandidate{Start: event.Timestamp, End: end, App: app},
+				titleTime: make(map[string]time.Duration),
+			}
+			clusters = append(clusters, current)
+		}
+
+		if end.After(current.candidate.End) {
+			current.candidate.End = end
+		}
+		current.active += duration
+		if event.Data.Title != "" {
+			current.titleTime[event.Data.Title] += duration
+		}
+	}
+
+	candidates := []ActivityCandidate{}
+	for _, c := range clusters {
+		if c.active < minDuration {
+			continue
+		}
+
+		// Order titles by time spent so the description reflects the main activity
+		titles := make([]string, 0, len(c.titleTime))
+		for title := range c.titleTime {
+			titles = append(titles, title)
+		}
+		sort.Slice(titles, func(i, j int) bool {
+			return c.titleTime[titles[i]] > c.titleTime[titles[j]]
+		})
+		if len(titles) > 3 {
+			titles = titles[:3]
+		}
+
+		candidate := c.candidate
+		candidate.Titles = titles
+		candidate.Timespan = fmt.Sprintf("%dm", int(c.active.Round(time.Minute).Minutes()))
+		candidate.Description = fmt.Sprintf("Worked in %s", candidate.App)
+		if len(titles) > 0 {
+			candidate.Description = fmt.Sprintf("Worked in %s: %s", candidate.App, strings.Join(titles, "; "))
+		}
+
+		candidates = append(candidates, candidate)
+	}
+
+	return candidates
+}
+
+func activityWatchImportHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	events, err := parseWindowEvents(body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	candidates := clusterWindowEvents(events)
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	// Submit each candidate as an uncategorized entry in the file for the day it started
+	errors := []string{}
+	if !dryRun {
+		for i := range candidates {
+			entry := TimeEntry{
+				ID:          uuid.New().String(),
+				Timespan:    candidates[i].Timespan,
+				Description: candidates[i].Description,
+				Categorized: false,
+				User:        entryUserName(currentUser(r)),
+			}
+
+			if err := appendEntry(r.Context(), candidates[i].Start.In(userLocation(entryOwner(entry))), entry); err != nil {
+				errors = append(errors, fmt.Sprintf("Error saving candidate starting %s: %v", candidates[i].Start.Format(time.RFC3339), err))
+				continue
+			}
+			candidates[i].EntryID = entry.ID
+		}
+	}
+
+	// Create response
+	response := map[string]interface{}{
+		"event_count":     len(events),
+		"candidate_count": len(candidates),
+		"candidates":      candidates,
+		"dry_run":         dryRun,
+	}
+
+	if len(errors) > 0 {
+		response["errors"] = errors
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
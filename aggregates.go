@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"log"
+	"maps"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// aggregateKey is one user's time on a task and Jira issue
+type aggregateKey struct {
+	User string
+	Task string
+	Jira string
+}
+
+// DayAggregate totals a day's entries so the summary and utilization reports don't
+// sum every entry on each request. Tasks are kept as stored and canonicalized when
+// reported, so renaming a category doesn't invalidate it.
+type DayAggregate struct {
+	Entries     int
+	Categorized int
+	// EntriesByUser and CategorizedByUser split the entry counts by owner
+	EntriesByUser     map[string]int
+	CategorizedByUser map[string]int
+	// MinutesByUser is each owner's time, rounded per entry by their preferences
+	MinutesByUser map[string]int
+	// Primary and Proportional hold the minutes per user, task and Jira issue in each label attribution mode
+	Primary      map[aggregateKey]int
+	Proportional map[aggregateKey]int
+}
+
+func newDayAggregate() *DayAggregate {
+	return &DayAggregate{
+		EntriesByUser:     make(map[string]int),
+		CategorizedByUser: make(map[string]int),
+		MinutesByUser:     make(map[string]int),
+		Primary:           make(map[aggregateKey]int),
+		Proportional:      make(map[aggregateKey]int),
+	}
+}
+
+// clone copies the aggregate so it can be changed while readers hold the original
+func (a *DayAggregate) clone() *DayAggregate {
+	return &DayAggregate{
+		Entries:           a.Entries,
+		Categorized:       a.Categorized,
+		EntriesByUser:     maps.Clone(a.EntriesByUser),
+		CategorizedByUser: maps.Clone(a.CategorizedByUser),
+		MinutesByUser:     maps.Clone(a.MinutesByUser),
+		Primary:           maps.Clone(a.Primary),
+		Proportional:      maps.Clone(a.Proportional),
+	}
+}
+
+// forUser narrows the aggregate to one user's entries, "" keeping every user's
+func (a *DayAggregate) forUser(user string) *DayAggregate {
+	if user == "" {
+		return a
+	}
+
+	narrowed := newDayAggregate()
+	narrowed.Entries = a.EntriesByUser[user]
+	narrowed.Categorized = a.CategorizedByUser[user]
+	narrowed.EntriesByUser[user] = a.EntriesByUser[user]
+	narrowed.CategorizedByUser[user] = a.CategorizedByUser[user]
+	narrowed.MinutesByUser[user] = a.MinutesByUser[user]
+	for key, minutes := range a.Primary {
+		if key.User == user {
+			narrowed.Primary[key] = minutes
+		}
+	}
+	for key, minutes := range a.Proportional {
+		if key.User == user {
+			narrowed.Proportional[key] = minutes
+		}
+	}
+	return narrowed
+}
+
+var (
+	primaryAttribution      = withAttribution(context.Background(), AttributePrimary)
+	proportionalAttribution = withAttribution(context.Background(), AttributeProportional)
+)
+
+// add counts an entry, entries in the trash are skipped
+func (a *DayAggregate) add(entry TimeEntry) {
+	if entry.DeletedAt != "" {
+		return
+	}
+	owner := entryOwner(entry)
+	a.Entries++
+	a.EntriesByUser[owner]++
+	if entry.Categorized {
+		a.Categorized++
+		a.CategorizedByUser[owner]++
+	}
+
+	duration, err := parseTimespan(entry.Timespan)
+	if err != nil {
+		return
+	}
+	minutes := roundMinutes(owner, int(duration.Minutes()))
+	a.MinutesByUser[owner] += minutes
+	for _, share := range attributeMinutes(primaryAttribution, entry, minutes) {
+		a.Primary[aggregateKey{User: owner, Task: share.Task, Jira: share.Jira}] += share.Minutes
+	}
+	for _, share := range attributeMinutes(proportionalAttribution, entry, minutes) {
+		a.Proportional[aggregateKey{User: owner, Task: share.Task, Jira: share.Jira}] += share.Minutes
+	}
+}
+
+// TotalMinutes returns the day's time across every user
+func (a *DayAggregate) TotalMinutes() int {
+	total := 0
+	for _, minutes := range a.MinutesByUser {
+		total += minutes
+	}
+	return total
+}
+
+// shares returns the minutes per user, task and Jira issue in the context's attribution mode
+func (a *DayAggregate) shares(ctx context.Context) map[aggregateKey]int {
+	if attribution(ctx) == AttributeProportional {
+		return a.Proportional
+	}
+	return a.Primary
+}
+
+// fileAggregate holds the aggregates of every day in a data file, valid while the
+// file's size and modification time and the aggregate generation are unchanged
+type fileAggregate struct {
+	size       int64
+	modTime    time.Time
+	generation int64
+	days       map[string]*DayAggregate
+}
+
+func (f *fileAggregate) current(info os.FileInfo) bool {
+	return f.size == info.Size() && f.modTime.Equal(info.ModTime()) && f.generation == aggregateGeneration.Load()
+}
+
+var (
+	aggregatesMu sync.Mutex
+	// dayAggregates is keyed by data file name
+	dayAggregates = map[string]*fileAggregate{}
+	// aggregateGeneration is bumped when a change outside the data files, like a
+	// rounding preference, alters every aggregate
+	aggregateGeneration atomic.Int64
+)
+
+// aggregateEntries totals the entries of a data file by day. Undated entries
+// predate the date column and always lived in daily files.
+func aggregateEntries(filename string, info os.FileInfo, generation int64, entries []TimeEntry) *fileAggregate {
+	undated := ""
+	if day, ok := filenameDay(filename); ok {
+		undated = entryDate(day)
+	}
+
+	aggregate := &fileAggregate{size: info.Size(), modTime: info.ModTime(), generation: generation, days: make(map[string]*DayAggregate)}
+	for _, entry := range entries {
+		date := entry.Date
+		if date == "" {
+			date = undated
+		}
+		day, ok := aggregate.days[date]
+		if !ok {
+			day = newDayAggregate()
+			aggregate.days[date] = day
+		}
+		day.add(entry)
+	}
+	return aggregate
+}
+
+// dailyAggregate returns a day's totals, summing its data file only when it changed
+// since it was last aggregated. The aggregate is shared and must not be modified.
+func dailyAggregate(day time.Time) (*DayAggregate, error) {
+	filename := dataFilename(day)
+	date := entryDate(day)
+
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		aggregatesMu.Lock()
+		delete(dayAggregates, filename)
+		aggregatesMu.Unlock()
+		return newDayAggregate(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	aggregatesMu.Lock()
+	if cached, ok := dayAggregates[filename]; ok && cached.current(info) {
+		aggregate, ok := cached.days[date]
+		aggregatesMu.Unlock()
+		if !ok {
+			aggregate = newDayAggregate()
+		}
+		return aggregate, nil
+	}
+	aggregatesMu.Unlock()
+
+	// Read the generation first, a bump while summing leaves the aggregate stale
+	generation := aggregateGeneration.Load()
+	entries, err := readEntries(filename)
+	if err != nil {
+		return nil, err
+	}
+	aggregate := aggregateEntries(filename, info, generation, entries)
+
+	aggregatesMu.Lock()
+	dayAggregates[filename] = aggregate
+	aggregatesMu.Unlock()
+
+	if day, ok := aggregate.days[date]; ok {
+		return day, nil
+	}
+	return newDayAggregate(), nil
+}
+
+// aggregateWrittenEntries replaces a file's aggregates with the entries just written to it
+func aggregateWrittenEntries(filename string, entries []TimeEntry) {
+	generation := aggregateGeneration.Load()
+	info, err := os.Stat(filename)
+	if err != nil {
+		aggregatesMu.Lock()
+		delete(dayAggregates, filename)
+		aggregatesMu.Unlock()
+		return
+	}
+	aggregate := aggregateEntries(filename, info, generation, entries)
+
+	aggregatesMu.Lock()
+	defer aggregatesMu.Unlock()
+	dayAggregates[filename] = aggregate
+}
+
+// aggregateAppendedEntry adds an entry appended to a file to its day's aggregate.
+// previous is the file as it was before the append, nil when the append created it.
+// Aggregates that were already out of date are left to be summed on the next read.
+func aggregateAppendedEntry(filename string, previous os.FileInfo, entry TimeEntry) {
+	info, err := os.Stat(filename)
+
+	aggregatesMu.Lock()
+	defer aggregatesMu.Unlock()
+
+	cached, ok := dayAggregates[filename]
+	switch {
+	case err != nil:
+		delete(dayAggregates, filename)
+		return
+	case previous == nil:
+		cached = &fileAggregate{generation: aggregateGeneration.Load(), days: make(map[string]*DayAggregate)}
+	case !ok || !cached.current(previous):
+		delete(dayAggregates, filename)
+		return
+	}
+
+	// Readers may hold the day's aggregate, so it is replaced rather than changed
+	day := newDayAggregate()
+	if existing, ok := cached.days[entry.Date]; ok {
+		day = existing.clone()
+	}
+	day.add(entry)
+	cached.days[entry.Date] = day
+	cached.size = info.Size()
+	cached.modTime = info.ModTime()
+	dayAggregates[filename] = cached
+}
+
+// warmAggregates sums the days of the entry cache window in the background at
+// startup, so the summary and utilization reports find them ready
+func warmAggregates(config EntriesConfig) {
+	today := storageToday()
+	for day := today.AddDate(0, 0, -config.CacheDays); !day.After(today); day = day.AddDate(0, 0, 1) {
+		if _, err := dailyAggregate(day); err != nil {
+			log.Printf("Error aggregating %s: %v", entryDate(day), err)
+		}
+	}
+}
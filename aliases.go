@@ -0,0 +1,343 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const aliasesFile = "aidea_aliases.json"
+
+// Alias explains shorthand users write in descriptions, e.g. "the dashboard project"
+// for FEDS or "JB" for John's onboarding project
+type Alias struct {
+	ID      string `json:"id"`
+	Phrase  string `json:"phrase"`
+	Meaning string `json:"meaning"`
+	// Jira is the issue or project key the phrase refers to, if any
+	Jira      string    `json:"jira,omitempty"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AliasRequest represents the JSON request for creating or updating an alias
+type AliasRequest struct {
+	Phrase  string `json:"phrase"`
+	Meaning string `json:"meaning"`
+	Jira    string `json:"jira"`
+}
+
+var (
+	aliasesMu sync.Mutex
+	aliases   []Alias
+)
+
+// loadAliases reads the aliases file once, callers must hold aliasesMu
+func loadAliases() error {
+	if aliases != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(aliasesFile)
+	if os.IsNotExist(err) {
+		aliases = []Alias{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read aliases: %v", err)
+	}
+
+	var loaded []Alias
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("couldn't parse aliases: %v", err)
+	}
+
+	aliases = loaded
+	return nil
+}
+
+// saveAliases writes the aliases file, callers must hold aliasesMu
+func saveAliases() error {
+	data, err := json.MarshalIndent(aliases, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't encode aliases: %v", err)
+	}
+
+	return os.WriteFile(aliasesFile, data, 0644)
+}
+
+// listAliases returns a copy of the aliases
+func listAliases() ([]Alias, error) {
+	aliasesMu.Lock()
+	defer aliasesMu.Unlock()
+
+	if err := loadAliases(); err != nil {
+		return nil, err
+	}
+	return slices.Clone(aliases), nil
+}
+
+// aliasPattern matches an alias phrase as whole words, ignoring case and spacing
+func aliasPattern(phrase string) *regexp.Regexp {
+	words := strings.Fields(regexp.QuoteMeta(phrase))
+	return regexp.MustCompile(`(?i)\b` + strings.Join(words, `\s+`) + `\b`)
+}
+
+// expandAliases annotates each alias phrase found in the text with its meaning,
+// e.g. "JB demo" becomes "JB (John's onboarding project, Jira ONB) demo", so both
+// the embeddings and the LLM see what the shorthand stands for
+func expandAliases(text string) (string, []Alias) {
+	all, err := listAliases()
+	if err != nil || len(all) == 0 {
+		return text, nil
+	}
+
+	// Longer phrases first so "the dashboard project" wins over "dashboard"
+	sort.SliceStable(all, func(i, j int) bool {
+		return len(all[i].Phrase) > len(all[j].Phrase)
+	})
+
+	type match struct {
+		alias      Alias
+		start, end int
+	}
+
+	// Find phrases in the original text, skipping any inside a longer phrase already found
+	matches := []match{}
+	for _, alias := range all {
+		location := aliasPattern(alias.Phrase).FindStringIndex(text)
+		if location == nil {
+			continue
+		}
+		overlaps := slices.ContainsFunc(matches, func(m match) bool {
+			return location[0] < m.end && m.start < location[1]
+		})
+		if !overlaps {
+			matches = append(matches, match{alias: alias, start: location[0], end: location[1]})
+		}
+	}
+
+	// Annotate from the end so earlier positions stay valid
+	sort.Slice(matches, func(i, j int) bool { return matches[i].end > matches[j].end })
+
+	matched := make([]Alias, 0, len(matches))
+	for _, m := range matches {
+		annotation := m.alias.Meaning
+		if m.alias.Jira != "" {
+			annotation += ", Jira " + m.alias.Jira
+		}
+		text = text[:m.end] + " (" + annotation + ")" + text[m.end:]
+		matched = append(matched, m.alias)
+	}
+
+	return text, matched
+}
+
+// applyAliasJira fills in the Jira issue when the LLM left it empty and exactly one
+// matched alias names a specific issue
+func applyAliasJira(result *CategoryResponse, matched []Alias) {
+	if result.Jira != "" {
+		return
+	}
+
+	issues := []string{}
+	for _, alias := range matched {
+		if jiraKeyPattern.MatchString(alias.Jira) && !slices.Contains(issues, alias.Jira) {
+			issues = append(issues, alias.Jira)
+		}
+	}
+
+	if len(issues) == 1 {
+		result.Jira = issues[0]
+		result.Reason = strings.TrimSpace(result.Reason + " Jira taken from alias.")
+	}
+}
+
+// validateAlias checks an alias payload, making sure phrases stay unique
+func validateAlias(request AliasRequest, existing []Alias, id string) []ErrorDetail {
+	v := &validator{}
+	v.text("phrase", request.Phrase, true, maxTaskLength)
+	v.text("meaning", request.Meaning, true, maxTaskLength)
+	v.jiraReference("jira", request.Jira)
+
+	for _, alias := range existing {
+		if alias.ID != id && strings.EqualFold(strings.Join(strings.Fields(alias.Phrase), " "), strings.Join(strings.Fields(request.Phrase), " ")) {
+			v.add("phrase", "%q is already an alias", request.Phrase)
+		}
+	}
+
+	return v.details
+}
+
+func parseAliasRequest(w http.ResponseWriter, r *http.Request) (AliasRequest, bool) {
+	var request AliasRequest
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return request, false
+	}
+	defer r.Body.Close()
+
+	// Parse JSON request
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+		return request, false
+	}
+
+	return request, true
+}
+
+// aliasesHandler lists (GET) or creates (POST) aliases, any user may maintain them
+func aliasesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		requireScope(ScopeEntriesRead, listAliasesHandler)(w, r)
+	case http.MethodPost:
+		requireScope(ScopeEntriesWrite, createAliasHandler)(w, r)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// aliasHandler updates (PUT) or deletes (DELETE) an alias
+func aliasHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		requireScope(ScopeEntriesWrite, updateAliasHandler)(w, r)
+	case http.MethodDelete:
+		requireScope(ScopeEntriesWrite, deleteAliasHandler)(w, r)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func listAliasesHandler(w http.ResponseWriter, r *http.Request) {
+	all, err := listAliases()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(all)
+}
+
+func createAliasHandler(w http.ResponseWriter, r *http.Request) {
+	request, ok := parseAliasRequest(w, r)
+	if !ok {
+		return
+	}
+
+	aliasesMu.Lock()
+	defer aliasesMu.Unlock()
+
+	if err := loadAliases(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if details := validateAlias(request, aliases, ""); len(details) > 0 {
+		writeValidationError(w, r, details...)
+		return
+	}
+
+	alias := Alias{
+		ID:        uuid.New().String(),
+		Phrase:    strings.TrimSpace(request.Phrase),
+		Meaning:   strings.TrimSpace(request.Meaning),
+		Jira:      request.Jira,
+		CreatedBy: entryUserName(currentUser(r)),
+		UpdatedAt: time.Now(),
+	}
+
+	aliases = append(aliases, alias)
+	if err := saveAliases(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving alias: "+err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(alias)
+}
+
+func updateAliasHandler(w http.ResponseWriter, r *http.Request) {
+	request, ok := parseAliasRequest(w, r)
+	if !ok {
+		return
+	}
+
+	id := r.PathValue("id")
+
+	aliasesMu.Lock()
+	defer aliasesMu.Unlock()
+
+	if err := loadAliases(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	index := slices.IndexFunc(aliases, func(a Alias) bool { return a.ID == id })
+	if index == -1 {
+		writeError(w, r, http.StatusNotFound, "Alias not found")
+		return
+	}
+
+	if details := validateAlias(request, aliases, id); len(details) > 0 {
+		writeValidationError(w, r, details...)
+		return
+	}
+
+	aliases[index].Phrase = strings.TrimSpace(request.Phrase)
+	aliases[index].Meaning = strings.TrimSpace(request.Meaning)
+	aliases[index].Jira = request.Jira
+	aliases[index].UpdatedAt = time.Now()
+	if err := saveAliases(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving alias: "+err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(aliases[index])
+}
+
+func deleteAliasHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	aliasesMu.Lock()
+	defer aliasesMu.Unlock()
+
+	if err := loadAliases(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	index := slices.IndexFunc(aliases, func(a Alias) bool { return a.ID == id })
+	if index == -1 {
+		writeError(w, r, http.StatusNotFound, "Alias not found")
+		return
+	}
+
+	aliases = slices.Delete(aliases, index, index+1)
+	if err := saveAliases(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving aliases: "+err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Anomaly kinds
+const (
+	AnomalyLongDay       = "long_day"
+	AnomalyDuplicate     = "duplicate_entry"
+	AnomalyCategorySpike = "category_spike"
+)
+
+// AnomalyConfig sets the thresholds for suspicious logged time
+type AnomalyConfig struct {
+	// MaxDailyHours flags days logging more than this
+	MaxDailyHours float64 `json:"max_daily_hours"`
+	// SpikeFactor flags a task whose share of a week is this many times its usual share
+	SpikeFactor float64 `json:"spike_factor"`
+	// BaselineWeeks is how many preceding weeks define a task's usual share
+	BaselineWeeks int `json:"baseline_weeks"`
+	// MinSpikeMinutes ignores spikes in tasks with less time than this in the week
+	MinSpikeMinutes int `json:"min_spike_minutes"`
+}
+
+// Anomaly is a suspicious pattern worth checking before a timesheet is submitted
+type Anomaly struct {
+	Kind     string   `json:"kind"`
+	Date     string   `json:"date"`
+	Message  string   `json:"message"`
+	EntryIDs []string `json:"entry_ids,omitempty"`
+}
+
+// AnomalyReport lists the anomalies found in a user's entries over a date range
+type AnomalyReport struct {
+	User      string    `json:"user"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Anomalies []Anomaly `json:"anomalies"`
+}
+
+// findLongDays flags days logging more than the configured maximum
+func findLongDays(entries []TimeEntry, config AnomalyConfig) []Anomaly {
+	minutesByDate := make(map[string]int)
+	idsByDate := make(map[string][]string)
+	for _, entry := range entries {
+		minutesByDate[entry.Date] += entryMinutes(entry)
+		idsByDate[entry.Date] = append(idsByDate[entry.Date], entry.ID)
+	}
+
+	anomalies := []Anomaly{}
+	limit := int(config.MaxDailyHours * 60)
+	for date, minutes := range minutesByDate {
+		if minutes > limit {
+			anomalies = append(anomalies, Anomaly{
+				Kind:     AnomalyLongDay,
+				Date:     date,
+				Message:  fmt.Sprintf("%.1fh logged, more than %.0fh", float64(minutes)/60, config.MaxDailyHours),
+				EntryIDs: idsByDate[date],
+			})
+		}
+	}
+
+	return anomalies
+}
+
+// findDuplicates flags entries logged more than once on the same day with the same description and duration
+func findDuplicates(entries []TimeEntry) []Anomaly {
+	groups := make(map[string][]TimeEntry)
+	keys := []string{}
+	for _, entry := range entries {
+		key := entry.Date + "\x00" + strings.ToLower(strings.Join(strings.Fields(entry.Description), " ")) + "\x00" + entry.Timespan
+		if groups[key] == nil {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], entry)
+	}
+
+	anomalies := []Anomaly{}
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) < 2 {
+			continue
+		}
+
+		ids := make([]string, 0, len(group))
+		for _, entry := range group {
+			ids = append(ids, entry.ID)
+		}
+		anomalies = append(anomalies, Anomaly{
+			Kind:     AnomalyDuplicate,
+			Date:     group[0].Date,
+			Message:  fmt.Sprintf("%q (%s) logged %d times", group[0].Description, group[0].Timespan, len(group)),
+			EntryIDs: ids,
+		})
+	}
+
+	return anomalies
+}
+
+// taskShares returns each task's share of the minutes logged between from and to inclusive
+func taskShares(entries []TimeEntry, from, to string) (map[string]float64, map[string]int) {
+	minutes := make(map[string]int)
+	total := 0
+	for _, entry := range entries {
+		if entry.Date < from || entry.Date > to || entry.Task == "" {
+			continue
+		}
+		minutes[entry.Task] += entryMinutes(entry)
+		total += entryMinutes(entry)
+	}
+
+	shares := make(map[string]float64)
+	for task, taskMinutes := range minutes {
+		if total > 0 {
+			shares[task] = float64(taskMinutes) / float64(total)
+		}
+	}
+	return shares, minutes
+}
+
+// findCategorySpikes flags tasks whose share of a week jumped well above their
+// share of the preceding baseline weeks
+func findCategorySpikes(entries []TimeEntry, from, to time.Time, config AnomalyConfig) []Anomaly {
+	anomalies := []Anomaly{}
+	for week := weekStart(from); !week.After(to); week = week.AddDate(0, 0, 7) {
+		shares, minutes := taskShares(entries, entryDate(week), entryDate(week.AddDate(0, 0, 6)))
+		baseline, _ := taskShares(entries, entryDate(week.AddDate(0, 0, -7*config.BaselineWeeks)), entryDate(week.AddDate(0, 0, -1)))
+
+		for task, share := range shares {
+			usual := baseline[task]
+			// A task new to the baseline has no usual share to compare with
+			if usual == 0 || minutes[task] < config.MinSpikeMinutes || share < usual*config.SpikeFactor {
+				continue
+			}
+
+			anomalies = append(anomalies, Anomaly{
+				Kind: AnomalyCategorySpike,
+				Date: entryDate(week),
+				Message: fmt.Sprintf("%s took %.0f%% of the week starting %s, %.1fx its usual %.0f%%",
+					task, share*100, entryDate(week), share/usual, usual*100),
+			})
+		}
+	}
+
+	return anomalies
+}
+
+// anomalyReportHandler flags suspicious time in the current user's entries between
+// from and to (YYYYMMDD, default this week), managers may pass ?user= to check someone else's
+func anomalyReportHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	current := currentUser(r)
+	user := current.Name
+	if requested := r.URL.Query().Get("user"); requested != "" && requested != user {
+		if !current.HasRole(RoleManager) {
+			writeError(w, r, http.StatusForbidden, "Forbidden")
+			return
+		}
+		user = requested
+	}
+
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Spikes are measured against the weeks before the range
+	config := currentConfig().Anomalies
+	baselineStart := weekStart(from).AddDate(0, 0, -7*config.BaselineWeeks)
+	all, err := readEntriesBetween(r.Context(), baselineStart, to)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error reading entries: %v", err))
+		return
+	}
+
+	history := []TimeEntry{}
+	inRange := []TimeEntry{}
+	for _, entry := range all {
+		if entryOwner(entry) != user {
+			continue
+		}
+		history = append(history, entry)
+		if entry.Date >= entryDate(from) {
+			inRange = append(inRange, entry)
+		}
+	}
+
+	report := AnomalyReport{
+		User:      user,
+		From:      from.Format("20060102"),
+		To:        to.Format("20060102"),
+		Anomalies: []Anomaly{},
+	}
+	report.Anomalies = append(report.Anomalies, findLongDays(inRange, config)...)
+	report.Anomalies = append(report.Anomalies, findDuplicates(inRange)...)
+	report.Anomalies = append(report.Anomalies, findCategorySpikes(history, from, to, config)...)
+
+	sort.SliceStable(report.Anomalies, func(i, j int) bool {
+		return report.Anomalies[i].Date < report.Anomalies[j].Date
+	})
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIConfig controls API version deprecation
+type APIConfig struct {
+	// V1Deprecated adds Deprecation headers to every /api/v1 response
+	V1Deprecated bool `json:"v1_deprecated"`
+	// V1Sunset is the date (YYYY-MM-DD) /api/v1 will be removed, sent as the Sunset header
+	V1Sunset string `json:"v1_sunset,omitempty"`
+}
+
+// isoDate is the date format used throughout /api/v2
+const isoDate = "2006-01-02"
+
+// EntryV2 is the /api/v2 representation of an entry with numeric durations and real timestamps
+type EntryV2 struct {
+	ID              string     `json:"id"`
+	Date            string     `json:"date"`
+	CreatedAt       *time.Time `json:"created_at,omitempty"`
+	DurationMinutes *int       `json:"duration_minutes"`
+	Description     string     `json:"description"`
+	Task            string     `json:"task,omitempty"`
+	TaskReason      string     `json:"task_reason,omitempty"`
+	Jira            string     `json:"jira,omitempty"`
+	Confidence      string     `json:"confidence,omitempty"`
+	Categorized     bool       `json:"categorized"`
+	User            string     `json:"user"`
+	InputHash       string     `json:"input_hash,omitempty"`
+	Tags            []string   `json:"tags,omitempty"`
+	Links           []string   `json:"links,omitempty"`
+	// Labels are the entry's further categories in multi-label mode
+	Labels []EntryLabel `json:"labels,omitempty"`
+}
+
+// EntryRequestV2 represents the JSON request for creating an entry through /api/v2
+type EntryRequestV2 struct {
+	Description     string   `json:"description"`
+	DurationMinutes int      `json:"duration_minutes,omitempty"`
+	Jira            string   `json:"jira,omitempty"`
+	Date            string   `json:"date,omitempty"` // YYYY-MM-DD
+	Links           []string `json:"links,omitempty"`
+}
+
+// entryV2 converts a stored entry, rendering its timestamp in the given time zone
+func entryV2(entry TimeEntry, location *time.Location) EntryV2 {
+	result := EntryV2{
+		ID:          entry.ID,
+		Date:        entry.Date,
+		Description: entry.Description,
+		Task:        entry.Task,
+		TaskReason:  entry.TaskReason,
+		Jira:        entry.Jira,
+		Confidence:  entry.Confidence,
+		Categorized: entry.Categorized,
+		User:        entryOwner(entry),
+		InputHash:   entry.InputHash,
+		Tags:        entry.Tags,
+		Links:       entry.Links,
+		Labels:      entry.Labels,
+	}
+
+	if createdAt, err := time.Parse(time.RFC3339, entry.CreatedAt); err == nil {
+		local := createdAt.In(location)
+		result.CreatedAt = &local
+	}
+	if duration, err := parseTimespan(entry.Timespan); err == nil {
+		minutes := int(duration.Minutes())
+		result.DurationMinutes = &minutes
+	}
+
+	return result
+}
+
+// parseISODate parses an optional YYYY-MM-DD query parameter in a time zone
+func parseISODate(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return time.ParseInLocation(isoDate, value, fallback.Location())
+}
+
+// activityV2Handler lists (GET) or creates (POST) entries
+func activityV2Handler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		requireScope(ScopeEntriesRead, withView(listEntriesV2))(w, r)
+	case http.MethodPost:
+		requireScope(ScopeEntriesWrite, createEntryV2)(w, r)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// listEntriesV2 returns the current user's entries between from and to (YYYY-MM-DD), default
+// today, optionally narrowed by the task, jira and tag filters
+func listEntriesV2(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	today := userToday(user.Name)
+
+	from, err := parseISODate(r.URL.Query().Get("from"), today)
+	if err != nil {
+		writeValidationError(w, r, ErrorDetail{Field: "from", Message: "from must be in YYYY-MM-DD format"})
+		return
+	}
+	to, err := parseISODate(r.URL.Query().Get("to"), from)
+	if err != nil {
+		writeValidationError(w, r, ErrorDetail{Field: "to", Message: "to must be in YYYY-MM-DD format"})
+		return
+	}
+	if to.Before(from) {
+		writeValidationError(w, r, ErrorDetail{Field: "to", Message: "to must not be before from"})
+		return
+	}
+	filter, details := parseEntryFilter(r)
+	if len(details) > 0 {
+		writeValidationError(w, r, details...)
+		return
+	}
+
+	entries, err := readEntriesBetween(r.Context(), from, to)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error reading entries: %v", err))
+		return
+	}
+
+	results := []EntryV2{}
+	for _, entry := range entries {
+		if entryOwner(entry) == user.Name && filter.matches(entry) {
+			results = append(results, entryV2(entry, today.Location()))
+		}
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+func createEntryV2(w http.ResponseWriter, r *http.Request) {
+	// Check content type
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		writeError(w, r, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return
+	}
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	// Parse JSON request
+	var request EntryRequestV2
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+		return
+	}
+
+	user := currentUser(r)
+	location := userLocation(user.Name)
+
+	// Validate every field at once
+	v := &validator{}
+	v.text("description", request.Description, true, maxDescriptionLength)
+	v.jiraKey("jira", request.Jira)
+	v.links("links", request.Links)
+	if request.DurationMinutes < 0 || request.DurationMinutes > int(maxTimespan.Minutes()) {
+		v.add("duration_minutes", "duration_minutes must be between 1 and %d", int(maxTimespan.Minutes()))
+	}
+	day, err := parseISODate(request.Date, time.Now().In(location))
+	if err != nil {
+		v.add("date", "date must be in YYYY-MM-DD format")
+	}
+	if len(v.details) > 0 {
+		writeValidationError(w, r, v.details...)
+		return
+	}
+
+	entry := TimeEntry{
+		ID:          uuid.New().String(),
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Description: request.Description,
+		Jira:        request.Jira,
+		Categorized: false,
+		User:        entryUserName(user),
+		Links:       request.Links,
+	}
+	if request.DurationMinutes > 0 {
+		entry.Timespan = fmt.Sprintf("%dm", request.DurationMinutes)
+	}
+
+	// The date limits are shared with /api/v1
+	day, err = resolveEntryDay(day.Format("20060102"), entryOwner(entry))
+	if err != nil {
+		writeValidationError(w, r, ErrorDetail{Field: "date", Message: err.Error()})
+		return
+	}
+
+	err = appendEntry(r.Context(), day, entry)
+	if errors.Is(err, errWeekFrozen) {
+		writeErrorCode(w, r, http.StatusConflict, ErrCodeWeekFrozen, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving data: "+err.Error())
+		return
+	}
+
+	entry.Date = entryDate(day)
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entryV2(entry, location))
+}
+
+// summaryV2Handler returns the current user's daily summary with an ISO date
+// (?date=YYYY-MM-DD), admins may pass ?all_users=true for everyone's
+func summaryV2Handler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	user, ok := summaryUser(r)
+	if !ok {
+		writeError(w, r, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	day, err := parseISODate(r.URL.Query().Get("date"), userToday(currentUser(r).Name))
+	if err != nil {
+		writeValidationError(w, r, ErrorDetail{Field: "date", Message: "date must be in YYYY-MM-DD format"})
+		return
+	}
+
+	summary, err := summarizeDay(r.Context(), day, user)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	summary.Date = day.Format(isoDate)
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// apiVersionMiddleware routes unversioned /api/ paths by the API-Version header
+// (default 1) and marks /api/v1 responses as deprecated when configured
+func apiVersionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rest, found := strings.CutPrefix(r.URL.Path, "/api/"); found && !strings.HasPrefix(rest, "v1/") && !strings.HasPrefix(rest, "v2/") {
+			version := r.Header.Get("API-Version")
+			if version == "" {
+				version = "1"
+			}
+			if version != "1" && version != "2" {
+				writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Unsupported API version %q", version))
+				return
+			}
+			r = r.Clone(r.Context())
+			r.URL.Path = "/api/v" + version + "/" + rest
+			r.URL.RawPath = ""
+		}
+
+		if strings.HasPrefix(r.URL.Path, "/api/v1/") {
+			w.Header().Set("API-Version", "1")
+			if currentConfig().API.V1Deprecated {
+				w.Header().Set("Deprecation", "true")
+				w.Header().Add("Link", `</api/v2/>; rel="successor-version"`)
+			}
+			if sunset, err := time.Parse(isoDate, currentConfig().API.V1Sunset); err == nil {
+				w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+		} else if strings.HasPrefix(r.URL.Path, "/api/v2/") {
+			w.Header().Set("API-Version", "2")
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Roles granted to users in config.json
+const (
+	RoleAdmin    = "admin"
+	RoleReviewer = "reviewer"
+	RoleManager  = "manager"
+)
+
+// Scopes restrict what a token may do, tokens without scopes may do anything their user can
+const (
+	ScopeEntriesRead      = "entries:read"
+	ScopeEntriesWrite     = "entries:write"
+	ScopeReportsRead      = "reports:read"
+	ScopeTimesheetsWrite  = "timesheets:write"
+	ScopeTimesheetsReview = "timesheets:review"
+	ScopeRulesWrite       = "rules:write"
+	ScopeAdmin            = "admin"
+)
+
+// APIToken is a static token allowed to call authenticated endpoints
+type APIToken struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	// User is the configured user the token acts as, if any
+	User   string   `json:"user,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// User is a person tracking time, identified by one or more API tokens
+type User struct {
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+	// Timezone is the IANA zone deciding the user's "today", default the storage timezone
+	Timezone string `json:"timezone,omitempty"`
+	// WorkingHours overrides the default working window for this user
+	WorkingHours *WorkingHours `json:"working_hours,omitempty"`
+}
+
+// localUser is the implicit owner of all requests when no users are configured
+var localUser = &User{Name: "local", Roles: []string{RoleAdmin}}
+
+type contextKey string
+
+const (
+	userContextKey   contextKey = "user"
+	scopesContextKey contextKey = "scopes"
+)
+
+// HasRole reports whether the user holds a role, admins hold every role
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role || r == RoleAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// findUser returns the configured user with the given name
+func findUser(name string) *User {
+	users := currentConfig().Users
+	for i := range users {
+		if users[i].Name == name {
+			return &users[i]
+		}
+	}
+	return nil
+}
+
+// requestToken extracts the token from an Authorization bearer header or X-API-Key header
+func requestToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		if token, found := strings.CutPrefix(header, "Bearer "); found {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// matchToken returns the configured static token presented by the request
+func matchToken(token string) (*APIToken, bool) {
+	tokens := currentConfig().APITokens
+	for i, configured := range tokens {
+		if configured.Token != "" && subtle.ConstantTimeCompare([]byte(configured.Token), []byte(token)) == 1 {
+			return &tokens[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// singleUserMode is true when neither users nor SSO are configured
+func singleUserMode() bool {
+	return len(currentConfig().Users) == 0 && !oidcConfigured()
+}
+
+// tokenUser resolves the user a static token from config.json acts as, a token
+// without a user acting under its own name
+func tokenUser(userName, tokenName string) *User {
+	if user := findUser(userName); user != nil {
+		return user
+	}
+	if singleUserMode() {
+		return localUser
+	}
+	return &User{Name: tokenName}
+}
+
+// authenticateToken resolves the user and scopes of the token presented by the
+// request: a static token from config.json, a managed token, or an SSO access token
+func authenticateToken(r *http.Request) (*User, []string, bool) {
+	token := requestToken(r)
+	if token == "" {
+		return nil, nil, false
+	}
+
+	if configured, ok := matchToken(token); ok {
+		return tokenUser(configured.User, configured.Name), configured.Scopes, true
+	}
+
+	if managed, found := lookupManagedToken(token); found {
+		// Revoked and expired tokens are rejected outright
+		if !managed.Active(time.Now()) {
+			return nil, nil, false
+		}
+		return managed.owner(), managed.Scopes, true
+	}
+
+	if oidcConfigured() {
+		if user, ok := introspectToken(token); ok {
+			return user, nil, true
+		}
+	}
+
+	return nil, nil, false
+}
+
+// authenticate resolves the user making the request from a token or an SSO
+// session cookie. Without configured users the server runs in single-user
+// mode and unauthenticated requests act as localUser.
+func authenticate(r *http.Request) (*User, []string, bool) {
+	if requestToken(r) != "" {
+		return authenticateToken(r)
+	}
+
+	if oidcConfigured() {
+		if user, ok := sessionUser(r); ok {
+			return user, nil, true
+		}
+	}
+
+	if singleUserMode() {
+		return localUser, nil, true
+	}
+
+	return nil, nil, false
+}
+
+// hasScope reports whether a scope list grants a scope, an empty list grants everything
+func hasScope(scopes []string, scope string) bool {
+	if scopes == nil {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// requireScope rejects unauthenticated requests and tokens lacking the scope,
+// and stores the user and token scopes in the request context
+func requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, scopes, ok := authenticate(r)
+		if !ok {
+			writeError(w, r, http.StatusUnauthorized, "Invalid or missing API token")
+			return
+		}
+
+		if !hasScope(scopes, scope) {
+			writeError(w, r, http.StatusForbidden, "Forbidden: token lacks the "+scope+" scope")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		ctx = context.WithValue(ctx, scopesContextKey, scopes)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// requireRole only lets users holding the role through
+func requireRole(role, scope string, next http.HandlerFunc) http.HandlerFunc {
+	return requireScope(scope, func(w http.ResponseWriter, r *http.Request) {
+		if !currentUser(r).HasRole(role) {
+			writeError(w, r, http.StatusForbidden, "Forbidden: "+role+" role required")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// currentUser returns the authenticated user stored by requireAuth
+func currentUser(r *http.Request) *User {
+	if user, ok := r.Context().Value(userContextKey).(*User); ok {
+		return user
+	}
+	return localUser
+}
+
+// currentScopes returns the scopes of the token used for the request, nil meaning unrestricted
+func currentScopes(r *http.Request) []string {
+	scopes, _ := r.Context().Value(scopesContextKey).([]string)
+	return scopes
+}
+
+// entryUserName returns the name recorded on new entries, which is left
+// empty in single-user mode to keep existing data files unchanged
+func entryUserName(user *User) string {
+	if user == localUser {
+		return ""
+	}
+	return user.Name
+}
+
+// entryOwner returns the user an entry belongs to
+func entryOwner(entry TimeEntry) string {
+	if entry.User == "" {
+		return localUser.Name
+	}
+	return entry.User
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultCategorizationQueueDepth is the most entries waiting on the LLM at once
+// when max_queue_depth isn't set
+const defaultCategorizationQueueDepth = 256
+
+// categorizationQueue counts the entries accepted for categorization and not yet
+// finished, across every request
+var categorizationQueue struct {
+	mu    sync.Mutex
+	depth int
+}
+
+// maxCategorizationQueueDepth returns the configured depth, 0 when it's unlimited
+func maxCategorizationQueueDepth() int {
+	depth := currentConfig().Categorization.MaxQueueDepth
+	if depth < 0 {
+		return 0
+	}
+	if depth == 0 {
+		return defaultCategorizationQueueDepth
+	}
+	return depth
+}
+
+// reserveCategorization admits n entries to the categorization queue, failing when
+// they would take it past the configured depth. A batch larger than the depth is
+// still admitted into an empty queue, so a busy day can always be categorized.
+// The returned func releases the entries once they are done.
+func reserveCategorization(n int) (func(), bool) {
+	categorizationQueue.mu.Lock()
+	defer categorizationQueue.mu.Unlock()
+
+	limit := maxCategorizationQueueDepth()
+	if limit > 0 && categorizationQueue.depth > 0 && categorizationQueue.depth+n > limit {
+		return nil, false
+	}
+	categorizationQueue.depth += n
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			categorizationQueue.mu.Lock()
+			defer categorizationQueue.mu.Unlock()
+			categorizationQueue.depth -= n
+		})
+	}, true
+}
+
+// categorizationQueueDepth returns how many entries are waiting on the LLM
+func categorizationQueueDepth() int {
+	categorizationQueue.mu.Lock()
+	defer categorizationQueue.mu.Unlock()
+	return categorizationQueue.depth
+}
+
+// queueRetryAfter estimates how long the queued entries take to drain, from the
+// mean categorization time and the number of workers
+func queueRetryAfter() time.Duration {
+	mean := stageMean(stageCategorization)
+	if mean <= 0 {
+		return time.Second
+	}
+	workers := max(1, currentConfig().Categorization.Workers)
+	seconds := math.Ceil(float64(categorizationQueueDepth()) * mean / float64(workers) / 1000)
+	return time.Duration(max(1, seconds)) * time.Second
+}
+
+// writeQueueFull answers 429 with a Retry-After header while the categorization
+// queue is full
+func writeQueueFull(w http.ResponseWriter, r *http.Request) {
+	seconds := int(queueRetryAfter().Seconds())
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeErrorCode(w, r, http.StatusTooManyRequests, ErrCodeRateLimited,
+		fmt.Sprintf("The categorization queue is full with %d entries, retry in %ds", categorizationQueueDepth(), seconds))
+}
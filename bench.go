@@ -0,0 +1,191 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// benchSuites are the suites "aidea bench" runs, in order
+var benchSuites = []string{"similarity", "matcher", "storage"}
+
+// benchWords make up the rule names and entry descriptions of the matcher and storage suites
+var benchWords = []string{"fix", "bug", "review", "standup", "implement", "docs", "email", "deploy", "design", "meeting",
+	"planning", "release", "billing", "search", "onboarding", "dashboard", "api", "migration", "incident", "support"}
+
+// runBench is the "aidea bench [similarity|matcher|storage] [dimensions]" command. It
+// runs every suite when none is named, the dimensions apply to the similarity suite.
+func runBench(args []string, out io.Writer) error {
+	suites := []string{}
+	dimensions := 768
+	for _, arg := range args {
+		if value, err := strconv.Atoi(arg); err == nil && value > 0 {
+			dimensions = value
+			continue
+		}
+		if !slices.Contains(benchSuites, arg) {
+			return fmt.Errorf("unknown bench suite %q, expected similarity, matcher or storage", arg)
+		}
+		suites = append(suites, arg)
+	}
+	if len(suites) == 0 {
+		suites = benchSuites
+	}
+
+	for i, suite := range suites {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		switch suite {
+		case "similarity":
+			runSimilarityBench(out, dimensions)
+		case "matcher":
+			runMatcherBench(out)
+		case "storage":
+			if err := runStorageBench(out); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// benchDescription strings random words into an entry description
+func benchDescription(random *rand.Rand, words int) string {
+	description := ""
+	for i := range words {
+		if i > 0 {
+			description += " "
+		}
+		description += benchWords[random.Intn(len(benchWords))]
+	}
+	return description
+}
+
+// runMatcherBench times scoring a description against rule sets of growing size,
+// embedding with the mock provider so only the matcher itself is measured
+func runMatcherBench(out io.Writer) {
+	ctx := context.Background()
+	random := rand.New(rand.NewSource(1))
+	updateActive(func(state *activeState) { state.provider = newMockProvider(nil) })
+
+	fmt.Fprintln(out, "Scoring a description against n rules with mock embeddings")
+	fmt.Fprintf(out, "%8s %14s\n", "n", "per match")
+
+	for _, count := range []int{10, 100, 1000} {
+		generated := make([]ActivityRule, count)
+		for i := range generated {
+			rule := ActivityRule{
+				ID:          uuid.New().String(),
+				Name:        fmt.Sprintf("Rule %d", i),
+				Description: benchDescription(random, 6),
+				Keywords:    []string{benchWords[random.Intn(len(benchWords))]},
+				Task:        "Development",
+			}
+			embedRule(ctx, &rule)
+			generated[i] = rule
+		}
+		rulesMu.Lock()
+		rules = generated
+		rulesMu.Unlock()
+
+		descriptions := make([]string, 100)
+		for i := range descriptions {
+			descriptions[i] = benchDescription(random, 8)
+		}
+		rounds := max(1, 20000/count)
+		start := time.Now()
+		for i := range rounds {
+			scoreRules(ctx, descriptions[i%len(descriptions)])
+		}
+		fmt.Fprintf(out, "%8d %14s\n", count, time.Since(start)/time.Duration(rounds))
+	}
+}
+
+// setCacheDays changes how many days the entry cache holds, for comparing reads with and without it
+func setCacheDays(days int) {
+	updateActive(func(state *activeState) { state.config.Entries.CacheDays = days })
+}
+
+// runStorageBench times appending, reading and updating entries in a scratch
+// directory, reading both from disk and from the entry cache
+func runStorageBench(out io.Writer) error {
+	working, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	scratch, err := os.MkdirTemp("", "aidea-bench-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(scratch)
+	if err := os.Chdir(scratch); err != nil {
+		return err
+	}
+	defer os.Chdir(working)
+
+	ctx := context.Background()
+	random := rand.New(rand.NewSource(1))
+	today := storageToday()
+	const days, perDay = 30, 20
+
+	fmt.Fprintf(out, "Storage with %d entries over %d days, %s rollover\n", days*perDay, days, cmp.Or(currentConfig().Storage.Rollover, "daily"))
+	fmt.Fprintf(out, "%-22s %14s\n", "operation", "per call")
+
+	ids := make([]string, 0, days*perDay)
+	start := time.Now()
+	for day := range days {
+		for range perDay {
+			entry := TimeEntry{ID: uuid.New().String(), Timespan: "30m", Description: benchDescription(random, 8)}
+			if err := appendEntry(ctx, today.AddDate(0, 0, -day), entry); err != nil {
+				return err
+			}
+			ids = append(ids, entry.ID)
+		}
+	}
+	fmt.Fprintf(out, "%-22s %14s\n", "append entry", time.Since(start)/time.Duration(len(ids)))
+
+	cacheDays := currentConfig().Entries.CacheDays
+	defer setCacheDays(cacheDays)
+	for _, cached := range []bool{false, true} {
+		setCacheDays(0)
+		label := "read 30 days (disk)"
+		if cached {
+			setCacheDays(days + 1)
+			label = "read 30 days (cache)"
+		}
+		const rounds = 50
+		start := time.Now()
+		for range rounds {
+			entries, err := readEntriesBetween(ctx, today.AddDate(0, 0, 1-days), today)
+			if err != nil {
+				return err
+			}
+			if len(entries) != len(ids) {
+				return errors.New("the storage bench read back the wrong number of entries")
+			}
+		}
+		fmt.Fprintf(out, "%-22s %14s\n", label, time.Since(start)/rounds)
+	}
+
+	const updates = 200
+	start = time.Now()
+	for i := range updates {
+		// Entries were appended newest day first
+		day := today.AddDate(0, 0, -(i%len(ids))/perDay)
+		if _, err := updateEntry(ctx, day, ids[i%len(ids)], func(entry *TimeEntry) { entry.Task = "Development" }); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(out, "%-22s %14s\n", "update entry", time.Since(start)/updates)
+	return nil
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half_open"
+)
+
+// errCircuitOpen is returned without calling the backend while its breaker is open
+var errCircuitOpen = errors.New("LLM backend unavailable, circuit breaker open")
+
+// BreakerConfig controls when a failing backend stops being called
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures opening the circuit, 0 disables it
+	FailureThreshold int `json:"failure_threshold"`
+	// CooldownSeconds is how long the circuit stays open before a trial call is let through
+	CooldownSeconds int `json:"cooldown_seconds"`
+}
+
+// circuitBreaker fails fast after repeated backend failures. After the cool-down
+// a single trial call is let through, closing the circuit again on success.
+type circuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	trial    bool
+	rejected int64
+}
+
+// BreakerStatus is a snapshot of a breaker for /readyz and /debug/vars
+type BreakerStatus struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+	Rejected            int64      `json:"rejected"`
+}
+
+func newCircuitBreaker(name string, config BreakerConfig) *circuitBreaker {
+	return &circuitBreaker{
+		name:      name,
+		threshold: config.FailureThreshold,
+		cooldown:  time.Duration(config.CooldownSeconds) * time.Second,
+		state:     breakerClosed,
+	}
+}
+
+// refresh half opens the circuit once the cool-down has passed, callers must hold b.mu
+func (b *circuitBreaker) refresh() {
+	if b.state == breakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		b.state = breakerHalfOpen
+		b.trial = false
+	}
+}
+
+// allow reports whether a call may go to the backend
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh()
+
+	switch b.state {
+	case breakerOpen:
+		b.rejected++
+		return false
+	case breakerHalfOpen:
+		// Only one trial call at a time while half open
+		if b.trial {
+			b.rejected++
+			return false
+		}
+		b.trial = true
+	}
+
+	return true
+}
+
+// record updates the breaker with the outcome of a call
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// A caller giving up says nothing about the backend's health, so a canceled
+	// trial only frees the slot for the next one
+	if errors.Is(err, context.Canceled) {
+		b.trial = false
+		return
+	}
+
+	if err == nil {
+		b.state = breakerClosed
+		b.failures = 0
+		b.trial = false
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		if b.state != breakerOpen {
+			log.Printf("Circuit breaker %s opened after %d consecutive failures: %v", b.name, b.failures, err)
+		}
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+		b.trial = false
+	}
+}
+
+// call runs fn unless the circuit is open
+func (b *circuitBreaker) call(fn func() error) error {
+	if !b.allow() {
+		return errCircuitOpen
+	}
+	err := fn()
+	b.record(err)
+	return err
+}
+
+// status returns a snapshot of the breaker
+func (b *circuitBreaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh()
+	status := BreakerStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		Rejected:            b.rejected,
+	}
+	if b.state != breakerClosed {
+		openedAt := b.openedAt
+		retryAt := openedAt.Add(b.cooldown)
+		status.OpenedAt = &openedAt
+		status.RetryAt = &retryAt
+	}
+
+	return status
+}
+
+// retryAfter is how long until an open breaker lets a trial call through
+func (b *circuitBreaker) retryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh()
+	if b.state != breakerOpen {
+		return 0
+	}
+	return max(b.cooldown-time.Since(b.openedAt), 0)
+}
+
+// breakerProvider guards the generation and embedding backends with separate breakers
+type breakerProvider struct {
+	provider   Provider
+	llm        *circuitBreaker
+	embeddings *circuitBreaker
+}
+
+func newBreakerProvider(config BreakerConfig, provider Provider) *breakerProvider {
+	return &breakerProvider{
+		provider:   provider,
+		llm:        newCircuitBreaker("llm", config),
+		embeddings: newCircuitBreaker("embeddings", config),
+	}
+}
+
+func (p *breakerProvider) Categorize(ctx context.Context, description string) (result *CategoryResponse, err error) {
+	err = p.llm.call(func() error {
+		result, err = p.provider.Categorize(ctx, description)
+		return err
+	})
+	return result, err
+}
+
+func (p *breakerProvider) ChooseRule(ctx context.Context, description string, candidates []RuleCandidate) (choice *RuleChoice, err error) {
+	err = p.llm.call(func() error {
+		choice, err = p.provider.ChooseRule(ctx, description, candidates)
+		return err
+	})
+	return choice, err
+}
+
+func (p *breakerProvider) Translate(ctx context.Context, text, language string) (translation string, err error) {
+	err = p.llm.call(func() error {
+		translation, err = p.provider.Translate(ctx, text, language)
+		return err
+	})
+	return translation, err
+}
+
+func (p *breakerProvider) Retrospective(ctx context.Context, facts string) (narrative *RetroNarrative, err error) {
+	err = p.llm.call(func() error {
+		narrative, err = p.provider.Retrospective(ctx, facts)
+		return err
+	})
+	return narrative, err
+}
+
+func (p *breakerProvider) Split(ctx context.Context, description string) (response *SplitResponse, err error) {
+	err = p.llm.call(func() error {
+		response, err = p.provider.Split(ctx, description)
+		return err
+	})
+	return response, err
+}
+
+func (p *breakerProvider) Clarify(ctx context.Context, description string) (question string, err error) {
+	err = p.llm.call(func() error {
+		question, err = p.provider.Clarify(ctx, description)
+		return err
+	})
+	return question, err
+}
+
+func (p *breakerProvider) LabelTopic(ctx context.Context, descriptions string) (label string, err error) {
+	err = p.llm.call(func() error {
+		label, err = p.provider.LabelTopic(ctx, descriptions)
+		return err
+	})
+	return label, err
+}
+
+func (p *breakerProvider) Embed(ctx context.Context, text string) (embedding []float64, err error) {
+	err = p.embeddings.call(func() error {
+		embedding, err = p.provider.Embed(ctx, text)
+		return err
+	})
+	return embedding, err
+}
+
+// breakerStatuses reports every active breaker by name
+func breakerStatuses() map[string]BreakerStatus {
+	statuses := make(map[string]BreakerStatus)
+	state := active.Load()
+	for _, breaker := range []*circuitBreaker{state.llmBreaker, state.embeddingBreaker} {
+		if breaker != nil {
+			statuses[breaker.name] = breaker.status()
+		}
+	}
+	return statuses
+}
+
+// writeCircuitOpen answers 503 with a Retry-After header while the LLM breaker is open
+func writeCircuitOpen(w http.ResponseWriter, r *http.Request) {
+	seconds := int(active.Load().llmBreaker.retryAfter().Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeErrorCode(w, r, http.StatusServiceUnavailable, ErrCodeUnavailable,
+		fmt.Sprintf("%v, entries stay queued for categorization, retry in %ds", errCircuitOpen, seconds))
+}
+
+// llmUnavailable reports whether the LLM breaker is currently rejecting calls
+func llmUnavailable() bool {
+	breaker := active.Load().llmBreaker
+	return breaker != nil && breaker.retryAfter() > 0
+}
+
+// readyHandler reports whether the server can categorize, failing while a breaker is open
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	statuses := breakerStatuses()
+	ready := true
+	for _, status := range statuses {
+		if status.State == breakerOpen {
+			ready = false
+		}
+	}
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ready":            ready,
+		"circuit_breakers": statuses,
+	})
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Bulk operations
+const (
+	BulkSetCategory = "set-category"
+	BulkSetJira     = "set-jira"
+	BulkAddTag      = "add-tag"
+	BulkDelete      = "delete"
+)
+
+// maxBulkDays bounds the date range a bulk operation may scan
+const maxBulkDays = 366
+
+// BulkFilter selects the current user's entries a bulk operation applies to
+type BulkFilter struct {
+	From string `json:"from"` // YYYYMMDD
+	To   string `json:"to"`   // YYYYMMDD
+	// Task limits the operation to entries currently in this category, aliases included
+	Task string `json:"task,omitempty"`
+}
+
+// BulkRequest represents the JSON request for a bulk operation
+type BulkRequest struct {
+	Operation string     `json:"operation"`
+	Value     string     `json:"value,omitempty"`
+	Filter    BulkFilter `json:"filter"`
+	// DryRun reports the matching entries without changing them
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// BulkResult reports what a bulk operation changed
+type BulkResult struct {
+	Matched int      `json:"matched"`
+	Updated int      `json:"updated"`
+	IDs     []string `json:"ids"`
+	// Skipped lists entries left alone, such as those in submitted weeks
+	Skipped []string `json:"skipped,omitempty"`
+	DryRun  bool     `json:"dry_run,omitempty"`
+}
+
+// validateBulkRequest checks a bulk payload and returns the parsed date range
+func validateBulkRequest(request BulkRequest, location *time.Location) (time.Time, time.Time, []ErrorDetail) {
+	v := &validator{}
+	v.oneOf("operation", request.Operation, []string{BulkSetCategory, BulkSetJira, BulkAddTag, BulkDelete})
+	if request.Operation == "" {
+		v.add("operation", "operation is required")
+	}
+
+	switch request.Operation {
+	case BulkSetCategory:
+		v.text("value", request.Value, true, maxTaskLength)
+	case BulkSetJira:
+		v.jiraKey("value", request.Value)
+		if request.Value == "" {
+			v.add("value", "value is required")
+		}
+	case BulkAddTag:
+		v.tag("value", request.Value)
+		if request.Value == "" {
+			v.add("value", "value is required")
+		}
+	}
+	v.text("filter.task", request.Filter.Task, false, maxTaskLength)
+
+	from, errFrom := time.ParseInLocation("20060102", request.Filter.From, location)
+	if errFrom != nil {
+		v.add("filter.from", "filter.from must be a date in YYYYMMDD format")
+	}
+	to, errTo := time.ParseInLocation("20060102", request.Filter.To, location)
+	if errTo != nil {
+		v.add("filter.to", "filter.to must be a date in YYYYMMDD format")
+	}
+	if errFrom == nil && errTo == nil {
+		if to.Before(from) {
+			v.add("filter.to", "filter.to must not be before filter.from")
+		} else if to.Sub(from) >= maxBulkDays*24*time.Hour {
+			v.add("filter.to", "the date range must not exceed %d days", maxBulkDays)
+		}
+	}
+
+	return from, to, v.details
+}
+
+// bulkMatches reports whether an entry falls under the filter's category
+func bulkMatches(entry TimeEntry, task string) bool {
+	if task == "" {
+		return true
+	}
+	current, _ := canonicalCategory(entry.Task)
+	wanted, _ := canonicalCategory(task)
+	return strings.EqualFold(current, wanted)
+}
+
+// bulkUpdate applies an update to the given entries, rewriting each data file once.
+// Entries in submitted weeks are skipped and returned with the reason.
+func bulkUpdate(ctx context.Context, entries []TimeEntry, update func(*TimeEntry)) (updated []string, skipped []string, err error) {
+	_, span := startSpan(ctx, "storage.bulk_update", spanKindInternal)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	// Group the entries by the file holding them
+	files := make(map[string]map[string]time.Time)
+	order := []string{}
+	for _, entry := range entries {
+		day, err := time.ParseInLocation("2006-01-02", entry.Date, userLocation(entryOwner(entry)))
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: invalid date %q", entry.ID, entry.Date))
+			continue
+		}
+		filename := dataFilename(day)
+		if files[filename] == nil {
+			files[filename] = make(map[string]time.Time)
+			order = append(order, filename)
+		}
+		files[filename][entry.ID] = day
+	}
+
+	storageMu.Lock()
+	defer storageMu.Unlock()
+
+	for _, filename := range order {
+		stored, err := readEntries(filename)
+		if err != nil {
+			return updated, skipped, fmt.Errorf("%s: %v", filename, err)
+		}
+
+		// Previous versions of the changed entries by index, for the change events
+		changed := []int{}
+		previous := []TimeEntry{}
+		for i := range stored {
+			day, selected := files[filename][stored[i].ID]
+			if !selected || stored[i].DeletedAt != "" {
+				continue
+			}
+			if err := checkWeekOpen(entryOwner(stored[i]), day); err != nil {
+				skipped = append(skipped, fmt.Sprintf("%s: %v", stored[i].ID, err))
+				continue
+			}
+			if stored[i].Date == "" {
+				stored[i].Date = entryDate(day)
+			}
+			previous = append(previous, stored[i])
+			update(&stored[i])
+			updated = append(updated, stored[i].ID)
+			changed = append(changed, i)
+		}
+
+		if len(changed) > 0 {
+			if err := writeEntries(filename, stored); err != nil {
+				return updated, skipped, fmt.Errorf("%s: %v", filename, err)
+			}
+			for n, i := range changed {
+				publishEvent(entryEvent(previous[n], stored[i]), stored[i])
+				streamEntryChange(previous[n], stored[i])
+				queueEntryEmbedding(stored[i])
+			}
+		}
+	}
+
+	return updated, skipped, nil
+}
+
+// bulkHandler applies one operation to every entry of the current user matching
+// the filter: set-category, set-jira, add-tag or delete (to the trash)
+func bulkHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	// Parse JSON request
+	var request BulkRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+		return
+	}
+
+	request.Operation = strings.ToLower(strings.TrimSpace(request.Operation))
+
+	user := currentUser(r)
+	from, to, details := validateBulkRequest(request, userLocation(user.Name))
+	if len(details) > 0 {
+		writeValidationError(w, r, details...)
+		return
+	}
+
+	entries, err := readEntriesBetween(r.Context(), from, to)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error reading entries: %v", err))
+		return
+	}
+
+	matched := []TimeEntry{}
+	result := BulkResult{IDs: []string{}, DryRun: request.DryRun}
+	for _, entry := range entries {
+		if entryOwner(entry) == user.Name && bulkMatches(entry, request.Filter.Task) {
+			matched = append(matched, entry)
+			result.IDs = append(result.IDs, entry.ID)
+		}
+	}
+	result.Matched = len(matched)
+
+	if !request.DryRun && len(matched) > 0 {
+		deletedAt := time.Now().UTC().Format(time.RFC3339)
+		task, _ := canonicalCategory(request.Value)
+
+		updated, skipped, err := bulkUpdate(r.Context(), matched, func(e *TimeEntry) {
+			switch request.Operation {
+			case BulkSetCategory:
+				e.Task = task
+				e.TaskReason = "Bulk corrected by " + user.Name
+				// A corrected task no longer comes from the recorded LLM inputs
+				e.InputHash = ""
+				e.Categorized = true
+			case BulkSetJira:
+				e.Jira = request.Value
+			case BulkAddTag:
+				if !slices.Contains(e.Tags, request.Value) {
+					e.Tags = append(e.Tags, request.Value)
+				}
+			case BulkDelete:
+				e.DeletedAt = deletedAt
+			}
+		})
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "Error saving entries: "+err.Error())
+			return
+		}
+		result.IDs = append([]string{}, updated...)
+		result.Updated = len(updated)
+		result.Skipped = skipped
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CalendarConfig lists public holidays and PTO so reports don't count them as missing time
+type CalendarConfig struct {
+	DaysOff []DayOff       `json:"days_off"`
+	Feeds   []CalendarFeed `json:"feeds"`
+	// AutoCreateEntries logs an entry as long as the user's working day for every day off of every user
+	AutoCreateEntries bool   `json:"auto_create_entries"`
+	PTOTask           string `json:"pto_task"`
+}
+
+// DayOff is a holiday or vacation day, shared by everyone when User is empty
+type DayOff struct {
+	Date string `json:"date"` // YYYYMMDD
+	Name string `json:"name"`
+	User string `json:"user,omitempty"`
+}
+
+// CalendarFeed is an ICS calendar of days off, e.g. a holiday or vacation calendar
+type CalendarFeed struct {
+	// URL is an http(s) address or a local file path
+	URL  string `json:"url"`
+	User string `json:"user,omitempty"`
+}
+
+const calendarRefreshInterval = 12 * time.Hour
+
+var (
+	feedDaysOffMu sync.RWMutex
+	feedDaysOff   []DayOff
+)
+
+// parseICSDaysOff extracts the days covered by each VEVENT of an ICS calendar.
+// All-day events end on the exclusive DTEND date, timed events cover their start day.
+func parseICSDaysOff(reader io.Reader, user string) ([]DayOff, error) {
+	// Unfold continuation lines, which start with a space or tab
+	lines := []string{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading calendar: %v", err)
+	}
+
+	daysOff := []DayOff{}
+	var inEvent bool
+	var summary, start, end string
+
+	for _, line := range lines {
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		property, _, _ := strings.Cut(name, ";")
+
+		switch {
+		case line == "BEGIN:VEVENT":
+			inEvent = true
+			summary, start, end = "", "", ""
+		case line == "END:VEVENT":
+			inEvent = false
+			if len(start) < 8 {
+				continue
+			}
+
+			first, err := time.Parse("20060102", start[:8])
+			if err != nil {
+				continue
+			}
+			last := first
+			if len(end) >= 8 && !strings.Contains(end, "T") {
+				if parsed, err := time.Parse("20060102", end[:8]); err == nil && parsed.After(first) {
+					last = parsed.AddDate(0, 0, -1)
+				}
+			}
+
+			for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+				daysOff = append(daysOff, DayOff{Date: day.Format("20060102"), Name: summary, User: user})
+			}
+		case !inEvent:
+			continue
+		case property == "SUMMARY":
+			summary = strings.ReplaceAll(value, `\,`, ",")
+		case property == "DTSTART":
+			start = value
+		case property == "DTEND":
+			end = value
+		}
+	}
+
+	return daysOff, nil
+}
+
+// fetchCalendarFeed downloads or reads an ICS feed
+func fetchCalendarFeed(feed CalendarFeed) ([]DayOff, error) {
+	if !strings.HasPrefix(feed.URL, "http://") && !strings.HasPrefix(feed.URL, "https://") {
+		file, err := os.Open(feed.URL)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return parseICSDaysOff(file, feed.User)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(feed.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching calendar: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("calendar returned error: %s", resp.Status)
+	}
+
+	return parseICSDaysOff(resp.Body, feed.User)
+}
+
+// refreshCalendarFeeds reloads every feed, keeping the previous days of a feed that fails
+func refreshCalendarFeeds(feeds []CalendarFeed) {
+	daysOff := []DayOff{}
+	failed := false
+
+	for _, feed := range feeds {
+		feedDays, err := fetchCalendarFeed(feed)
+		if err != nil {
+			log.Printf("Error loading calendar %s: %v", feed.URL, err)
+			failed = true
+			continue
+		}
+		daysOff = append(daysOff, feedDays...)
+	}
+
+	feedDaysOffMu.Lock()
+	defer feedDaysOffMu.Unlock()
+	if failed && len(daysOff) == 0 {
+		return
+	}
+	feedDaysOff = daysOff
+}
+
+// findDayOff returns the holiday or PTO of a user on a day, if any
+func findDayOff(user string, day time.Time) (DayOff, bool) {
+	date := day.Format("20060102")
+	matches := func(dayOff DayOff) bool {
+		return dayOff.Date == date && (dayOff.User == "" || dayOff.User == user)
+	}
+
+	for _, dayOff := range currentConfig().Calendar.DaysOff {
+		if matches(dayOff) {
+			return dayOff, true
+		}
+	}
+
+	feedDaysOffMu.RLock()
+	defer feedDaysOffMu.RUnlock()
+	for _, dayOff := range feedDaysOff {
+		if matches(dayOff) {
+			return dayOff, true
+		}
+	}
+
+	return DayOff{}, false
+}
+
+// calendarUsers returns the users whose days off get entries, the local user in single-user mode
+func calendarUsers() []string {
+	users := currentConfig().Users
+	if len(users) == 0 {
+		return []string{localUser.Name}
+	}
+
+	names := make([]string, 0, len(users))
+	for _, user := range users {
+		names = append(names, user.Name)
+	}
+	return names
+}
+
+// createDayOffEntries logs a full-day entry for each user off on the given day,
+// skipping users who already have one
+func createDayOffEntries(ctx context.Context, day time.Time) {
+	config := currentConfig().Calendar
+
+	for _, name := range calendarUsers() {
+		userDay := day.In(userLocation(name))
+		dayOff, found := findDayOff(name, userDay)
+		hours := userWorkingHours(name)
+		if !found || !hours.WorksOn(userDay.Weekday()) {
+			continue
+		}
+		minutes := hours.DailyMinutes()
+
+		entries, err := readDayEntries(userDay)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("Error reading entries for %s: %v", name, err)
+			continue
+		}
+
+		exists := false
+		for _, entry := range entries {
+			if entryOwner(entry) == name && entry.Task == config.PTOTask {
+				exists = true
+				break
+			}
+		}
+		if exists {
+			continue
+		}
+
+		owner := name
+		if owner == localUser.Name {
+			owner = ""
+		}
+
+		entry := TimeEntry{
+			ID:          uuid.New().String(),
+			Timespan:    fmt.Sprintf("%dh%02dm", minutes/60, minutes%60),
+			Description: dayOff.Name,
+			Task:        config.PTOTask,
+			TaskReason:  "Day off from calendar",
+			Confidence:  "high",
+			Categorized: true,
+			User:        owner,
+		}
+		if entry.Description == "" {
+			entry.Description = "Day off"
+		}
+
+		if err := appendEntry(ctx, userDay, entry); err != nil {
+			log.Printf("Error logging day off for %s: %v", name, err)
+		}
+	}
+}
+
+// startCalendar loads the ICS feeds and, when enabled, logs days off as each user's day starts
+func startCalendar(config CalendarConfig) {
+	if len(config.Feeds) > 0 {
+		refreshCalendarFeeds(config.Feeds)
+		go func() {
+			for range time.Tick(calendarRefreshInterval) {
+				refreshCalendarFeeds(config.Feeds)
+			}
+		}()
+	}
+
+	if !config.AutoCreateEntries {
+		return
+	}
+
+	// Checked hourly since users' days start in different time zones, existing entries are skipped
+	createDayOffEntries(context.Background(), time.Now())
+	go func() {
+		for range time.Tick(time.Hour) {
+			createDayOffEntries(context.Background(), time.Now())
+		}
+	}()
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// CassetteConfig records LLM interactions to disk or replays them from a previous run
+type CassetteConfig struct {
+	// Mode is "record", "replay" or empty to disable
+	Mode string `json:"mode"`
+	Path string `json:"path"`
+}
+
+// cassetteInteraction is one recorded request/response pair
+type cassetteInteraction struct {
+	Kind     string            `json:"kind"`
+	Input    string            `json:"input"`
+	Category *CategoryResponse `json:"category,omitempty"`
+	Choice   *RuleChoice       `json:"choice,omitempty"`
+	// Translation is the answer to a "translate" interaction
+	Translation string          `json:"translation,omitempty"`
+	Narrative   *RetroNarrative `json:"narrative,omitempty"`
+	Split       *SplitResponse  `json:"split,omitempty"`
+	Question    string          `json:"question,omitempty"`
+	Label       string          `json:"label,omitempty"`
+	Embedding   []float64       `json:"embedding,omitempty"`
+	Error       string          `json:"error,omitempty"`
+}
+
+// cassetteProvider wraps the real providers, saving every interaction when
+// recording and answering from the saved interactions when replaying
+type cassetteProvider struct {
+	mode     string
+	path     string
+	provider Provider
+
+	mu           sync.Mutex
+	interactions []cassetteInteraction
+}
+
+func newCassetteProvider(config CassetteConfig, provider Provider) (*cassetteProvider, error) {
+	if config.Mode != "record" && config.Mode != "replay" {
+		return nil, fmt.Errorf("unknown cassette mode %q, expected record or replay", config.Mode)
+	}
+	if config.Path == "" {
+		config.Path = "aidea_llm_cassette.json"
+	}
+
+	cassette := &cassetteProvider{
+		mode:         config.Mode,
+		path:         config.Path,
+		provider:     provider,
+		interactions: []cassetteInteraction{},
+	}
+
+	data, err := os.ReadFile(config.Path)
+	if os.IsNotExist(err) && config.Mode == "record" {
+		return cassette, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read cassette: %v", err)
+	}
+	if err := json.Unmarshal(data, &cassette.interactions); err != nil {
+		return nil, fmt.Errorf("couldn't parse cassette: %v", err)
+	}
+
+	return cassette, nil
+}
+
+// find returns the most recent interaction for an input, callers must hold mu
+func (p *cassetteProvider) find(kind, input string) (cassetteInteraction, bool) {
+	for i := len(p.interactions) - 1; i >= 0; i-- {
+		if p.interactions[i].Kind == kind && p.interactions[i].Input == input {
+			return p.interactions[i], true
+		}
+	}
+	return cassetteInteraction{}, false
+}
+
+// record appends an interaction and rewrites the cassette file
+func (p *cassetteProvider) record(interaction cassetteInteraction) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.interactions = append(p.interactions, interaction)
+
+	data, err := json.MarshalIndent(p.interactions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't encode cassette: %v", err)
+	}
+	return os.WriteFile(p.path, data, 0644)
+}
+
+func (p *cassetteProvider) replay(kind, input string) (cassetteInteraction, error) {
+	p.mu.Lock()
+	interaction, found := p.find(kind, input)
+	p.mu.Unlock()
+
+	if !found {
+		return interaction, fmt.Errorf("no recorded %s interaction for %q", kind, input)
+	}
+	if interaction.Error != "" {
+		return interaction, fmt.Errorf("%s", interaction.Error)
+	}
+	return interaction, nil
+}
+
+func (p *cassetteProvider) Categorize(ctx context.Context, description string) (*CategoryResponse, error) {
+	if p.mode == "replay" {
+		interaction, err := p.replay("categorize", description)
+		if err != nil {
+			return nil, err
+		}
+		return interaction.Category, nil
+	}
+
+	category, err := p.provider.Categorize(ctx, description)
+
+	interaction := cassetteInteraction{Kind: "categorize", Input: description, Category: category}
+	if err != nil {
+		interaction.Error = err.Error()
+	}
+	if recordErr := p.record(interaction); recordErr != nil {
+		return nil, recordErr
+	}
+
+	return category, err
+}
+
+func (p *cassetteProvider) Embed(ctx context.Context, text string) ([]float64, error) {
+	if p.mode == "replay" {
+		interaction, err := p.replay("embed", text)
+		if err != nil {
+			return nil, err
+		}
+		return interaction.Embedding, nil
+	}
+
+	embedding, err := p.provider.Embed(ctx, text)
+
+	interaction := cassetteInteraction{Kind: "embed", Input: text, Embedding: embedding}
+	if err != nil {
+		interaction.Error = err.Error()
+	}
+	if recordErr := p.record(interaction); recordErr != nil {
+		return nil, recordErr
+	}
+
+	return embedding, err
+}
+
+func (p *cassetteProvider) ChooseRule(ctx context.Context, description string, candidates []RuleCandidate) (*RuleChoice, error) {
+	// The shortlist is part of the input, the same text may pick differently as rules change
+	ids := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		ids = append(ids, candidate.Rule.ID)
+	}
+	input := description + "\n" + strings.Join(ids, ",")
+
+	if p.mode == "replay" {
+		interaction, err := p.replay("choose_rule", input)
+		if err != nil {
+			return nil, err
+		}
+		return interaction.Choice, nil
+	}
+
+	choice, err := p.provider.ChooseRule(ctx, description, candidates)
+
+	interaction := cassetteInteraction{Kind: "choose_rule", Input: input, Choice: choice}
+	if err != nil {
+		interaction.Error = err.Error()
+	}
+	if recordErr := p.record(interaction); recordErr != nil {
+		return nil, recordErr
+	}
+
+	return choice, err
+}
+
+func (p *cassetteProvider) Translate(ctx context.Context, text, language string) (string, error) {
+	input := language + "\n" + text
+
+	if p.mode == "replay" {
+		interaction, err := p.replay("translate", input)
+		if err != nil {
+			return "", err
+		}
+		return interaction.Translation, nil
+	}
+
+	translation, err := p.provider.Translate(ctx, text, language)
+
+	interaction := cassetteInteraction{Kind: "translate", Input: input, Translation: translation}
+	if err != nil {
+		interaction.Error = err.Error()
+	}
+	if recordErr := p.record(interaction); recordErr != nil {
+		return "", recordErr
+	}
+
+	return translation, err
+}
+
+func (p *cassetteProvider) Retrospective(ctx context.Context, facts string) (*RetroNarrative, error) {
+	if p.mode == "replay" {
+		interaction, err := p.replay("retrospective", facts)
+		if err != nil {
+			return nil, err
+		}
+		return interaction.Narrative, nil
+	}
+
+	narrative, err := p.provider.Retrospective(ctx, facts)
+
+	interaction := cassetteInteraction{Kind: "retrospective", Input: facts, Narrative: narrative}
+	if err != nil {
+		interaction.Error = err.Error()
+	}
+	if recordErr := p.record(interaction); recordErr != nil {
+		return nil, recordErr
+	}
+
+	return narrative, err
+}
+
+func (p *cassetteProvider) Split(ctx context.Context, description string) (*SplitResponse, error) {
+	if p.mode == "replay" {
+		interaction, err := p.replay("split", description)
+		if err != nil {
+			return nil, err
+		}
+		return interaction.Split, nil
+	}
+
+	split, err := p.provider.Split(ctx, description)
+
+	interaction := cassetteInteraction{Kind: "split", Input: description, Split: split}
+	if err != nil {
+		interaction.Error = err.Error()
+	}
+	if recordErr := p.record(interaction); recordErr != nil {
+		return nil, recordErr
+	}
+
+	return split, err
+}
+
+func (p *cassetteProvider) Clarify(ctx context.Context, description string) (string, error) {
+	if p.mode == "replay" {
+		interaction, err := p.replay("clarify", description)
+		if err != nil {
+			return "", err
+		}
+		return interaction.Question, nil
+	}
+
+	question, err := p.provider.Clarify(ctx, description)
+
+	interaction := cassetteInteraction{Kind: "clarify", Input: description, Question: question}
+	if err != nil {
+		interaction.Error = err.Error()
+	}
+	if recordErr := p.record(interaction); recordErr != nil {
+		return "", recordErr
+	}
+
+	return question, err
+}
+
+func (p *cassetteProvider) LabelTopic(ctx context.Context, descriptions string) (string, error) {
+	if p.mode == "replay" {
+		interaction, err := p.replay("topic", descriptions)
+		if err != nil {
+			return "", err
+		}
+		return interaction.Label, nil
+	}
+
+	label, err := p.provider.LabelTopic(ctx, descriptions)
+
+	interaction := cassetteInteraction{Kind: "topic", Input: descriptions, Label: label}
+	if err != nil {
+		interaction.Error = err.Error()
+	}
+	if recordErr := p.record(interaction); recordErr != nil {
+		return "", recordErr
+	}
+
+	return label, err
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const categoriesFile = "aidea_categories.json"
+
+// maxIconLength leaves room for an emoji with modifiers or a short icon name
+const maxIconLength = 32
+
+// categoryColorPattern matches hex colors like #4e79a7
+var categoryColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Taxonomy enforcement modes
+const (
+	// TaxonomyOff keeps whatever category the categorizer returns
+	TaxonomyOff = "off"
+	// TaxonomyNormalize maps names and aliases onto the canonical category, keeping unknown ones
+	TaxonomyNormalize = "normalize"
+	// TaxonomyStrict also sends unknown categories to review with low confidence
+	TaxonomyStrict = "strict"
+)
+
+// TaxonomyConfig controls how categorization output is checked against the managed categories
+type TaxonomyConfig struct {
+	Enforcement string `json:"enforcement"`
+}
+
+// Category is a managed task category, aliases catch spellings like "Dev" for "Development"
+type Category struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Aliases     []string `json:"aliases,omitempty"`
+	Description string   `json:"description,omitempty"`
+	// Color (#rrggbb) and Icon (an emoji or icon name) style the category in reports and UIs
+	Color string `json:"color,omitempty"`
+	Icon  string `json:"icon,omitempty"`
+}
+
+// CategoryRequest represents the JSON request for creating or updating a category
+type CategoryRequest struct {
+	Name        string   `json:"name"`
+	Aliases     []string `json:"aliases"`
+	Description string   `json:"description"`
+	Color       string   `json:"color"`
+	Icon        string   `json:"icon"`
+}
+
+// CategoryStyle is the display metadata of a category returned alongside reports
+type CategoryStyle struct {
+	Color string `json:"color,omitempty"`
+	Icon  string `json:"icon,omitempty"`
+}
+
+var (
+	categoriesMu sync.Mutex
+	categories   []Category
+)
+
+// loadCategories reads the categories file once, callers must hold categoriesMu
+func loadCategories() error {
+	if categories != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(categoriesFile)
+	if os.IsNotExist(err) {
+		categories = []Category{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read categories: %v", err)
+	}
+
+	var loaded []Category
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("couldn't parse categories: %v", err)
+	}
+
+	categories = loaded
+	return nil
+}
+
+// saveCategories writes the categories file, callers must hold categoriesMu
+func saveCategories() error {
+	data, err := json.MarshalIndent(categories, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't encode categories: %v", err)
+	}
+
+	return os.WriteFile(categoriesFile, data, 0644)
+}
+
+// listCategories returns a copy of the managed categories
+func listCategories() ([]Category, error) {
+	categoriesMu.Lock()
+	defer categoriesMu.Unlock()
+
+	if err := loadCategories(); err != nil {
+		return nil, err
+	}
+	return slices.Clone(categories), nil
+}
+
+// matches reports whether a name is the category's name or one of its aliases, ignoring case
+func (c Category) matches(name string) bool {
+	name = strings.TrimSpace(name)
+	if strings.EqualFold(c.Name, name) {
+		return true
+	}
+	return slices.ContainsFunc(c.Aliases, func(alias string) bool {
+		return strings.EqualFold(alias, name)
+	})
+}
+
+// categoryStyles returns the display metadata of the managed categories among
+// tasks, keyed by task name. Tasks without a styled category are left out.
+func categoryStyles(tasks []string) map[string]CategoryStyle {
+	styles := make(map[string]CategoryStyle)
+
+	managed, err := listCategories()
+	if err != nil {
+		return styles
+	}
+
+	for _, task := range tasks {
+		for _, category := range managed {
+			if category.matches(task) && (category.Color != "" || category.Icon != "") {
+				styles[task] = CategoryStyle{Color: category.Color, Icon: category.Icon}
+				break
+			}
+		}
+	}
+
+	return styles
+}
+
+// canonicalCategory returns the managed category name for a task, or false if it isn't known
+func canonicalCategory(task string) (string, bool) {
+	managed, err := listCategories()
+	if err != nil {
+		return task, false
+	}
+
+	for _, category := range managed {
+		if category.matches(task) {
+			return category.Name, true
+		}
+	}
+	return task, false
+}
+
+// taxonomyPrompt lists the allowed categories and Jira projects for the system prompt,
+// empty when nothing constrains the answer
+func taxonomyPrompt() string {
+	if currentConfig().Taxonomy.Enforcement == TaxonomyOff {
+		return ""
+	}
+
+	var builder strings.Builder
+	if managed, err := listCategories(); err == nil && len(managed) > 0 {
+		builder.WriteString("\n\nThe task must be exactly one of these categories:\n")
+		for _, category := range managed {
+			builder.WriteString("- " + category.Name)
+			if category.Description != "" {
+				builder.WriteString(": " + category.Description)
+			}
+			builder.WriteString("\n")
+		}
+	}
+	if keys := allowedJiraProjects(); len(keys) > 0 {
+		builder.WriteString("\nJira issues must belong to one of these projects: " + strings.Join(keys, ", ") + ". Leave jira empty otherwise.\n")
+	}
+
+	return builder.String()
+}
+
+// taxonomyViolation describes why a result breaks the taxonomy, or returns ""
+func taxonomyViolation(result *CategoryResponse) string {
+	problems := []string{}
+
+	if result.Task != "" {
+		if _, known := canonicalCategory(result.Task); !known {
+			problems = append(problems, fmt.Sprintf("category %q is not in the taxonomy", result.Task))
+		}
+	}
+	if keys := allowedJiraProjects(); result.Jira != "" && len(keys) > 0 && !slices.Contains(keys, jiraProject(result.Jira)) {
+		problems = append(problems, fmt.Sprintf("Jira issue %s is not in an allowed project", result.Jira))
+	}
+
+	return strings.Join(problems, ", ")
+}
+
+// closestCategory picks the managed category whose name and description embed
+// closest to the entry description
+func closestCategory(ctx context.Context, description string) (string, float64, error) {
+	managed, err := listCategories()
+	if err != nil {
+		return "", 0, err
+	}
+	if len(managed) == 0 {
+		return "", 0, fmt.Errorf("no categories defined")
+	}
+
+	target, err := embedText(ctx, description)
+	if err != nil {
+		return "", 0, err
+	}
+
+	best, bestScore := "", -1.0
+	for _, category := range managed {
+		embedding, err := embedText(ctx, strings.TrimSpace(category.Name+" "+category.Description+" "+strings.Join(category.Aliases, " ")))
+		if err != nil {
+			return "", 0, err
+		}
+		if score := cosineSimilarity(target, embedding); score > bestScore {
+			best, bestScore = category.Name, score
+		}
+	}
+
+	return best, bestScore, nil
+}
+
+// enforceTaxonomy applies the configured enforcement to a categorization result.
+// In strict mode an invented category or Jira project triggers one re-prompt
+// naming the problem, then a fallback to the closest category by embedding.
+func enforceTaxonomy(ctx context.Context, description string, result *CategoryResponse) *CategoryResponse {
+	mode := currentConfig().Taxonomy.Enforcement
+	if mode == "" || mode == TaxonomyOff {
+		return result
+	}
+
+	result.Task, _ = canonicalCategory(result.Task)
+	if mode != TaxonomyStrict {
+		return result
+	}
+
+	problem := taxonomyViolation(result)
+	if problem == "" {
+		return result
+	}
+
+	retry, err := llm().Categorize(ctx, description+"\n\nA previous answer was rejected: "+problem+". Use only the allowed categories and projects.")
+	if err == nil {
+		checkModelJira(description, retry)
+		retry.Task, _ = canonicalCategory(retry.Task)
+		if taxonomyViolation(retry) == "" {
+			return retry
+		}
+	}
+
+	if _, known := canonicalCategory(result.Task); !known {
+		category, score, err := closestCategory(ctx, description)
+		if err != nil {
+			result.Confidence = "low"
+			result.Reason = strings.TrimSpace(result.Reason + " (" + problem + ")")
+			return result
+		}
+		result.Task = category
+		result.Reason = fmt.Sprintf("Closest category by embedding similarity (%.2f), the model suggested an unknown category", score)
+	}
+	if taxonomyViolation(result) != "" {
+		result.Jira = ""
+	}
+	result.Confidence = "low"
+
+	return result
+}
+
+// validateCategory checks a category payload, making sure names and aliases stay unique
+func validateCategory(request CategoryRequest, existing []Category, id string) []ErrorDetail {
+	v := &validator{}
+	v.text("name", request.Name, true, maxTaskLength)
+	v.text("description", request.Description, false, maxDescriptionLength)
+	for _, alias := range request.Aliases {
+		v.text("aliases", alias, true, maxTaskLength)
+	}
+	if request.Color != "" && !categoryColorPattern.MatchString(request.Color) {
+		v.add("color", "color must be a hex color like #4e79a7")
+	}
+	v.text("icon", request.Icon, false, maxIconLength)
+
+	for _, category := range existing {
+		if category.ID == id {
+			continue
+		}
+		for _, name := range append([]string{request.Name}, request.Aliases...) {
+			if name != "" && category.matches(name) {
+				v.add("name", "%q is already used by category %s", name, category.Name)
+			}
+		}
+	}
+
+	return v.details
+}
+
+func parseCategoryRequest(w http.ResponseWriter, r *http.Request) (CategoryRequest, bool) {
+	var request CategoryRequest
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return request, false
+	}
+	defer r.Body.Close()
+
+	// Parse JSON request
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+		return request, false
+	}
+
+	return request, true
+}
+
+// categoriesHandler lists (GET) or creates (POST) categories
+func categoriesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		requireScope(ScopeEntriesRead, listCategoriesHandler)(w, r)
+	case http.MethodPost:
+		requireScope(ScopeRulesWrite, createCategoryHandler)(w, r)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// categoryHandler updates (PUT) or deletes (DELETE) a category
+func categoryHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		requireScope(ScopeRulesWrite, updateCategoryHandler)(w, r)
+	case http.MethodDelete:
+		requireScope(ScopeRulesWrite, deleteCategoryHandler)(w, r)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func listCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	managed, err := listCategories()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(managed)
+}
+
+func createCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	request, ok := parseCategoryRequest(w, r)
+	if !ok {
+		return
+	}
+
+	categoriesMu.Lock()
+	defer categoriesMu.Unlock()
+
+	if err := loadCategories(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if details := validateCategory(request, categories, ""); len(details) > 0 {
+		writeValidationError(w, r, details...)
+		return
+	}
+
+	category := Category{
+		ID:          uuid.New().String(),
+		Name:        strings.TrimSpace(request.Name),
+		Aliases:     request.Aliases,
+		Description: request.Description,
+		Color:       strings.ToLower(request.Color),
+		Icon:        strings.TrimSpace(request.Icon),
+	}
+
+	categories = append(categories, category)
+	if err := saveCategories(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving category: "+err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(category)
+}
+
+func updateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	request, ok := parseCategoryRequest(w, r)
+	if !ok {
+		return
+	}
+
+	id := r.PathValue("id")
+
+	categoriesMu.Lock()
+	defer categoriesMu.Unlock()
+
+	if err := loadCategories(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	index := slices.IndexFunc(categories, func(c Category) bool { return c.ID == id })
+	if index == -1 {
+		writeError(w, r, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	if details := validateCategory(request, categories, id); len(details) > 0 {
+		writeValidationError(w, r, details...)
+		return
+	}
+
+	categories[index].Name = strings.TrimSpace(request.Name)
+	categories[index].Aliases = request.Aliases
+	categories[index].Description = request.Description
+	categories[index].Color = strings.ToLower(request.Color)
+	categories[index].Icon = strings.TrimSpace(request.Icon)
+	if err := saveCategories(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving category: "+err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categories[index])
+}
+
+func deleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	categoriesMu.Lock()
+	defer categoriesMu.Unlock()
+
+	if err := loadCategories(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	index := slices.IndexFunc(categories, func(c Category) bool { return c.ID == id })
+	if index == -1 {
+		writeError(w, r, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	categories = slices.Delete(categories, index, index+1)
+	if err := saveCategories(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving categories: "+err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
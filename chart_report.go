@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// chartColors are cycled through for chart slices and bars
+var chartColors = []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac"}
+
+// maxChartItems keeps charts readable, smaller items are folded into "Other"
+const maxChartItems = 8
+
+// chartItem is one labelled value of a chart, Color overrides the palette
+type chartItem struct {
+	Label   string
+	Minutes int
+	Color   string
+}
+
+// chartColor returns the item's own color or the palette color for its position
+func chartColor(item chartItem, index int) string {
+	if item.Color != "" {
+		return item.Color
+	}
+	return chartColors[index%len(chartColors)]
+}
+
+// chartPeriod returns the first and last day of the day, week or month containing day
+func chartPeriod(period string, day time.Time) (time.Time, time.Time) {
+	switch period {
+	case "day":
+		return day, day
+	case "month":
+		first := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+		return first, first.AddDate(0, 1, -1)
+	default:
+		start := weekStart(day)
+		return start, start.AddDate(0, 0, 6)
+	}
+}
+
+// chartLabel returns the chart label of a task or Jira project
+func chartLabel(task, jira, by string) string {
+	label := canonicalTask(task)
+	if by == "jira" {
+		label = jiraProject(jira)
+		if label == "" {
+			label = "No project"
+		}
+	}
+	if label == "" {
+		label = "Uncategorized"
+	}
+	return label
+}
+
+// chartItems totals entries by task or Jira project, largest first
+func chartItems(ctx context.Context, entries []TimeEntry, by string) []chartItem {
+	minutes := make(map[string]int)
+	for _, entry := range entries {
+		for _, share := range attributeMinutes(ctx, entry, entryMinutes(entry)) {
+			minutes[chartLabel(share.Task, share.Jira, by)] += share.Minutes
+		}
+	}
+	return chartItemsFromMinutes(minutes, by)
+}
+
+// rollupChartItems totals a user's time over a week or month from the rollups
+func rollupChartItems(ctx context.Context, granularity, user string, from, to time.Time, by string) ([]chartItem, error) {
+	report, err := buildRollupReport(ctx, granularity, user, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	minutes := make(map[string]int)
+	for _, period := range report.Periods {
+		for _, row := range period.rows {
+			minutes[chartLabel(row.Task, row.Jira, by)] += row.Minutes
+		}
+	}
+	return chartItemsFromMinutes(minutes, by), nil
+}
+
+// chartItemsFromMinutes turns minutes per label into chart items, largest first
+func chartItemsFromMinutes(minutes map[string]int, by string) []chartItem {
+	items := []chartItem{}
+	for label, total := range minutes {
+		if total > 0 {
+			items = append(items, chartItem{Label: label, Minutes: total})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Minutes != items[j].Minutes {
+			return items[i].Minutes > items[j].Minutes
+		}
+		return items[i].Label < items[j].Label
+	})
+
+	if len(items) > maxChartItems {
+		other := chartItem{Label: "Other"}
+		for _, item := range items[maxChartItems-1:] {
+			other.Minutes += item.Minutes
+		}
+		items = append(items[:maxChartItems-1], other)
+	}
+
+	if by != "jira" {
+		labels := make([]string, 0, len(items))
+		for _, item := range items {
+			labels = append(labels, item.Label)
+		}
+		styles := categoryStyles(labels)
+		for i := range items {
+			items[i].Color = styles[items[i].Label].Color
+			if icon := styles[items[i].Label].Icon; icon != "" {
+				items[i].Label = icon + " " + items[i].Label
+			}
+		}
+	}
+
+	return items
+}
+
+// canonicalTask maps a task onto the taxonomy's name when it has one
+func canonicalTask(task string) string {
+	if task == "" {
+		return ""
+	}
+	name, _ := canonicalCategory(task)
+	return name
+}
+
+// svgText escapes text for use in SVG markup
+func svgText(text string) string {
+	var builder strings.Builder
+	xml.EscapeText(&builder, []byte(text))
+	return builder.String()
+}
+
+// formatHours renders minutes as hours for chart labels
+func formatHours(minutes int) string {
+	return fmt.Sprintf("%.1fh", float64(minutes)/60)
+}
+
+// renderPieChart draws items as a pie with a legend to the right
+func renderPieChart(title string, items []chartItem) string {
+	const width, height, cx, cy, radius = 480, 300, 150, 160, 110
+
+	total := 0
+	for _, item := range items {
+		total += item.Minutes
+	}
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`, width, height, width, height)
+	fmt.Fprintf(&svg, `<text x="%d" y="24" font-size="16" font-weight="bold">%s</text>`, 10, svgText(title))
+
+	angle := -math.Pi / 2
+	for i, item := range items {
+		color := chartColor(item, i)
+		share := float64(item.Minutes) / float64(total)
+
+		// A single item is a full circle, which an arc can't draw
+		if len(items) == 1 {
+			fmt.Fprintf(&svg, `<circle cx="%d" cy="%d" r="%d" fill="%s"/>`, cx, cy, radius, color)
+		} else {
+			end := angle + share*2*math.Pi
+			largeArc := 0
+			if share > 0.5 {
+				largeArc = 1
+			}
+			fmt.Fprintf(&svg, `<path d="M %d %d L %.2f %.2f A %d %d 0 %d 1 %.2f %.2f Z" fill="%s"/>`,
+				cx, cy, cx+radius*math.Cos(angle), cy+radius*math.Sin(angle),
+				radius, radius, largeArc, cx+radius*math.Cos(end), cy+radius*math.Sin(end), color)
+			angle = end
+		}
+
+		y := 60 + i*24
+		fmt.Fprintf(&svg, `<rect x="290" y="%d" width="14" height="14" fill="%s"/>`, y, color)
+		fmt.Fprintf(&svg, `<text x="310" y="%d">%s %s (%.0f%%)</text>`, y+12, svgText(item.Label), formatHours(item.Minutes), share*100)
+	}
+
+	svg.WriteString(`</svg>`)
+	return svg.String()
+}
+
+// renderBarChart draws items as horizontal bars labelled with their hours
+func renderBarChart(title string, items []chartItem) string {
+	const width, labelWidth, barHeight, gap, top = 480, 140, 22, 8, 44
+	height := top + len(items)*(barHeight+gap) + 10
+
+	largest := 1
+	for _, item := range items {
+		largest = max(largest, item.Minutes)
+	}
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`, width, height, width, height)
+	fmt.Fprintf(&svg, `<text x="%d" y="24" font-size="16" font-weight="bold">%s</text>`, 10, svgText(title))
+
+	maxBar := float64(width - labelWidth - 60)
+	for i, item := range items {
+		y := top + i*(barHeight+gap)
+		barWidth := maxBar * float64(item.Minutes) / float64(largest)
+		fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="end">%s</text>`, labelWidth-8, y+barHeight-7, svgText(item.Label))
+		fmt.Fprintf(&svg, `<rect x="%d" y="%d" width="%.1f" height="%d" fill="%s"/>`, labelWidth, y, barWidth, barHeight, chartColor(item, i))
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%d">%s</text>`, float64(labelWidth)+barWidth+6, y+barHeight-7, formatHours(item.Minutes))
+	}
+
+	svg.WriteString(`</svg>`)
+	return svg.String()
+}
+
+// chartReportHandler renders the current user's time by task (?by=category, default)
+// or Jira project (?by=jira) as an SVG pie or bar chart (?type=pie|bar) for the day,
+// week or month (?period=) containing ?date=YYYYMMDD, default today, or from/to
+// (YYYYMMDD) when given. The task, jira and tag filters narrow the entries charted.
+func chartReportHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	chartType, period, by := query.Get("type"), query.Get("period"), query.Get("by")
+	if chartType == "" {
+		chartType = "pie"
+	}
+	if period == "" {
+		period = "week"
+	}
+	if by == "" {
+		by = "category"
+	}
+
+	user := currentUser(r)
+	v := &validator{}
+	v.oneOf("type", chartType, []string{"pie", "bar"})
+	v.oneOf("period", period, []string{"day", "week", "month"})
+	v.oneOf("by", by, []string{"category", "jira"})
+	if format := query.Get("format"); format != "" && format != "svg" {
+		v.add("format", "only svg charts are supported")
+	}
+	day, err := resolveEntryDay(query.Get("date"), user.Name)
+	if err != nil {
+		v.add("date", "%s", err.Error())
+	}
+	from, to := chartPeriod(period, day)
+	if query.Has("from") || query.Has("to") {
+		if from, to, err = parseDateRange(r); err != nil {
+			v.add("from", "%s", err.Error())
+		}
+	}
+	filter, details := parseEntryFilter(r)
+	v.details = append(v.details, details...)
+	ctx, details := attributionContext(r)
+	v.details = append(v.details, details...)
+	if len(v.details) > 0 {
+		writeValidationError(w, r, v.details...)
+		return
+	}
+
+	// Unfiltered weeks and months come from the rollups instead of every entry
+	var items []chartItem
+	if (period == "week" || period == "month") && !query.Has("from") && !query.Has("to") && filter == (EntryFilter{}) {
+		granularity := map[string]string{"week": RollupWeekly, "month": RollupMonthly}[period]
+		if items, err = rollupChartItems(ctx, granularity, user.Name, from, to, by); err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error reading entries: %v", err))
+			return
+		}
+	} else {
+		entries, err := readEntriesBetween(r.Context(), from, to)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error reading entries: %v", err))
+			return
+		}
+
+		own := []TimeEntry{}
+		for _, entry := range entries {
+			if entryOwner(entry) == user.Name && filter.matches(entry) {
+				own = append(own, entry)
+			}
+		}
+		items = chartItems(ctx, own, by)
+	}
+	title := fmt.Sprintf("Time by %s, %s to %s", map[string]string{"category": "category", "jira": "project"}[by], entryDate(from), entryDate(to))
+
+	var svg string
+	switch {
+	case len(items) == 0:
+		svg = fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="480" height="60" font-family="sans-serif"><text x="10" y="24" font-size="16" font-weight="bold">%s</text><text x="10" y="48" font-size="12">No time logged</text></svg>`, svgText(title))
+	case chartType == "bar":
+		svg = renderBarChart(title, items)
+	default:
+		svg = renderPieChart(title, items)
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Write([]byte(svg))
+}
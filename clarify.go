@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// clarifySystemPrompt asks for the one question that would settle an uncertain categorization
+const clarifySystemPrompt = "A time tracking entry couldn't be categorized with confidence. " +
+	"Ask the user one short question whose answer would settle which category or Jira issue it belongs to, " +
+	"e.g. \"Was the security scan for client A or internal infra?\". " +
+	"Respond only with JSON: {\"question\": \"<question>\"}"
+
+// ClarifyRequest represents the JSON request answering an entry's clarifying question
+type ClarifyRequest struct {
+	Answer string `json:"answer"`
+}
+
+// Clarifier asks a question about an entry that couldn't be categorized with confidence
+type Clarifier interface {
+	Clarify(ctx context.Context, description string) (string, error)
+}
+
+// clarifyingQuestion asks the model what would settle a low-confidence result,
+// returning "" for confident results or when no question could be generated
+func clarifyingQuestion(ctx context.Context, text string, result *CategoryResponse) string {
+	if result == nil || result.Confidence != "low" {
+		return ""
+	}
+
+	question, err := llm().Clarify(ctx, text)
+	if err != nil {
+		log.Printf("Error generating clarifying question: %v", err)
+		return ""
+	}
+	return strings.TrimSpace(question)
+}
+
+// clarifiedText adds the answered questions of an entry to what the categorizer sees
+func clarifiedText(text, clarification string) string {
+	if clarification == "" {
+		return text
+	}
+	return text + "\n\nClarified by the user:\n" + clarification
+}
+
+// clarifyEntryHandler answers an entry's clarifying question and categorizes it again
+// with the answer as extra context. A result that is still uncertain comes with a
+// new question. The entry's day is given as ?date=YYYYMMDD and defaults to today.
+func clarifyEntryHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	// Parse JSON request
+	var request ClarifyRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+		return
+	}
+
+	v := &validator{}
+	v.text("answer", request.Answer, true, maxDescriptionLength)
+	if len(v.details) > 0 {
+		writeValidationError(w, r, v.details...)
+		return
+	}
+
+	day, existing, ok := lookupEntry(w, r)
+	if !ok {
+		return
+	}
+	if existing.Question == "" {
+		writeError(w, r, http.StatusConflict, "Entry has no open question")
+		return
+	}
+	if err := checkWeekOpen(entryOwner(*existing), day); err != nil {
+		writeErrorCode(w, r, http.StatusConflict, ErrCodeWeekFrozen, err.Error())
+		return
+	}
+
+	// Fail fast while the LLM backend is down, the question stays open
+	if llmUnavailable() {
+		writeCircuitOpen(w, r)
+		return
+	}
+	release, ok := reserveCategorization(1)
+	if !ok {
+		writeQueueFull(w, r)
+		return
+	}
+	defer release()
+
+	answered := *existing
+	answered.Clarification = strings.TrimSpace(fmt.Sprintf("%s\n%s %s", existing.Clarification, existing.Question, strings.TrimSpace(request.Answer)))
+	text := categorizationText(answered)
+
+	ctx := withWorkTime(r.Context(), entryWorkTime(answered))
+	result, err := categorizeDescription(ctx, text)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error categorizing entry: "+err.Error())
+		return
+	}
+	question := clarifyingQuestion(ctx, text, result)
+
+	user := currentUser(r)
+	entry, err := updateEntry(r.Context(), day, existing.ID, func(e *TimeEntry) {
+		e.Task = result.Task
+		e.TaskReason = result.Reason
+		if result.Jira != "" {
+			e.Jira = result.Jira
+		}
+		e.Confidence = result.Confidence
+		e.InputHash = result.InputHash
+		e.Labels = result.Labels
+		e.Question = question
+		e.Clarification = answered.Clarification
+		e.Categorized = autoAccepted(result.Confidence)
+	})
+	if err == nil {
+		entry = runCategorizedHooks(r.Context(), day, entry)
+		if err := recordExperimentOutcome(day, *entry, result); err != nil {
+			log.Printf("Error recording experiment outcome: %v", err)
+		}
+	}
+	if errors.Is(err, errWeekFrozen) {
+		writeErrorCode(w, r, http.StatusConflict, ErrCodeWeekFrozen, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving entry: "+err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(localizeEntry(*entry, userLocation(user.Name)))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ClassifyRequest represents the JSON request for categorizing text without saving an entry
+type ClassifyRequest struct {
+	Description string `json:"description"`
+	// Options override the configured generation options for this request only
+	Options GenerationOverrides `json:"options"`
+}
+
+// ClassifyResponse is the categorization and the generation options that produced it
+type ClassifyResponse struct {
+	CategoryResponse
+	Options GenerationOptions `json:"options"`
+}
+
+// classifyHandler categorizes a description through the same pipeline as entries, without saving anything
+func classifyHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	// Parse JSON request
+	var request ClassifyRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+		return
+	}
+
+	v := &validator{}
+	v.text("description", request.Description, true, maxDescriptionLength)
+	request.Options.validate(v, "options")
+	if len(v.details) > 0 {
+		writeValidationError(w, r, v.details...)
+		return
+	}
+
+	release, ok := reserveCategorization(1)
+	if !ok {
+		writeQueueFull(w, r)
+		return
+	}
+	defer release()
+
+	ctx := withGenerationOverrides(r.Context(), request.Options)
+	result, err := categorizeDescription(ctx, request.Description)
+	if errors.Is(err, errCircuitOpen) {
+		writeCircuitOpen(w, r)
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, "Error categorizing description: "+err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ClassifyResponse{
+		CategoryResponse: *result,
+		Options:          generationOptions(ctx),
+	})
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Cluster report limits
+const (
+	maxClusters          = 20
+	maxClusterIterations = 25
+	// clusterExamples is how many of a cluster's most typical entries are shown and sent to the labeler
+	clusterExamples = 8
+)
+
+// clusterLabelPrompt asks for a short theme name for a group of entries
+const clusterLabelPrompt = "These time tracking entries were grouped together because they are about similar work. " +
+	"Name the theme they share in 2 to 6 words, specific enough to tell it apart from other work, e.g. \"build pipeline babysitting\". " +
+	"Respond only with JSON: {\"label\": \"<theme>\"}"
+
+// TopicLabeler names the theme shared by a group of entry descriptions, given one per line
+type TopicLabeler interface {
+	LabelTopic(ctx context.Context, descriptions string) (string, error)
+}
+
+// TopicCluster is a group of entries about similar work, however they were categorized
+type TopicCluster struct {
+	Label      string  `json:"label"`
+	Minutes    int     `json:"minutes"`
+	Share      float64 `json:"share"`
+	EntryCount int     `json:"entry_count"`
+	// Tasks shows how the cluster's time was categorized
+	Tasks    map[string]int `json:"tasks"`
+	Examples []string       `json:"examples"`
+}
+
+// ClusterReport groups a period's entries by topic, largest first
+type ClusterReport struct {
+	User         string         `json:"user"`
+	From         string         `json:"from"`
+	To           string         `json:"to"`
+	TotalMinutes int            `json:"total_minutes"`
+	Clusters     []TopicCluster `json:"clusters"`
+	// Errors lists entries that couldn't be embedded and clusters the LLM couldn't label
+	Errors []string `json:"errors,omitempty"`
+}
+
+// entryVector returns an entry's stored embedding, embedding it now when none is current
+func entryVector(ctx context.Context, entry TimeEntry) (Vector, error) {
+	vector, found, err := storedEntryEmbedding(entry)
+	if err != nil || found {
+		return vector, err
+	}
+	return embedText(ctx, categorizationText(entry))
+}
+
+// clusterVectors groups unit vectors into at most k clusters with spherical k-means.
+// Seeds are chosen farthest-first from the first vector, so the same entries
+// always give the same clusters.
+func clusterVectors(vectors []Vector, k int) []int {
+	assignments := make([]int, len(vectors))
+	if len(vectors) == 0 {
+		return assignments
+	}
+	k = min(k, len(vectors))
+
+	centroids := []Vector{vectors[0]}
+	for len(centroids) < k {
+		farthest, lowest := -1, math.Inf(1)
+		for i, vector := range vectors {
+			closest := math.Inf(-1)
+			for _, centroid := range centroids {
+				closest = math.Max(closest, cosineSimilarity(vector, centroid))
+			}
+			if closest < lowest {
+				farthest, lowest = i, closest
+			}
+		}
+		centroids = append(centroids, vectors[farthest])
+	}
+
+	for iteration := 0; iteration < maxClusterIterations; iteration++ {
+		changed := iteration == 0
+		for i, vector := range vectors {
+			best, bestScore := 0, math.Inf(-1)
+			for c, centroid := range centroids {
+				if score := cosineSimilarity(vector, centroid); score > bestScore {
+					best, bestScore = c, score
+				}
+			}
+			if assignments[i] != best {
+				assignments[i] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		for c := range centroids {
+			sum := make([]float64, len(vectors[0]))
+			for i, vector := range vectors {
+				if assignments[i] != c {
+					continue
+				}
+				for d := range sum {
+					sum[d] += float64(vector[d])
+				}
+			}
+			var norm float64
+			for _, value := range sum {
+				norm += value * value
+			}
+			// A centroid left without members keeps its place
+			if norm == 0 {
+				continue
+			}
+			for d := range sum {
+				sum[d] /= math.Sqrt(norm)
+			}
+			centroids[c] = toVector(sum)
+		}
+	}
+
+	return assignments
+}
+
+// defaultClusterCount picks a cluster count that grows slowly with the number of entries
+func defaultClusterCount(entries int) int {
+	return max(1, min(8, int(math.Round(math.Sqrt(float64(entries)/2)))))
+}
+
+// clusterReportHandler clusters the current user's entries between ?from= and ?to=
+// (YYYYMMDD, default this week) by the similarity of their embeddings and has the
+// LLM name each cluster's theme. ?k= sets the number of clusters.
+func clusterReportHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	k := 0
+	if value := r.URL.Query().Get("k"); value != "" {
+		k, err = strconv.Atoi(value)
+		if err != nil || k < 1 || k > maxClusters {
+			writeValidationError(w, r, ErrorDetail{Field: "k", Message: fmt.Sprintf("k must be a number from 1 to %d", maxClusters)})
+			return
+		}
+	}
+
+	entries, err := readEntriesBetween(r.Context(), from, to)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error reading entries: %v", err))
+		return
+	}
+
+	user := currentUser(r).Name
+	report := ClusterReport{
+		User:     user,
+		From:     from.Format("20060102"),
+		To:       to.Format("20060102"),
+		Clusters: []TopicCluster{},
+	}
+
+	embedded := []TimeEntry{}
+	vectors := []Vector{}
+	for _, entry := range entries {
+		if entryOwner(entry) != user || entry.Description == "" {
+			continue
+		}
+		vector, err := entryVector(r.Context(), entry)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("Error embedding entry ID %s: %v", entry.ID, err))
+			continue
+		}
+		embedded = append(embedded, entry)
+		vectors = append(vectors, vector)
+		report.TotalMinutes += entryMinutes(entry)
+	}
+
+	if k == 0 {
+		k = defaultClusterCount(len(embedded))
+	}
+	assignments := clusterVectors(vectors, k)
+
+	// Collect each cluster's entries, most typical (closest to the others) first
+	members := make(map[int][]int)
+	for i, cluster := range assignments {
+		members[cluster] = append(members[cluster], i)
+	}
+	for _, indexes := range members {
+		typicality := make(map[int]float64)
+		for _, i := range indexes {
+			for _, j := range indexes {
+				typicality[i] += cosineSimilarity(vectors[i], vectors[j])
+			}
+		}
+		sort.SliceStable(indexes, func(a, b int) bool { return typicality[indexes[a]] > typicality[indexes[b]] })
+	}
+
+	for c := range k {
+		indexes, found := members[c]
+		if !found {
+			continue
+		}
+
+		cluster := TopicCluster{Tasks: make(map[string]int), Examples: []string{}}
+		for _, i := range indexes {
+			minutes := entryMinutes(embedded[i])
+			task := canonicalTask(embedded[i].Task)
+			if task == "" {
+				task = "Uncategorized"
+			}
+			cluster.Minutes += minutes
+			cluster.Tasks[task] += minutes
+			cluster.EntryCount++
+			if len(cluster.Examples) < clusterExamples && !slices.ContainsFunc(cluster.Examples, func(example string) bool { return strings.EqualFold(example, embedded[i].Description) }) {
+				cluster.Examples = append(cluster.Examples, embedded[i].Description)
+			}
+		}
+		if report.TotalMinutes > 0 {
+			cluster.Share = math.Round(float64(cluster.Minutes)/float64(report.TotalMinutes)*1000) / 1000
+		}
+
+		label, err := llm().LabelTopic(r.Context(), "- "+strings.Join(cluster.Examples, "\n- "))
+		if label = strings.TrimSpace(label); err != nil || label == "" {
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("Error labeling the cluster of %q: %v", cluster.Examples[0], err))
+			}
+			label = cluster.Examples[0]
+		}
+		cluster.Label = label
+
+		report.Clusters = append(report.Clusters, cluster)
+	}
+
+	sort.Slice(report.Clusters, func(i, j int) bool {
+		if report.Clusters[i].Minutes != report.Clusters[j].Minutes {
+			return report.Clusters[i].Minutes > report.Clusters[j].Minutes
+		}
+		return report.Clusters[i].Label < report.Clusters[j].Label
+	})
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
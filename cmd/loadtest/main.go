@@ -0,0 +1,206 @@
+// Command loadtest drives entry creation and categorization against a running
+// aidea server at fixed rates and reports latency percentiles. Run the server
+// with the mock provider (e.g. "aidea --demo") so the numbers measure aidea, not
+// the LLM. Budgets make it fail, exiting 1, when latency or errors exceed them:
+//
+//	go run ./cmd/loadtest -rate 50 -categorize-rate 2 -duration 1m -p95 100ms
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// descriptions are combined into the logged entries, the mock provider recognizes some words
+var descriptions = []string{
+	"fix login bug", "review pull request", "standup", "implement search api", "write docs",
+	"answer email", "deploy release", "design dashboard", "planning meeting", "support ticket",
+}
+
+// operation collects the results of one kind of request
+type operation struct {
+	name string
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    int
+	statuses  map[int]int
+}
+
+func (o *operation) record(latency time.Duration, status int, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.latencies = append(o.latencies, latency)
+	if o.statuses == nil {
+		o.statuses = make(map[int]int)
+	}
+	o.statuses[status]++
+	if err != nil || status >= 400 {
+		o.errors++
+	}
+}
+
+// percentile returns the latency below which the given fraction of requests finished
+func percentile(sorted []time.Duration, fraction float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := int(fraction*float64(len(sorted))+0.5) - 1
+	return sorted[max(0, min(index, len(sorted)-1))]
+}
+
+func main() {
+	url := flag.String("url", "http://localhost:8080", "server to load")
+	token := flag.String("token", "", "API token, sent as a bearer token")
+	duration := flag.Duration("duration", 30*time.Second, "how long to send requests")
+	rate := flag.Float64("rate", 10, "entries created per second")
+	categorizeRate := flag.Float64("categorize-rate", 1, "categorization runs per second, 0 for none")
+	concurrency := flag.Int("concurrency", 32, "most requests in flight, requests beyond it are dropped and counted")
+	date := flag.String("date", time.Now().Format("20060102"), "day the entries are logged on, YYYYMMDD")
+	p95 := flag.Duration("p95", 0, "fail when an operation's p95 latency exceeds this")
+	p99 := flag.Duration("p99", 0, "fail when an operation's p99 latency exceeds this")
+	maxErrors := flag.Float64("max-errors", 0.01, "fail when more than this fraction of an operation's requests fail")
+	flag.Parse()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	send := func(op *operation, method, path string, body interface{}) {
+		var reader io.Reader
+		if body != nil {
+			data, _ := json.Marshal(body)
+			reader = bytes.NewReader(data)
+		}
+		request, err := http.NewRequest(method, strings.TrimRight(*url, "/")+path, reader)
+		if err != nil {
+			op.record(0, 0, err)
+			return
+		}
+		if body != nil {
+			request.Header.Set("Content-Type", "application/json")
+		}
+		if *token != "" {
+			request.Header.Set("Authorization", "Bearer "+*token)
+		}
+
+		start := time.Now()
+		response, err := client.Do(request)
+		if err != nil {
+			op.record(time.Since(start), 0, err)
+			return
+		}
+		io.Copy(io.Discard, response.Body)
+		response.Body.Close()
+		op.record(time.Since(start), response.StatusCode, nil)
+	}
+
+	create := &operation{name: "create entry"}
+	categorize := &operation{name: "categorize"}
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	var randomMu sync.Mutex
+	description := func() string {
+		randomMu.Lock()
+		defer randomMu.Unlock()
+		return descriptions[random.Intn(len(descriptions))] + " " + descriptions[random.Intn(len(descriptions))]
+	}
+
+	// Requests are sent on a fixed schedule, not when the previous one returns, so a
+	// slow server shows up as latency instead of as a lower rate
+	inFlight := make(chan struct{}, *concurrency)
+	dropped := 0
+	var droppedMu sync.Mutex
+	var wg sync.WaitGroup
+	drive := func(perSecond float64, request func()) {
+		defer wg.Done()
+		if perSecond <= 0 {
+			return
+		}
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / perSecond))
+		defer ticker.Stop()
+		deadline := time.After(*duration)
+		for {
+			select {
+			case <-deadline:
+				return
+			case <-ticker.C:
+				select {
+				case inFlight <- struct{}{}:
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						defer func() { <-inFlight }()
+						request()
+					}()
+				default:
+					droppedMu.Lock()
+					dropped++
+					droppedMu.Unlock()
+				}
+			}
+		}
+	}
+
+	fmt.Printf("Loading %s for %s: %.1f entries/s, %.1f categorizations/s\n", *url, *duration, *rate, *categorizeRate)
+	started := time.Now()
+	wg.Add(2)
+	go drive(*rate, func() {
+		send(create, http.MethodPost, "/api/v1/save_time", map[string]string{"timespan": "30m", "description": description(), "date": *date})
+	})
+	go drive(*categorizeRate, func() {
+		send(categorize, http.MethodPost, "/api/v1/categorize?date="+*date, nil)
+	})
+	wg.Wait()
+	elapsed := time.Since(started)
+
+	fmt.Printf("\n%-14s %7s %7s %8s %10s %10s %10s %10s %10s\n", "operation", "count", "errors", "rate/s", "p50", "p90", "p95", "p99", "max")
+	failures := []string{}
+	for _, op := range []*operation{create, categorize} {
+		if len(op.latencies) == 0 {
+			continue
+		}
+		sorted := append([]time.Duration(nil), op.latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		fmt.Printf("%-14s %7d %7d %8.1f %10s %10s %10s %10s %10s\n", op.name, len(sorted), op.errors,
+			float64(len(sorted))/elapsed.Seconds(),
+			percentile(sorted, 0.50).Round(time.Microsecond), percentile(sorted, 0.90).Round(time.Microsecond),
+			percentile(sorted, 0.95).Round(time.Microsecond), percentile(sorted, 0.99).Round(time.Microsecond),
+			sorted[len(sorted)-1].Round(time.Microsecond))
+
+		codes := []string{}
+		for status, count := range op.statuses {
+			codes = append(codes, fmt.Sprintf("%d×%d", status, count))
+		}
+		sort.Strings(codes)
+		fmt.Printf("%-14s statuses %s\n", "", strings.Join(codes, " "))
+
+		if *p95 > 0 && percentile(sorted, 0.95) > *p95 {
+			failures = append(failures, fmt.Sprintf("%s p95 %s exceeds %s", op.name, percentile(sorted, 0.95), *p95))
+		}
+		if *p99 > 0 && percentile(sorted, 0.99) > *p99 {
+			failures = append(failures, fmt.Sprintf("%s p99 %s exceeds %s", op.name, percentile(sorted, 0.99), *p99))
+		}
+		if share := float64(op.errors) / float64(len(sorted)); share > *maxErrors {
+			failures = append(failures, fmt.Sprintf("%s error rate %.1f%% exceeds %.1f%%", op.name, share*100, *maxErrors*100))
+		}
+	}
+	if dropped > 0 {
+		fmt.Printf("\n%d requests weren't sent, %d were already in flight\n", dropped, *concurrency)
+	}
+
+	if len(failures) > 0 {
+		fmt.Println("\nOver budget:")
+		for _, failure := range failures {
+			fmt.Println("  " + failure)
+		}
+		os.Exit(1)
+	}
+}
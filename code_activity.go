@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxActivityMinutes caps the estimate for a single code activity suggestion
+const maxActivityMinutes = 240
+
+// ActivityEstimates are the minutes assumed per unit of code hosting activity
+type ActivityEstimates struct {
+	CommitMinutes      int `json:"commit_minutes"`
+	ReviewMinutes      int `json:"review_minutes"`
+	CommentMinutes     int `json:"comment_minutes"`
+	PullRequestMinutes int `json:"pull_request_minutes"`
+	IssueMinutes       int `json:"issue_minutes"`
+	PipelineMinutes    int `json:"pipeline_minutes,omitempty"`
+}
+
+// ActivitySuggestion is GitHub or GitLab activity proposed as a time entry
+type ActivitySuggestion struct {
+	Repo        string `json:"repo"`
+	Kind        string `json:"kind"`
+	Count       int    `json:"count"`
+	Description string `json:"description"`
+	Timespan    string `json:"timespan"`
+	Jira        string `json:"jira,omitempty"`
+	EntryID     string `json:"entry_id,omitempty"`
+	// DuplicateOf is an entry already logged for this activity, if any
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+}
+
+type activityGroup struct {
+	suggestion ActivitySuggestion
+	subject    string
+	texts      []string
+	minutes    int
+}
+
+// activityGroups collects activity into one suggestion per repository, kind and
+// subject (a branch, pull/merge request or issue)
+type activityGroups struct {
+	groups []*activityGroup
+	byKey  map[string]*activityGroup
+}
+
+func newActivityGroups() *activityGroups {
+	return &activityGroups{byKey: make(map[string]*activityGroup)}
+}
+
+// add records count units of activity estimated at minutes each. Kinds are commits,
+// review, comments, pull_request, issue and pipelines.
+func (a *activityGroups) add(repo, kind, subject, text string, count, minutes int) {
+	key := repo + "\x00" + kind + "\x00" + subject
+	g, found := a.byKey[key]
+	if !found {
+		g = &activityGroup{suggestion: ActivitySuggestion{Repo: repo, Kind: kind}, subject: subject}
+		a.byKey[key] = g
+		a.groups = append(a.groups, g)
+	}
+	g.suggestion.Count += count
+	g.minutes += count * minutes
+	if text != "" && !slices.Contains(g.texts, text) {
+		g.texts = append(g.texts, text)
+	}
+}
+
+// suggestions describes each group, jira returns the issue for a repository's activity text
+func (a *activityGroups) suggestions(jira func(repo, text string) string) []ActivitySuggestion {
+	suggestions := []ActivitySuggestion{}
+	for _, g := range a.groups {
+		s := g.suggestion
+		switch s.Kind {
+		case "commits":
+			s.Description = fmt.Sprintf("Pushed %d commit(s) to %s", s.Count, s.Repo)
+			if g.subject != "" {
+				s.Description += " (" + g.subject + ")"
+			}
+			if len(g.texts) > 0 {
+				s.Description += ": " + strings.Join(g.texts, "; ")
+			}
+		case "pipelines":
+			s.Description = fmt.Sprintf("Watched %d pipeline(s) in %s", s.Count, s.Repo)
+			if g.subject != "" {
+				s.Description += " (" + g.subject + ")"
+			}
+		case "review":
+			s.Description = "Reviewed " + g.subject
+		case "comments":
+			s.Description = "Commented on " + g.subject
+		case "pull_request", "issue":
+			s.Description = "Opened " + g.subject
+		}
+		if len(s.Description) > maxDescriptionLength {
+			s.Description = s.Description[:maxDescriptionLength-3] + "..."
+		}
+
+		s.Jira = jira(s.Repo, g.subject+" "+strings.Join(g.texts, " "))
+		s.Timespan = fmt.Sprintf("%dm", min(max(g.minutes, 1), maxActivityMinutes))
+		suggestions = append(suggestions, s)
+	}
+
+	return suggestions
+}
+
+// pickJira chooses the Jira issue for activity from the keys mentioned in its text.
+// mapped is the repository's configured Jira reference: a project restricts the
+// keys to that project, an issue is used when the text mentions none.
+func pickJira(mapped, text string) string {
+	keys := jiraKeyFinder.FindAllString(text, -1)
+
+	switch {
+	case jiraProjectPattern.MatchString(mapped):
+		for _, key := range keys {
+			if jiraProject(key) == mapped {
+				return key
+			}
+		}
+		return ""
+	case len(keys) > 0:
+		return keys[0]
+	default:
+		return mapped
+	}
+}
+
+// dayBounds returns midnight starting and ending a day
+func dayBounds(day time.Time) (time.Time, time.Time) {
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	return midnight, midnight.AddDate(0, 0, 1)
+}
+
+// saveSuggestions stores suggestions as uncategorized entries for the user on the day.
+// Importing the same day twice produces the same descriptions, so those are marked
+// as duplicates of the existing entries instead. Dry runs only mark duplicates.
+func saveSuggestions(ctx context.Context, user *User, day time.Time, suggestions []ActivitySuggestion, dryRun bool) ([]string, error) {
+	existing, err := readDayEntries(day)
+	if err != nil {
+		return nil, err
+	}
+
+	errors := []string{}
+	for i := range suggestions {
+		suggestion := &suggestions[i]
+
+		for _, entry := range existing {
+			if entryOwner(entry) == user.Name && entry.Description == suggestion.Description {
+				suggestion.DuplicateOf = entry.ID
+				break
+			}
+		}
+		if suggestion.DuplicateOf != "" || dryRun {
+			continue
+		}
+
+		entry := TimeEntry{
+			ID:          uuid.New().String(),
+			Timespan:    suggestion.Timespan,
+			Description: suggestion.Description,
+			Jira:        suggestion.Jira,
+			Categorized: false,
+			User:        entryUserName(user),
+		}
+
+		if err := appendEntry(ctx, day, entry); err != nil {
+			errors = append(errors, fmt.Sprintf("Error saving %s: %v", suggestion.Description, err))
+			continue
+		}
+		suggestion.EntryID = entry.ID
+	}
+
+	return errors, nil
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config holds the runtime configuration loaded from config.json
+type Config struct {
+	API            APIConfig            `json:"api"`
+	Pomodoro       PomodoroConfig       `json:"pomodoro"`
+	WindowImport   WindowImportConfig   `json:"window_import"`
+	Entries        EntriesConfig        `json:"entries"`
+	Calendar       CalendarConfig       `json:"calendar"`
+	Rules          RulesConfig          `json:"rules"`
+	Normalization  NormalizationConfig  `json:"normalization"`
+	Anomalies      AnomalyConfig        `json:"anomalies"`
+	Forecast       ForecastConfig       `json:"forecast"`
+	Reports        ReportsConfig        `json:"reports"`
+	Updates        UpdatesConfig        `json:"updates"`
+	Plugins        []PluginConfig       `json:"plugins"`
+	Hooks          []HookConfig         `json:"hooks"`
+	Events         EventsConfig         `json:"events"`
+	Stream         StreamConfig         `json:"stream"`
+	Taxonomy       TaxonomyConfig       `json:"taxonomy"`
+	Categorization CategorizationConfig `json:"categorization"`
+	WorkingHours   WorkingHours         `json:"working_hours"`
+	APITokens      []APIToken           `json:"api_tokens"`
+	Users          []User               `json:"users"`
+	Jira           JiraConfig           `json:"jira"`
+	Harvest        HarvestConfig        `json:"harvest"`
+	RescueTime     RescueTimeConfig     `json:"rescuetime"`
+	GitHub         GitHubConfig         `json:"github"`
+	GitLab         GitLabConfig         `json:"gitlab"`
+	Zoom           ZoomConfig           `json:"zoom"`
+	OIDC           OIDCConfig           `json:"oidc"`
+	Storage        StorageConfig        `json:"storage"`
+	Tracing        TracingConfig        `json:"tracing"`
+	LLM            LLMConfig            `json:"llm"`
+	Quick          QuickConfig          `json:"quick"`
+	Telegram       TelegramConfig       `json:"telegram"`
+	Teams          TeamsConfig          `json:"teams"`
+	EmailIn        EmailInConfig        `json:"email_in"`
+	VectorStore    VectorStoreConfig    `json:"vector_store"`
+	Logging        LoggingConfig        `json:"logging"`
+	Performance    PerformanceConfig    `json:"performance"`
+
+	// Exports maps entry fields onto the fields of each export target
+	Exports map[string][]ExportField `json:"exports"`
+}
+
+// PomodoroConfig holds the default pomodoro intervals in minutes
+type PomodoroConfig struct {
+	WorkMinutes      int `json:"work_minutes"`
+	BreakMinutes     int `json:"break_minutes"`
+	LongBreakMinutes int `json:"long_break_minutes"`
+	LongBreakEvery   int `json:"long_break_every"`
+}
+
+// WindowImportConfig controls how window/app usage events are clustered into entries
+type WindowImportConfig struct {
+	MaxGapMinutes int      `json:"max_gap_minutes"`
+	MinMinutes    int      `json:"min_minutes"`
+	IgnoredApps   []string `json:"ignored_apps"`
+}
+
+// EntriesConfig limits how far from today entries may be dated
+type EntriesConfig struct {
+	MaxPastDays   int `json:"max_past_days"`
+	MaxFutureDays int `json:"max_future_days"`
+	// TrashDays is how long deleted entries can be restored before they are purged, 0 keeps them forever
+	TrashDays int `json:"trash_days"`
+	// Embed keeps an embedding of every entry for semantic search and analytics
+	Embed bool `json:"embed"`
+	// CacheDays keeps the data files of this many recent days in memory, 0 reads every file from disk
+	CacheDays int `json:"cache_days"`
+}
+
+// QuickConfig controls the browser extension endpoint
+type QuickConfig struct {
+	AllowedOrigins []string `json:"allowed_origins"`
+}
+
+// activeState is a configuration together with everything built from it: time
+// zones, the LLM provider and its breakers, the vector store, plugins and export
+// templates. It is never changed once active, a reload swaps in a new one whole so
+// requests see either the old settings or the new ones, never a mix.
+type activeState struct {
+	config           Config
+	storageLocation  *time.Location
+	userLocations    map[string]*time.Location
+	provider         Provider
+	llmBreaker       *circuitBreaker
+	embeddingBreaker *circuitBreaker
+	vectorStore      VectorStore
+	plugins          []*categorizerPlugin
+	exportFields     map[string][]exportField
+}
+
+var (
+	active atomic.Pointer[activeState]
+	// activateMu serializes swaps, so two reloads don't each build on the state the other replaced
+	activateMu sync.Mutex
+)
+
+func init() {
+	active.Store(&activeState{
+		config:          defaultConfig(),
+		storageLocation: time.Local,
+		userLocations:   map[string]*time.Location{},
+		provider:        ollamaProvider{baseURL: "http://localhost:11434", model: "gemma3", embeddingModel: "all-minilm"},
+		exportFields:    map[string][]exportField{},
+	})
+}
+
+// currentConfig returns the active configuration, which must not be modified
+func currentConfig() *Config {
+	return &active.Load().config
+}
+
+// updateActive swaps in a copy of the active state changed by update
+func updateActive(update func(*activeState)) {
+	activateMu.Lock()
+	defer activateMu.Unlock()
+
+	state := *active.Load()
+	update(&state)
+	active.Store(&state)
+}
+
+// setConfig makes a config active without rebuilding what is derived from it, for
+// commands that only read settings
+func setConfig(config Config) {
+	updateActive(func(state *activeState) { state.config = config })
+}
+
+// prepareConfig checks every setting and builds what the server derives from
+// them, leaving the active state untouched. Parts whose settings match the active
+// config are kept, so a reload doesn't reset breakers or restart plugins needlessly.
+func prepareConfig(config Config) (*activeState, error) {
+	current := active.Load()
+	state := &activeState{config: config}
+
+	location, err := prepareStorage(config.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("storage: %v", err)
+	}
+	state.storageLocation = location
+	if state.userLocations, err = prepareUserTimezones(config.Users); err != nil {
+		return nil, fmt.Errorf("users: %v", err)
+	}
+	if err := configureWorkingHours(config); err != nil {
+		return nil, fmt.Errorf("users: %v", err)
+	}
+
+	if _, ok := confidenceRank[config.Categorization.AutoAcceptConfidence]; !ok {
+		return nil, fmt.Errorf("categorization: unknown confidence %q", config.Categorization.AutoAcceptConfidence)
+	}
+	if err := validateSchedules(config.Categorization.Schedules); err != nil {
+		return nil, fmt.Errorf("categorization: %v", err)
+	}
+	if mode := config.Categorization.LabelAttribution; mode != "" && !slices.Contains(attributionModes, mode) {
+		return nil, fmt.Errorf("categorization: unknown label attribution %q, expected primary or proportional", mode)
+	}
+	switch config.Taxonomy.Enforcement {
+	case TaxonomyOff, TaxonomyNormalize, TaxonomyStrict:
+	default:
+		return nil, fmt.Errorf("taxonomy: unknown enforcement %q", config.Taxonomy.Enforcement)
+	}
+
+	if reflect.DeepEqual(config.LLM, current.config.LLM) && current.provider != nil {
+		state.provider, state.llmBreaker, state.embeddingBreaker = current.provider, current.llmBreaker, current.embeddingBreaker
+	} else {
+		provider, breakers, err := newProvider(config.LLM)
+		if err != nil {
+			return nil, fmt.Errorf("LLM provider: %v", err)
+		}
+		state.provider = provider
+		if breakers != nil {
+			state.llmBreaker, state.embeddingBreaker = breakers.llm, breakers.embeddings
+		}
+	}
+
+	if reflect.DeepEqual(config.Plugins, current.config.Plugins) {
+		state.plugins = current.plugins
+	} else if state.plugins, err = preparePlugins(config.Plugins); err != nil {
+		return nil, fmt.Errorf("plugins: %v", err)
+	}
+	if err := validateHooks(config.Hooks); err != nil {
+		return nil, fmt.Errorf("hooks: %v", err)
+	}
+	if err := validateJiraConfig(config.Jira); err != nil {
+		return nil, fmt.Errorf("Jira: %v", err)
+	}
+	if state.exportFields, err = prepareExports(config.Exports); err != nil {
+		return nil, fmt.Errorf("exports: %v", err)
+	}
+	if _, err := newEventSinks(config.Events); err != nil {
+		return nil, fmt.Errorf("event sinks: %v", err)
+	}
+	if _, err := newStreamSink(config.Stream); err != nil {
+		return nil, fmt.Errorf("entry stream: %v", err)
+	}
+
+	// Last, so a failed check never leaves a new database connection behind
+	if reflect.DeepEqual(config.VectorStore, current.config.VectorStore) {
+		state.vectorStore = current.vectorStore
+	} else if state.vectorStore, err = newVectorStore(config.VectorStore); err != nil {
+		return nil, fmt.Errorf("vector store: %v", err)
+	}
+
+	return state, nil
+}
+
+// activateConfig swaps in a prepared state and stops the plugin processes and
+// closes the vector store it replaced
+func activateConfig(state *activeState) {
+	activateMu.Lock()
+	previous := active.Swap(state)
+	activateMu.Unlock()
+
+	for _, plugin := range previous.plugins {
+		if !slices.Contains(state.plugins, plugin) {
+			plugin.close()
+		}
+	}
+	if previous.vectorStore != nil && previous.vectorStore != state.vectorStore {
+		if err := previous.vectorStore.Close(); err != nil {
+			log.Printf("Error closing the replaced vector store: %v", err)
+		}
+	}
+}
+
+func defaultConfig() Config {
+	return Config{
+		Pomodoro: PomodoroConfig{
+			WorkMinutes:      25,
+			BreakMinutes:     5,
+			LongBreakMinutes: 15,
+			LongBreakEvery:   4,
+		},
+		WindowImport: WindowImportConfig{
+			MaxGapMinutes: 5,
+			MinMinutes:    10,
+			IgnoredApps:   []string{"loginwindow", "LockApp.exe"},
+		},
+		Entries: EntriesConfig{
+			MaxPastDays:   31,
+			MaxFutureDays: 7,
+			TrashDays:     30,
+			CacheDays:     62,
+		},
+		Anomalies: AnomalyConfig{
+			MaxDailyHours:   14,
+			SpikeFactor:     3,
+			BaselineWeeks:   4,
+			MinSpikeMinutes: 120,
+		},
+		Forecast: ForecastConfig{
+			HistoryWeeks: 12,
+			AverageWeeks: 4,
+		},
+		GitHub: GitHubConfig{
+			Estimates: ActivityEstimates{
+				CommitMinutes:      20,
+				ReviewMinutes:      30,
+				CommentMinutes:     10,
+				PullRequestMinutes: 15,
+				IssueMinutes:       10,
+			},
+		},
+		GitLab: GitLabConfig{
+			Estimates: ActivityEstimates{
+				CommitMinutes:      20,
+				ReviewMinutes:      30,
+				CommentMinutes:     10,
+				PullRequestMinutes: 15,
+				IssueMinutes:       10,
+				PipelineMinutes:    10,
+			},
+		},
+		Exports: defaultExports(),
+		Normalization: NormalizationConfig{
+			TicketURLs: true,
+		},
+		Rules: RulesConfig{
+			TopK:     5,
+			MinScore: 0.2,
+		},
+		Categorization: CategorizationConfig{
+			AutoAcceptConfidence: "medium",
+			Workers:              2,
+		},
+		Taxonomy: TaxonomyConfig{
+			Enforcement: TaxonomyNormalize,
+		},
+		Calendar: CalendarConfig{
+			PTOTask: "PTO",
+		},
+		WorkingHours: WorkingHours{
+			Start: "09:00",
+			End:   "17:00",
+			Days:  []string{"mon", "tue", "wed", "thu", "fri"},
+		},
+		LLM: LLMConfig{
+			Provider:       "ollama",
+			OllamaURL:      "http://localhost:11434",
+			Model:          "gemma3",
+			EmbeddingModel: "all-minilm",
+			Generation: GenerationOptions{
+				Temperature: 0,
+				MaxTokens:   2000,
+				TopP:        0.9,
+				Seed:        42,
+			},
+			Breaker: BreakerConfig{
+				FailureThreshold: 5,
+				CooldownSeconds:  30,
+			},
+		},
+		EmailIn: EmailInConfig{
+			SubjectPrefix: "track",
+		},
+		Updates: UpdatesConfig{
+			Repository: "austinmoody/aidea-time-tracker",
+		},
+	}
+}
+
+// loadConfig reads config.json if present, otherwise the defaults are used
+func loadConfig() (Config, error) {
+	config := defaultConfig()
+
+	configPath := locateFile("config.json")
+	configData, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	if err := json.Unmarshal(configData, &config); err != nil {
+		return config, fmt.Errorf("error parsing config file: %w", err)
+	}
+
+	return config, nil
+}
+
+// locateFile looks for a file next to the executable first, then in the working
+// (data) directory and the config directory. A file found nowhere belongs in the
+// config directory.
+func locateFile(name string) string {
+	execPath, err := os.Executable()
+	if err == nil {
+		filePath := filepath.Join(filepath.Dir(execPath), name)
+		if _, err := os.Stat(filePath); err == nil {
+			return filePath
+		}
+	}
+
+	currentDir, _ := os.Getwd()
+	filePath := filepath.Join(currentDir, name)
+	if _, err := os.Stat(filePath); err == nil || appDirs.Config == "" {
+		return filePath
+	}
+	return filepath.Join(appDirs.Config, name)
+}
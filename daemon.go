@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+)
+
+// pidFileName is written to the data directory by "aidea daemon"
+const pidFileName = "aidea.pid"
+
+// shutdownTimeout is how long in-flight requests get to finish on SIGTERM
+const shutdownTimeout = 15 * time.Second
+
+// Service identifiers for systemd and launchd
+const (
+	systemdUnitName = "aidea.service"
+	launchdLabel    = "com.aidea.tracker"
+)
+
+// systemdUnit runs the daemon as a user service started at login
+var systemdUnit = template.Must(template.New("unit").Parse(`[Unit]
+Description=aidea time tracker
+After=network-online.target
+
+[Service]
+ExecStart={{.Executable}} daemon{{if .DataDir}} --data-dir {{.DataDir}}{{end}}
+WorkingDirectory={{.WorkingDirectory}}
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=default.target
+`))
+
+// launchdAgent runs the daemon as a launch agent started at login and kept alive
+var launchdAgent = template.Must(template.New("agent").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{.Label}}</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{.Executable}}</string>
+		<string>daemon</string>{{if .DataDir}}
+		<string>--data-dir</string>
+		<string>{{.DataDir}}</string>{{end}}
+	</array>
+	<key>WorkingDirectory</key>
+	<string>{{.WorkingDirectory}}</string>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>StandardOutPath</key>
+	<string>{{.LogDirectory}}/aidea.log</string>
+	<key>StandardErrorPath</key>
+	<string>{{.LogDirectory}}/aidea.log</string>
+</dict>
+</plist>
+`))
+
+// serviceDefinition fills in the service templates
+type serviceDefinition struct {
+	Label            string
+	Executable       string
+	WorkingDirectory string
+	LogDirectory     string
+	// DataDir is passed on as --data-dir when everything is kept in one directory
+	DataDir string
+}
+
+// writePIDFile records the daemon's process ID, refusing to start when another
+// daemon still runs from the same directory
+func writePIDFile(path string) error {
+	if data, err := os.ReadFile(path); err == nil {
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && pid != os.Getpid() && processRunning(pid) {
+			return fmt.Errorf("aidea is already running with PID %d (%s)", pid, path)
+		}
+	}
+	return os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+}
+
+// processRunning reports whether a process exists, by sending it signal 0
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// reloadRules drops the loaded rules so they are read from disk again
+func reloadRules() error {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	rules = nil
+	return loadRules()
+}
+
+// handleSignals reloads the config and rules on SIGHUP and shuts the server down
+// gracefully on SIGINT or SIGTERM, removing the PID file if there is one
+func handleSignals(server *http.Server, pidFile string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+
+	for received := range signals {
+		if received == syscall.SIGHUP {
+			if err := reloadConfig(); err != nil {
+				log.Printf("Error reloading config, keeping the current one: %v", err)
+			} else {
+				log.Println("Reloaded config.json")
+			}
+			if err := reloadRules(); err != nil {
+				log.Printf("Error reloading rules: %v", err)
+			} else {
+				log.Println("Reloaded rules")
+			}
+			continue
+		}
+
+		log.Printf("Received %s, shutting down", received)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down: %v", err)
+		}
+		cancel()
+		if pidFile != "" {
+			os.Remove(pidFile)
+		}
+		return
+	}
+}
+
+// currentService describes this executable run with the current directories
+func currentService() (serviceDefinition, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return serviceDefinition{}, err
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+	definition := serviceDefinition{Label: launchdLabel, Executable: executable, WorkingDirectory: appDirs.Data, LogDirectory: appDirs.Logs}
+	if appDirs.Config == appDirs.Data {
+		definition.DataDir = appDirs.Data
+	}
+	return definition, nil
+}
+
+// servicePath is where the service definition for this OS is installed
+func servicePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	switch runtime.GOOS {
+	case "linux":
+		return filepath.Join(home, ".config", "systemd", "user", systemdUnitName), nil
+	case "darwin":
+		return filepath.Join(home, "Library", "LaunchAgents", launchdLabel+".plist"), nil
+	default:
+		return "", fmt.Errorf("installing a service isn't supported on %s", runtime.GOOS)
+	}
+}
+
+// runCommand runs a service manager command, showing its output
+func runCommand(out io.Writer, name string, args ...string) error {
+	fmt.Fprintf(out, "$ %s %s\n", name, strings.Join(args, " "))
+	command := exec.Command(name, args...)
+	command.Stdout = out
+	command.Stderr = out
+	return command.Run()
+}
+
+// runService is the "aidea service install|uninstall" command. The service runs
+// "aidea daemon" with the same directories as this command.
+func runService(args []string, out io.Writer) error {
+	if len(args) != 1 || (args[0] != "install" && args[0] != "uninstall") {
+		return errors.New("usage: aidea service install|uninstall")
+	}
+
+	path, err := servicePath()
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "uninstall" {
+		switch runtime.GOOS {
+		case "linux":
+			runCommand(out, "systemctl", "--user", "disable", "--now", systemdUnitName)
+		case "darwin":
+			runCommand(out, "launchctl", "unload", "-w", path)
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		fmt.Fprintf(out, "Removed %s\n", path)
+		return nil
+	}
+
+	definition, err := currentService()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	tmpl := systemdUnit
+	if runtime.GOOS == "darwin" {
+		tmpl = launchdAgent
+	}
+	err = tmpl.Execute(file, definition)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Wrote %s\n", path)
+
+	if runtime.GOOS == "darwin" {
+		return runCommand(out, "launchctl", "load", "-w", path)
+	}
+	if err := runCommand(out, "systemctl", "--user", "daemon-reload"); err != nil {
+		return err
+	}
+	return runCommand(out, "systemctl", "--user", "enable", "--now", systemdUnitName)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// defaultFiles are built into the binary so it runs without any files next to it.
+// A file of the same name on disk overrides each of them.
+//
+//go:embed defaults/system_prompt.txt defaults/starter_rules.json
+var defaultFiles embed.FS
+
+// readDefaultFile reads name from disk, next to the executable or in the working
+// directory, falling back to the built-in copy
+func readDefaultFile(name string) ([]byte, error) {
+	data, err := os.ReadFile(locateFile(name))
+	if err == nil {
+		return data, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return defaultFiles.ReadFile("defaults/" + name)
+}
+
+// builtInRules are the rules used until the rules file exists. They are embedded
+// on first use and saved with the first rule change.
+func builtInRules() ([]ActivityRule, error) {
+	data, err := defaultFiles.ReadFile("defaults/starter_rules.json")
+	if err != nil {
+		return nil, err
+	}
+
+	var starter []ActivityRule
+	if err := json.Unmarshal(data, &starter); err != nil {
+		return nil, fmt.Errorf("couldn't parse starter rules: %v", err)
+	}
+	return starter, nil
+}
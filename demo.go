@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// demoDir holds the demo data so it never mixes with real entries
+const demoDir = "aidea_demo"
+
+// demoDays is how many past working days are seeded with entries
+const demoDays = 10
+
+// demoEntry is a sample entry, a blank Confidence leaves it for /categorize
+type demoEntry struct {
+	Description string
+	Timespan    string
+	Task        string
+	Jira        string
+	Confidence  string
+}
+
+// demoEntryPool is cycled through to fill each demo day
+var demoEntryPool = []demoEntry{
+	{"Daily standup", "15m", "Meetings", "", "high"},
+	{"Fix login redirect bug", "1h30m", "Development", "DEMO-101", "high"},
+	{"Review pull request for search filters", "45m", "Code Review", "DEMO-98", "high"},
+	{"Implement CSV export for reports", "2h", "Development", "DEMO-104", "high"},
+	{"Answer support emails", "30m", "Administration", "", "medium"},
+	{"Sprint planning meeting", "1h", "Meetings", "", "high"},
+	{"Update API docs for the v2 endpoints", "1h", "Documentation", "DEMO-99", "high"},
+	{"Refactor notification service", "2h30m", "Development", "DEMO-107", "medium"},
+	{"1:1 with team lead", "30m", "Meetings", "", "high"},
+	{"Review onboarding guide", "40m", "Code Review", "", "medium"},
+	{"Investigate flaky integration test", "1h15m", "Development", "DEMO-110", "low"},
+	{"Expense report", "20m", "Administration", "", "low"},
+}
+
+// demoPending are logged today without a category so the categorize and review flow has work
+var demoPending = []demoEntry{
+	{Description: "Fix timezone bug in weekly summary", Timespan: "1h"},
+	{Description: "Quick sync with design about the dashboard", Timespan: "30m"},
+}
+
+// demoCategories seed the taxonomy with display metadata
+var demoCategories = []Category{
+	{Name: "Development", Aliases: []string{"Dev"}, Color: "#4e79a7", Icon: "💻"},
+	{Name: "Code Review", Aliases: []string{"Review"}, Color: "#f28e2b", Icon: "🔍"},
+	{Name: "Meetings", Aliases: []string{"Meeting"}, Color: "#e15759", Icon: "📅"},
+	{Name: "Documentation", Aliases: []string{"Docs"}, Color: "#76b7b2", Icon: "📝"},
+	{Name: "Administration", Aliases: []string{"Admin"}, Color: "#59a14f", Icon: "📋"},
+}
+
+// demoRules seed the rule pipeline
+var demoRules = []ActivityRule{
+	{Name: "Development", Description: "Writing, fixing or refactoring code", Keywords: []string{"fix", "bug", "implement", "refactor"}, Task: "Development", Jira: "DEMO"},
+	{Name: "Code Review", Description: "Reviewing pull requests and other people's work", Keywords: []string{"review", "pull request"}, Task: "Code Review"},
+	{Name: "Meetings", Description: "Standups, planning, syncs and 1:1s", Keywords: []string{"standup", "meeting", "sync", "1:1"}, Task: "Meetings"},
+	{Name: "Documentation", Description: "Writing and updating docs and guides", Keywords: []string{"docs", "guide", "readme"}, Task: "Documentation"},
+	{Name: "Administration", Description: "Email, expenses and other admin work", Keywords: []string{"email", "expense"}, Task: "Administration"},
+}
+
+// demoConfig switches to the demo directory and returns the configuration for
+// demo mode: the defaults with the mock provider, ignoring config.json
+func demoConfig() (Config, error) {
+	if err := os.MkdirAll(demoDir, 0755); err != nil {
+		return Config{}, fmt.Errorf("couldn't create %s: %v", demoDir, err)
+	}
+	if err := os.Chdir(demoDir); err != nil {
+		return Config{}, fmt.Errorf("couldn't switch to %s: %v", demoDir, err)
+	}
+	// Demo embeddings mustn't mix with the real ones
+	appDirs.Cache, _ = os.Getwd()
+
+	config := defaultConfig()
+	config.LLM.Provider = "mock"
+	return config, nil
+}
+
+// seedDemoData fills an empty demo directory with sample categories, rules and entries
+func seedDemoData(ctx context.Context) error {
+	existing, err := dataFiles()
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	categoriesMu.Lock()
+	categories = []Category{}
+	for _, category := range demoCategories {
+		category.ID = uuid.New().String()
+		category.Description = "Sample " + strings.ToLower(category.Name) + " category"
+		categories = append(categories, category)
+	}
+	err = saveCategories()
+	categoriesMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	rulesMu.Lock()
+	rules = []ActivityRule{}
+	for _, rule := range demoRules {
+		rule.ID = uuid.New().String()
+		rule.UpdatedAt = now
+		rules = append(rules, rule)
+	}
+	err = saveRules()
+	rulesMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Walk back over working days, cycling through the pool so days differ
+	today := storageToday()
+	next := 0
+	for day, seeded := today.AddDate(0, 0, -1), 0; seeded < demoDays; day = day.AddDate(0, 0, -1) {
+		if !currentConfig().WorkingHours.WorksOn(day.Weekday()) {
+			continue
+		}
+		seeded++
+
+		start := time.Date(day.Year(), day.Month(), day.Day(), 9, 0, 0, 0, day.Location())
+		for i := 0; i < 5; i++ {
+			sample := demoEntryPool[next%len(demoEntryPool)]
+			next++
+
+			if err := appendEntry(ctx, day, demoTimeEntry(sample, start.Add(time.Duration(i)*90*time.Minute))); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, sample := range demoPending {
+		if err := appendEntry(ctx, today, demoTimeEntry(sample, now)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// demoTimeEntry builds an entry from a sample, treating confident samples as reviewed
+func demoTimeEntry(sample demoEntry, createdAt time.Time) TimeEntry {
+	entry := TimeEntry{
+		ID:          uuid.New().String(),
+		CreatedAt:   createdAt.UTC().Format(time.RFC3339),
+		Timespan:    sample.Timespan,
+		Description: sample.Description,
+		Task:        sample.Task,
+		Jira:        sample.Jira,
+		Confidence:  sample.Confidence,
+		Categorized: sample.Confidence != "" && autoAccepted(sample.Confidence),
+	}
+	if sample.Task != "" {
+		entry.TaskReason = "Sample entry"
+	}
+	return entry
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+)
+
+// publishDiagnostics registers runtime gauges served by /debug/vars
+// alongside the standard cmdline and memstats variables
+func publishDiagnostics() {
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+
+	expvar.Publish("caches", expvar.Func(func() interface{} {
+		epicCacheMu.Lock()
+		epics := len(epicCache)
+		epicCacheMu.Unlock()
+
+		oidcMu.Lock()
+		sessionCount := len(sessions)
+		introspectionCount := len(introspections)
+		oidcMu.Unlock()
+
+		tokensMu.Lock()
+		tokenCount := len(managedTokens)
+		tokensMu.Unlock()
+
+		return map[string]int{
+			"jira_epics":         epics,
+			"sso_sessions":       sessionCount,
+			"sso_introspections": introspectionCount,
+			"managed_tokens":     tokenCount,
+		}
+	}))
+
+	expvar.Publish("entry_cache", expvar.Func(func() interface{} {
+		return entriesCache.stats()
+	}))
+
+	expvar.Publish("circuit_breakers", expvar.Func(func() interface{} {
+		return breakerStatuses()
+	}))
+
+	expvar.Publish("dirs", expvar.Func(func() interface{} {
+		return appDirs
+	}))
+
+	expvar.Publish("prompt_leaks", expvar.Func(func() interface{} {
+		return promptLeakStats()
+	}))
+
+	expvar.Publish("queues", expvar.Func(func() interface{} {
+		return map[string]int{
+			"trace_spans":    len(spanQueue),
+			"categorization": categorizationQueueDepth(),
+		}
+	}))
+}
+
+// registerDiagnostics exposes pprof and expvar on the mux, restricted to admins
+func registerDiagnostics(mux *http.ServeMux) {
+	publishDiagnostics()
+
+	admin := func(handler http.HandlerFunc) http.HandlerFunc {
+		return requireRole(RoleAdmin, ScopeAdmin, handler)
+	}
+
+	mux.HandleFunc("/debug/vars", admin(expvar.Handler().ServeHTTP))
+	mux.HandleFunc("/debug/pprof/", admin(pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", admin(pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", admin(pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", admin(pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", admin(pprof.Trace))
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// appName names the tracker's directories under the OS locations
+const appName = "aidea"
+
+// AppDirs are where the tracker keeps its files
+type AppDirs struct {
+	// Config holds config.json and prompt overrides
+	Config string `json:"config"`
+	// Data holds the entry CSVs, rules, categories and other state, it is the working directory
+	Data string `json:"data"`
+	// Cache holds files that can be regenerated, like entry embeddings
+	Cache string `json:"cache"`
+	// Logs holds the log files of the daemon
+	Logs string `json:"logs"`
+	// Legacy is set when an existing working directory with tracker files is used for everything
+	Legacy bool `json:"legacy,omitempty"`
+}
+
+// appDirs is set by useAppDirs at startup
+var appDirs AppDirs
+
+// userDataDir is the OS location for application data, $XDG_DATA_HOME on Linux
+func userDataDir() (string, error) {
+	switch runtime.GOOS {
+	case "windows":
+		if dir := os.Getenv("LocalAppData"); dir != "" {
+			return dir, nil
+		}
+		return "", fmt.Errorf("%%LocalAppData%% is not set")
+	case "darwin":
+		return os.UserConfigDir()
+	default:
+		if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+			return dir, nil
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, ".local", "share"), nil
+	}
+}
+
+// userLogDir is the OS location for logs, $XDG_STATE_HOME on Linux
+func userLogDir(data string) (string, error) {
+	switch runtime.GOOS {
+	case "windows":
+		return filepath.Join(data, "logs"), nil
+	case "darwin":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, "Library", "Logs", appName), nil
+	default:
+		if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+			return filepath.Join(dir, appName), nil
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, ".local", "state", appName), nil
+	}
+}
+
+// dataDirArgument returns the directory given with --data-dir DIR or --data-dir=DIR
+// and the arguments without it
+func dataDirArgument(args []string) (string, []string) {
+	for i, arg := range args {
+		if value, found := strings.CutPrefix(arg, "--data-dir="); found {
+			return value, slices.Delete(slices.Clone(args), i, i+1)
+		}
+		if arg == "--data-dir" && i+1 < len(args) {
+			return args[i+1], slices.Delete(slices.Clone(args), i, i+2)
+		}
+	}
+	return "", args
+}
+
+// hasTrackerFiles reports whether a directory was used by an earlier version that
+// kept everything in the working directory
+func hasTrackerFiles(dir string) bool {
+	for _, pattern := range []string{"config.json", rulesFile, "aidea_time_tracking_*.csv"} {
+		if matches, _ := filepath.Glob(filepath.Join(dir, pattern)); len(matches) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveAppDirs picks the directories: everything in --data-dir when given, the
+// working directory when it already has tracker files, the OS locations otherwise
+func resolveAppDirs(dir string) (AppDirs, error) {
+	if dir != "" {
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			return AppDirs{}, err
+		}
+		return AppDirs{Config: dir, Data: dir, Cache: dir, Logs: dir}, nil
+	}
+
+	working, err := os.Getwd()
+	if err != nil {
+		return AppDirs{}, err
+	}
+	if hasTrackerFiles(working) {
+		return AppDirs{Config: working, Data: working, Cache: working, Logs: working, Legacy: true}, nil
+	}
+
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return AppDirs{}, err
+	}
+	data, err := userDataDir()
+	if err != nil {
+		return AppDirs{}, err
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return AppDirs{}, err
+	}
+	dirs := AppDirs{
+		Config: filepath.Join(config, appName),
+		Data:   filepath.Join(data, appName),
+		Cache:  filepath.Join(cache, appName),
+	}
+	if dirs.Logs, err = userLogDir(dirs.Data); err != nil {
+		return AppDirs{}, err
+	}
+	return dirs, nil
+}
+
+// useAppDirs creates the tracker's directories and makes the data directory the
+// working directory, which the data files are read and written relative to. It
+// returns the arguments without --data-dir.
+func useAppDirs(args []string) ([]string, error) {
+	dir, args := dataDirArgument(args)
+	dirs, err := resolveAppDirs(dir)
+	if err != nil {
+		return args, fmt.Errorf("couldn't find the data directory: %v", err)
+	}
+
+	for _, dir := range []string{dirs.Config, dirs.Data, dirs.Cache, dirs.Logs} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return args, fmt.Errorf("couldn't create %s: %v", dir, err)
+		}
+	}
+	if err := os.Chdir(dirs.Data); err != nil {
+		return args, fmt.Errorf("couldn't switch to %s: %v", dirs.Data, err)
+	}
+
+	appDirs = dirs
+	if dirs.Legacy {
+		log.Printf("Keeping data in %s, which has files from an earlier version", dirs.Data)
+	}
+	return args, nil
+}
+
+// cachePath places a regenerable file in the cache directory
+func cachePath(name string) string {
+	if appDirs.Cache == "" {
+		return name
+	}
+	return filepath.Join(appDirs.Cache, name)
+}
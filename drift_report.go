@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// maxDriftExamples limits the far entries quoted in a drift report
+const maxDriftExamples = 10
+
+// DriftConfig controls the check for entries no rule is close to
+type DriftConfig struct {
+	// CheckHours is how often the check runs in the background, 0 disables it
+	CheckHours int `json:"check_hours"`
+	// Days is the length of the recent window, compared with the window before it
+	Days int `json:"days"`
+	// WarnShare is the share of far entries, from 0 to 1, that is warned about
+	// once it has grown since the previous window
+	WarnShare float64 `json:"warn_share"`
+}
+
+// DriftExample is a recent entry far from every rule
+type DriftExample struct {
+	Description string  `json:"description"`
+	Date        string  `json:"date"`
+	Similarity  float64 `json:"similarity"`
+	NearestRule string  `json:"nearest_rule,omitempty"`
+}
+
+// DriftReport compares how many recent entries are far from every rule with the window before
+type DriftReport struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Threshold is the similarity below which an entry counts as far, the rules' min_score
+	Threshold        float64        `json:"threshold"`
+	Entries          int            `json:"entries"`
+	FarEntries       int            `json:"far_entries"`
+	FarShare         float64        `json:"far_share"`
+	PreviousEntries  int            `json:"previous_entries"`
+	PreviousFarShare float64        `json:"previous_far_share"`
+	Drifting         bool           `json:"drifting"`
+	Examples         []DriftExample `json:"examples"`
+	Errors           []string       `json:"errors,omitempty"`
+}
+
+// driftWindow counts the entries between from and to far from every rule
+func driftWindow(ctx context.Context, all []ActivityRule, from, to time.Time, threshold float64) (entries, far int, examples []DriftExample, errors []string) {
+	loaded, err := readEntriesBetween(ctx, from, to)
+	if err != nil {
+		return 0, 0, nil, []string{fmt.Sprintf("Error reading entries: %v", err)}
+	}
+
+	for _, entry := range loaded {
+		if entry.Description == "" {
+			continue
+		}
+		vector, err := entryVector(ctx, entry)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("Error embedding entry ID %s: %v", entry.ID, err))
+			continue
+		}
+
+		nearest, best := "", math.Inf(-1)
+		var mismatch error
+		for _, rule := range all {
+			if mismatch = ruleDimensionError(rule, vector); mismatch != nil {
+				break
+			}
+			if similarity := cosineSimilarity(vector, rule.Embedding); similarity > best {
+				nearest, best = rule.Name, similarity
+			}
+		}
+		if mismatch != nil {
+			errors = append(errors, fmt.Sprintf("Error comparing entry ID %s: %v", entry.ID, mismatch))
+			continue
+		}
+
+		entries++
+		if best < threshold {
+			far++
+			examples = append(examples, DriftExample{
+				Description: entry.Description,
+				Date:        entry.Date,
+				Similarity:  math.Round(best*1000) / 1000,
+				NearestRule: nearest,
+			})
+		}
+	}
+
+	return entries, far, examples, errors
+}
+
+// buildDriftReport checks the entries of the recent window ending on day, and the
+// window before it, against the rule embeddings
+func buildDriftReport(ctx context.Context, day time.Time) (*DriftReport, error) {
+	config := currentConfig().Rules.Drift
+	days := config.Days
+	if days < 1 {
+		days = 7
+	}
+
+	all, err := listRules()
+	if err != nil {
+		return nil, err
+	}
+	if len(all) == 0 {
+		return nil, fmt.Errorf("there are no rules to compare entries with")
+	}
+
+	// Rules embedded with another model are embedded again on the fly, like scoreRules does
+	for i := range all {
+		if len(all[i].Embedding) == 0 || all[i].EmbeddingModel != currentConfig().LLM.EmbeddingModel {
+			if err := embedRule(ctx, &all[i]); err != nil {
+				return nil, fmt.Errorf("error embedding rule %s: %v", all[i].Name, err)
+			}
+		}
+	}
+
+	from := day.AddDate(0, 0, 1-days)
+	report := &DriftReport{
+		From:      from.Format("20060102"),
+		To:        day.Format("20060102"),
+		Threshold: currentConfig().Rules.MinScore,
+		Examples:  []DriftExample{},
+	}
+
+	var far int
+	var examples []DriftExample
+	report.Entries, far, examples, report.Errors = driftWindow(ctx, all, from, day, report.Threshold)
+	previousEntries, previousFar, _, previousErrors := driftWindow(ctx, all, from.AddDate(0, 0, -days), from.AddDate(0, 0, -1), report.Threshold)
+	report.Errors = append(report.Errors, previousErrors...)
+
+	report.FarEntries = far
+	report.PreviousEntries = previousEntries
+	if report.Entries > 0 {
+		report.FarShare = math.Round(float64(far)/float64(report.Entries)*1000) / 1000
+	}
+	if previousEntries > 0 {
+		report.PreviousFarShare = math.Round(float64(previousFar)/float64(previousEntries)*1000) / 1000
+	}
+
+	warnShare := config.WarnShare
+	if warnShare <= 0 {
+		warnShare = 0.3
+	}
+	report.Drifting = report.Entries > 0 && report.FarShare >= warnShare && report.FarShare > report.PreviousFarShare
+
+	// The farthest entries show best what the rules are missing
+	sort.SliceStable(examples, func(i, j int) bool { return examples[i].Similarity < examples[j].Similarity })
+	if len(examples) > maxDriftExamples {
+		examples = examples[:maxDriftExamples]
+	}
+	report.Examples = append(report.Examples, examples...)
+
+	return report, nil
+}
+
+// startDriftMonitor checks for drift every CheckHours and warns through the log
+// and the event bus, so a webhook sink subscribed to rules.drift is notified
+func startDriftMonitor(config DriftConfig) {
+	if config.CheckHours <= 0 {
+		return
+	}
+
+	check := func() {
+		report, err := buildDriftReport(context.Background(), storageToday())
+		if err != nil {
+			log.Printf("Error checking rule drift: %v", err)
+			return
+		}
+		if report.Drifting {
+			log.Printf("Rule drift: %.0f%% of entries from %s to %s are far from every rule (%.0f%% the period before), the rules may be stale",
+				report.FarShare*100, report.From, report.To, report.PreviousFarShare*100)
+			publishEvent(EventRulesDrift, report)
+		}
+	}
+
+	go func() {
+		check()
+		for range time.Tick(time.Duration(config.CheckHours) * time.Hour) {
+			check()
+		}
+	}()
+}
+
+// driftReportHandler reports how many entries of the window ending on ?date=YYYYMMDD
+// (default today) are far from every rule, against the window before it
+func driftReportHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	day, err := resolveEntryDay(r.URL.Query().Get("date"), currentUser(r).Name)
+	if err != nil {
+		writeValidationError(w, r, ErrorDetail{Field: "date", Message: err.Error()})
+		return
+	}
+
+	report, err := buildDriftReport(r.Context(), day)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
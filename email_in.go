@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/mail"
+	"strings"
+)
+
+// EmailInConfig controls entry creation from inbound email
+type EmailInConfig struct {
+	// Secret must be sent as the token query parameter by the mail provider
+	Secret string `json:"secret"`
+	// SubjectPrefix marks emails meant for the tracker, e.g. "track"
+	SubjectPrefix  string   `json:"subject_prefix"`
+	AllowedSenders []string `json:"allowed_senders"`
+	// SenderUsers maps a sender address to the user its entries belong to, unmapped
+	// senders log as the local user
+	SenderUsers map[string]string `json:"sender_users,omitempty"`
+}
+
+// inboundEmail is the normalized form of an email regardless of how it was delivered
+type inboundEmail struct {
+	From    string `json:"from"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+}
+
+// parseInboundEmail accepts raw RFC 822 messages, JSON payloads, or provider form posts
+func parseInboundEmail(r *http.Request, body []byte) (*inboundEmail, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "application/json":
+		var email inboundEmail
+		if err := json.Unmarshal(body, &email); err != nil {
+			return nil, fmt.Errorf("error parsing JSON: %v", err)
+		}
+		return &email, nil
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if err := r.ParseMultipartForm(1 << 20); err != nil && err != http.ErrNotMultipart {
+			return nil, fmt.Errorf("error parsing form: %v", err)
+		}
+		// Field names used by Mailgun and SendGrid inbound parse
+		email := &inboundEmail{
+			From:    firstNonEmpty(r.FormValue("sender"), r.FormValue("from")),
+			Subject: r.FormValue("subject"),
+			Text:    firstNonEmpty(r.FormValue("body-plain"), r.FormValue("text")),
+		}
+		return email, nil
+	default:
+		message, err := mail.ReadMessage(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing message: %v", err)
+		}
+
+		text, err := io.ReadAll(message.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error reading message body: %v", err)
+		}
+
+		decoder := new(mime.WordDecoder)
+		subject, err := decoder.DecodeHeader(message.Header.Get("Subject"))
+		if err != nil {
+			subject = message.Header.Get("Subject")
+		}
+
+		return &inboundEmail{
+			From:    message.Header.Get("From"),
+			Subject: subject,
+			Text:    string(text),
+		}, nil
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// senderAllowed checks the sender address against the configured allow-list
+func senderAllowed(from string) bool {
+	if len(currentConfig().EmailIn.AllowedSenders) == 0 {
+		return true
+	}
+
+	address, err := mail.ParseAddress(from)
+	if err != nil {
+		return false
+	}
+
+	for _, allowed := range currentConfig().EmailIn.AllowedSenders {
+		if strings.EqualFold(allowed, address.Address) {
+			return true
+		}
+	}
+	return false
+}
+
+// senderUser returns the user mapped to the sender address, "" for the local user
+func senderUser(from string) string {
+	address, err := mail.ParseAddress(from)
+	if err != nil {
+		return ""
+	}
+
+	for sender, user := range currentConfig().EmailIn.SenderUsers {
+		if strings.EqualFold(sender, address.Address) {
+			return user
+		}
+	}
+	return ""
+}
+
+// emailEntryText extracts "code review 30m" from a subject like "track — code review 30m",
+// falling back to the first line of the body when the subject only holds the prefix
+func emailEntryText(email *inboundEmail) (string, bool) {
+	subject := strings.TrimSpace(email.Subject)
+	prefix := currentConfig().EmailIn.SubjectPrefix
+
+	if prefix != "" {
+		// Compare the subject's own leading bytes, lowercasing can change its length
+		if len(subject) < len(prefix) || !strings.EqualFold(subject[:len(prefix)], prefix) {
+			return "", false
+		}
+		subject = strings.TrimLeft(subject[len(prefix):], " \t-–—:")
+	}
+
+	if subject != "" {
+		return subject, true
+	}
+
+	for _, line := range strings.Split(email.Text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line, true
+		}
+	}
+
+	return "", true
+}
+
+func emailInHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(currentConfig().EmailIn.Secret)) != 1 {
+		writeError(w, r, http.StatusUnauthorized, "Invalid token")
+		return
+	}
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	email, err := parseInboundEmail(r, body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !senderAllowed(email.From) {
+		writeError(w, r, http.StatusForbidden, "Sender not allowed")
+		return
+	}
+
+	text, matched := emailEntryText(email)
+	if !matched {
+		// Not addressed to the tracker, acknowledge so the provider doesn't retry
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Email ignored, subject prefix not found",
+		})
+		return
+	}
+
+	entry, err := logMessageEntry(r.Context(), text, senderUser(email.From))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error logging entry: "+err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(localizeEntry(*entry, userLocation(entryOwner(*entry))))
+}
@@ -0,0 +1,657 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	importJobsFile = "aidea_import_jobs.json"
+	importDir      = "aidea_imports"
+
+	// importCheckpointRows is how many rows are processed between saves of a job's
+	// progress. A job interrupted by a crash resumes from its last checkpoint.
+	importCheckpointRows = 100
+
+	// maxImportLineBytes limits a single NDJSON line
+	maxImportLineBytes = 1024 * 1024
+)
+
+// Import job statuses
+const (
+	ImportQueued      = "queued"
+	ImportRunning     = "running"
+	ImportCompleted   = "completed"
+	ImportFailed      = "failed"
+	ImportInterrupted = "interrupted"
+)
+
+// Import file formats
+const (
+	ImportCSV    = "csv"
+	ImportNDJSON = "ndjson"
+)
+
+// ImportJob is a background import of an uploaded CSV or NDJSON file of entries
+type ImportJob struct {
+	ID        string    `json:"id"`
+	User      string    `json:"user"`
+	Format    string    `json:"format"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Size and Offset are the file size and the bytes read so far
+	Size    int64   `json:"size"`
+	Offset  int64   `json:"offset"`
+	Percent float64 `json:"percent"`
+	// Rows counts the rows processed, a resumed job skips them
+	Rows     int    `json:"rows"`
+	Imported int    `json:"imported"`
+	Failed   int    `json:"failed"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ImportRowError is a row that couldn't be imported, listed in the job's error report.
+// Rows are numbered from 1, not counting the CSV header.
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *ImportRowError) Error() string {
+	return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+}
+
+// importReader yields the entries of an uploaded file one row at a time
+type importReader interface {
+	// next returns the next row's entry, or io.EOF after the last row. A malformed
+	// row returns an *ImportRowError and reading continues with the following row.
+	next() (TimeEntry, error)
+	// offset is the number of bytes consumed so far
+	offset() int64
+}
+
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVImportReader(r io.Reader) (*csvImportReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	// Data files start with a schema version comment
+	reader.Comment = '#'
+
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %v", err)
+	}
+	columns := csvColumns(headers)
+	if _, found := columns["description"]; !found {
+		return nil, fmt.Errorf("CSV needs a description column, columns are named as in the data files: %s", strings.Join(csvHeaders, ", "))
+	}
+	if _, found := columns["date"]; !found {
+		return nil, fmt.Errorf("CSV needs a date column")
+	}
+
+	return &csvImportReader{reader: reader, columns: columns}, nil
+}
+
+func (c *csvImportReader) next() (TimeEntry, error) {
+	record, err := c.reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return TimeEntry{}, &ImportRowError{Message: parseErr.Err.Error()}
+	}
+	if err != nil {
+		return TimeEntry{}, err
+	}
+	return recordEntry(c.columns, record), nil
+}
+
+func (c *csvImportReader) offset() int64 {
+	return c.reader.InputOffset()
+}
+
+type ndjsonImportReader struct {
+	scanner *bufio.Scanner
+	read    int64
+}
+
+func newNDJSONImportReader(r io.Reader) *ndjsonImportReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLineBytes)
+	return &ndjsonImportReader{scanner: scanner}
+}
+
+func (n *ndjsonImportReader) next() (TimeEntry, error) {
+	for n.scanner.Scan() {
+		line := n.scanner.Bytes()
+		n.read += int64(len(line)) + 1
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		var entry TimeEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return TimeEntry{}, &ImportRowError{Message: "invalid JSON: " + err.Error()}
+		}
+		// Exports from before confidences were unified may hold letter grades
+		entry.Confidence = normalizeConfidence(entry.Confidence)
+		return entry, nil
+	}
+
+	if err := n.scanner.Err(); err != nil {
+		return TimeEntry{}, fmt.Errorf("error reading NDJSON: %v", err)
+	}
+	return TimeEntry{}, io.EOF
+}
+
+func (n *ndjsonImportReader) offset() int64 {
+	return n.read
+}
+
+var (
+	importJobsMu sync.Mutex
+	importJobs   []ImportJob
+)
+
+// loadImportJobs reads the jobs file once, callers must hold importJobsMu. Jobs
+// still marked queued or running were cut short by a restart and can be resumed.
+func loadImportJobs() error {
+	if importJobs != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(importJobsFile)
+	if os.IsNotExist(err) {
+		importJobs = []ImportJob{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read import jobs: %v", err)
+	}
+
+	var loaded []ImportJob
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("couldn't parse import jobs: %v", err)
+	}
+
+	for i := range loaded {
+		if loaded[i].Status == ImportQueued || loaded[i].Status == ImportRunning {
+			loaded[i].Status = ImportInterrupted
+		}
+	}
+
+	importJobs = loaded
+	return nil
+}
+
+// saveImportJob stores a job's current state in the jobs file
+func saveImportJob(job *ImportJob) error {
+	importJobsMu.Lock()
+	defer importJobsMu.Unlock()
+
+	if err := loadImportJobs(); err != nil {
+		return err
+	}
+
+	job.UpdatedAt = time.Now()
+	if job.Size > 0 {
+		job.Percent = math.Round(float64(job.Offset)/float64(job.Size)*1000) / 10
+	}
+
+	index := slices.IndexFunc(importJobs, func(existing ImportJob) bool { return existing.ID == job.ID })
+	if index == -1 {
+		importJobs = append(importJobs, *job)
+	} else {
+		importJobs[index] = *job
+	}
+
+	data, err := json.MarshalIndent(importJobs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't encode import jobs: %v", err)
+	}
+
+	return os.WriteFile(importJobsFile, data, 0644)
+}
+
+// findImportJob returns a user's import job
+func findImportJob(user, id string) (*ImportJob, error) {
+	importJobsMu.Lock()
+	defer importJobsMu.Unlock()
+
+	if err := loadImportJobs(); err != nil {
+		return nil, err
+	}
+
+	for _, job := range importJobs {
+		if job.ID == id && job.User == user {
+			return &job, nil
+		}
+	}
+	return nil, nil
+}
+
+func importFilePath(job *ImportJob) string {
+	return filepath.Join(importDir, job.ID+"."+job.Format)
+}
+
+func importErrorsPath(job *ImportJob) string {
+	return filepath.Join(importDir, job.ID+"_errors.csv")
+}
+
+// appendImportErrors adds rows to the job's error report
+func appendImportErrors(job *ImportJob, rowErrors []ImportRowError) error {
+	if len(rowErrors) == 0 {
+		return nil
+	}
+
+	filename := importErrorsPath(job)
+	_, statErr := os.Stat(filename)
+
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("couldn't open error report: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if os.IsNotExist(statErr) {
+		writer.Write([]string{"row", "field", "message"})
+	}
+	for _, rowError := range rowErrors {
+		writer.Write([]string{strconv.Itoa(rowError.Row), rowError.Field, rowError.Message})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// importRow validates and stores one row. Rows within recheck of a resumed job
+// may already have been stored before the interruption and are skipped when found.
+func importRow(ctx context.Context, job *ImportJob, user *User, row int, entry TimeEntry, recheck bool) []ImportRowError {
+	rowError := func(field, format string, args ...interface{}) []ImportRowError {
+		return []ImportRowError{{Row: row, Field: field, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	details := validateEntry(entry)
+	v := &validator{}
+	for _, tag := range entry.Tags {
+		v.tag("tags", tag)
+	}
+	details = append(details, v.details...)
+	if len(details) > 0 {
+		rowErrors := []ImportRowError{}
+		for _, detail := range details {
+			rowErrors = append(rowErrors, ImportRowError{Row: row, Field: detail.Field, Message: detail.Message})
+		}
+		return rowErrors
+	}
+
+	owner := entryUserName(user)
+	if entry.User != "" && entry.User != owner && !user.HasRole(RoleAdmin) {
+		return rowError("user", "only admins can import entries of other users")
+	}
+	if entry.User == "" {
+		entry.User = owner
+	}
+
+	location := userLocation(entryOwner(entry))
+	day, err := time.ParseInLocation("2006-01-02", entry.Date, location)
+	if err != nil {
+		day, err = time.ParseInLocation("20060102", entry.Date, location)
+	}
+	if err != nil {
+		return rowError("date", "date must be in YYYY-MM-DD or YYYYMMDD format")
+	}
+
+	// Rows without an ID get one derived from the job and row, so a resumed job
+	// recognizes what it already stored
+	if entry.ID == "" {
+		entry.ID = uuid.NewSHA1(uuid.NameSpaceOID, []byte(job.ID+":"+strconv.Itoa(row))).String()
+	}
+	entry.DeletedAt = ""
+
+	if recheck {
+		existing, err := readDayEntries(day)
+		if err != nil && !os.IsNotExist(err) {
+			return rowError("", "error reading entries: %v", err)
+		}
+		if slices.ContainsFunc(existing, func(e TimeEntry) bool { return e.ID == entry.ID }) {
+			job.Imported++
+			return nil
+		}
+	}
+
+	if err := appendEntry(ctx, day, entry); err != nil {
+		return rowError("", "%v", err)
+	}
+	job.Imported++
+	return nil
+}
+
+// runImportJob reads the job's file row by row, skipping the rows processed before
+// it was interrupted, and checkpoints its progress and error report as it goes
+func runImportJob(job ImportJob, user *User) {
+	ctx := context.Background()
+
+	fail := func(err error) {
+		job.Status = ImportFailed
+		job.Error = err.Error()
+		if err := saveImportJob(&job); err != nil {
+			log.Printf("Error saving import job %s: %v", job.ID, err)
+		}
+	}
+
+	file, err := os.Open(importFilePath(&job))
+	if err != nil {
+		fail(fmt.Errorf("couldn't open import file: %v", err))
+		return
+	}
+	defer file.Close()
+
+	var reader importReader
+	if job.Format == ImportCSV {
+		reader, err = newCSVImportReader(bufio.NewReader(file))
+		if err != nil {
+			fail(err)
+			return
+		}
+	} else {
+		reader = newNDJSONImportReader(file)
+	}
+
+	resumeFrom := job.Rows
+	job.Status = ImportRunning
+	job.Error = ""
+	if err := saveImportJob(&job); err != nil {
+		log.Printf("Error saving import job %s: %v", job.ID, err)
+	}
+
+	pending := []ImportRowError{}
+	checkpoint := func(row int) error {
+		if err := appendImportErrors(&job, pending); err != nil {
+			return err
+		}
+		pending = pending[:0]
+		job.Rows = row
+		job.Offset = reader.offset()
+		return saveImportJob(&job)
+	}
+
+	row := 0
+	for {
+		entry, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+
+		var rowErr *ImportRowError
+		if err != nil && !errors.As(err, &rowErr) {
+			checkpoint(row)
+			fail(err)
+			return
+		}
+
+		row++
+		if row <= resumeFrom {
+			continue
+		}
+
+		var rowErrors []ImportRowError
+		if rowErr != nil {
+			rowErr.Row = row
+			rowErrors = []ImportRowError{*rowErr}
+		} else {
+			recheck := resumeFrom > 0 && row <= resumeFrom+importCheckpointRows
+			rowErrors = importRow(ctx, &job, user, row, entry, recheck)
+		}
+		if len(rowErrors) > 0 {
+			job.Failed++
+			pending = append(pending, rowErrors...)
+		}
+
+		if row%importCheckpointRows == 0 {
+			if err := checkpoint(row); err != nil {
+				fail(err)
+				return
+			}
+		}
+	}
+
+	job.Status = ImportCompleted
+	if err := checkpoint(row); err != nil {
+		fail(err)
+		return
+	}
+	log.Printf("Import job %s completed: %d imported, %d failed", job.ID, job.Imported, job.Failed)
+}
+
+// importFormat picks the file format from ?format= or the Content-Type header
+func importFormat(r *http.Request) string {
+	if format := strings.ToLower(r.URL.Query().Get("format")); format != "" {
+		return format
+	}
+
+	contentType := strings.ToLower(r.Header.Get("Content-Type"))
+	switch {
+	case strings.Contains(contentType, "csv"):
+		return ImportCSV
+	case strings.Contains(contentType, "ndjson"), strings.Contains(contentType, "jsonl"):
+		return ImportNDJSON
+	}
+	return ""
+}
+
+// importEntriesHandler accepts a CSV file (columns named as in the data files) or NDJSON
+// file (one entry object per line) as the request body and imports it in the background.
+// The response is the job, whose progress is polled at /api/v1/import/jobs/{id}.
+func importEntriesHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	format := importFormat(r)
+	v := &validator{}
+	if format == "" {
+		v.add("format", "format is required, send ?format=csv|ndjson or a text/csv or application/x-ndjson body")
+	} else {
+		v.oneOf("format", format, []string{ImportCSV, ImportNDJSON})
+	}
+	if len(v.details) > 0 {
+		writeValidationError(w, r, v.details...)
+		return
+	}
+
+	job := ImportJob{
+		ID:        uuid.New().String(),
+		User:      currentUser(r).Name,
+		Format:    format,
+		Status:    ImportQueued,
+		CreatedAt: time.Now(),
+	}
+
+	// The upload is streamed to disk, it may be far larger than memory allows
+	if err := os.MkdirAll(importDir, 0755); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error storing upload: "+err.Error())
+		return
+	}
+	file, err := os.Create(importFilePath(&job))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error storing upload: "+err.Error())
+		return
+	}
+	job.Size, err = io.Copy(file, r.Body)
+	file.Close()
+	if err != nil {
+		os.Remove(importFilePath(&job))
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return
+	}
+	if job.Size == 0 {
+		os.Remove(importFilePath(&job))
+		writeError(w, r, http.StatusBadRequest, "Request body is empty")
+		return
+	}
+
+	if err := saveImportJob(&job); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	go runImportJob(job, currentUser(r))
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// importJobsHandler lists the current user's import jobs
+func importJobsHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	importJobsMu.Lock()
+	err := loadImportJobs()
+	own := []ImportJob{}
+	for _, job := range importJobs {
+		if job.User == currentUser(r).Name {
+			own = append(own, job)
+		}
+	}
+	importJobsMu.Unlock()
+
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"jobs": own})
+}
+
+// importJobHandler returns an import job's progress
+func importJobHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	job, err := findImportJob(currentUser(r).Name, r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if job == nil {
+		writeError(w, r, http.StatusNotFound, "Import job not found")
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// importJobErrorsHandler downloads the rows of an import job that failed validation as CSV
+func importJobErrorsHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	job, err := findImportJob(currentUser(r).Name, r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if job == nil {
+		writeError(w, r, http.StatusNotFound, "Import job not found")
+		return
+	}
+
+	data, err := os.ReadFile(importErrorsPath(job))
+	if os.IsNotExist(err) {
+		data, err = []byte("row,field,message\n"), nil
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error reading error report: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="import_`+job.ID+`_errors.csv"`)
+	w.Write(data)
+}
+
+// importJobResumeHandler restarts a failed or interrupted import job after the last row it processed
+func importJobResumeHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	user := currentUser(r)
+	id := r.PathValue("id")
+
+	// Claim the job under the lock so it can't be resumed twice
+	importJobsMu.Lock()
+	err := loadImportJobs()
+	index := slices.IndexFunc(importJobs, func(job ImportJob) bool { return job.ID == id && job.User == user.Name })
+	var job ImportJob
+	claimed := false
+	if err == nil && index != -1 {
+		job = importJobs[index]
+		if job.Status == ImportFailed || job.Status == ImportInterrupted {
+			importJobs[index].Status = ImportQueued
+			job.Status = ImportQueued
+			claimed = true
+		}
+	}
+	importJobsMu.Unlock()
+
+	switch {
+	case err != nil:
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	case index == -1:
+		writeError(w, r, http.StatusNotFound, "Import job not found")
+		return
+	case !claimed:
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("Import job is %s, only failed or interrupted jobs can be resumed", job.Status))
+		return
+	}
+
+	go runImportJob(job, user)
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
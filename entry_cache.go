@@ -0,0 +1,161 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// cachedFile is the parsed contents of a data file, valid while the file's size and
+// modification time are unchanged
+type cachedFile struct {
+	entries []TimeEntry
+	size    int64
+	modTime time.Time
+}
+
+// entryCache keeps the data files of the recent window in memory so the entry and
+// report endpoints don't parse the same CSVs on every call. Writes go to disk first
+// and then replace the cached file, older files are always read from disk.
+type entryCache struct {
+	mu    sync.RWMutex
+	files map[string]cachedFile
+	// window holds the file names of the recent days, recomputed when windowKey changes
+	window    map[string]bool
+	windowKey string
+
+	hits   int
+	misses int
+}
+
+var entriesCache = &entryCache{files: make(map[string]cachedFile)}
+
+// recent reports whether a data file covers one of the last CacheDays days, the
+// window is worked out once a day and when the storage layout changes
+func (c *entryCache) recent(filename string) bool {
+	days := currentConfig().Entries.CacheDays
+	if days <= 0 {
+		return false
+	}
+
+	today := storageToday()
+	key := entryDate(today) + "|" + currentConfig().Storage.Rollover + "|" + dataFilenameTemplate() + "|" + strconv.Itoa(days)
+
+	c.mu.RLock()
+	if c.windowKey == key {
+		recent := c.window[filename]
+		c.mu.RUnlock()
+		return recent
+	}
+	c.mu.RUnlock()
+
+	window := make(map[string]bool)
+	// Tomorrow is included for entries logged ahead in a user's time zone
+	for day := today.AddDate(0, 0, -days); !day.After(today.AddDate(0, 0, 1)); day = day.AddDate(0, 0, 1) {
+		window[dataFilename(day)] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.window = window
+	c.windowKey = key
+	for name := range c.files {
+		if !window[name] {
+			delete(c.files, name)
+		}
+	}
+	return window[filename]
+}
+
+// get returns a copy of a file's cached entries if the file is unchanged on disk
+func (c *entryCache) get(filename string, info os.FileInfo) ([]TimeEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.files[filename]
+	if !ok || cached.size != info.Size() || !cached.modTime.Equal(info.ModTime()) {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	return cloneEntries(cached.entries), true
+}
+
+// put caches a copy of a file's entries as of the given file info
+func (c *entryCache) put(filename string, info os.FileInfo, entries []TimeEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files[filename] = cachedFile{entries: cloneEntries(entries), size: info.Size(), modTime: info.ModTime()}
+}
+
+// cloneEntries copies entries along with their tags, links and labels, so callers
+// changing an entry in place can't change the cached one
+func cloneEntries(entries []TimeEntry) []TimeEntry {
+	cloned := slices.Clone(entries)
+	for i := range cloned {
+		cloned[i].Tags = slices.Clone(cloned[i].Tags)
+		cloned[i].Links = slices.Clone(cloned[i].Links)
+		cloned[i].Labels = slices.Clone(cloned[i].Labels)
+	}
+	return cloned
+}
+
+// invalidate drops a file that can no longer be read
+func (c *entryCache) invalidate(filename string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.files, filename)
+}
+
+// stats reports the cache size and hit rate for /debug/vars
+func (c *entryCache) stats() map[string]int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entries := 0
+	for _, cached := range c.files {
+		entries += len(cached.entries)
+	}
+	return map[string]int{"files": len(c.files), "entries": entries, "hits": c.hits, "misses": c.misses}
+}
+
+// readEntries loads every time entry from a CSV file, from memory when the file is
+// in the recent window and hasn't changed since it was cached. Appending an entry
+// changes the file's size, so the next read parses it again.
+func readEntries(filename string) ([]TimeEntry, error) {
+	if !entriesCache.recent(filename) {
+		return readEntriesFile(filename)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		entriesCache.invalidate(filename)
+		return nil, err
+	}
+	if entries, ok := entriesCache.get(filename, info); ok {
+		return entries, nil
+	}
+
+	entries, err := readEntriesFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	// A write between the stat and the read leaves a stale size, so the next read misses
+	entriesCache.put(filename, info, entries)
+	return entries, nil
+}
+
+// cacheWrittenEntries replaces a cached file with the entries just written to it
+func cacheWrittenEntries(filename string, entries []TimeEntry) {
+	if !entriesCache.recent(filename) {
+		return
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		entriesCache.invalidate(filename)
+		return
+	}
+	entriesCache.put(filename, info, entries)
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// entryEmbeddingsFile is kept in the cache directory, the embeddings can be regenerated
+const entryEmbeddingsFile = "aidea_entry_embeddings.json"
+
+// EntryEmbedding is the stored embedding of an entry, kept apart from the CSV data
+// so semantic search, clustering and drift checks don't re-embed history
+type EntryEmbedding struct {
+	EntryID string `json:"entry_id"`
+	User    string `json:"user"`
+	Date    string `json:"date"`
+	// TextHash identifies the embedded text, an entry whose text changed is embedded again
+	TextHash  string    `json:"text_hash"`
+	Model     string    `json:"model"`
+	Embedding Vector    `json:"embedding"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// EntryEmbedProgress is streamed as one JSON line per day, followed by a final line with Finished set
+type EntryEmbedProgress struct {
+	Date     string   `json:"date,omitempty"`
+	Embedded int      `json:"embedded"`
+	Skipped  int      `json:"skipped"`
+	Failed   int      `json:"failed"`
+	Errors   []string `json:"errors,omitempty"`
+	Finished bool     `json:"finished,omitempty"`
+}
+
+var (
+	entryEmbeddingsMu sync.Mutex
+	// entryEmbeddings maps entry IDs to their embedding, loaded by loadEntryEmbeddings
+	entryEmbeddings map[string]EntryEmbedding
+
+	// entryEmbedQueue feeds changed entries to the background embedder
+	entryEmbedQueue chan TimeEntry
+)
+
+// loadEntryEmbeddings reads the entry embeddings file once, callers must hold entryEmbeddingsMu
+func loadEntryEmbeddings() error {
+	if entryEmbeddings != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(cachePath(entryEmbeddingsFile))
+	if os.IsNotExist(err) {
+		entryEmbeddings = make(map[string]EntryEmbedding)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read entry embeddings: %v", err)
+	}
+
+	var loaded []EntryEmbedding
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("couldn't parse entry embeddings: %v", err)
+	}
+
+	entryEmbeddings = make(map[string]EntryEmbedding, len(loaded))
+	for _, embedding := range loaded {
+		entryEmbeddings[embedding.EntryID] = embedding
+	}
+	return nil
+}
+
+// saveEntryEmbeddings writes the entry embeddings file, callers must hold entryEmbeddingsMu.
+// The vectors make the file large, so it isn't indented.
+func saveEntryEmbeddings() error {
+	all := make([]EntryEmbedding, 0, len(entryEmbeddings))
+	for _, embedding := range entryEmbeddings {
+		all = append(all, embedding)
+	}
+
+	data, err := json.Marshal(all)
+	if err != nil {
+		return fmt.Errorf("couldn't encode entry embeddings: %v", err)
+	}
+
+	path := cachePath(entryEmbeddingsFile)
+	tmpName := path + ".tmp"
+	if err := os.WriteFile(tmpName, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
+
+// entryEmbeddingHash identifies the text an entry is embedded from and the model embedding it
+func entryEmbeddingHash(text string) string {
+	sum := sha256.Sum256([]byte(currentConfig().LLM.EmbeddingModel + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+// storedEntryEmbedding returns an entry's embedding if it is current
+func storedEntryEmbedding(entry TimeEntry) (Vector, bool, error) {
+	entryEmbeddingsMu.Lock()
+	defer entryEmbeddingsMu.Unlock()
+
+	if err := loadEntryEmbeddings(); err != nil {
+		return nil, false, err
+	}
+
+	stored, found := entryEmbeddings[entry.ID]
+	if !found || stored.TextHash != entryEmbeddingHash(categorizationText(entry)) {
+		return nil, false, nil
+	}
+	return stored.Embedding, true, nil
+}
+
+// listEntryEmbeddings returns a copy of every stored embedding, or only a user's
+func listEntryEmbeddings(user string) ([]EntryEmbedding, error) {
+	entryEmbeddingsMu.Lock()
+	defer entryEmbeddingsMu.Unlock()
+
+	if err := loadEntryEmbeddings(); err != nil {
+		return nil, err
+	}
+
+	all := []EntryEmbedding{}
+	for _, embedding := range entryEmbeddings {
+		if user == "" || embedding.User == user {
+			all = append(all, embedding)
+		}
+	}
+	return all, nil
+}
+
+// embedEntries embeds the entries whose stored embedding is missing or stale and
+// saves them together, removing the embeddings of deleted entries. It returns how
+// many were embedded and skipped as current, and the errors of those that failed.
+func embedEntries(ctx context.Context, entries []TimeEntry) (embedded, skipped int, failures []string, err error) {
+	type pending struct {
+		entry TimeEntry
+		text  string
+		hash  string
+	}
+
+	entryEmbeddingsMu.Lock()
+	if err := loadEntryEmbeddings(); err != nil {
+		entryEmbeddingsMu.Unlock()
+		return 0, 0, nil, err
+	}
+	removed := []string{}
+	todo := []pending{}
+	for _, entry := range entries {
+		if entry.DeletedAt != "" {
+			if _, found := entryEmbeddings[entry.ID]; found {
+				delete(entryEmbeddings, entry.ID)
+				removed = append(removed, entry.ID)
+			}
+			continue
+		}
+
+		text := categorizationText(entry)
+		hash := entryEmbeddingHash(text)
+		if stored, found := entryEmbeddings[entry.ID]; found && stored.TextHash == hash {
+			skipped++
+			continue
+		}
+		todo = append(todo, pending{entry: entry, text: text, hash: hash})
+	}
+	entryEmbeddingsMu.Unlock()
+
+	// Embedding is slow, so it happens without holding the lock
+	results := []EntryEmbedding{}
+	for _, item := range todo {
+		if ctx.Err() != nil {
+			failures = append(failures, fmt.Sprintf("entry %s: %v", item.entry.ID, ctx.Err()))
+			continue
+		}
+
+		vector, err := embedText(ctx, item.text)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("entry %s: %v", item.entry.ID, err))
+			continue
+		}
+		results = append(results, EntryEmbedding{
+			EntryID:   item.entry.ID,
+			User:      entryOwner(item.entry),
+			Date:      item.entry.Date,
+			TextHash:  item.hash,
+			Model:     currentConfig().LLM.EmbeddingModel,
+			Embedding: vector,
+			UpdatedAt: time.Now().UTC(),
+		})
+	}
+
+	if len(results) == 0 && len(removed) == 0 {
+		return 0, skipped, failures, nil
+	}
+
+	entryEmbeddingsMu.Lock()
+	points := make([]VectorPoint, 0, len(results))
+	for _, result := range results {
+		entryEmbeddings[result.EntryID] = result
+		points = append(points, VectorPoint{ID: result.EntryID, User: result.User, Vector: result.Embedding})
+	}
+	err = saveEntryEmbeddings()
+	entryEmbeddingsMu.Unlock()
+	if err != nil {
+		return 0, skipped, failures, err
+	}
+
+	// The file stays authoritative, a store that missed changes catches up at the next start.
+	// Embeddings already paid for are indexed even when the caller has gone away.
+	ctx = context.WithoutCancel(ctx)
+	if err := upsertVectors(ctx, vectorEntries, points); err != nil {
+		log.Printf("Error indexing entries in the vector store: %v", err)
+	}
+	if err := deleteVectors(ctx, vectorEntries, removed); err != nil {
+		log.Printf("Error removing entries from the vector store: %v", err)
+	}
+	return len(results), skipped, failures, nil
+}
+
+// startEntryEmbedder embeds entries in the background as they are saved
+func startEntryEmbedder(config EntriesConfig) {
+	if !config.Embed {
+		return
+	}
+
+	entryEmbedQueue = make(chan TimeEntry, 256)
+	go func() {
+		for entry := range entryEmbedQueue {
+			// Entries saved together, e.g. by an import, are embedded and saved as one batch
+			batch := []TimeEntry{entry}
+		drain:
+			for len(batch) < 100 {
+				select {
+				case next := <-entryEmbedQueue:
+					batch = append(batch, next)
+				default:
+					break drain
+				}
+			}
+
+			_, _, failures, err := embedEntries(context.Background(), batch)
+			if err != nil {
+				log.Printf("Error saving entry embeddings: %v", err)
+			}
+			for _, failure := range failures {
+				log.Printf("Error embedding %s", failure)
+			}
+		}
+	}()
+}
+
+// queueEntryEmbedding hands a saved entry to the background embedder. When the
+// queue is full the entry is left for the next backfill rather than slowing the write.
+func queueEntryEmbedding(entry TimeEntry) {
+	if entryEmbedQueue == nil {
+		return
+	}
+
+	select {
+	case entryEmbedQueue <- entry:
+	default:
+		log.Printf("Entry embedding queue full, entry %s is left for the next backfill", entry.ID)
+	}
+}
+
+// embedEntriesHandler embeds every entry between ?from= and ?to= (YYYYMMDD, default
+// this week) without a current embedding, e.g. history logged before embeddings were
+// stored or after the embedding model changed. Progress is streamed as
+// newline-delimited JSON, one line per day.
+func embedEntriesHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if !currentConfig().Entries.Embed {
+		writeError(w, r, http.StatusForbidden, "Entry embeddings are not enabled")
+		return
+	}
+
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	controller := http.NewResponseController(w)
+
+	total := EntryEmbedProgress{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if r.Context().Err() != nil {
+			break
+		}
+
+		entries, err := readDayEntries(day)
+		if err != nil && !os.IsNotExist(err) {
+			total.Failed++
+			encoder.Encode(EntryEmbedProgress{Date: entryDate(day), Failed: 1, Errors: []string{err.Error()}})
+			controller.Flush()
+			continue
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		embedded, skipped, failures, err := embedEntries(r.Context(), entries)
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+		progress := EntryEmbedProgress{Date: entryDate(day), Embedded: embedded, Skipped: skipped, Failed: len(failures), Errors: failures}
+		total.Embedded += progress.Embedded
+		total.Skipped += progress.Skipped
+		total.Failed += progress.Failed
+
+		encoder.Encode(progress)
+		controller.Flush()
+	}
+
+	total.Finished = true
+	encoder.Encode(total)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// APIError is the JSON body of every error response
+type APIError struct {
+	Code      string        `json:"code"`
+	Message   string        `json:"message"`
+	Details   []ErrorDetail `json:"details,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
+}
+
+// ErrorDetail describes one problem with a request, usually a single field
+type ErrorDetail struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// Machine-readable error codes, clients should branch on these rather than messages
+const (
+	ErrCodeInvalidRequest   = "invalid_request"
+	ErrCodeValidation       = "validation_failed"
+	ErrCodeUnauthorized     = "unauthorized"
+	ErrCodeForbidden        = "forbidden"
+	ErrCodeNotFound         = "not_found"
+	ErrCodeMethodNotAllowed = "method_not_allowed"
+	ErrCodeConflict         = "conflict"
+	ErrCodeWeekFrozen       = "week_frozen"
+	ErrCodeUnsupportedMedia = "unsupported_media_type"
+	ErrCodeRateLimited      = "rate_limited"
+	ErrCodeUnavailable      = "service_unavailable"
+	ErrCodeInternal         = "internal_error"
+)
+
+type requestIDContextKey struct{}
+
+// errorCodeForStatus returns the default code of an HTTP status
+func errorCodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrCodeInvalidRequest
+	case http.StatusUnauthorized:
+		return ErrCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrCodeForbidden
+	case http.StatusNotFound:
+		return ErrCodeNotFound
+	case http.StatusMethodNotAllowed:
+		return ErrCodeMethodNotAllowed
+	case http.StatusConflict:
+		return ErrCodeConflict
+	case http.StatusUnprocessableEntity:
+		return ErrCodeValidation
+	case http.StatusUnsupportedMediaType:
+		return ErrCodeUnsupportedMedia
+	case http.StatusTooManyRequests:
+		return ErrCodeRateLimited
+	case http.StatusServiceUnavailable:
+		return ErrCodeUnavailable
+	default:
+		return ErrCodeInternal
+	}
+}
+
+// writeError sends an error envelope using the default code of the status
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	writeErrorCode(w, r, status, errorCodeForStatus(status), message)
+}
+
+// writeErrorCode sends an error envelope with an explicit code and optional details
+func writeErrorCode(w http.ResponseWriter, r *http.Request, status int, code string, message string, details ...ErrorDetail) {
+	response := APIError{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: requestID(r.Context()),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeValidationError reports every invalid field of a request at once
+func writeValidationError(w http.ResponseWriter, r *http.Request, details ...ErrorDetail) {
+	writeErrorCode(w, r, http.StatusUnprocessableEntity, ErrCodeValidation, "Request validation failed", details...)
+}
+
+// requestID returns the ID assigned to the request by requestIDMiddleware
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// requestIDMiddleware tags each request with an ID, reusing a caller-supplied
+// X-Request-ID so errors can be matched with client and proxy logs
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 128 {
+			id = uuid.New().String()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDContextKey{}, id)))
+	})
+}
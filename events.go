@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types published on the event bus
+const (
+	EventEntryCreated     = "entry.created"
+	EventEntryUpdated     = "entry.updated"
+	EventEntryCategorized = "entry.categorized"
+	EventEntryDeleted     = "entry.deleted"
+	EventEntryRestored    = "entry.restored"
+	EventRuleCreated      = "rule.created"
+	EventRuleUpdated      = "rule.updated"
+	EventRuleDeleted      = "rule.deleted"
+	EventJobCompleted     = "job.completed"
+	// EventRulesDrift is published when recent entries drift away from the rules
+	EventRulesDrift = "rules.drift"
+)
+
+// Sink types events can be delivered to
+const (
+	SinkWebhook = "webhook"
+	SinkFile    = "file"
+	SinkNATS    = "nats"
+	SinkKafka   = "kafka"
+)
+
+// eventBufferSize is how many events may wait for delivery before new ones are dropped
+const eventBufferSize = 256
+
+// sinkTimeout bounds a single delivery to a sink
+const sinkTimeout = 10 * time.Second
+
+// Event is something that happened in the tracker, delivered to every sink subscribed to its type
+type Event struct {
+	ID   string      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// EventsConfig lists the sinks receiving events
+type EventsConfig struct {
+	Sinks []EventSinkConfig `json:"sinks"`
+}
+
+// EventSinkConfig describes where events are delivered
+type EventSinkConfig struct {
+	// Type is webhook, file, nats or kafka
+	Type string `json:"type"`
+	// URL is the webhook URL, the NATS server (nats://host:4222) or the Kafka REST proxy
+	URL string `json:"url,omitempty"`
+	// Path is the JSON lines file for file sinks
+	Path string `json:"path,omitempty"`
+	// Subject prefixes the NATS subject, e.g. "aidea" publishes entry.created on "aidea.entry.created"
+	Subject string `json:"subject,omitempty"`
+	// Topic is the Kafka topic
+	Topic string `json:"topic,omitempty"`
+	// Events limits the sink to these event types, empty means all
+	Events []string `json:"events,omitempty"`
+}
+
+// EventSink delivers events to another system
+type EventSink interface {
+	Send(ctx context.Context, event Event) error
+}
+
+type subscribedSink struct {
+	config EventSinkConfig
+	sink   EventSink
+}
+
+// eventBus hands published events to a single delivery goroutine so publishers never wait on sinks
+type eventBus struct {
+	queue chan Event
+	sinks []subscribedSink
+}
+
+// bus is the running event bus, nil when no sinks are configured
+var bus *eventBus
+
+// newEventSink builds the sink for a config
+func newEventSink(config EventSinkConfig) (EventSink, error) {
+	switch config.Type {
+	case SinkWebhook:
+		if config.URL == "" {
+			return nil, fmt.Errorf("webhook sinks need a url")
+		}
+		return &webhookSink{url: config.URL, client: &http.Client{Timeout: sinkTimeout}}, nil
+	case SinkFile:
+		if config.Path == "" {
+			return nil, fmt.Errorf("file sinks need a path")
+		}
+		return &fileSink{path: config.Path}, nil
+	case SinkNATS:
+		address, err := natsAddress(config.URL)
+		if err != nil {
+			return nil, err
+		}
+		subject := config.Subject
+		if subject == "" {
+			subject = "aidea"
+		}
+		return &natsSink{address: address, subject: subject}, nil
+	case SinkKafka:
+		if config.URL == "" || config.Topic == "" {
+			return nil, fmt.Errorf("kafka sinks need the REST proxy url and a topic")
+		}
+		return &kafkaSink{url: config.URL, topic: config.Topic, client: &http.Client{Timeout: sinkTimeout}}, nil
+	default:
+		return nil, fmt.Errorf("unknown event sink type %q", config.Type)
+	}
+}
+
+// newEventSinks creates the configured sinks
+func newEventSinks(config EventsConfig) ([]subscribedSink, error) {
+	var sinks []subscribedSink
+	for _, sinkConfig := range config.Sinks {
+		sink, err := newEventSink(sinkConfig)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, subscribedSink{config: sinkConfig, sink: sink})
+	}
+	return sinks, nil
+}
+
+// startEventBus creates the configured sinks and starts delivering events
+func startEventBus(config EventsConfig) error {
+	if len(config.Sinks) == 0 {
+		return nil
+	}
+
+	sinks, err := newEventSinks(config)
+	if err != nil {
+		return err
+	}
+
+	b := &eventBus{queue: make(chan Event, eventBufferSize), sinks: sinks}
+	bus = b
+	go b.deliver()
+	log.Printf("Publishing events to %d sink(s)", len(b.sinks))
+	return nil
+}
+
+func (b *eventBus) deliver() {
+	for event := range b.queue {
+		for _, subscribed := range b.sinks {
+			if len(subscribed.config.Events) > 0 && !slices.Contains(subscribed.config.Events, event.Type) {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), sinkTimeout)
+			if err := subscribed.sink.Send(ctx, event); err != nil {
+				log.Printf("Error delivering %s event to %s sink: %v", event.Type, subscribed.config.Type, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// publishEvent queues an event for the sinks. Events are dropped rather than
+// slowing down requests when the sinks fall behind.
+func publishEvent(eventType string, data interface{}) {
+	if bus == nil {
+		return
+	}
+
+	event := Event{
+		ID:   uuid.New().String(),
+		Type: eventType,
+		Time: time.Now().UTC(),
+		Data: data,
+	}
+
+	select {
+	case bus.queue <- event:
+	default:
+		log.Printf("Event queue full, dropping %s event", eventType)
+	}
+}
+
+// entryEvent names the change between two versions of an entry
+func entryEvent(before, after TimeEntry) string {
+	switch {
+	case before.DeletedAt == "" && after.DeletedAt != "":
+		return EventEntryDeleted
+	case before.DeletedAt != "" && after.DeletedAt == "":
+		return EventEntryRestored
+	case before.Task == "" && after.Task != "":
+		return EventEntryCategorized
+	default:
+		return EventEntryUpdated
+	}
+}
+
+// webhookSink POSTs each event as JSON
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookSink) Send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// fileSink appends each event as a JSON line
+type fileSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (s *fileSink) Send(ctx context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// natsSink publishes events with the NATS text protocol, reconnecting when the connection drops
+type natsSink struct {
+	mu      sync.Mutex
+	address string
+	subject string
+	conn    net.Conn
+	reader  *bufio.Reader
+}
+
+// natsAddress turns nats://host:port into a dial address
+func natsAddress(raw string) (string, error) {
+	if raw == "" {
+		return "127.0.0.1:4222", nil
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Scheme != "nats" || parsed.Host == "" {
+		return "", fmt.Errorf("nats sinks need a url like nats://host:4222")
+	}
+	if parsed.Port() == "" {
+		return net.JoinHostPort(parsed.Hostname(), "4222"), nil
+	}
+	return parsed.Host, nil
+}
+
+// connect dials the server and completes the handshake, callers must hold s.mu
+func (s *natsSink) connect(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	// The server greets with INFO before accepting commands
+	if line, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(line, "INFO") {
+		conn.Close()
+		return fmt.Errorf("unexpected NATS greeting: %q %v", line, err)
+	}
+	if _, err := fmt.Fprint(conn, "CONNECT {\"verbose\":false,\"name\":\"aidea\"}\r\n"); err != nil {
+		conn.Close()
+		return err
+	}
+
+	s.conn, s.reader = conn, reader
+	return nil
+}
+
+// Send publishes the event and waits for the server to answer a PING, so an
+// error means the server may not have received it
+func (s *natsSink) Send(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := s.publish(ctx, s.subject+"."+event.Type, payload); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *natsSink) publish(ctx context.Context, subject string, payload []byte) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetDeadline(deadline)
+	}
+
+	if _, err := fmt.Fprintf(s.conn, "PUB %s %d\r\n%s\r\nPING\r\n", subject, len(payload), payload); err != nil {
+		return err
+	}
+
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			fmt.Fprint(s.conn, "PONG\r\n")
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS server error: %s", line)
+		}
+	}
+}
+
+// kafkaSink produces events through a Kafka REST proxy, keyed by event ID
+type kafkaSink struct {
+	url    string
+	topic  string
+	client *http.Client
+}
+
+func (s *kafkaSink) Send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"records": []map[string]interface{}{{"key": event.ID, "value": event}},
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimRight(s.url, "/") + "/topics/" + url.PathEscape(s.topic)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+
+	resp, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Offsets []struct {
+			ErrorCode *int   `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Kafka REST proxy returned %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("error decoding Kafka REST proxy response: %v", err)
+	}
+	for _, offset := range result.Offsets {
+		if offset.ErrorCode != nil {
+			return fmt.Errorf("Kafka rejected the event: %s", offset.Error)
+		}
+	}
+	return nil
+}
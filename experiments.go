@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	experimentsFile = "aidea_experiments.json"
+
+	// VariantControl is categorized with the configured model and prompt
+	VariantControl = "control"
+	// VariantChallenger is categorized with the experiment's model or prompt
+	VariantChallenger = "challenger"
+
+	// experimentMinReviewed is how many reviewed entries each variant needs before a leader is named
+	experimentMinReviewed = 20
+)
+
+// ExperimentConfig routes a share of categorizations to a challenger model or
+// prompt, so the two can be compared by how often users correct them
+type ExperimentConfig struct {
+	// Name identifies the experiment's results, use a new name for each experiment
+	Name string `json:"name"`
+	// Percent of categorizations that go to the challenger, 0 turns the experiment off
+	Percent int `json:"percent"`
+	// Model is the challenger's model, default the configured model
+	Model string `json:"model,omitempty"`
+	// Prompt is the challenger's system prompt file, default system_prompt.txt
+	Prompt string `json:"prompt,omitempty"`
+}
+
+// validateExperimentConfig checks an experiment, an empty one being off
+func validateExperimentConfig(config ExperimentConfig) error {
+	if config.Percent == 0 {
+		return nil
+	}
+	if config.Percent < 0 || config.Percent > 100 {
+		return fmt.Errorf("percent must be between 0 and 100, got %d", config.Percent)
+	}
+	if strings.TrimSpace(config.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if config.Model == "" && config.Prompt == "" {
+		return fmt.Errorf("set a challenger model or prompt")
+	}
+	if config.Prompt != "" {
+		if _, err := readDefaultFile(config.Prompt); err != nil {
+			return fmt.Errorf("couldn't read challenger prompt: %v", err)
+		}
+	}
+	return nil
+}
+
+// ExperimentAssignment is the variant a categorization was routed to
+type ExperimentAssignment struct {
+	Experiment string `json:"experiment"`
+	Variant    string `json:"variant"`
+	Model      string `json:"model"`
+	Prompt     string `json:"prompt,omitempty"`
+}
+
+type experimentContextKey struct{}
+
+// assignExperiment picks the variant of a description in the running experiment,
+// nil when none is running. The same description always gets the same variant, so
+// re-categorizing an entry doesn't move it between variants.
+func assignExperiment(description string) *ExperimentAssignment {
+	config := currentConfig().LLM.Experiment
+	if config.Percent <= 0 {
+		return nil
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(config.Name + "\x00" + description))
+	if int(hash.Sum32()%100) >= config.Percent {
+		return &ExperimentAssignment{Experiment: config.Name, Variant: VariantControl, Model: categorizationModel(context.Background())}
+	}
+
+	assignment := &ExperimentAssignment{Experiment: config.Name, Variant: VariantChallenger, Model: config.Model, Prompt: config.Prompt}
+	if assignment.Model == "" {
+		assignment.Model = categorizationModel(context.Background())
+	}
+	return assignment
+}
+
+// withExperiment routes the provider calls made with the context to a variant
+func withExperiment(ctx context.Context, assignment *ExperimentAssignment) context.Context {
+	if assignment == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, experimentContextKey{}, assignment)
+}
+
+// experimentAssignment returns the variant set on the context, nil outside an experiment
+func experimentAssignment(ctx context.Context) *ExperimentAssignment {
+	assignment, _ := ctx.Value(experimentContextKey{}).(*ExperimentAssignment)
+	return assignment
+}
+
+// ExperimentOutcome is the categorization a variant gave an entry. Whether the user
+// corrected it is worked out when reporting, from the entry as it is then.
+type ExperimentOutcome struct {
+	EntryID    string    `json:"entry_id"`
+	Date       string    `json:"date"` // YYYYMMDD
+	Experiment string    `json:"experiment"`
+	Variant    string    `json:"variant"`
+	Model      string    `json:"model"`
+	Prompt     string    `json:"prompt,omitempty"`
+	Task       string    `json:"task"`
+	Jira       string    `json:"jira,omitempty"`
+	Confidence string    `json:"confidence"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+var (
+	experimentsMu sync.Mutex
+	outcomes      []ExperimentOutcome
+)
+
+// loadOutcomes reads the experiment outcomes file once, callers must hold experimentsMu
+func loadOutcomes() error {
+	if outcomes != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(experimentsFile)
+	if os.IsNotExist(err) {
+		outcomes = []ExperimentOutcome{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read experiment outcomes: %v", err)
+	}
+
+	var loaded []ExperimentOutcome
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("couldn't parse experiment outcomes: %v", err)
+	}
+
+	outcomes = loaded
+	return nil
+}
+
+// saveOutcomes writes the experiment outcomes file, callers must hold experimentsMu
+func saveOutcomes() error {
+	data, err := json.MarshalIndent(outcomes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't encode experiment outcomes: %v", err)
+	}
+
+	return os.WriteFile(experimentsFile, data, 0644)
+}
+
+// recordExperimentOutcome keeps the categorization stored for an entry in an
+// experiment, replacing an earlier one when the entry was categorized again
+func recordExperimentOutcome(day time.Time, entry TimeEntry, result *CategoryResponse) error {
+	if result.Experiment == nil {
+		return nil
+	}
+
+	experimentsMu.Lock()
+	defer experimentsMu.Unlock()
+
+	if err := loadOutcomes(); err != nil {
+		return err
+	}
+
+	outcome := ExperimentOutcome{
+		EntryID:    entry.ID,
+		Date:       day.Format("20060102"),
+		Experiment: result.Experiment.Experiment,
+		Variant:    result.Experiment.Variant,
+		Model:      result.Experiment.Model,
+		Prompt:     result.Experiment.Prompt,
+		Task:       entry.Task,
+		Jira:       entry.Jira,
+		Confidence: entry.Confidence,
+		RecordedAt: time.Now().UTC(),
+	}
+	outcomes = slices.DeleteFunc(outcomes, func(existing ExperimentOutcome) bool {
+		return existing.EntryID == entry.ID
+	})
+	outcomes = append(outcomes, outcome)
+	return saveOutcomes()
+}
+
+// VariantResult is how one variant of an experiment fared
+type VariantResult struct {
+	Variant string `json:"variant"`
+	Model   string `json:"model"`
+	Prompt  string `json:"prompt,omitempty"`
+	// Categorized counts the entries the variant categorized that still exist
+	Categorized int `json:"categorized"`
+	// Reviewed counts those accepted, corrected or auto-accepted, suggestions awaiting review are left out
+	Reviewed       int     `json:"reviewed"`
+	Corrected      int     `json:"corrected"`
+	CorrectionRate float64 `json:"correction_rate"`
+}
+
+// ExperimentReport compares the variants of an experiment
+type ExperimentReport struct {
+	Experiment string          `json:"experiment"`
+	Variants   []VariantResult `json:"variants"`
+	// Leader is the variant corrected less often, once each has enough reviewed entries
+	Leader string `json:"leader,omitempty"`
+}
+
+// corrected reports whether the user changed the task or Jira issue a variant gave an entry
+func (o ExperimentOutcome) corrected(entry TimeEntry) bool {
+	task, _ := canonicalCategory(o.Task)
+	current, _ := canonicalCategory(entry.Task)
+	return !strings.EqualFold(task, current) || !strings.EqualFold(o.Jira, entry.Jira)
+}
+
+// buildExperimentReports compares the variants of each experiment, or only the named one
+func buildExperimentReports(name string) ([]ExperimentReport, error) {
+	experimentsMu.Lock()
+	if err := loadOutcomes(); err != nil {
+		experimentsMu.Unlock()
+		return nil, err
+	}
+	recorded := slices.Clone(outcomes)
+	experimentsMu.Unlock()
+
+	days := map[string]map[string]TimeEntry{}
+	results := map[string]map[string]*VariantResult{}
+	for _, outcome := range recorded {
+		if name != "" && outcome.Experiment != name {
+			continue
+		}
+
+		entries, ok := days[outcome.Date]
+		if !ok {
+			entries = map[string]TimeEntry{}
+			if day, err := time.Parse("20060102", outcome.Date); err == nil {
+				dayEntries, err := readDayEntries(day)
+				if err != nil && !os.IsNotExist(err) {
+					return nil, err
+				}
+				for _, entry := range dayEntries {
+					entries[entry.ID] = entry
+				}
+			}
+			days[outcome.Date] = entries
+		}
+		entry, ok := entries[outcome.EntryID]
+		if !ok || entry.DeletedAt != "" {
+			continue
+		}
+
+		variants, ok := results[outcome.Experiment]
+		if !ok {
+			variants = map[string]*VariantResult{}
+			results[outcome.Experiment] = variants
+		}
+		result, ok := variants[outcome.Variant]
+		if !ok {
+			result = &VariantResult{Variant: outcome.Variant, Model: outcome.Model, Prompt: outcome.Prompt}
+			variants[outcome.Variant] = result
+		}
+		result.Categorized++
+		if !entry.Categorized {
+			continue
+		}
+		result.Reviewed++
+		if outcome.corrected(entry) {
+			result.Corrected++
+		}
+	}
+
+	reports := []ExperimentReport{}
+	for experiment, variants := range results {
+		report := ExperimentReport{Experiment: experiment, Variants: []VariantResult{}}
+		for _, variant := range []string{VariantControl, VariantChallenger} {
+			result, ok := variants[variant]
+			if !ok {
+				continue
+			}
+			if result.Reviewed > 0 {
+				result.CorrectionRate = math.Round(float64(result.Corrected)/float64(result.Reviewed)*1000) / 1000
+			}
+			report.Variants = append(report.Variants, *result)
+		}
+		report.Leader = experimentLeader(report.Variants)
+		reports = append(reports, report)
+	}
+	slices.SortFunc(reports, func(a, b ExperimentReport) int { return strings.Compare(a.Experiment, b.Experiment) })
+	return reports, nil
+}
+
+// experimentLeader names the variant corrected less often, "" while either has too
+// few reviewed entries or they tie
+func experimentLeader(variants []VariantResult) string {
+	if len(variants) != 2 || variants[0].Reviewed < experimentMinReviewed || variants[1].Reviewed < experimentMinReviewed {
+		return ""
+	}
+	switch {
+	case variants[0].CorrectionRate < variants[1].CorrectionRate:
+		return variants[0].Variant
+	case variants[1].CorrectionRate < variants[0].CorrectionRate:
+		return variants[1].Variant
+	}
+	return ""
+}
+
+// experimentsHandler reports how often users corrected each variant's categorizations,
+// for every experiment or the one named by ?experiment=
+func experimentsHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	reports, err := buildExperimentReports(r.URL.Query().Get("experiment"))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error building experiment report: "+err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"running":     currentConfig().LLM.Experiment.Percent > 0,
+		"experiments": reports,
+	})
+}
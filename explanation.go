@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// maxPromptExcerpt limits how much of the system prompt an explanation includes
+const maxPromptExcerpt = 2000
+
+// Explanation shows how an entry's categorization was reached
+type Explanation struct {
+	Entry TimeEntry `json:"entry"`
+	// Pipeline is "rules" when the LLM chooses among rule candidates, "open" otherwise
+	Pipeline string `json:"pipeline"`
+	// Rules scores the description against every rule, best first
+	Rules []RuleCandidate `json:"rules"`
+	// Candidates are the IDs of the rules offered to the LLM
+	Candidates []string `json:"candidates"`
+	// PromptExcerpt is the start of the system prompt, the description is sent as the prompt
+	PromptExcerpt string `json:"prompt_excerpt"`
+	// Reason is the model's explanation recorded on the entry
+	Reason string `json:"reason"`
+}
+
+// explainEntry re-runs the ranking stage for an entry against the current rules.
+// Rules edited since the entry was categorized may rank differently.
+func explainEntry(ctx context.Context, entry TimeEntry) (*Explanation, error) {
+	scored, err := scoreRules(ctx, normalizeDescription(entry.Description))
+	if err != nil {
+		return nil, err
+	}
+
+	explanation := &Explanation{
+		Entry:      localizeEntry(entry, userLocation(entryOwner(entry))),
+		Pipeline:   "open",
+		Rules:      scored,
+		Candidates: []string{},
+		Reason:     entry.TaskReason,
+	}
+	if explanation.Rules == nil {
+		explanation.Rules = []RuleCandidate{}
+	}
+
+	var prompt string
+	if candidates := topCandidates(scored); len(candidates) > 0 {
+		explanation.Pipeline = "rules"
+		for _, candidate := range candidates {
+			explanation.Candidates = append(explanation.Candidates, candidate.Rule.ID)
+		}
+		prompt = ruleChoicePrompt(candidates)
+	} else {
+		prompt, err = readSystemPrompt(ctx)
+		if err != nil {
+			return nil, err
+		}
+		prompt += taxonomyPrompt()
+	}
+
+	if len(prompt) > maxPromptExcerpt {
+		prompt = prompt[:maxPromptExcerpt] + "..."
+	}
+	explanation.PromptExcerpt = prompt
+
+	return explanation, nil
+}
+
+// explanationHandler explains why an entry was assigned its task and Jira issue.
+// The entry's day is given as ?date=YYYYMMDD and defaults to today.
+func explanationHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	_, entry, ok := lookupEntry(w, r)
+	if !ok {
+		return
+	}
+
+	explanation, err := explainEntry(r.Context(), *entry)
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, "Error explaining categorization: "+err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(explanation)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// Export targets whose fields are mapped in the exports section of config.json
+const (
+	ExportCSV     = "csv"
+	ExportHarvest = "harvest"
+)
+
+// ExportField maps one field of an export target to a Go template rendered per entry,
+// e.g. {"name": "Ticket", "value": "{{.Jira}}"}. Templates see the entry fields plus
+// Minutes, Hours and Project, and can use contains, join, upper and lower.
+type ExportField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// exportEntry is the data an export template is rendered with
+type exportEntry struct {
+	TimeEntry
+	Minutes int
+	Hours   float64
+	// Project is the Jira project key of the entry's issue
+	Project string
+}
+
+// exportField is a configured field with its parsed template
+type exportField struct {
+	name     string
+	template *template.Template
+}
+
+var exportFuncs = template.FuncMap{
+	"contains": strings.Contains,
+	"join":     strings.Join,
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+}
+
+// defaultExports reproduces the fixed layouts used before mappings were configurable
+func defaultExports() map[string][]ExportField {
+	return map[string][]ExportField{
+		ExportCSV: {
+			{Name: "date", Value: "{{.Date}}"},
+			{Name: "user", Value: "{{.User}}"},
+			{Name: "timespan", Value: "{{.Timespan}}"},
+			{Name: "description", Value: "{{.Description}}"},
+			{Name: "task", Value: "{{.Task}}"},
+			{Name: "jira", Value: "{{.Jira}}"},
+			{Name: "confidence", Value: "{{.Confidence}}"},
+			{Name: "task_reason", Value: "{{.TaskReason}}"},
+			{Name: "links", Value: `{{join .Links " "}}`},
+		},
+		ExportHarvest: {
+			{Name: "notes", Value: "{{if and .Jira (not (contains .Description .Jira))}}{{.Jira}} {{end}}{{.Description}}"},
+		},
+	}
+}
+
+// prepareExports parses the field templates of every export target
+func prepareExports(config map[string][]ExportField) (map[string][]exportField, error) {
+	parsed := make(map[string][]exportField)
+	for target, fields := range config {
+		switch target {
+		case ExportCSV, ExportHarvest:
+		default:
+			return nil, fmt.Errorf("unknown export target %q", target)
+		}
+
+		for _, field := range fields {
+			if field.Name == "" {
+				return nil, fmt.Errorf("%s: field name is required", target)
+			}
+			tmpl, err := template.New(target + "." + field.Name).Funcs(exportFuncs).Parse(field.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", target, err)
+			}
+			parsed[target] = append(parsed[target], exportField{name: field.Name, template: tmpl})
+		}
+	}
+
+	if len(parsed[ExportCSV]) == 0 {
+		return nil, fmt.Errorf("%s: at least one column is required", ExportCSV)
+	}
+
+	return parsed, nil
+}
+
+// render renders the field template for an entry
+func (field exportField) render(entry TimeEntry) (string, error) {
+	minutes := entryMinutes(entry)
+	data := exportEntry{
+		TimeEntry: entry,
+		Minutes:   minutes,
+		Hours:     math.Round(float64(minutes)/60*100) / 100,
+		Project:   jiraProject(entry.Jira),
+	}
+
+	var buf bytes.Buffer
+	if err := field.template.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("field %s: %v", field.name, err)
+	}
+	return buf.String(), nil
+}
+
+// exportValue renders a target's field for an entry, returning false when the
+// field isn't mapped
+func exportValue(target, name string, entry TimeEntry) (string, bool, error) {
+	for _, field := range active.Load().exportFields[target] {
+		if field.name == name {
+			value, err := field.render(entry)
+			return value, true, err
+		}
+	}
+	return "", false, nil
+}
+
+// selectColumns picks the csv columns named by ?columns= (comma separated, in the
+// order given, default every mapped column) less those named by ?exclude=
+func selectColumns(r *http.Request) ([]exportField, []ErrorDetail) {
+	mapped := active.Load().exportFields[ExportCSV]
+	names := make([]string, len(mapped))
+	for i, field := range mapped {
+		names[i] = field.name
+	}
+
+	find := func(name string) (exportField, bool) {
+		for _, field := range mapped {
+			if strings.EqualFold(field.name, name) {
+				return field, true
+			}
+		}
+		return exportField{}, false
+	}
+
+	v := &validator{}
+	query := r.URL.Query()
+
+	selected := mapped
+	if value := query.Get("columns"); value != "" {
+		selected = []exportField{}
+		for _, name := range strings.Split(value, ",") {
+			field, found := find(strings.TrimSpace(name))
+			if !found {
+				v.add("columns", "unknown column %q, expected one of %s", strings.TrimSpace(name), strings.Join(names, ", "))
+				continue
+			}
+			selected = append(selected, field)
+		}
+	}
+
+	if value := query.Get("exclude"); value != "" {
+		excluded := make(map[string]bool)
+		for _, name := range strings.Split(value, ",") {
+			field, found := find(strings.TrimSpace(name))
+			if !found {
+				v.add("exclude", "unknown column %q, expected one of %s", strings.TrimSpace(name), strings.Join(names, ", "))
+				continue
+			}
+			excluded[field.name] = true
+		}
+
+		kept := []exportField{}
+		for _, field := range selected {
+			if !excluded[field.name] {
+				kept = append(kept, field)
+			}
+		}
+		selected = kept
+	}
+
+	if len(v.details) == 0 && len(selected) == 0 {
+		v.add("columns", "at least one column must be exported")
+	}
+
+	return selected, v.details
+}
+
+// exportCSVHandler returns the current user's entries for ?from=YYYYMMDD&to=YYYYMMDD,
+// default this week, as CSV laid out by the csv export mapping. ?columns= and
+// ?exclude= choose and order the columns, and the task, jira and tag filters
+// narrow the entries. A saved view works as an export profile.
+func exportCSVHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter, details := parseEntryFilter(r)
+	fields, columnDetails := selectColumns(r)
+	if details = append(details, columnDetails...); len(details) > 0 {
+		writeValidationError(w, r, details...)
+		return
+	}
+
+	entries, err := readEntriesBetween(r.Context(), from, to)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error reading entries: "+err.Error())
+		return
+	}
+
+	headers := make([]string, len(fields))
+	for i, field := range fields {
+		headers[i] = field.name
+	}
+
+	// Render everything before writing so a failing template can still be reported
+	records := [][]string{headers}
+	user := currentUser(r).Name
+	for _, entry := range entries {
+		if entryOwner(entry) != user || !filter.matches(entry) {
+			continue
+		}
+
+		record := make([]string, len(fields))
+		for i, field := range fields {
+			value, err := field.render(entry)
+			if err != nil {
+				writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error exporting entry ID %s: %v", entry.ID, err))
+				return
+			}
+			record[i] = value
+		}
+		records = append(records, record)
+	}
+
+	filename := fmt.Sprintf("aidea_%s_%s.csv", from.Format("20060102"), to.Format("20060102"))
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	csv.NewWriter(w).WriteAll(records)
+}
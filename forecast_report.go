@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ForecastConfig controls the project burn forecast
+type ForecastConfig struct {
+	// HistoryWeeks is how many complete weeks of history the forecast looks at
+	HistoryWeeks int `json:"history_weeks"`
+	// AverageWeeks is the window of the moving average
+	AverageWeeks int `json:"average_weeks"`
+	// BudgetHours are the hours budgeted per project or epic key, giving hours remaining
+	BudgetHours map[string]float64 `json:"budget_hours,omitempty"`
+}
+
+// ProjectForecast is the weekly burn of one project or epic and where it is heading
+type ProjectForecast struct {
+	Key string `json:"key"`
+	// WeeklyHours is the history, oldest week first
+	WeeklyHours        []float64 `json:"weekly_hours"`
+	LoggedHours        float64   `json:"logged_hours"`
+	MovingAverageHours float64   `json:"moving_average_hours"`
+	// TrendHours is next week's hours on the least-squares trend line
+	TrendHours        float64  `json:"trend_hours"`
+	SlopeHoursPerWeek float64  `json:"slope_hours_per_week"`
+	BudgetHours       *float64 `json:"budget_hours,omitempty"`
+	RemainingHours    *float64 `json:"remaining_hours,omitempty"`
+	// WeeksRemaining is how long the remaining budget lasts at the moving average burn
+	WeeksRemaining *float64 `json:"weeks_remaining,omitempty"`
+}
+
+// ForecastReport forecasts weekly burn per Jira project or epic
+type ForecastReport struct {
+	GroupBy  string            `json:"group_by"`
+	From     string            `json:"from"`
+	To       string            `json:"to"`
+	Projects []ProjectForecast `json:"projects"`
+	Errors   []string          `json:"errors,omitempty"`
+}
+
+// linearTrend fits y = intercept + slope*x by least squares over x = 0..n-1
+func linearTrend(values []float64) (float64, float64) {
+	n := float64(len(values))
+	if n < 2 {
+		if n == 1 {
+			return values[0], 0
+		}
+		return 0, 0
+	}
+
+	var sumX, sumY, sumXY, sumXX float64
+	for i, y := range values {
+		x := float64(i)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	slope := (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+	intercept := (sumY - slope*sumX) / n
+	return intercept, slope
+}
+
+// forecastProject computes the averages, trend and budget of one weekly series
+func forecastProject(key string, weekly []float64, config ForecastConfig) ProjectForecast {
+	forecast := ProjectForecast{Key: key, WeeklyHours: weekly}
+
+	for _, hours := range weekly {
+		forecast.LoggedHours += hours
+	}
+
+	window := weekly[max(len(weekly)-config.AverageWeeks, 0):]
+	for _, hours := range window {
+		forecast.MovingAverageHours += hours / float64(len(window))
+	}
+
+	intercept, slope := linearTrend(weekly)
+	forecast.SlopeHoursPerWeek = roundHours(slope)
+	forecast.TrendHours = roundHours(math.Max(intercept+slope*float64(len(weekly)), 0))
+	forecast.MovingAverageHours = roundHours(forecast.MovingAverageHours)
+	forecast.LoggedHours = roundHours(forecast.LoggedHours)
+
+	if budget, ok := config.BudgetHours[key]; ok {
+		remaining := roundHours(budget - forecast.LoggedHours)
+		forecast.BudgetHours = &budget
+		forecast.RemainingHours = &remaining
+		if forecast.MovingAverageHours > 0 {
+			weeks := roundHours(math.Max(remaining, 0) / forecast.MovingAverageHours)
+			forecast.WeeksRemaining = &weeks
+		}
+	}
+
+	return forecast
+}
+
+func roundHours(hours float64) float64 {
+	return math.Round(hours*100) / 100
+}
+
+// forecastReportHandler forecasts weekly hours per Jira project (?group=project, default)
+// or epic (?group=epic) from the last ?weeks= complete weeks. Managers see the whole
+// team, everyone else their own time.
+func forecastReportHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	config := currentConfig().Forecast
+	v := &validator{}
+	groupBy := r.URL.Query().Get("group")
+	if groupBy == "" {
+		groupBy = "project"
+	}
+	v.oneOf("group", groupBy, []string{"project", "epic"})
+	if value := r.URL.Query().Get("weeks"); value != "" {
+		weeks, err := strconv.Atoi(value)
+		if err != nil || weeks < 1 || weeks > 104 {
+			v.add("weeks", "weeks must be a number from 1 to 104")
+		}
+		config.HistoryWeeks = weeks
+	}
+	if groupBy == "epic" && !jiraConfigured() {
+		v.add("group", "grouping by epic requires Jira to be configured")
+	}
+	if len(v.details) > 0 {
+		writeValidationError(w, r, v.details...)
+		return
+	}
+
+	current := currentUser(r)
+	to := weekStart(userToday(current.Name)).AddDate(0, 0, -1)
+	from := weekStart(to).AddDate(0, 0, -7*(config.HistoryWeeks-1))
+
+	entries, err := readEntriesBetween(r.Context(), from, to)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error reading entries: %v", err))
+		return
+	}
+
+	report := ForecastReport{
+		GroupBy:  groupBy,
+		From:     from.Format("20060102"),
+		To:       to.Format("20060102"),
+		Projects: []ProjectForecast{},
+	}
+
+	weekly := make(map[string][]float64)
+	failed := make(map[string]bool)
+	for _, entry := range entries {
+		minutes := entryMinutes(entry)
+		if entry.Jira == "" || minutes == 0 || failed[entry.Jira] {
+			continue
+		}
+		if !current.HasRole(RoleManager) && entryOwner(entry) != current.Name {
+			continue
+		}
+
+		key := jiraProject(entry.Jira)
+		if groupBy == "epic" {
+			epic, err := resolveEpic(r.Context(), entry.Jira)
+			if err != nil {
+				failed[entry.Jira] = true
+				report.Errors = append(report.Errors, fmt.Sprintf("Error resolving epic for %s: %v", entry.Jira, err))
+				continue
+			}
+			key = epic
+		}
+		if key == "" {
+			continue
+		}
+
+		day, err := time.ParseInLocation(isoDate, entry.Date, from.Location())
+		if err != nil {
+			continue
+		}
+		if weekly[key] == nil {
+			weekly[key] = make([]float64, config.HistoryWeeks)
+		}
+		week := int(weekStart(day).Sub(from).Hours()/24+0.5) / 7
+		if week >= 0 && week < config.HistoryWeeks {
+			weekly[key][week] += float64(minutes) / 60
+		}
+	}
+
+	for key, hours := range weekly {
+		report.Projects = append(report.Projects, forecastProject(key, hours, config))
+	}
+	sort.Slice(report.Projects, func(i, j int) bool {
+		return report.Projects[i].MovingAverageHours > report.Projects[j].MovingAverageHours
+	})
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
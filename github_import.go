@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+const defaultGitHubURL = "https://api.github.com"
+
+// githubEventPages bounds how far back the events feed is paged, GitHub serves at most 300 events
+const githubEventPages = 3
+
+var githubClient = &http.Client{Timeout: 15 * time.Second}
+
+// GitHubConfig holds the GitHub API token and how activity becomes entries
+type GitHubConfig struct {
+	BaseURL string `json:"base_url,omitempty"`
+	Token   string `json:"token"`
+	// Login is the GitHub user whose activity is imported, Logins overrides it per tracker user
+	Login  string            `json:"login"`
+	Logins map[string]string `json:"logins,omitempty"`
+	// Repos map repositories to Jira, the first matching rule applies
+	Repos     []GitHubRepoRule  `json:"repos,omitempty"`
+	Estimates ActivityEstimates `json:"estimates"`
+}
+
+// GitHubRepoRule maps a repository ("owner/name", or "owner/*" for all of an owner's)
+// to a Jira project or issue. With a project, issue keys of that project found in the
+// activity are used; with an issue, it's used when the activity mentions none.
+type GitHubRepoRule struct {
+	Repo string `json:"repo"`
+	Jira string `json:"jira"`
+}
+
+type githubEvent struct {
+	Type string `json:"type"`
+	Repo struct {
+		Name string `json:"name"`
+	} `json:"repo"`
+	CreatedAt time.Time `json:"created_at"`
+	Payload   struct {
+		Action  string `json:"action"`
+		Ref     string `json:"ref"`
+		Size    int    `json:"size"`
+		Commits []struct {
+			Message string `json:"message"`
+		} `json:"commits"`
+		PullRequest *struct {
+			Number int    `json:"number"`
+			Title  string `json:"title"`
+			Head   struct {
+				Ref string `json:"ref"`
+			} `json:"head"`
+		} `json:"pull_request"`
+		Issue *struct {
+			Number      int       `json:"number"`
+			Title       string    `json:"title"`
+			PullRequest *struct{} `json:"pull_request"`
+		} `json:"issue"`
+	} `json:"payload"`
+}
+
+// githubLogin returns the GitHub login of a tracker user
+func githubLogin(user string) string {
+	if login, found := currentConfig().GitHub.Logins[user]; found {
+		return login
+	}
+	return currentConfig().GitHub.Login
+}
+
+// fetchGitHubEvents returns the user's events between start and end, newest first
+func fetchGitHubEvents(login string, start, end time.Time) ([]githubEvent, error) {
+	baseURL := currentConfig().GitHub.BaseURL
+	if baseURL == "" {
+		baseURL = defaultGitHubURL
+	}
+
+	events := []githubEvent{}
+	for page := 1; page <= githubEventPages; page++ {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/users/%s/events?per_page=100&page=%d", strings.TrimRight(baseURL, "/"), login, page), nil)
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %w", err)
+		}
+		req.Header.Set("Accept", "application/vnd.github+json")
+		if currentConfig().GitHub.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+currentConfig().GitHub.Token)
+		}
+
+		resp, err := githubClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("error sending request to GitHub: %w", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading response body: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GitHub API returned error: %s - %s", resp.Status, string(body))
+		}
+
+		var pageEvents []githubEvent
+		if err := json.Unmarshal(body, &pageEvents); err != nil {
+			return nil, fmt.Errorf("error decoding GitHub events: %w", err)
+		}
+
+		for _, event := range pageEvents {
+			if !event.CreatedAt.Before(start) && event.CreatedAt.Before(end) {
+				events = append(events, event)
+			}
+		}
+
+		// The feed is newest first, stop once it reaches days before the import
+		if len(pageEvents) < 100 || pageEvents[len(pageEvents)-1].CreatedAt.Before(start) {
+			break
+		}
+	}
+
+	return events, nil
+}
+
+// githubJira picks the Jira issue for activity in a repository using the first matching repo rule
+func githubJira(repo string, text string) string {
+	for _, rule := range currentConfig().GitHub.Repos {
+		if matched, _ := path.Match(rule.Repo, repo); matched {
+			return pickJira(rule.Jira, text)
+		}
+	}
+	return pickJira("", text)
+}
+
+// githubSuggestions groups a day's events into one suggestion per repository branch
+// or pull request/issue and kind of activity, estimating the time spent from the
+// configured minutes per commit, review, comment, pull request or issue
+func githubSuggestions(events []githubEvent) []ActivitySuggestion {
+	estimates := currentConfig().GitHub.Estimates
+
+	groups := newActivityGroups()
+
+	// Oldest first so commit messages read in order
+	for i := len(events) - 1; i >= 0; i-- {
+		event := events[i]
+		repo := event.Repo.Name
+		payload := event.Payload
+
+		switch event.Type {
+		case "PushEvent":
+			branch := strings.TrimPrefix(payload.Ref, "refs/heads/")
+			count := max(len(payload.Commits), payload.Size, 1)
+			text := ""
+			if len(payload.Commits) > 0 {
+				messages := []string{}
+				for _, commit := range payload.Commits {
+					messages = append(messages, strings.SplitN(commit.Message, "\n", 2)[0])
+				}
+				text = strings.Join(messages, "; ")
+			}
+			groups.add(repo, "commits", branch, text, count, estimates.CommitMinutes)
+		case "PullRequestReviewEvent":
+			if payload.PullRequest != nil {
+				subject := fmt.Sprintf("PR %s#%d: %s", repo, payload.PullRequest.Number, payload.PullRequest.Title)
+				groups.add(repo, "review", subject, payload.PullRequest.Head.Ref, 1, estimates.ReviewMinutes)
+			}
+		case "PullRequestReviewCommentEvent":
+			if payload.PullRequest != nil {
+				subject := fmt.Sprintf("PR %s#%d: %s", repo, payload.PullRequest.Number, payload.PullRequest.Title)
+				groups.add(repo, "comments", subject, payload.PullRequest.Head.Ref, 1, estimates.CommentMinutes)
+			}
+		case "IssueCommentEvent":
+			if payload.Issue != nil {
+				kind := "issue"
+				if payload.Issue.PullRequest != nil {
+					kind = "PR"
+				}
+				groups.add(repo, "comments", fmt.Sprintf("%s %s#%d: %s", kind, repo, payload.Issue.Number, payload.Issue.Title), "", 1, estimates.CommentMinutes)
+			}
+		case "PullRequestEvent":
+			if payload.PullRequest != nil && payload.Action == "opened" {
+				subject := fmt.Sprintf("PR %s#%d: %s", repo, payload.PullRequest.Number, payload.PullRequest.Title)
+				groups.add(repo, "pull_request", subject, payload.PullRequest.Head.Ref, 1, estimates.PullRequestMinutes)
+			}
+		case "IssuesEvent":
+			if payload.Issue != nil && payload.Action == "opened" {
+				groups.add(repo, "issue", fmt.Sprintf("issue %s#%d: %s", repo, payload.Issue.Number, payload.Issue.Title), "", 1, estimates.IssueMinutes)
+			}
+		}
+	}
+
+	return groups.suggestions(githubJira)
+}
+
+// githubImportHandler turns the current user's GitHub activity on ?date=YYYYMMDD
+// (default today) into uncategorized entries with estimated durations. Activity
+// already imported is skipped, ?dry_run=true only lists the suggestions.
+func githubImportHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	owner := currentUser(r).Name
+	login := githubLogin(owner)
+	if login == "" {
+		writeError(w, r, http.StatusServiceUnavailable, "GitHub is not configured for "+owner)
+		return
+	}
+
+	day, err := resolveEntryDay(r.URL.Query().Get("date"), owner)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	start, end := dayBounds(day)
+	events, err := fetchGitHubEvents(login, start, end)
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	suggestions := githubSuggestions(events)
+	errors, err := saveSuggestions(r.Context(), currentUser(r), day, suggestions, dryRun)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error reading entries: "+err.Error())
+		return
+	}
+
+	// Create response
+	response := map[string]interface{}{
+		"login":            login,
+		"date":             day.Format("2006-01-02"),
+		"event_count":      len(events),
+		"suggestion_count": len(suggestions),
+		"suggestions":      suggestions,
+		"dry_run":          dryRun,
+	}
+
+	if len(errors) > 0 {
+		response["errors"] = errors
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
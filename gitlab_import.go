@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const defaultGitLabURL = "https://gitlab.com"
+
+// gitlabEventPages bounds how many pages of a day's events are read per group
+const gitlabEventPages = 5
+
+var gitlabClient = &http.Client{Timeout: 15 * time.Second}
+
+// GitLabConfig holds the GitLab instance and the groups whose activity is imported
+type GitLabConfig struct {
+	BaseURL string `json:"base_url,omitempty"`
+	// Token is used for groups without their own token
+	Token string `json:"token,omitempty"`
+	// Username is the GitLab user whose activity is imported, Usernames overrides it per tracker user
+	Username  string            `json:"username"`
+	Usernames map[string]string `json:"usernames,omitempty"`
+	Groups    []GitLabGroup     `json:"groups"`
+	Estimates ActivityEstimates `json:"estimates"`
+}
+
+// GitLabGroup is a group (with its subgroups) whose projects are imported. Each group
+// may have its own access token. Jira is a project or issue used like a GitHub repo rule.
+type GitLabGroup struct {
+	Path  string `json:"path"`
+	Token string `json:"token,omitempty"`
+	Jira  string `json:"jira,omitempty"`
+}
+
+type gitlabEvent struct {
+	ID          int64     `json:"id"`
+	ProjectID   int64     `json:"project_id"`
+	ActionName  string    `json:"action_name"`
+	TargetType  string    `json:"target_type"`
+	TargetIID   int64     `json:"target_iid"`
+	TargetTitle string    `json:"target_title"`
+	CreatedAt   time.Time `json:"created_at"`
+	PushData    *struct {
+		CommitCount int    `json:"commit_count"`
+		Ref         string `json:"ref"`
+		CommitTitle string `json:"commit_title"`
+	} `json:"push_data"`
+	Note *struct {
+		NoteableType string `json:"noteable_type"`
+		NoteableIID  int64  `json:"noteable_iid"`
+	} `json:"note"`
+}
+
+type gitlabPipeline struct {
+	Ref string `json:"ref"`
+}
+
+// gitlabGroupClient reads one group's activity with the group's token
+type gitlabGroupClient struct {
+	group GitLabGroup
+	token string
+	// projects caches project paths by ID, empty for projects outside the group
+	projects map[int64]string
+}
+
+// get calls the GitLab API and decodes the response into result
+func (c *gitlabGroupClient) get(path string, query url.Values, result interface{}) error {
+	baseURL := currentConfig().GitLab.BaseURL
+	if baseURL == "" {
+		baseURL = defaultGitLabURL
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimRight(baseURL, "/")+"/api/v4"+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	if c.token != "" {
+		req.Header.Set("PRIVATE-TOKEN", c.token)
+	}
+
+	resp, err := gitlabClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request to GitLab: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GitLab API returned error: %s - %s", resp.Status, string(body))
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+// projectPath returns the path of a project in the group, or "" when it's outside it
+func (c *gitlabGroupClient) projectPath(id int64) (string, error) {
+	if path, cached := c.projects[id]; cached {
+		return path, nil
+	}
+
+	var project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	}
+	if err := c.get(fmt.Sprintf("/projects/%d", id), url.Values{}, &project); err != nil {
+		return "", err
+	}
+
+	path := ""
+	if strings.HasPrefix(project.PathWithNamespace, strings.TrimSuffix(c.group.Path, "/")+"/") {
+		path = project.PathWithNamespace
+	}
+	c.projects[id] = path
+	return path, nil
+}
+
+// events returns the user's events between start and end in the group's projects
+func (c *gitlabGroupClient) events(username string, start, end time.Time) ([]gitlabEvent, error) {
+	// after and before are exclusive dates, the times are filtered below
+	query := url.Values{}
+	query.Set("after", start.AddDate(0, 0, -1).Format("2006-01-02"))
+	query.Set("before", end.AddDate(0, 0, 1).Format("2006-01-02"))
+	query.Set("sort", "asc")
+	query.Set("per_page", "100")
+
+	events := []gitlabEvent{}
+	for page := 1; page <= gitlabEventPages; page++ {
+		query.Set("page", fmt.Sprint(page))
+
+		var pageEvents []gitlabEvent
+		if err := c.get("/users/"+url.PathEscape(username)+"/events", query, &pageEvents); err != nil {
+			return nil, err
+		}
+
+		for _, event := range pageEvents {
+			if event.CreatedAt.Before(start) || !event.CreatedAt.Before(end) {
+				continue
+			}
+			path, err := c.projectPath(event.ProjectID)
+			if err != nil {
+				return nil, err
+			}
+			if path != "" {
+				events = append(events, event)
+			}
+		}
+
+		if len(pageEvents) < 100 {
+			break
+		}
+	}
+
+	return events, nil
+}
+
+// pipelines returns the user's pipelines in a project updated between start and end
+func (c *gitlabGroupClient) pipelines(projectID int64, username string, start, end time.Time) ([]gitlabPipeline, error) {
+	query := url.Values{}
+	query.Set("username", username)
+	query.Set("updated_after", start.UTC().Format(time.RFC3339))
+	query.Set("updated_before", end.UTC().Format(time.RFC3339))
+	query.Set("per_page", "100")
+
+	var pipelines []gitlabPipeline
+	err := c.get(fmt.Sprintf("/projects/%d/pipelines", projectID), query, &pipelines)
+	return pipelines, err
+}
+
+// gitlabUsername returns the GitLab username of a tracker user
+func gitlabUsername(user string) string {
+	if username, found := currentConfig().GitLab.Usernames[user]; found {
+		return username
+	}
+	return currentConfig().GitLab.Username
+}
+
+// gitlabSuggestions reads each group's merge request reviews, comments, pushes and
+// pipelines for the day and groups them into suggestions. Events seen through
+// several groups' tokens are counted once.
+func gitlabSuggestions(username string, start, end time.Time) ([]ActivitySuggestion, int, error) {
+	estimates := currentConfig().GitLab.Estimates
+	groups := newActivityGroups()
+	seen := make(map[int64]bool)
+	jira := make(map[string]string)
+
+	for _, group := range currentConfig().GitLab.Groups {
+		token := group.Token
+		if token == "" {
+			token = currentConfig().GitLab.Token
+		}
+		client := &gitlabGroupClient{group: group, token: token, projects: make(map[int64]string)}
+
+		events, err := client.events(username, start, end)
+		if err != nil {
+			return nil, 0, fmt.Errorf("group %s: %v", group.Path, err)
+		}
+
+		pushedProjects := []int64{}
+		for _, event := range events {
+			if seen[event.ID] {
+				continue
+			}
+			seen[event.ID] = true
+
+			repo := client.projects[event.ProjectID]
+			jira[repo] = group.Jira
+
+			switch {
+			case event.PushData != nil:
+				text := event.PushData.CommitTitle
+				groups.add(repo, "commits", event.PushData.Ref, text, max(event.PushData.CommitCount, 1), estimates.CommitMinutes)
+				if !slices.Contains(pushedProjects, event.ProjectID) {
+					pushedProjects = append(pushedProjects, event.ProjectID)
+				}
+			case event.ActionName == "approved" && event.TargetType == "MergeRequest":
+				groups.add(repo, "review", fmt.Sprintf("MR %s!%d: %s", repo, event.TargetIID, event.TargetTitle), "", 1, estimates.ReviewMinutes)
+			case event.ActionName == "commented on" && event.Note != nil:
+				subject := fmt.Sprintf("issue %s#%d: %s", repo, event.Note.NoteableIID, event.TargetTitle)
+				if event.Note.NoteableType == "MergeRequest" {
+					subject = fmt.Sprintf("MR %s!%d: %s", repo, event.Note.NoteableIID, event.TargetTitle)
+				}
+				groups.add(repo, "comments", subject, "", 1, estimates.CommentMinutes)
+			case event.ActionName == "opened" && event.TargetType == "MergeRequest":
+				groups.add(repo, "pull_request", fmt.Sprintf("MR %s!%d: %s", repo, event.TargetIID, event.TargetTitle), "", 1, estimates.PullRequestMinutes)
+			case event.ActionName == "opened" && event.TargetType == "Issue":
+				groups.add(repo, "issue", fmt.Sprintf("issue %s#%d: %s", repo, event.TargetIID, event.TargetTitle), "", 1, estimates.IssueMinutes)
+			}
+		}
+
+		// Pipelines only show up in the projects the user pushed to
+		for _, projectID := range pushedProjects {
+			pipelines, err := client.pipelines(projectID, username, start, end)
+			if err != nil {
+				return nil, 0, fmt.Errorf("group %s: %v", group.Path, err)
+			}
+			for _, pipeline := range pipelines {
+				groups.add(client.projects[projectID], "pipelines", pipeline.Ref, "", 1, estimates.PipelineMinutes)
+			}
+		}
+	}
+
+	suggestions := groups.suggestions(func(repo, text string) string {
+		return pickJira(jira[repo], text)
+	})
+	return suggestions, len(seen), nil
+}
+
+// gitlabImportHandler turns the current user's GitLab activity on ?date=YYYYMMDD
+// (default today) into uncategorized entries with estimated durations. Activity
+// already imported is skipped, ?dry_run=true only lists the suggestions.
+func gitlabImportHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	owner := currentUser(r).Name
+	username := gitlabUsername(owner)
+	if username == "" || len(currentConfig().GitLab.Groups) == 0 {
+		writeError(w, r, http.StatusServiceUnavailable, "GitLab is not configured for "+owner)
+		return
+	}
+
+	day, err := resolveEntryDay(r.URL.Query().Get("date"), owner)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	start, end := dayBounds(day)
+	suggestions, eventCount, err := gitlabSuggestions(username, start, end)
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	errors, err := saveSuggestions(r.Context(), currentUser(r), day, suggestions, dryRun)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error reading entries: "+err.Error())
+		return
+	}
+
+	// Create response
+	response := map[string]interface{}{
+		"username":         username,
+		"date":             day.Format("2006-01-02"),
+		"event_count":      eventCount,
+		"suggestion_count": len(suggestions),
+		"suggestions":      suggestions,
+		"dry_run":          dryRun,
+	}
+
+	if len(errors) > 0 {
+		response["errors"] = errors
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
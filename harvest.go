@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHarvestURL = "https://api.harvestapp.com/v2"
+	// harvestReferenceGroup marks Harvest entries pushed by the tracker
+	harvestReferenceGroup = "aidea"
+)
+
+// HarvestConfig holds the Harvest API credentials and how entries map to Harvest projects
+type HarvestConfig struct {
+	BaseURL     string `json:"base_url,omitempty"`
+	AccountID   string `json:"account_id"`
+	AccessToken string `json:"access_token"`
+	// Mappings are tried in order, the first matching an entry decides its project and task
+	Mappings []HarvestMapping `json:"mappings"`
+}
+
+// HarvestMapping maps a Jira project or a category to a Harvest project and task.
+// A mapping with both set needs both to match.
+type HarvestMapping struct {
+	JiraProject string `json:"jira_project,omitempty"`
+	Category    string `json:"category,omitempty"`
+	ProjectID   int64  `json:"project_id"`
+	TaskID      int64  `json:"task_id"`
+}
+
+// HarvestPush is a time entry that is, or would be, created in Harvest
+type HarvestPush struct {
+	EntryID   string  `json:"entry_id"`
+	SpentDate string  `json:"spent_date"`
+	Hours     float64 `json:"hours"`
+	ProjectID int64   `json:"project_id"`
+	TaskID    int64   `json:"task_id"`
+	Notes     string  `json:"notes"`
+	// HarvestID is the created Harvest entry, empty on dry runs
+	HarvestID int64 `json:"harvest_id,omitempty"`
+}
+
+// HarvestSkip is an entry left out of the sync and why
+type HarvestSkip struct {
+	EntryID string `json:"entry_id"`
+	Reason  string `json:"reason"`
+}
+
+type harvestTimeEntry struct {
+	ID        int64   `json:"id"`
+	SpentDate string  `json:"spent_date"`
+	Hours     float64 `json:"hours"`
+	Project   struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	} `json:"project"`
+	ExternalReference *struct {
+		ID      string `json:"id"`
+		GroupID string `json:"group_id"`
+	} `json:"external_reference"`
+}
+
+var harvestClient = &http.Client{Timeout: 30 * time.Second}
+
+func harvestConfigured() bool {
+	return currentConfig().Harvest.AccountID != "" && currentConfig().Harvest.AccessToken != ""
+}
+
+// harvestRequest calls the Harvest API and decodes the response into result
+func harvestRequest(method, path string, payload, result interface{}) error {
+	baseURL := currentConfig().Harvest.BaseURL
+	if baseURL == "" {
+		baseURL = defaultHarvestURL
+	}
+
+	var body io.Reader
+	if payload != nil {
+		requestData, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("error marshalling request: %w", err)
+		}
+		body = bytes.NewReader(requestData)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(baseURL, "/")+path, body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+currentConfig().Harvest.AccessToken)
+	req.Header.Set("Harvest-Account-Id", currentConfig().Harvest.AccountID)
+	req.Header.Set("User-Agent", "aidea-time-tracker")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := harvestClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request to Harvest: %w", err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Harvest API returned error: %s - %s", resp.Status, string(responseBody))
+	}
+
+	return json.Unmarshal(responseBody, result)
+}
+
+// harvestTimeEntries returns the token owner's Harvest time entries in the range
+func harvestTimeEntries(from, to time.Time) ([]harvestTimeEntry, error) {
+	var me struct {
+		ID int64 `json:"id"`
+	}
+	if err := harvestRequest(http.MethodGet, "/users/me", nil, &me); err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("user_id", fmt.Sprint(me.ID))
+	query.Set("from", from.Format("2006-01-02"))
+	query.Set("to", to.Format("2006-01-02"))
+	query.Set("per_page", "2000")
+
+	entries := []harvestTimeEntry{}
+	for page := 1; ; page++ {
+		query.Set("page", fmt.Sprint(page))
+
+		var response struct {
+			TimeEntries []harvestTimeEntry `json:"time_entries"`
+			NextPage    *int               `json:"next_page"`
+		}
+		if err := harvestRequest(http.MethodGet, "/time_entries?"+query.Encode(), nil, &response); err != nil {
+			return nil, err
+		}
+		entries = append(entries, response.TimeEntries...)
+
+		if response.NextPage == nil {
+			return entries, nil
+		}
+	}
+}
+
+// harvestEntryID returns the tracker entry a Harvest entry was pushed from, if any
+func harvestEntryID(entry harvestTimeEntry) string {
+	if entry.ExternalReference != nil && entry.ExternalReference.GroupID == harvestReferenceGroup {
+		return entry.ExternalReference.ID
+	}
+	return ""
+}
+
+// syncedHarvestEntries returns the tracker entry IDs already pushed to Harvest in the range,
+// read from the external reference of each Harvest entry
+func syncedHarvestEntries(from, to time.Time) (map[string]bool, error) {
+	entries, err := harvestTimeEntries(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	synced := make(map[string]bool)
+	for _, entry := range entries {
+		if id := harvestEntryID(entry); id != "" {
+			synced[id] = true
+		}
+	}
+	return synced, nil
+}
+
+// harvestMapping returns the first mapping matching the entry's Jira project and category
+func harvestMapping(entry TimeEntry) *HarvestMapping {
+	project := jiraProject(entry.Jira)
+	category, _ := canonicalCategory(entry.Task)
+
+	mappings := currentConfig().Harvest.Mappings
+	for i, mapping := range mappings {
+		if mapping.JiraProject == "" && mapping.Category == "" {
+			continue
+		}
+		if mapping.JiraProject != "" && !strings.EqualFold(mapping.JiraProject, project) {
+			continue
+		}
+		if mapping.Category != "" && !strings.EqualFold(mapping.Category, category) {
+			continue
+		}
+		return &mappings[i]
+	}
+	return nil
+}
+
+// harvestNotes describes an entry in Harvest using the harvest export mapping,
+// which by default leads with its Jira issue
+func harvestNotes(entry TimeEntry) (string, error) {
+	notes, mapped, err := exportValue(ExportHarvest, "notes", entry)
+	if !mapped {
+		return entry.Description, nil
+	}
+	return notes, err
+}
+
+// harvestSyncHandler pushes the current user's categorized entries to Harvest. The range
+// is given as ?from=YYYYMMDD&to=YYYYMMDD and defaults to this week; ?dry_run=true lists
+// what would be pushed without creating anything. Entries already in Harvest are
+// recognized by their external reference and never pushed twice.
+func harvestSyncHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if !harvestConfigured() {
+		writeError(w, r, http.StatusServiceUnavailable, "Harvest is not configured")
+		return
+	}
+
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	entries, err := readEntriesBetween(r.Context(), from, to)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error reading entries: "+err.Error())
+		return
+	}
+
+	synced, err := syncedHarvestEntries(from, to)
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, "Error reading Harvest entries: "+err.Error())
+		return
+	}
+
+	user := currentUser(r).Name
+	pushes := []HarvestPush{}
+	skipped := []HarvestSkip{}
+	errors := []string{}
+
+	for _, entry := range entries {
+		if entryOwner(entry) != user {
+			continue
+		}
+
+		switch {
+		case synced[entry.ID]:
+			skipped = append(skipped, HarvestSkip{EntryID: entry.ID, Reason: "already in Harvest"})
+			continue
+		case !entry.Categorized:
+			skipped = append(skipped, HarvestSkip{EntryID: entry.ID, Reason: "not categorized"})
+			continue
+		}
+
+		minutes := entryMinutes(entry)
+		if minutes == 0 {
+			skipped = append(skipped, HarvestSkip{EntryID: entry.ID, Reason: "no duration"})
+			continue
+		}
+
+		mapping := harvestMapping(entry)
+		if mapping == nil {
+			skipped = append(skipped, HarvestSkip{EntryID: entry.ID, Reason: fmt.Sprintf("no Harvest mapping for %s %s", entry.Task, entry.Jira)})
+			continue
+		}
+
+		notes, err := harvestNotes(entry)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("Error mapping entry ID %s: %v", entry.ID, err))
+			continue
+		}
+
+		push := HarvestPush{
+			EntryID:   entry.ID,
+			SpentDate: entry.Date,
+			Hours:     math.Round(float64(minutes)/60*100) / 100,
+			ProjectID: mapping.ProjectID,
+			TaskID:    mapping.TaskID,
+			Notes:     notes,
+		}
+
+		if !dryRun {
+			var created harvestTimeEntry
+			err := harvestRequest(http.MethodPost, "/time_entries", map[string]interface{}{
+				"project_id": push.ProjectID,
+				"task_id":    push.TaskID,
+				"spent_date": push.SpentDate,
+				"hours":      push.Hours,
+				"notes":      push.Notes,
+				"external_reference": map[string]string{
+					"id":       entry.ID,
+					"group_id": harvestReferenceGroup,
+				},
+			}, &created)
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("Error pushing entry ID %s: %v", entry.ID, err))
+				continue
+			}
+			push.HarvestID = created.ID
+		}
+
+		pushes = append(pushes, push)
+	}
+
+	// Create response
+	response := map[string]interface{}{
+		"from":    from.Format("2006-01-02"),
+		"to":      to.Format("2006-01-02"),
+		"dry_run": dryRun,
+		"pushed":  pushes,
+		"skipped": skipped,
+	}
+
+	if len(errors) > 0 {
+		response["errors"] = errors
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"reflect"
+	"time"
+)
+
+// Entry lifecycle events hooks can run on
+const (
+	HookEntryCreated     = "entry.created"
+	HookEntryCategorized = "entry.categorized"
+)
+
+// defaultHookTimeout bounds a hook script when no timeout is configured
+const defaultHookTimeout = 5 * time.Second
+
+// HookConfig runs a user script on an entry lifecycle event. The script gets the
+// entry as JSON on stdin and may print the entry back with changed fields, e.g.
+// to force a category for certain keywords or rewrite a Jira project. Printing
+// nothing leaves the entry as it is.
+type HookConfig struct {
+	Event   string   `json:"event"`
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	// TimeoutSeconds bounds each run, the entry is kept unchanged when it's exceeded
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+}
+
+// validateHooks checks the hook configs at startup
+func validateHooks(hooks []HookConfig) error {
+	for _, hook := range hooks {
+		if hook.Command == "" {
+			return fmt.Errorf("hooks need a command")
+		}
+		if hook.Event != HookEntryCreated && hook.Event != HookEntryCategorized {
+			return fmt.Errorf("hook %s: unknown event %q, expected %s or %s", hook.Command, hook.Event, HookEntryCreated, HookEntryCategorized)
+		}
+	}
+	return nil
+}
+
+// runEntryHooks passes the entry through each hook configured for the event in
+// order. A failing hook or one returning an invalid entry is logged and skipped
+// so scripts can't stop entries from being saved.
+func runEntryHooks(ctx context.Context, event string, entry *TimeEntry) {
+	for _, hook := range currentConfig().Hooks {
+		if hook.Event != event {
+			continue
+		}
+
+		changed, err := runHook(ctx, hook, *entry)
+		if err != nil {
+			log.Printf("Error running %s hook %s: %v", event, hook.Command, err)
+			continue
+		}
+		if changed == nil {
+			continue
+		}
+		changed.Confidence = normalizeConfidence(changed.Confidence)
+		if details := validateEntry(*changed); len(details) > 0 {
+			log.Printf("Ignoring %s hook %s: %s", event, hook.Command, details[0].Message)
+			continue
+		}
+
+		applyHookChanges(entry, *changed)
+	}
+}
+
+// applyHookChanges copies what a hook may change onto an entry. Hooks may tweak
+// what was logged and how it's categorized, not which entry it is.
+func applyHookChanges(entry *TimeEntry, changed TimeEntry) {
+	entry.Description = changed.Description
+	entry.Timespan = changed.Timespan
+	entry.Task = changed.Task
+	entry.TaskReason = changed.TaskReason
+	entry.Jira = changed.Jira
+	entry.Confidence = changed.Confidence
+	entry.Categorized = changed.Categorized
+	entry.Tags = changed.Tags
+	entry.Links = changed.Links
+	entry.Labels = changed.Labels
+}
+
+// runCategorizedHooks runs the entry.categorized hooks on an entry whose
+// categorization was saved. Like the entry.created hooks they run outside the
+// storage lock so a slow script doesn't block other writes, and their changes
+// are saved with a second update, unless the entry was reviewed meanwhile.
+func runCategorizedHooks(ctx context.Context, day time.Time, saved *TimeEntry) *TimeEntry {
+	hooked := *saved
+	runEntryHooks(ctx, HookEntryCategorized, &hooked)
+	if reflect.DeepEqual(hooked, *saved) {
+		return saved
+	}
+
+	updated, err := updateEntry(context.WithoutCancel(ctx), day, saved.ID, func(e *TimeEntry) {
+		if e.Task == saved.Task && e.Confidence == saved.Confidence && e.Categorized == saved.Categorized {
+			applyHookChanges(e, hooked)
+		}
+	})
+	if err != nil {
+		log.Printf("Error saving the %s hooks' changes to entry %s: %v", HookEntryCategorized, saved.ID, err)
+		return saved
+	}
+	return updated
+}
+
+// runHook runs one hook script, returning nil when it printed nothing
+func runHook(ctx context.Context, hook HookConfig, entry TimeEntry) (*TimeEntry, error) {
+	timeout := defaultHookTimeout
+	if hook.TimeoutSeconds > 0 {
+		timeout = time.Duration(hook.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	input, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, hook.Command, hook.Args...)
+	cmd.Env = append(os.Environ(), "AIDEA_EVENT="+hook.Event)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = log.Writer()
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("timed out after %s", timeout)
+		}
+		return nil, err
+	}
+
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return nil, nil
+	}
+
+	var changed TimeEntry
+	if err := json.Unmarshal(stdout.Bytes(), &changed); err != nil {
+		return nil, fmt.Errorf("invalid entry JSON: %v", err)
+	}
+	return &changed, nil
+}
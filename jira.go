@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const jiraIssueURL = "%s/rest/api/2/issue/%s"
+
+// JiraConfig holds the connection details for the Jira REST API
+type JiraConfig struct {
+	BaseURL  string `json:"base_url"`
+	Email    string `json:"email"`
+	APIToken string `json:"api_token"`
+	// EpicLinkField is the custom field holding the epic on company-managed projects
+	EpicLinkField string `json:"epic_link_field,omitempty"`
+	// ProjectKeys restricts categorization to issues in these projects
+	ProjectKeys []string `json:"project_keys,omitempty"`
+	// TempoToken reads worklogs from Tempo instead of Jira when set
+	TempoToken string `json:"tempo_token,omitempty"`
+	TempoURL   string `json:"tempo_url,omitempty"`
+	// Instances are further Jira sites, each serving the issues of its projects.
+	// Issues in other projects go to the site configured above.
+	Instances []JiraInstance `json:"instances,omitempty"`
+	// CategoryMappings derive the category of entries referencing an issue from the
+	// issue itself, skipping the LLM for explicitly ticketed work
+	CategoryMappings []JiraCategoryMapping `json:"category_mappings,omitempty"`
+}
+
+// JiraCategoryMapping maps issues to a category. Every field set must match the
+// issue, and the first matching mapping wins.
+type JiraCategoryMapping struct {
+	Project   string `json:"project,omitempty"`
+	Component string `json:"component,omitempty"`
+	Label     string `json:"label,omitempty"`
+	Epic      string `json:"epic,omitempty"`
+	Category  string `json:"category"`
+}
+
+// JiraInstance is a Jira site and the credentials used for it, e.g. a client's own Jira
+type JiraInstance struct {
+	Name          string `json:"name"`
+	BaseURL       string `json:"base_url"`
+	Email         string `json:"email"`
+	APIToken      string `json:"api_token"`
+	EpicLinkField string `json:"epic_link_field,omitempty"`
+	// ProjectKeys are the projects routed to this instance, required for additional instances
+	ProjectKeys []string `json:"project_keys"`
+	TempoToken  string   `json:"tempo_token,omitempty"`
+	TempoURL    string   `json:"tempo_url,omitempty"`
+}
+
+// jiraComponent is a component an issue belongs to
+type jiraComponent struct {
+	Name string `json:"name"`
+}
+
+// jiraIssue is the subset of issue fields the tracker uses
+type jiraIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Summary   string `json:"summary"`
+		IssueType struct {
+			Name string `json:"name"`
+		} `json:"issuetype"`
+		Components []jiraComponent `json:"components"`
+		Labels     []string        `json:"labels"`
+		Parent     *struct {
+			Key    string `json:"key"`
+			Fields struct {
+				IssueType struct {
+					Name string `json:"name"`
+				} `json:"issuetype"`
+			} `json:"fields"`
+		} `json:"parent"`
+	} `json:"fields"`
+	rawFields map[string]json.RawMessage
+}
+
+var (
+	jiraClient  = &http.Client{Timeout: 15 * time.Second}
+	epicCacheMu sync.Mutex
+	epicCache   = make(map[string]string)
+)
+
+func jiraConfigured() bool {
+	return len(jiraInstances()) > 0
+}
+
+// jiraInstances returns every configured Jira site, the top-level one first
+func jiraInstances() []JiraInstance {
+	config := currentConfig().Jira
+	instances := []JiraInstance{}
+	if config.BaseURL != "" {
+		instances = append(instances, JiraInstance{
+			Name:          "default",
+			BaseURL:       config.BaseURL,
+			Email:         config.Email,
+			APIToken:      config.APIToken,
+			EpicLinkField: config.EpicLinkField,
+			ProjectKeys:   config.ProjectKeys,
+			TempoToken:    config.TempoToken,
+			TempoURL:      config.TempoURL,
+		})
+	}
+	return append(instances, config.Instances...)
+}
+
+// jiraInstanceFor returns the Jira site holding an issue: the additional instance
+// listing its project, otherwise the top-level site
+func jiraInstanceFor(key string) (JiraInstance, error) {
+	project := jiraProject(key)
+	for _, instance := range currentConfig().Jira.Instances {
+		if slices.Contains(instance.ProjectKeys, project) {
+			return instance, nil
+		}
+	}
+
+	if currentConfig().Jira.BaseURL == "" {
+		return JiraInstance{}, fmt.Errorf("no Jira instance is configured for project %q", project)
+	}
+	return jiraInstances()[0], nil
+}
+
+// allowedJiraProjects returns the projects issues may belong to, nil allowing any.
+// Projects of additional instances are allowed alongside the top-level project keys,
+// while a top-level site without project keys still accepts every project.
+func allowedJiraProjects() []string {
+	config := currentConfig().Jira
+	if config.BaseURL != "" && len(config.ProjectKeys) == 0 {
+		return nil
+	}
+
+	projects := slices.Clone(config.ProjectKeys)
+	for _, instance := range config.Instances {
+		projects = append(projects, instance.ProjectKeys...)
+	}
+	return projects
+}
+
+// validateJiraConfig checks that every additional instance can be reached, that no
+// project is routed to two of them and that category mappings are complete
+func validateJiraConfig(config JiraConfig) error {
+	routed := make(map[string]string)
+	for i, instance := range config.Instances {
+		if instance.Name == "" {
+			return fmt.Errorf("instance %d: name is required", i+1)
+		}
+		if instance.BaseURL == "" {
+			return fmt.Errorf("instance %s: base_url is required", instance.Name)
+		}
+		if len(instance.ProjectKeys) == 0 {
+			return fmt.Errorf("instance %s: project_keys is required", instance.Name)
+		}
+		for _, project := range instance.ProjectKeys {
+			if other, found := routed[project]; found {
+				return fmt.Errorf("project %s is routed to both %s and %s", project, other, instance.Name)
+			}
+			routed[project] = instance.Name
+		}
+	}
+
+	for i, mapping := range config.CategoryMappings {
+		if mapping.Category == "" {
+			return fmt.Errorf("category mapping %d: category is required", i+1)
+		}
+		if mapping.Project == "" && mapping.Component == "" && mapping.Label == "" && mapping.Epic == "" {
+			return fmt.Errorf("category mapping %d: set at least one of project, component, label or epic", i+1)
+		}
+	}
+	return nil
+}
+
+// jiraProject returns the project key of an issue key, e.g. FEDS for FEDS-101
+func jiraProject(key string) string {
+	project, _, found := strings.Cut(key, "-")
+	if !found {
+		return ""
+	}
+	return project
+}
+
+// modelJiraProblem describes why a Jira key the model answered with can't be
+// trusted, or returns "". The model only copies keys out of the entry, so a key the
+// description doesn't mention, like the ABC-123 of the prompt's example, is invented.
+func modelJiraProblem(description, key string) string {
+	projects := allowedJiraProjects()
+	switch {
+	case !jiraKeyPattern.MatchString(key):
+		return fmt.Sprintf("%q is not a Jira issue key", key)
+	case len(projects) > 0 && !slices.Contains(projects, jiraProject(key)):
+		return fmt.Sprintf("Jira issue %s is not in an allowed project", key)
+	case !slices.Contains(jiraKeyFinder.FindAllString(strings.ToUpper(description), -1), key):
+		return fmt.Sprintf("Jira issue %s is not mentioned in the entry", key)
+	}
+	return ""
+}
+
+// checkModelJira drops the Jira issues the model invented from a categorization.
+// An invented primary issue is noted in the reason and lowers the confidence, so the
+// entry goes to review rather than being logged against the wrong issue.
+func checkModelJira(description string, result *CategoryResponse) {
+	if result.Jira != "" {
+		result.Jira = strings.ToUpper(strings.TrimSpace(result.Jira))
+		if problem := modelJiraProblem(description, result.Jira); problem != "" {
+			log.Printf("Dropping the model's Jira issue: %s", problem)
+			result.Jira = ""
+			result.Confidence = "low"
+			result.Reason = strings.TrimSpace(result.Reason + " (" + problem + ")")
+		}
+	}
+	for i, label := range result.Labels {
+		if label.Jira != "" && modelJiraProblem(description, strings.ToUpper(strings.TrimSpace(label.Jira))) != "" {
+			result.Labels[i].Jira = ""
+		}
+	}
+}
+
+// fetchJiraIssue loads an issue from the Jira instance serving its project
+func fetchJiraIssue(ctx context.Context, key string) (*jiraIssue, error) {
+	instance, err := jiraInstanceFor(key)
+	if err != nil {
+		return nil, err
+	}
+	return instance.fetchIssue(ctx, key)
+}
+
+// fetchIssue loads an issue, by key or ID, from the instance's REST API
+func (instance JiraInstance) fetchIssue(ctx context.Context, key string) (*jiraIssue, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf(jiraIssueURL, strings.TrimRight(instance.BaseURL, "/"), key), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.SetBasicAuth(instance.Email, instance.APIToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := jiraClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request to Jira: %w", err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Jira API returned error: %s - %s", resp.Status, string(responseBody))
+	}
+
+	var issue jiraIssue
+	if err := json.Unmarshal(responseBody, &issue); err != nil {
+		return nil, fmt.Errorf("error decoding Jira issue: %w", err)
+	}
+
+	var raw struct {
+		Fields map[string]json.RawMessage `json:"fields"`
+	}
+	if err := json.Unmarshal(responseBody, &raw); err == nil {
+		issue.rawFields = raw.Fields
+	}
+
+	return &issue, nil
+}
+
+// resolveEpic returns the epic key an issue rolls up to, caching lookups.
+// An epic resolves to itself and issues without an epic resolve to "".
+func resolveEpic(ctx context.Context, key string) (string, error) {
+	epicCacheMu.Lock()
+	epic, cached := epicCache[key]
+	epicCacheMu.Unlock()
+	if cached {
+		return epic, nil
+	}
+
+	issue, err := fetchJiraIssue(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case strings.EqualFold(issue.Fields.IssueType.Name, "Epic"):
+		epic = issue.Key
+	case issue.Fields.Parent != nil && strings.EqualFold(issue.Fields.Parent.Fields.IssueType.Name, "Epic"):
+		epic = issue.Fields.Parent.Key
+	case issue.Fields.Parent != nil:
+		// Sub-tasks roll up through their parent issue
+		epic, err = resolveEpic(ctx, issue.Fields.Parent.Key)
+		if err != nil {
+			return "", err
+		}
+	default:
+		if instance, err := jiraInstanceFor(key); err == nil && instance.EpicLinkField != "" {
+			if value, ok := issue.rawFields[instance.EpicLinkField]; ok {
+				json.Unmarshal(value, &epic)
+			}
+		}
+	}
+
+	epicCacheMu.Lock()
+	epicCache[key] = epic
+	epicCacheMu.Unlock()
+
+	return epic, nil
+}
+
+// epicRollup groups minutes by epic for reports, resolving each issue once
+// and recording issues whose epic couldn't be fetched
+type epicRollup struct {
+	minutes map[string]int
+	failed  map[string]bool
+	errors  []string
+}
+
+func newEpicRollup() *epicRollup {
+	return &epicRollup{
+		minutes: make(map[string]int),
+		failed:  make(map[string]bool),
+	}
+}
+
+// add counts an entry's minutes towards the epic of its issue, or "No epic"
+func (e *epicRollup) add(ctx context.Context, jira string, minutes int) {
+	epic := "No epic"
+	if jira != "" && !e.failed[jira] {
+		resolved, err := resolveEpic(ctx, jira)
+		if err != nil {
+			e.failed[jira] = true
+			e.errors = append(e.errors, fmt.Sprintf("Error resolving epic for %s: %v", jira, err))
+		} else if resolved != "" {
+			epic = resolved
+		}
+	}
+	e.minutes[epic] += minutes
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	jiraCategoryMu    sync.Mutex
+	jiraCategoryCache = make(map[string]*CategoryResponse)
+)
+
+// categorizeFromJira categorizes text referencing a Jira issue by the configured
+// category mappings, returning nil when no issue is referenced or no mapping matches
+func categorizeFromJira(ctx context.Context, text string) *CategoryResponse {
+	if len(currentConfig().Jira.CategoryMappings) == 0 {
+		return nil
+	}
+
+	for _, key := range jiraKeyFinder.FindAllString(text, -1) {
+		if _, err := jiraInstanceFor(key); err != nil {
+			continue
+		}
+
+		result, err := jiraCategory(ctx, key)
+		if err != nil {
+			log.Printf("Error reading Jira issue %s for categorization: %v", key, err)
+			continue
+		}
+		if result != nil {
+			categorized := *result
+			return &categorized
+		}
+	}
+	return nil
+}
+
+// jiraCategory returns the category mapped from an issue's project, components,
+// labels and epic, caching the outcome per issue
+func jiraCategory(ctx context.Context, key string) (*CategoryResponse, error) {
+	jiraCategoryMu.Lock()
+	result, cached := jiraCategoryCache[key]
+	jiraCategoryMu.Unlock()
+	if cached {
+		return result, nil
+	}
+
+	issue, err := fetchJiraIssue(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// The epic costs another lookup, so it's only resolved when a mapping needs it
+	epic := ""
+	if slices.ContainsFunc(currentConfig().Jira.CategoryMappings, func(m JiraCategoryMapping) bool { return m.Epic != "" }) {
+		if epic, err = resolveEpic(ctx, key); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, mapping := range currentConfig().Jira.CategoryMappings {
+		matched := []string{}
+		if mapping.Project != "" {
+			if !strings.EqualFold(mapping.Project, jiraProject(issue.Key)) {
+				continue
+			}
+			matched = append(matched, "project "+mapping.Project)
+		}
+		if mapping.Component != "" {
+			if !slices.ContainsFunc(issue.Fields.Components, func(c jiraComponent) bool { return strings.EqualFold(c.Name, mapping.Component) }) {
+				continue
+			}
+			matched = append(matched, fmt.Sprintf("component %q", mapping.Component))
+		}
+		if mapping.Label != "" {
+			if !slices.ContainsFunc(issue.Fields.Labels, func(l string) bool { return strings.EqualFold(l, mapping.Label) }) {
+				continue
+			}
+			matched = append(matched, fmt.Sprintf("label %q", mapping.Label))
+		}
+		if mapping.Epic != "" {
+			if epic != mapping.Epic {
+				continue
+			}
+			matched = append(matched, "epic "+mapping.Epic)
+		}
+
+		result = &CategoryResponse{
+			Task:       mapping.Category,
+			Jira:       issue.Key,
+			Confidence: "high",
+			Reason:     fmt.Sprintf("Jira issue %s has %s, mapped to %s", issue.Key, strings.Join(matched, " and "), mapping.Category),
+		}
+		break
+	}
+
+	jiraCategoryMu.Lock()
+	jiraCategoryCache[key] = result
+	jiraCategoryMu.Unlock()
+
+	return result, nil
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const defaultTempoURL = "https://api.tempo.io/4"
+
+// worklogToleranceMinutes is how far Jira and local time may differ and still match,
+// covering rounding on either side
+const worklogToleranceMinutes = 5
+
+// Reconciliation statuses of a day's time on an issue
+const (
+	WorklogMatched        = "matched"
+	WorklogMismatch       = "mismatch"
+	WorklogMissingLocally = "missing_locally"
+	WorklogMissingInJira  = "missing_in_jira"
+)
+
+// Worklog is time logged against an issue in Jira or Tempo
+type Worklog struct {
+	ID      string    `json:"id"`
+	Jira    string    `json:"jira"`
+	Started time.Time `json:"started"`
+	Minutes int       `json:"minutes"`
+	Comment string    `json:"comment,omitempty"`
+}
+
+// WorklogReconciliation compares one day's time on an issue between Jira and the tracker
+type WorklogReconciliation struct {
+	Date         string   `json:"date"`
+	Jira         string   `json:"jira"`
+	Status       string   `json:"status"`
+	JiraMinutes  int      `json:"jira_minutes"`
+	LocalMinutes int      `json:"local_minutes"`
+	WorklogIDs   []string `json:"worklog_ids,omitempty"`
+	EntryIDs     []string `json:"entry_ids,omitempty"`
+	// Imported lists the entries created from worklogs missing locally
+	Imported []string `json:"imported,omitempty"`
+}
+
+// get calls the instance's REST API and decodes the response into result
+func (instance JiraInstance) get(ctx context.Context, path string, query url.Values, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimRight(instance.BaseURL, "/")+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.SetBasicAuth(instance.Email, instance.APIToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := jiraClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request to Jira: %w", err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Jira API returned error: %s - %s", resp.Status, string(responseBody))
+	}
+
+	return json.Unmarshal(responseBody, result)
+}
+
+// fetchWorklogs collects the worklogs between from and to (inclusive days) from every
+// Jira instance, read from Tempo for instances with a Tempo token. The source names
+// where they came from, "jira", "tempo" or both.
+func fetchWorklogs(ctx context.Context, from, to time.Time, location *time.Location) ([]Worklog, string, error) {
+	worklogs := []Worklog{}
+	sources := []string{}
+	for _, instance := range jiraInstances() {
+		source := "jira"
+		var instanceWorklogs []Worklog
+		var err error
+		if instance.TempoToken != "" {
+			source = "tempo"
+			instanceWorklogs, err = tempoWorklogs(ctx, instance, from, to, location)
+		} else {
+			instanceWorklogs, err = jiraWorklogs(ctx, instance, from, to)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", instance.Name, err)
+		}
+
+		worklogs = append(worklogs, instanceWorklogs...)
+		if !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	return worklogs, strings.Join(sources, ","), nil
+}
+
+// jiraWorklogs returns the Jira account's worklogs started between from and to (inclusive days)
+func jiraWorklogs(ctx context.Context, instance JiraInstance, from, to time.Time) ([]Worklog, error) {
+	var myself struct {
+		AccountID    string `json:"accountId"`
+		Name         string `json:"name"`
+		EmailAddress string `json:"emailAddress"`
+	}
+	if err := instance.get(ctx, "/rest/api/2/myself", url.Values{}, &myself); err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("jql", fmt.Sprintf(`worklogAuthor = currentUser() AND worklogDate >= "%s" AND worklogDate <= "%s"`, from.Format("2006-01-02"), to.Format("2006-01-02")))
+	query.Set("fields", "summary")
+	query.Set("maxResults", "100")
+
+	worklogs := []Worklog{}
+	for startAt := 0; ; {
+		query.Set("startAt", fmt.Sprint(startAt))
+
+		var search struct {
+			Total  int `json:"total"`
+			Issues []struct {
+				Key string `json:"key"`
+			} `json:"issues"`
+		}
+		if err := instance.get(ctx, "/rest/api/2/search", query, &search); err != nil {
+			return nil, err
+		}
+
+		for _, issue := range search.Issues {
+			var issueWorklogs struct {
+				Worklogs []struct {
+					ID     string `json:"id"`
+					Author struct {
+						AccountID    string `json:"accountId"`
+						Name         string `json:"name"`
+						EmailAddress string `json:"emailAddress"`
+					} `json:"author"`
+					Started          string `json:"started"`
+					TimeSpentSeconds int    `json:"timeSpentSeconds"`
+					Comment          string `json:"comment"`
+				} `json:"worklogs"`
+			}
+			if err := instance.get(ctx, "/rest/api/2/issue/"+issue.Key+"/worklog", url.Values{"maxResults": {"1000"}}, &issueWorklogs); err != nil {
+				return nil, err
+			}
+
+			for _, worklog := range issueWorklogs.Worklogs {
+				// Cloud identifies people by account ID, Server and Data Center by name
+				author := worklog.Author
+				if author.AccountID != myself.AccountID || author.Name != myself.Name {
+					continue
+				}
+
+				started, err := time.Parse("2006-01-02T15:04:05.000-0700", worklog.Started)
+				if err != nil {
+					return nil, fmt.Errorf("worklog %s: invalid start %q", worklog.ID, worklog.Started)
+				}
+
+				worklogs = append(worklogs, Worklog{
+					ID:      worklog.ID,
+					Jira:    issue.Key,
+					Started: started,
+					Minutes: (worklog.TimeSpentSeconds + 30) / 60,
+					Comment: worklog.Comment,
+				})
+			}
+		}
+
+		startAt += len(search.Issues)
+		if len(search.Issues) == 0 || startAt >= search.Total {
+			return worklogs, nil
+		}
+	}
+}
+
+// tempoWorklogs returns the Jira account's worklogs from Tempo between from and to (inclusive days)
+func tempoWorklogs(ctx context.Context, instance JiraInstance, from, to time.Time, location *time.Location) ([]Worklog, error) {
+	var myself struct {
+		AccountID string `json:"accountId"`
+	}
+	if err := instance.get(ctx, "/rest/api/2/myself", url.Values{}, &myself); err != nil {
+		return nil, err
+	}
+
+	baseURL := instance.TempoURL
+	if baseURL == "" {
+		baseURL = defaultTempoURL
+	}
+
+	query := url.Values{}
+	query.Set("from", from.Format("2006-01-02"))
+	query.Set("to", to.Format("2006-01-02"))
+	query.Set("limit", "1000")
+	next := strings.TrimRight(baseURL, "/") + "/worklogs/user/" + url.PathEscape(myself.AccountID) + "?" + query.Encode()
+
+	worklogs := []Worklog{}
+	issueKeys := make(map[int64]string)
+	for next != "" {
+		req, err := http.NewRequestWithContext(ctx, "GET", next, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+instance.TempoToken)
+
+		resp, err := jiraClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("error sending request to Tempo: %w", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading response body: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Tempo API returned error: %s - %s", resp.Status, string(body))
+		}
+
+		var page struct {
+			Metadata struct {
+				Next string `json:"next"`
+			} `json:"metadata"`
+			Results []struct {
+				TempoWorklogID int64 `json:"tempoWorklogId"`
+				Issue          struct {
+					ID int64 `json:"id"`
+				} `json:"issue"`
+				TimeSpentSeconds int    `json:"timeSpentSeconds"`
+				StartDate        string `json:"startDate"`
+				StartTime        string `json:"startTime"`
+				Description      string `json:"description"`
+			} `json:"results"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("error decoding Tempo worklogs: %w", err)
+		}
+
+		for _, result := range page.Results {
+			// Tempo only returns issue IDs, the key is looked up once per issue
+			key, found := issueKeys[result.Issue.ID]
+			if !found {
+				issue, err := instance.fetchIssue(ctx, fmt.Sprint(result.Issue.ID))
+				if err != nil {
+					return nil, err
+				}
+				key = issue.Key
+				issueKeys[result.Issue.ID] = key
+			}
+
+			started, err := time.ParseInLocation("2006-01-02 15:04:05", result.StartDate+" "+result.StartTime, location)
+			if err != nil {
+				return nil, fmt.Errorf("Tempo worklog %d: invalid start %s %s", result.TempoWorklogID, result.StartDate, result.StartTime)
+			}
+
+			worklogs = append(worklogs, Worklog{
+				ID:      fmt.Sprint(result.TempoWorklogID),
+				Jira:    key,
+				Started: started,
+				Minutes: (result.TimeSpentSeconds + 30) / 60,
+				Comment: result.Description,
+			})
+		}
+
+		next = page.Metadata.Next
+	}
+
+	return worklogs, nil
+}
+
+// reconcileWorklogs compares Jira and local time per day and issue. Local entries
+// without a Jira issue can't be compared and are left out.
+func reconcileWorklogs(worklogs []Worklog, entries []TimeEntry, location *time.Location) []WorklogReconciliation {
+	byKey := make(map[string]*WorklogReconciliation)
+	keys := []string{}
+	item := func(date, jira string) *WorklogReconciliation {
+		key := date + " " + jira
+		if byKey[key] == nil {
+			byKey[key] = &WorklogReconciliation{Date: date, Jira: jira}
+			keys = append(keys, key)
+		}
+		return byKey[key]
+	}
+
+	for _, worklog := range worklogs {
+		reconciliation := item(worklog.Started.In(location).Format("2006-01-02"), worklog.Jira)
+		reconciliation.JiraMinutes += worklog.Minutes
+		reconciliation.WorklogIDs = append(reconciliation.WorklogIDs, worklog.ID)
+	}
+
+	for _, entry := range entries {
+		if entry.Jira == "" {
+			continue
+		}
+		reconciliation := item(entry.Date, entry.Jira)
+		reconciliation.LocalMinutes += entryMinutes(entry)
+		reconciliation.EntryIDs = append(reconciliation.EntryIDs, entry.ID)
+	}
+
+	sort.Strings(keys)
+	reconciliations := []WorklogReconciliation{}
+	for _, key := range keys {
+		reconciliation := byKey[key]
+		difference := reconciliation.JiraMinutes - reconciliation.LocalMinutes
+		switch {
+		case reconciliation.LocalMinutes == 0:
+			reconciliation.Status = WorklogMissingLocally
+		case reconciliation.JiraMinutes == 0:
+			reconciliation.Status = WorklogMissingInJira
+		case difference > worklogToleranceMinutes || difference < -worklogToleranceMinutes:
+			reconciliation.Status = WorklogMismatch
+		default:
+			reconciliation.Status = WorklogMatched
+		}
+		reconciliations = append(reconciliations, *reconciliation)
+	}
+	return reconciliations
+}
+
+// jiraWorklogImportHandler pulls the worklogs already logged in each Jira instance (or
+// Tempo where a Tempo token is configured) for ?from=YYYYMMDD&to=YYYYMMDD, default this week, and
+// reconciles them with the current user's entries. Worklogs with no local time on
+// their day and issue are imported as entries, other differences are only flagged.
+// ?dry_run=true imports nothing.
+func jiraWorklogImportHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if !jiraConfigured() {
+		writeError(w, r, http.StatusServiceUnavailable, "Jira is not configured")
+		return
+	}
+
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	owner := currentUser(r).Name
+	location := userLocation(owner)
+
+	worklogs, source, err := fetchWorklogs(r.Context(), from, to, location)
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, "Error reading worklogs: "+err.Error())
+		return
+	}
+
+	all, err := readEntriesBetween(r.Context(), from, to)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error reading entries: "+err.Error())
+		return
+	}
+	entries := []TimeEntry{}
+	for _, entry := range all {
+		if entryOwner(entry) == owner {
+			entries = append(entries, entry)
+		}
+	}
+
+	reconciliations := reconcileWorklogs(worklogs, entries, location)
+
+	errors := []string{}
+	importedCount := 0
+	if !dryRun {
+		for i := range reconciliations {
+			reconciliation := &reconciliations[i]
+			if reconciliation.Status != WorklogMissingLocally {
+				continue
+			}
+
+			for _, worklog := range worklogs {
+				if worklog.Jira != reconciliation.Jira || worklog.Started.In(location).Format("2006-01-02") != reconciliation.Date {
+					continue
+				}
+
+				description := strings.TrimSpace(worklog.Comment)
+				if description == "" {
+					description = "Work on " + worklog.Jira
+				}
+				if len(description) > maxDescriptionLength {
+					description = description[:maxDescriptionLength]
+				}
+
+				entry := TimeEntry{
+					ID:          uuid.New().String(),
+					CreatedAt:   worklog.Started.Add(time.Duration(worklog.Minutes) * time.Minute).UTC().Format(time.RFC3339),
+					Timespan:    fmt.Sprintf("%dm", worklog.Minutes),
+					Description: description,
+					Jira:        worklog.Jira,
+					Categorized: false,
+					User:        entryUserName(currentUser(r)),
+				}
+				if err := appendEntry(r.Context(), worklog.Started.In(location), entry); err != nil {
+					errors = append(errors, fmt.Sprintf("Error importing worklog %s: %v", worklog.ID, err))
+					continue
+				}
+				reconciliation.Imported = append(reconciliation.Imported, entry.ID)
+				importedCount++
+			}
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, reconciliation := range reconciliations {
+		counts[reconciliation.Status]++
+	}
+
+	// Create response
+	response := map[string]interface{}{
+		"source":          source,
+		"from":            from.Format("2006-01-02"),
+		"to":              to.Format("2006-01-02"),
+		"dry_run":         dryRun,
+		"worklog_count":   len(worklogs),
+		"imported_count":  importedCount,
+		"status_counts":   counts,
+		"reconciliations": reconciliations,
+	}
+
+	if len(errors) > 0 {
+		response["errors"] = errors
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Label attribution modes, how reports count the time of an entry with several labels
+const (
+	AttributePrimary      = "primary"
+	AttributeProportional = "proportional"
+)
+
+var attributionModes = []string{AttributePrimary, AttributeProportional}
+
+// multiLabelPrompt asks the categorizer for the other categories an entry covers
+const multiLabelPrompt = "\n\nIf the entry also covers other categories or Jira issues besides the main one, " +
+	"add them as \"labels\": [{\"task\": \"<category>\", \"jira\": \"<key or empty>\", \"weight\": <fraction of the time>}]. " +
+	"Leave labels out when the entry covers a single category."
+
+// EntryLabel is an additional category of an entry in multi-label mode, the
+// entry's own task and Jira issue being its primary label
+type EntryLabel struct {
+	Task string `json:"task"`
+	Jira string `json:"jira,omitempty"`
+	// Weight is the fraction of the entry's time spent on this label, the
+	// primary label gets what the labels leave over
+	Weight float64 `json:"weight,omitempty"`
+}
+
+// labelShare is the time a report attributes to one label of an entry
+type labelShare struct {
+	Task    string
+	Jira    string
+	Minutes int
+}
+
+type attributionContextKey struct{}
+
+// withAttribution sets the label attribution mode reports use for a request
+func withAttribution(ctx context.Context, mode string) context.Context {
+	return context.WithValue(ctx, attributionContextKey{}, mode)
+}
+
+// attribution returns the mode set on the context, defaulting to the configured one
+func attribution(ctx context.Context) string {
+	if mode, ok := ctx.Value(attributionContextKey{}).(string); ok && mode != "" {
+		return mode
+	}
+	if mode := currentConfig().Categorization.LabelAttribution; mode != "" {
+		return mode
+	}
+	return AttributePrimary
+}
+
+// attributionContext applies ?attribution=primary|proportional to the request's context
+func attributionContext(r *http.Request) (context.Context, []ErrorDetail) {
+	mode := strings.ToLower(r.URL.Query().Get("attribution"))
+	v := &validator{}
+	v.oneOf("attribution", mode, attributionModes)
+	if len(v.details) > 0 || mode == "" {
+		return r.Context(), v.details
+	}
+	return withAttribution(r.Context(), mode), nil
+}
+
+// attributeMinutes splits an entry's minutes between its labels. In primary mode,
+// or for an entry without labels, the primary label gets all of it.
+func attributeMinutes(ctx context.Context, entry TimeEntry, minutes int) []labelShare {
+	primary := labelShare{Task: entry.Task, Jira: entry.Jira, Minutes: minutes}
+	if len(entry.Labels) == 0 || attribution(ctx) != AttributeProportional {
+		return []labelShare{primary}
+	}
+
+	// Without usable weights every label counts the same
+	weights := []float64{1}
+	var sum float64
+	usable := true
+	for _, label := range entry.Labels {
+		weights = append(weights, label.Weight)
+		sum += label.Weight
+		usable = usable && label.Weight > 0
+	}
+	if usable && sum < 1 {
+		weights[0] = 1 - sum
+	} else {
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+
+	shares := []labelShare{primary}
+	for _, label := range entry.Labels {
+		shares = append(shares, labelShare{Task: label.Task, Jira: label.Jira})
+	}
+	for i, portion := range apportion(minutes, weights) {
+		shares[i].Minutes = portion
+	}
+	return shares
+}
+
+// cleanLabels keeps the labels of a categorization in multi-label mode, mapped
+// onto the taxonomy and without repeating the primary label
+func cleanLabels(result *CategoryResponse) []EntryLabel {
+	if !currentConfig().Categorization.MultiLabel {
+		return nil
+	}
+
+	labels := []EntryLabel{}
+	for _, label := range result.Labels {
+		label.Task = strings.TrimSpace(label.Task)
+		if label.Task == "" || len(labels) == maxLabels {
+			continue
+		}
+		if !jiraKeyPattern.MatchString(label.Jira) {
+			label.Jira = ""
+		}
+		if mode := currentConfig().Taxonomy.Enforcement; mode != "" && mode != TaxonomyOff {
+			var known bool
+			label.Task, known = canonicalCategory(label.Task)
+			if !known && mode == TaxonomyStrict {
+				continue
+			}
+		}
+		if label.Weight < 0 || label.Weight > 1 {
+			label.Weight = 0
+		}
+		if strings.EqualFold(label.Task, result.Task) && label.Jira == result.Jira {
+			continue
+		}
+		labels = append(labels, label)
+	}
+
+	if len(labels) == 0 {
+		return nil
+	}
+
+	// Weights leaving no time for the primary label are dropped for an equal split
+	var total float64
+	for _, label := range labels {
+		total += label.Weight
+	}
+	if total >= 1 {
+		for i := range labels {
+			labels[i].Weight = 0
+		}
+	}
+	return labels
+}
+
+// encodeLabels stores labels in their CSV column as JSON
+func encodeLabels(labels []EntryLabel) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// decodeLabels reads the labels column, ignoring a value that isn't valid JSON
+func decodeLabels(value string) []EntryLabel {
+	if value == "" {
+		return nil
+	}
+	var labels []EntryLabel
+	if err := json.Unmarshal([]byte(value), &labels); err != nil {
+		return nil
+	}
+	return labels
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"unicode"
+)
+
+// MultilingualConfig controls translation of descriptions written in other languages
+type MultilingualConfig struct {
+	// Translate sends descriptions detected as another language through the LLM for an
+	// English translation before embedding and categorization
+	Translate bool `json:"translate"`
+}
+
+// languageNames are the languages detectLanguage recognizes
+var languageNames = map[string]string{
+	"en": "English",
+	"de": "German",
+	"fr": "French",
+	"es": "Spanish",
+	"it": "Italian",
+	"nl": "Dutch",
+	"pt": "Portuguese",
+}
+
+// languageWords are frequent function words and common work vocabulary per language.
+// Words shared between languages are left out so each hit is a clear signal.
+var languageWords = map[string][]string{
+	"en": {"the", "and", "with", "for", "of", "to", "on", "meeting", "fixed", "call", "review", "wrote", "worked"},
+	"de": {"und", "der", "die", "das", "mit", "für", "ein", "eine", "nicht", "besprechung", "mit dem", "fehler", "behoben", "überprüft", "zur", "zum", "im", "auf"},
+	"fr": {"le", "la", "les", "et", "avec", "pour", "des", "du", "une", "réunion", "correction", "revue", "sur", "au", "aux"},
+	"es": {"el", "los", "las", "y", "del", "reunión", "corrección", "revisión", "por", "en el"},
+	"it": {"il", "gli", "per", "della", "delle", "riunione", "correzione", "revisione", "nel"},
+	"nl": {"het", "een", "en", "met", "voor", "van", "vergadering", "opgelost", "bij", "naar"},
+	"pt": {"os", "com", "uma", "reunião", "correção", "revisão", "não", "na"},
+}
+
+// languageLetters are letters found only, or almost only, in one language's spelling
+var languageLetters = map[rune]string{
+	'ß': "de", 'ä': "de", 'ö': "de", 'ü': "de",
+	'è': "fr", 'ê': "fr", 'ç': "fr", 'à': "fr", 'œ': "fr",
+	'ñ': "es", '¿': "es", '¡': "es",
+	'ã': "pt", 'õ': "pt",
+}
+
+// detectLanguage guesses the language of a short description, returning "" when
+// there is no clear signal. Time entries are terse, so an unclear entry is treated
+// as the default language rather than guessed at.
+func detectLanguage(text string) string {
+	lower := strings.ToLower(text)
+	scores := make(map[string]int)
+
+	for _, r := range lower {
+		if language, ok := languageLetters[r]; ok {
+			scores[language] += 2
+		}
+	}
+
+	words := strings.FieldsFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	padded := " " + strings.Join(words, " ") + " "
+	for language, vocabulary := range languageWords {
+		for _, word := range vocabulary {
+			scores[language] += strings.Count(padded, " "+word+" ")
+		}
+	}
+
+	best, bestScore, tied := "", 0, false
+	for language, score := range scores {
+		switch {
+		case score > bestScore:
+			best, bestScore, tied = language, score, false
+		case score == bestScore:
+			tied = true
+		}
+	}
+
+	if bestScore < 2 || tied {
+		return ""
+	}
+	return best
+}
+
+// translateDescription returns the English text to categorize and the detected
+// source language, or the description unchanged and "" when no translation is needed.
+// A failed translation falls back to the original text.
+func translateDescription(ctx context.Context, description string) (string, string) {
+	if !currentConfig().LLM.Multilingual.Translate {
+		return description, ""
+	}
+
+	language := detectLanguage(description)
+	if language == "" || language == "en" {
+		return description, ""
+	}
+
+	translation, err := llm().Translate(ctx, description, language)
+	if err != nil || strings.TrimSpace(translation) == "" {
+		log.Printf("Error translating %s description, categorizing it untranslated: %v", languageNames[language], err)
+		return description, ""
+	}
+
+	return translation, language
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// LinkRequest represents the JSON request for attaching or removing an entry link
+type LinkRequest struct {
+	URL string `json:"url"`
+}
+
+// linkContext summarizes what a link points at for the categorizer, e.g. the Jira
+// issue of a browse URL, a GitHub PR, or otherwise the site it's on
+func linkContext(link string) string {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	host := strings.TrimPrefix(strings.ToLower(parsed.Host), "www.")
+
+	switch {
+	case jiraBrowsePattern.MatchString(parsed.Path):
+		return jiraBrowsePattern.FindStringSubmatch(parsed.Path)[1]
+	case host == "github.com" && githubPathPattern.MatchString(parsed.Path):
+		match := githubPathPattern.FindStringSubmatch(parsed.Path)
+		kind := "PR"
+		if match[3] == "issues" {
+			kind = "issue"
+		}
+		return fmt.Sprintf("GitHub %s %s/%s#%s", kind, match[1], match[2], match[4])
+	default:
+		return host
+	}
+}
+
+// categorizationText is what the categorizer sees for an entry: its description
+// followed by its Jira issue and what its links point at, which often name the
+// project or issue, and the user's answers to clarifying questions
+func categorizationText(entry TimeEntry) string {
+	return clarifiedText(referencedText(entry), entry.Clarification)
+}
+
+// referencedText is an entry's description with its Jira issue and link summaries
+func referencedText(entry TimeEntry) string {
+	contexts := []string{}
+	if entry.Jira != "" && !strings.Contains(entry.Description, entry.Jira) {
+		contexts = append(contexts, entry.Jira)
+	}
+	for _, link := range entry.Links {
+		if summary := linkContext(link); summary != "" && !slices.Contains(contexts, summary) {
+			contexts = append(contexts, summary)
+		}
+	}
+
+	if len(contexts) == 0 {
+		return entry.Description
+	}
+	return fmt.Sprintf("%s (references: %s)", entry.Description, strings.Join(contexts, ", "))
+}
+
+// entryLinksHandler attaches (POST) or removes (DELETE) a link on an entry. The
+// entry's day is given as ?date=YYYYMMDD and defaults to today.
+func entryLinksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	// Parse JSON request
+	var request LinkRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+		return
+	}
+
+	v := &validator{}
+	if request.URL == "" {
+		v.add("url", "url is required")
+	}
+	v.links("url", []string{request.URL})
+	if len(v.details) > 0 {
+		writeValidationError(w, r, v.details...)
+		return
+	}
+
+	day, existing, ok := lookupEntry(w, r)
+	if !ok {
+		return
+	}
+	if r.Method == http.MethodPost && !slices.Contains(existing.Links, request.URL) && len(existing.Links) >= maxLinks {
+		writeValidationError(w, r, ErrorDetail{Field: "url", Message: fmt.Sprintf("an entry can have at most %d links", maxLinks)})
+		return
+	}
+
+	entry, err := updateEntry(r.Context(), day, existing.ID, func(e *TimeEntry) {
+		if r.Method == http.MethodDelete {
+			e.Links = slices.DeleteFunc(e.Links, func(link string) bool { return link == request.URL })
+		} else if !slices.Contains(e.Links, request.URL) {
+			e.Links = append(e.Links, request.URL)
+		}
+	})
+	if errors.Is(err, errWeekFrozen) {
+		writeErrorCode(w, r, http.StatusConflict, ErrCodeWeekFrozen, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving entry: "+err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(localizeEntry(*entry, userLocation(currentUser(r).Name)))
+}
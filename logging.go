@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log outputs
+const (
+	LogStderr = "stderr"
+	LogStdout = "stdout"
+	LogFile   = "file"
+	LogBoth   = "both"
+)
+
+// Log rotation schedules, besides rotating by size
+const (
+	RotateDaily  = "daily"
+	RotateHourly = "hourly"
+)
+
+// LoggingConfig controls where the log goes and how log files are rotated
+type LoggingConfig struct {
+	// Output is "stderr" (default), "stdout", "file", or "both" for the file and stderr
+	Output string `json:"output"`
+	// File is the log file, default aidea.log in the log directory
+	File string `json:"file,omitempty"`
+	// MaxSizeMB rotates the file once it grows past this size, default 10
+	MaxSizeMB int `json:"max_size_mb,omitempty"`
+	// Rotate also rotates the file "daily" or "hourly"
+	Rotate string `json:"rotate,omitempty"`
+	// MaxBackups is how many rotated files are kept, default 5
+	MaxBackups int `json:"max_backups,omitempty"`
+}
+
+// rotatingFile is a log file that is renamed aside, with the time it was rotated,
+// once it is too large or its period is over
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	rotate     string
+	maxBackups int
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// openRotatingFile opens or creates the log file, appending to it
+func openRotatingFile(config LoggingConfig) (*rotatingFile, error) {
+	path := config.File
+	if path == "" {
+		path = filepath.Join(appDirs.Logs, "aidea.log")
+	}
+	maxSize := int64(config.MaxSizeMB) << 20
+	if maxSize <= 0 {
+		maxSize = 10 << 20
+	}
+	maxBackups := config.MaxBackups
+	if maxBackups <= 0 {
+		maxBackups = 5
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f := &rotatingFile{path: path, maxSize: maxSize, rotate: config.Rotate, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the log file, callers must hold mu
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = info.ModTime()
+	if f.size == 0 {
+		f.openedAt = time.Now()
+	}
+	return nil
+}
+
+// periodOver reports whether the file's rotation period ended since it was opened
+func (f *rotatingFile) periodOver(now time.Time) bool {
+	switch f.rotate {
+	case RotateDaily:
+		return now.Format("20060102") != f.openedAt.Format("20060102")
+	case RotateHourly:
+		return now.Format("2006010215") != f.openedAt.Format("2006010215")
+	default:
+		return false
+	}
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if f.size > 0 && (f.size+int64(len(p)) > f.maxSize || f.periodOver(now)) {
+		if err := f.rotateFile(now); err != nil {
+			// Keep logging to the current file rather than losing the line
+			fmt.Fprintf(os.Stderr, "Error rotating %s: %v\n", f.path, err)
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotateFile renames the file aside and starts a new one, callers must hold mu
+func (f *rotatingFile) rotateFile(now time.Time) error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	extension := filepath.Ext(f.path)
+	backup := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(f.path, extension), now.Format("20060102T150405.000"), extension)
+	renameErr := os.Rename(f.path, backup)
+	if err := f.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+
+	f.pruneBackups()
+	return nil
+}
+
+// pruneBackups removes the oldest rotated files beyond maxBackups
+func (f *rotatingFile) pruneBackups() {
+	extension := filepath.Ext(f.path)
+	backups, err := filepath.Glob(strings.TrimSuffix(f.path, extension) + "-*" + extension)
+	if err != nil || len(backups) <= f.maxBackups {
+		return
+	}
+
+	// The timestamp in the name sorts oldest first
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-f.maxBackups] {
+		os.Remove(backup)
+	}
+}
+
+// configureLogging points the log at the configured output
+func configureLogging(config LoggingConfig) error {
+	switch config.Rotate {
+	case "", RotateDaily, RotateHourly:
+	default:
+		return fmt.Errorf("unknown log rotation %q, expected daily or hourly", config.Rotate)
+	}
+
+	var output io.Writer
+	switch config.Output {
+	case "", LogStderr:
+		output = os.Stderr
+	case LogStdout:
+		output = os.Stdout
+	case LogFile, LogBoth:
+		file, err := openRotatingFile(config)
+		if err != nil {
+			return fmt.Errorf("couldn't open the log file: %v", err)
+		}
+		output = file
+		if config.Output == LogBoth {
+			output = io.MultiWriter(os.Stderr, file)
+		}
+	default:
+		return fmt.Errorf("unknown log output %q, expected stderr, stdout, file or both", config.Output)
+	}
+
+	log.SetOutput(output)
+	return nil
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,6 +21,8 @@ import (
 // TimeEntry represents a single time tracking entry
 type TimeEntry struct {
 	ID          string `json:"id,omitempty"`
+	Date        string `json:"date,omitempty"`
+	CreatedAt   string `json:"created_at,omitempty"` // RFC 3339 in UTC
 	Timespan    string `json:"timespan,omitempty"`
 	Description string `json:"description"`
 	Task        string `json:"task,omitempty"`
@@ -23,16 +30,37 @@ type TimeEntry struct {
 	Jira        string `json:"jira,omitempty"`
 	Confidence  string `json:"confidence,omitempty"`
 	Categorized bool   `json:"categorized,omitempty"`
+	User        string `json:"user,omitempty"`
+	// InputHash identifies the LLM inputs behind the categorization in deterministic mode
+	InputHash string `json:"input_hash,omitempty"`
+	// DeletedAt (RFC 3339 in UTC) marks an entry moved to the trash
+	DeletedAt string   `json:"deleted_at,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	// Links are reference URLs such as the PR, doc or meeting the work was about
+	Links []string `json:"links,omitempty"`
+	// Labels are further categories of the entry in multi-label mode, Task and
+	// Jira being the primary one
+	Labels []EntryLabel `json:"labels,omitempty"`
+	// Question asks the user to clarify a low-confidence categorization, and
+	// Clarification keeps the questions answered so far with their answers
+	Question      string `json:"question,omitempty"`
+	Clarification string `json:"clarification,omitempty"`
 }
 
 // TimeEntryRequest represents the JSON request for creating a time entry
 type TimeEntryRequest struct {
 	Description string `json:"description"`
+	// Timespan and Jira are optional, the categorizer fills them in when empty
+	Timespan string `json:"timespan,omitempty"`
+	Jira     string `json:"jira,omitempty"`
+	// Date (YYYYMMDD) logs the entry on another day, defaults to today
+	Date  string   `json:"date,omitempty"`
+	Links []string `json:"links,omitempty"`
 }
 
 func main() {
 	// Check if we're running the test command
-	if len(os.Args) > 1 && os.Args[0] == "test_ollama" {
+	if len(os.Args) > 1 && filepath.Base(os.Args[0]) == "test_ollama" {
 		// We're running the test binary
 		if len(os.Args) < 2 {
 			fmt.Println("Usage: ./test_ollama \"Your task description here\"")
@@ -42,36 +70,295 @@ func main() {
 		return
 	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/api/v1/save_time", saveTimeHandler)
-	mux.HandleFunc("/api/v1/categorize", categorizeHandler)
+	// Files live in the OS config and data directories, or --data-dir
+	args, err := useAppDirs(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Args = append(os.Args[:1], args...)
+
+	// "aidea init" walks through a first-run setup instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		if err := runInit(os.Stdin, os.Stdout); err != nil {
+			log.Fatal("Error running setup: ", err)
+		}
+		return
+	}
+
+	// "aidea version" prints the build and checks for a newer release when enabled
+	if len(os.Args) > 1 && os.Args[1] == "version" {
+		if config, err := loadConfig(); err == nil {
+			setConfig(config)
+		}
+		printVersion()
+		return
+	}
+
+	// "aidea bench" times the similarity, the rule matcher and the storage layer
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		if err := runBench(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal("Error running benchmarks: ", err)
+		}
+		return
+	}
 
-	// Start the server
-	fmt.Println("Server starting on :8080...")
-	err := http.ListenAndServe(":8080", mux)
+	// "aidea service install|uninstall" runs the daemon at login with systemd or launchd
+	if len(os.Args) > 1 && os.Args[1] == "service" {
+		if err := runService(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal("Error managing the service: ", err)
+		}
+		return
+	}
+
+	// "aidea workspace export|import FILE" moves every entry, rule and setting between machines
+	if len(os.Args) > 1 && os.Args[1] == "workspace" {
+		config, err := loadConfig()
+		if err != nil {
+			log.Fatal("Error loading config: ", err)
+		}
+		if err := useStorageConfig(config); err != nil {
+			log.Fatal("Error configuring storage: ", err)
+		}
+		if err := runWorkspace(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal("Error moving the workspace: ", err)
+		}
+		return
+	}
+
+	// "aidea migrate [status|up|down]" upgrades or rolls back the data file schema
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		config, err := loadConfig()
+		if err != nil {
+			log.Fatal("Error loading config: ", err)
+		}
+		if err := useStorageConfig(config); err != nil {
+			log.Fatal("Error configuring storage: ", err)
+		}
+		if err := runMigrate(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal("Error migrating storage: ", err)
+		}
+		return
+	}
+
+	// "aidea daemon" runs the server under a service manager, with a PID file
+	daemon := len(os.Args) > 1 && os.Args[1] == "daemon"
+
+	// --demo runs on sample data in its own directory with the mock provider
+	demo := slices.Contains(os.Args[1:], "--demo")
+
+	// Load configuration, falling back to defaults when config.json is absent
+	var config Config
+	if demo {
+		config, err = demoConfig()
+	} else {
+		config, err = loadConfig()
+	}
 	if err != nil {
+		log.Fatal("Error loading config: ", err)
+	}
+	if err := configureLogging(config.Logging); err != nil {
+		log.Fatal("Error configuring logging: ", err)
+	}
+	if _, err := os.Stat(locateFile("config.json")); os.IsNotExist(err) && !demo {
+		log.Println("No config.json found, using defaults. Run \"aidea init\" or POST /api/v1/setup to create one.")
+	}
+
+	// Check every setting and select the categorization backend, "mock" runs without Ollama
+	state, err := prepareConfig(config)
+	if err != nil {
+		log.Fatal("Error loading config: ", err)
+	}
+	activateConfig(state)
+
+	// Bring data files written by older versions up to the current schema
+	migrated, err := migrateStorage(false)
+	if err != nil {
+		log.Fatal("Error migrating storage: ", err)
+	}
+	for _, result := range migrated {
+		if len(result.Files) > 0 {
+			log.Printf("Migrated %d rows in %d data files to schema version %d (%s)", result.Rows, len(result.Files), result.Version, result.Name)
+		}
+	}
+
+	if err := startEventBus(config.Events); err != nil {
+		log.Fatal("Error configuring event sinks: ", err)
+	}
+	if err := startEntryStream(config.Stream); err != nil {
+		log.Fatal("Error configuring entry stream: ", err)
+	}
+
+	if demo {
+		if err := seedDemoData(context.Background()); err != nil {
+			log.Fatal("Error seeding demo data: ", err)
+		}
+		log.Printf("Demo mode: sample data in %s, categorization uses the mock provider", demoDir)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/save_time", requireScope(ScopeEntriesWrite, saveTimeHandler))
+	mux.HandleFunc("/api/v1/activity", requireScope(ScopeEntriesWrite, saveTimeHandler))
+	mux.HandleFunc("/api/v1/activity/bulk", requireScope(ScopeEntriesWrite, bulkHandler))
+	mux.HandleFunc("/api/v1/activity/{id}", requireScope(ScopeEntriesWrite, deleteEntryHandler))
+	mux.HandleFunc("/api/v1/activity/{id}/accept", requireScope(ScopeEntriesWrite, acceptEntryHandler))
+	mux.HandleFunc("/api/v1/activity/{id}/links", requireScope(ScopeEntriesWrite, entryLinksHandler))
+	mux.HandleFunc("/api/v1/activity/{id}/clarify", requireScope(ScopeEntriesWrite, clarifyEntryHandler))
+	mux.HandleFunc("/api/v1/activity/{id}/split", requireScope(ScopeEntriesWrite, splitEntryHandler))
+	mux.HandleFunc("/api/v1/splits", requireScope(ScopeEntriesRead, splitsHandler))
+	mux.HandleFunc("/api/v1/splits/{id}/{action}", requireScope(ScopeEntriesWrite, reviewSplitHandler))
+	mux.HandleFunc("/api/v1/activity/{id}/explanation", requireScope(ScopeEntriesRead, explanationHandler))
+	mux.HandleFunc("/api/v1/entries/embed", requireRole(RoleAdmin, ScopeAdmin, embedEntriesHandler))
+	mux.HandleFunc("/api/v1/trash", requireScope(ScopeEntriesRead, trashHandler))
+	mux.HandleFunc("/api/v1/trash/{id}/restore", requireScope(ScopeEntriesWrite, restoreEntryHandler))
+	mux.HandleFunc("/api/v1/suggestions", requireScope(ScopeEntriesRead, withView(suggestionsHandler)))
+	mux.HandleFunc("/api/v1/categorize", requireScope(ScopeEntriesWrite, categorizeHandler))
+	mux.HandleFunc("/api/v1/classify", requireScope(ScopeEntriesWrite, classifyHandler))
+	mux.HandleFunc("/api/v1/summary", requireScope(ScopeReportsRead, withView(summaryHandler)))
+	mux.HandleFunc("/api/v1/pomodoro", requireScope(ScopeEntriesRead, pomodoroStatusHandler))
+	mux.HandleFunc("/api/v1/pomodoro/start", requireScope(ScopeEntriesWrite, pomodoroStartHandler))
+	mux.HandleFunc("/api/v1/pomodoro/interrupt", requireScope(ScopeEntriesWrite, pomodoroInterruptHandler))
+	mux.HandleFunc("/api/v1/pomodoro/cancel", requireScope(ScopeEntriesWrite, pomodoroCancelHandler))
+	mux.HandleFunc("/api/v1/import/activitywatch", requireScope(ScopeEntriesWrite, activityWatchImportHandler))
+	mux.HandleFunc("/api/v1/import/rescuetime", requireScope(ScopeEntriesWrite, rescueTimeImportHandler))
+	mux.HandleFunc("/api/v1/import/github", requireScope(ScopeEntriesWrite, githubImportHandler))
+	mux.HandleFunc("/api/v1/import/gitlab", requireScope(ScopeEntriesWrite, gitlabImportHandler))
+	mux.HandleFunc("/api/v1/import/zoom", requireScope(ScopeEntriesWrite, zoomImportHandler))
+	mux.HandleFunc("/api/v1/import/entries", requireScope(ScopeEntriesWrite, importEntriesHandler))
+	mux.HandleFunc("/api/v1/import/jobs", requireScope(ScopeEntriesRead, importJobsHandler))
+	mux.HandleFunc("/api/v1/import/jobs/{id}", requireScope(ScopeEntriesRead, importJobHandler))
+	mux.HandleFunc("/api/v1/import/jobs/{id}/errors", requireScope(ScopeEntriesRead, importJobErrorsHandler))
+	mux.HandleFunc("/api/v1/import/jobs/{id}/resume", requireScope(ScopeEntriesWrite, importJobResumeHandler))
+	mux.HandleFunc("/api/v1/import/jira-worklogs", requireScope(ScopeEntriesWrite, jiraWorklogImportHandler))
+	mux.HandleFunc("/api/v1/export/csv", requireScope(ScopeEntriesRead, withView(exportCSVHandler)))
+	mux.HandleFunc("/api/v1/sync/harvest", requireScope(ScopeTimesheetsWrite, harvestSyncHandler))
+	mux.HandleFunc("/api/v1/timesheets", requireScope(ScopeReportsRead, listTimesheetsHandler))
+	mux.HandleFunc("/api/v1/timesheets/submit", requireScope(ScopeTimesheetsWrite, submitTimesheetHandler))
+	mux.HandleFunc("/api/v1/timesheets/{user}/{week}/{action}", requireRole(RoleReviewer, ScopeTimesheetsReview, reviewTimesheetHandler))
+	mux.HandleFunc("/api/v1/reports/team", requireRole(RoleManager, ScopeReportsRead, withView(teamReportHandler)))
+	mux.HandleFunc("/api/v1/reports/utilization", requireScope(ScopeReportsRead, withView(utilizationReportHandler)))
+	mux.HandleFunc("/api/v1/reports/retro", requireScope(ScopeReportsRead, withView(retroReportHandler)))
+	mux.HandleFunc("/api/v1/reports/anomalies", requireScope(ScopeReportsRead, withView(anomalyReportHandler)))
+	mux.HandleFunc("/api/v1/reports/forecast", requireScope(ScopeReportsRead, withView(forecastReportHandler)))
+	mux.HandleFunc("/api/v1/reports/reconcile", requireScope(ScopeReportsRead, reconcileReportHandler))
+	mux.HandleFunc("/api/v1/reports/clusters", requireScope(ScopeReportsRead, withView(clusterReportHandler)))
+	mux.HandleFunc("/api/v1/reports/drift", requireRole(RoleAdmin, ScopeReportsRead, driftReportHandler))
+	mux.HandleFunc("/api/v1/reports/chart", requireScope(ScopeReportsRead, withView(chartReportHandler)))
+	mux.HandleFunc("/api/v1/reports/rollups", requireScope(ScopeReportsRead, withView(rollupReportHandler)))
+	mux.HandleFunc("/reports/week/{date}", requireScope(ScopeReportsRead, withView(weekReportHandler)))
+	mux.HandleFunc("/api/v1/tokens", requireScope(ScopeAdmin, tokensHandler))
+	mux.HandleFunc("/api/v1/tokens/{id}", requireScope(ScopeAdmin, revokeTokenHandler))
+	mux.HandleFunc("/api/v1/quick", quickEntryHandler)
+	mux.HandleFunc("/api/v1/rules", rulesHandler)
+	mux.HandleFunc("/api/v1/rules/test", requireScope(ScopeRulesWrite, testRulesHandler))
+	mux.HandleFunc("/api/v1/rules/reembed", requireScope(ScopeRulesWrite, reembedRulesHandler))
+	mux.HandleFunc("/api/v1/rules/{id}", ruleHandler)
+	mux.HandleFunc("/api/v1/aliases", aliasesHandler)
+	mux.HandleFunc("/api/v1/aliases/{id}", aliasHandler)
+	mux.HandleFunc("/api/v1/preferences", preferencesHandler)
+	mux.HandleFunc("/api/v1/views", viewsHandler)
+	mux.HandleFunc("/api/v1/views/{id}", viewHandler)
+	mux.HandleFunc("/api/v1/categories", categoriesHandler)
+	mux.HandleFunc("/api/v1/categories/{id}", categoryHandler)
+	mux.HandleFunc("/api/v2/activity", activityV2Handler)
+	mux.HandleFunc("/api/v2/summary", requireScope(ScopeReportsRead, summaryV2Handler))
+	mux.HandleFunc("/readyz", readyHandler)
+	mux.HandleFunc("/api/v1/version", versionHandler)
+	mux.HandleFunc("/api/v1/setup", requireRole(RoleAdmin, ScopeAdmin, setupHandler))
+	mux.HandleFunc("/api/v1/admin/maintenance", requireRole(RoleAdmin, ScopeAdmin, maintenanceHandler))
+	mux.HandleFunc("/api/v1/admin/compact", requireRole(RoleAdmin, ScopeAdmin, compactHandler))
+	mux.HandleFunc("/api/v1/admin/workspace", requireRole(RoleAdmin, ScopeAdmin, workspaceHandler))
+	mux.HandleFunc("/api/v1/stats/performance", requireRole(RoleAdmin, ScopeAdmin, performanceHandler))
+	mux.HandleFunc("/api/v1/stats/experiments", requireRole(RoleAdmin, ScopeAdmin, experimentsHandler))
+	registerDiagnostics(mux)
+	if oidcConfigured() {
+		mux.HandleFunc("/auth/login", oidcLoginHandler)
+		mux.HandleFunc("/auth/callback", oidcCallbackHandler)
+		mux.HandleFunc("/auth/logout", oidcLogoutHandler)
+	}
+	if config.Teams.OutgoingSecret != "" {
+		mux.HandleFunc("/api/v1/teams/messages", teamsMessageHandler)
+	}
+	if config.EmailIn.Secret != "" {
+		mux.HandleFunc("/api/v1/inbound/email", emailInHandler)
+	}
+
+	// Start optional chat integrations
+	if config.Telegram.BotToken != "" {
+		startTelegramBot(config.Telegram)
+	}
+	if config.Teams.WebhookURL != "" && config.Teams.SummaryTime != "" {
+		startTeamsSummaryScheduler(config.Teams)
+	}
+
+	// Load holiday and PTO calendars
+	startCalendar(config.Calendar)
+
+	// Empty the trash of entries past the retention period
+	startTrashPurge(config.Entries)
+
+	// Embed entries as they are saved
+	startEntryEmbedder(config.Entries)
+	syncVectorStore()
+
+	// Sum the recent days up front so the first reports don't have to
+	go warmAggregates(config.Entries)
+
+	// Roll finished weeks and months up for long-range reports
+	startRollups(config.Reports)
+
+	// Warn when the rules no longer match what's being logged
+	startDriftMonitor(config.Rules.Drift)
+
+	// Remind users who set a reminder schedule and haven't logged time
+	startReminderScheduler()
+
+	// Export traces when an OpenTelemetry collector is configured
+	if config.Tracing.Enabled {
+		startTraceExporter(config.Tracing)
+	}
+
+	// Start the server, SIGHUP reloads the config and rules and SIGTERM shuts it down
+	server := &http.Server{Addr: ":8080", Handler: tracingMiddleware(requestIDMiddleware(apiVersionMiddleware(maintenanceMiddleware(performanceMiddleware(mux)))))}
+	pidFile := ""
+	if daemon {
+		pidFile = filepath.Join(appDirs.Data, pidFileName)
+		if err := writePIDFile(pidFile); err != nil {
+			log.Fatal("Error writing PID file: ", err)
+		}
+	}
+	stopped := make(chan struct{})
+	go func() {
+		handleSignals(server, pidFile)
+		close(stopped)
+	}()
+
+	fmt.Printf("Server %s starting on :8080...\n", version)
+	err = server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal("ListenAndServe: ", err)
 	}
+	// Wait for in-flight requests to finish
+	<-stopped
 }
 
 func saveTimeHandler(w http.ResponseWriter, r *http.Request) {
 	// Only allow POST method
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	// Check content type
 	contentType := r.Header.Get("Content-Type")
 	if contentType != "application/json" {
-		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		writeError(w, r, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
 		return
 	}
 
 	// Read request body
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Error reading request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
 		return
 	}
 	defer r.Body.Close()
@@ -80,33 +367,48 @@ func saveTimeHandler(w http.ResponseWriter, r *http.Request) {
 	var request TimeEntryRequest
 	err = json.Unmarshal(body, &request)
 	if err != nil {
-		http.Error(w, "Error parsing JSON: "+err.Error(), http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
 		return
 	}
 
-	// Validate required fields
-	if request.Description == "" {
-		http.Error(w, "Description is required", http.StatusBadRequest)
+	// Validate every field at once
+	if details := validateEntryRequest(request); len(details) > 0 {
+		writeValidationError(w, r, details...)
 		return
 	}
 
 	// Create a new time entry
 	entry := TimeEntry{
 		ID:          uuid.New().String(),
+		Timespan:    request.Timespan,
+		Jira:        request.Jira,
 		Description: request.Description,
 		Categorized: false,
+		User:        entryUserName(currentUser(r)),
+		Links:       request.Links,
+	}
+
+	day, err := resolveEntryDay(request.Date, entryOwner(entry))
+	if err != nil {
+		writeValidationError(w, r, ErrorDetail{Field: "date", Message: err.Error()})
+		return
 	}
 
 	// Save to CSV
-	err = saveToCSV(entry)
+	err = appendEntry(r.Context(), day, entry)
+	if errors.Is(err, errWeekFrozen) {
+		writeErrorCode(w, r, http.StatusConflict, ErrCodeWeekFrozen, err.Error())
+		return
+	}
 	if err != nil {
-		http.Error(w, "Error saving data: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, "Error saving data: "+err.Error())
 		return
 	}
 
 	// Create JSON response
 	response := map[string]string{
 		"id":      entry.ID,
+		"date":    day.Format("20060102"),
 		"message": "Time entry saved successfully",
 	}
 
@@ -116,17 +418,76 @@ func saveTimeHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func saveToCSV(entry TimeEntry) error {
-	// Generate filename based on current date
-	currentDate := time.Now().Format("20060102") // Format for YYYYMMDD
-	filename := fmt.Sprintf("aidea_time_tracking_%s.csv", currentDate)
+// resolveEntryDay parses the requested entry date in the owner's time zone,
+// enforcing the configured backdating and future-dating limits
+func resolveEntryDay(value string, owner string) (time.Time, error) {
+	today := userToday(owner)
+	if value == "" {
+		return today, nil
+	}
+
+	day, err := time.ParseInLocation("20060102", value, today.Location())
+	if err != nil {
+		return today, fmt.Errorf("date must be in YYYYMMDD format")
+	}
+
+	midnight := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
+	limits := currentConfig().Entries
+	if day.Before(midnight.AddDate(0, 0, -limits.MaxPastDays)) {
+		return today, fmt.Errorf("date can't be more than %d days in the past", limits.MaxPastDays)
+	}
+	if day.After(midnight.AddDate(0, 0, limits.MaxFutureDays)) {
+		return today, fmt.Errorf("date can't be more than %d days in the future", limits.MaxFutureDays)
+	}
+
+	return day, nil
+}
+
+func saveToCSV(ctx context.Context, entry TimeEntry) error {
+	return appendEntry(ctx, userToday(entryOwner(entry)), entry)
+}
+
+// appendEntry writes an entry to the CSV file for the given day, creating it with headers if needed
+func appendEntry(ctx context.Context, day time.Time, entry TimeEntry) (err error) {
+	_, span := startSpan(ctx, "storage.append_entry", spanKindInternal)
+	span.SetAttribute("storage.day", day.Format("20060102"))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	// Entries can't be added to a week that has been submitted for approval
+	if err := checkWeekOpen(entryOwner(entry), day); err != nil {
+		return err
+	}
+
+	// Scripts run before taking the storage lock so a slow hook doesn't block other writes
+	runEntryHooks(ctx, HookEntryCreated, &entry)
+
+	storageMu.Lock()
+	defer storageMu.Unlock()
+
+	// Generate filename based on the entry date
+	filename := dataFilename(day)
+	entry.Date = entryDate(day)
+	if entry.CreatedAt == "" {
+		entry.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	}
 
 	// Check if file exists to determine if we need to write headers
 	fileExists := false
 	if _, err := os.Stat(filename); err == nil {
 		fileExists = true
+
+		// Files written before newer columns existed are rewritten with the current headers
+		if err := upgradeHeaders(filename); err != nil {
+			return err
+		}
 	}
 
+	// The file as it was before the append, to update its daily aggregate in place
+	previous, _ := os.Stat(filename)
+
 	// Open file in append mode or create if it doesn't exist
 	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
@@ -137,160 +498,159 @@ func saveToCSV(entry TimeEntry) error {
 	writer := csv.NewWriter(file)
 	defer writer.Flush()
 
-	// Write headers if file was just created
+	// Write the schema version and headers if file was just created
 	if !fileExists {
-		headers := []string{"id", "timespan", "description", "task", "task_reason", "jira", "confidence", "categorized"}
-		if err := writer.Write(headers); err != nil {
+		if err := writeSchemaStamp(file, currentSchemaVersion()); err != nil {
+			return fmt.Errorf("error writing schema version: %v", err)
+		}
+		if err := writer.Write(csvHeaders); err != nil {
 			return fmt.Errorf("error writing headers: %v", err)
 		}
 	}
 
 	// Write the entry as a CSV record
-	categorizedStr := "false"
-	if entry.Categorized {
-		categorizedStr = "true"
-	}
-
-	record := []string{
-		entry.ID,
-		entry.Timespan,
-		entry.Description,
-		entry.Task,
-		entry.TaskReason,
-		entry.Jira,
-		entry.Confidence,
-		categorizedStr,
-	}
+	record := entryRecord(entry)
 
 	if err := writer.Write(record); err != nil {
 		return fmt.Errorf("error writing record: %v", err)
 	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing record: %v", err)
+	}
+	aggregateAppendedEntry(filename, previous, entry)
 
+	publishEvent(EventEntryCreated, entry)
+	streamEntryChange(TimeEntry{}, entry)
+	queueEntryEmbedding(entry)
 	return nil
 }
 
+// categorizeJob is one entry waiting on the categorizer and its outcome
+type categorizeJob struct {
+	entry  TimeEntry
+	result *CategoryResponse
+	err    error
+	// suggestion is set when the saved result awaits review
+	suggestion bool
+	// split is set when a split into several entries was proposed for review
+	split bool
+	// question asks the user to clarify a low-confidence result
+	question string
+}
+
+// categorizeConcurrently runs the jobs on a bounded pool of workers so slow LLM
+// calls overlap without exceeding the provider's parallelism. Each job is passed
+// to persist as soon as it completes, so an interrupted run keeps finished work.
+func categorizeConcurrently(ctx context.Context, jobs []categorizeJob, persist func(*categorizeJob)) {
+	workers := currentConfig().Categorization.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	queue := make(chan *categorizeJob)
+	var wg sync.WaitGroup
+	for range min(workers, len(jobs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				text := categorizationText(job.entry)
+				job.result, job.err = categorizeDescription(withWorkTime(ctx, entryWorkTime(job.entry)), text)
+				if job.err == nil {
+					job.question = clarifyingQuestion(ctx, text, job.result)
+				}
+				persist(job)
+			}
+		}()
+	}
+
+	// Stop handing out work once the caller has gone away
+queueJobs:
+	for i := range jobs {
+		select {
+		case queue <- &jobs[i]:
+		case <-ctx.Done():
+			for j := i; j < len(jobs); j++ {
+				jobs[j].err = ctx.Err()
+			}
+			break queueJobs
+		}
+	}
+	close(queue)
+	wg.Wait()
+}
+
 func categorizeHandler(w http.ResponseWriter, r *http.Request) {
 	// Only allow POST method
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	// Generate filename based on current date
-	currentDate := time.Now().Format("20060102") // Format for YYYYMMDD
-	filename := fmt.Sprintf("aidea_time_tracking_%s.csv", currentDate)
+	user := currentUser(r)
 
-	// Check if file exists
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		http.Error(w, fmt.Sprintf("No data file found for today (%s)", filename), http.StatusNotFound)
-		return
-	}
-
-	// Open the CSV file for reading and writing
-	file, err := os.OpenFile(filename, os.O_RDWR, 0644)
+	// Generate filename based on current date, or the date parameter (YYYYMMDD) for backdated entries
+	today, err := resolveEntryDay(r.URL.Query().Get("date"), user.Name)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error opening file: %v", err), http.StatusInternalServerError)
+		writeError(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
-	defer file.Close()
+	filename := dataFilename(today)
 
-	// Read all records from the CSV file
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error reading CSV: %v", err), http.StatusInternalServerError)
+	// Check if file exists
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		writeError(w, r, http.StatusNotFound, fmt.Sprintf("No data file found for %s (%s)", today.Format("20060102"), filename))
 		return
 	}
 
-	if len(records) <= 1 {
-		http.Error(w, "No time entries found", http.StatusNotFound)
+	// Fail fast while the LLM backend is down, uncategorized entries wait for the next run
+	if llmUnavailable() {
+		writeCircuitOpen(w, r)
 		return
 	}
 
-	// Get headers
-	headers := records[0]
-
-	// Find index of each column
-	idIdx := -1
-	descIdx := -1
-	timespanIdx := -1
-	taskIdx := -1
-	reasonIdx := -1
-	jiraIdx := -1
-	confidenceIdx := -1
-	categorizedIdx := -1
-
-	for i, header := range headers {
-		switch header {
-		case "id":
-			idIdx = i
-		case "description":
-			descIdx = i
-		case "timespan":
-			timespanIdx = i
-		case "task":
-			taskIdx = i
-		case "task_reason":
-			reasonIdx = i
-		case "jira":
-			jiraIdx = i
-		case "confidence":
-			confidenceIdx = i
-		case "categorized":
-			categorizedIdx = i
-		}
+	// Weekly and monthly files also hold other days' entries, only this day's are read
+	entries, err := readDayEntries(today)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error reading CSV: %v", err))
+		return
 	}
 
-	// Check if we found all required columns
-	if idIdx == -1 || descIdx == -1 || timespanIdx == -1 || taskIdx == -1 || reasonIdx == -1 ||
-		jiraIdx == -1 || confidenceIdx == -1 || categorizedIdx == -1 {
-		http.Error(w, "CSV file does not have the required columns", http.StatusInternalServerError)
+	if len(entries) == 0 {
+		writeError(w, r, http.StatusNotFound, "No time entries found")
 		return
 	}
 
 	// Process uncategorized entries
 	uncategorizedCount := 0
-	successCount := 0
 	errors := []string{}
+	jobs := []categorizeJob{}
 
-	for i, record := range records {
-		// Skip header row
-		if i == 0 {
+	for _, entry := range entries {
+		// Admins categorize everyone's entries, other users only their own
+		if entryOwner(entry) != user.Name && !user.HasRole(RoleAdmin) {
 			continue
 		}
 
-		// Check if entry is already categorized
-		if record[categorizedIdx] == "true" {
+		// Check if entry is already categorized, or has a suggestion awaiting review
+		if entry.Categorized || entry.Confidence != "" {
 			continue
 		}
 
-		uncategorizedCount++
-
-		// Get the description
-		description := record[descIdx]
-		if description == "" {
-			errors = append(errors, fmt.Sprintf("Entry ID %s has no description", record[idIdx]))
+		// Leave entries in submitted timesheets untouched
+		if checkWeekOpen(entryOwner(entry), today) != nil {
 			continue
 		}
 
-		// Call Ollama to categorize the description
-		categoryResp, err := categorizeDescription(description)
-		if err != nil {
-			errors = append(errors, fmt.Sprintf("Error categorizing entry ID %s: %v", record[idIdx], err))
+		uncategorizedCount++
+
+		if entry.Description == "" {
+			errors = append(errors, fmt.Sprintf("Entry ID %s has no description", entry.ID))
 			continue
 		}
 
-		// Update the record with the category information
-		record[taskIdx] = categoryResp.Task
-		record[reasonIdx] = categoryResp.Reason
-		record[jiraIdx] = categoryResp.Jira
-		record[timespanIdx] = categoryResp.Timespan
-		record[confidenceIdx] = categoryResp.Confidence
-		record[categorizedIdx] = "true"
-
-		// Update the record in the records slice
-		records[i] = record
-		successCount++
+		jobs = append(jobs, categorizeJob{entry: entry})
 	}
 
 	// If no uncategorized entries were found
@@ -302,21 +662,87 @@ func categorizeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Write the updated records back to the file
-	file.Seek(0, 0)
-	file.Truncate(0)
-	writer := csv.NewWriter(file)
-	err = writer.WriteAll(records)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error writing updated CSV: %v", err), http.StatusInternalServerError)
+	// Turn the run away rather than pile more work on a busy LLM
+	release, ok := reserveCategorization(len(jobs))
+	if !ok {
+		writeQueueFull(w, r)
 		return
 	}
-	writer.Flush()
+	defer release()
+
+	// Save each result as it completes. Entries already holding a result are skipped
+	// above, so running categorize again after an interruption resumes where it stopped.
+	categorizeConcurrently(r.Context(), jobs, func(job *categorizeJob) {
+		if job.err != nil {
+			return
+		}
+
+		categoryResp := job.result
+		job.suggestion = !autoAccepted(categoryResp.Confidence)
+		applied := false
+		updated, err := updateEntry(context.WithoutCancel(r.Context()), today, job.entry.ID, func(e *TimeEntry) {
+			// Skip entries reviewed or categorized while the LLM was working
+			if e.Categorized || e.Confidence != "" {
+				return
+			}
+			applied = true
+
+			// Update the entry with the category information
+			e.Task = categoryResp.Task
+			e.TaskReason = categoryResp.Reason
+			// Keep a Jira issue the user supplied with the entry
+			if e.Jira == "" {
+				e.Jira = categoryResp.Jira
+			}
+			// Keep a timespan that was already recorded (e.g. by the pomodoro timer)
+			if e.Timespan == "" {
+				e.Timespan = categoryResp.Timespan
+			}
+			if e.Timespan == "" {
+				e.Timespan = defaultTimespan(entryOwner(*e))
+			}
+			e.Confidence = categoryResp.Confidence
+			e.InputHash = categoryResp.InputHash
+			e.Labels = categoryResp.Labels
+			e.Question = job.question
+			// Results below the auto-accept confidence stay uncategorized as suggestions
+			e.Categorized = !job.suggestion
+		})
+		if job.err = err; err == nil {
+			if applied {
+				updated = runCategorizedHooks(r.Context(), today, updated)
+				if err := recordExperimentOutcome(today, *updated, categoryResp); err != nil {
+					log.Printf("Error recording experiment outcome: %v", err)
+				}
+			}
+			job.split = autoProposeSplit(context.WithoutCancel(r.Context()), today, *updated)
+		}
+	})
+
+	successCount := 0
+	suggestionCount := 0
+	splitCount := 0
+	for _, job := range jobs {
+		if job.err != nil {
+			errors = append(errors, fmt.Sprintf("Error categorizing entry ID %s: %v", job.entry.ID, job.err))
+			continue
+		}
+
+		if job.suggestion {
+			suggestionCount++
+		}
+		if job.split {
+			splitCount++
+		}
+		successCount++
+	}
 
 	// Create response
 	response := map[string]interface{}{
 		"total_uncategorized": uncategorizedCount,
 		"success_count":       successCount,
+		"suggestion_count":    suggestionCount,
+		"split_count":         splitCount,
 		"error_count":         len(errors),
 	}
 
@@ -324,6 +750,12 @@ func categorizeHandler(w http.ResponseWriter, r *http.Request) {
 		response["errors"] = errors
 	}
 
+	publishEvent(EventJobCompleted, map[string]interface{}{
+		"job":    "categorize",
+		"date":   today.Format("2006-01-02"),
+		"result": response,
+	})
+
 	// Send JSON response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
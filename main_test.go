@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestCategorizeLeavesOtherUsersEntries(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(rulesFile, []byte("[]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := active.Load()
+	t.Cleanup(func() { active.Store(previous) })
+	config := defaultConfig()
+	config.LLM.Provider = "mock"
+	config.Users = []User{
+		{Name: "ann", Roles: []string{RoleReviewer}},
+		{Name: "bob", Roles: []string{RoleReviewer}},
+		{Name: "root", Roles: []string{RoleAdmin}},
+	}
+	state, err := prepareConfig(config)
+	if err != nil {
+		t.Fatalf("prepareConfig: %v", err)
+	}
+	activateConfig(state)
+
+	ctx := context.Background()
+	day := storageToday()
+	for _, entry := range []TimeEntry{
+		{ID: "ann-1", Timespan: "30m", Description: "code review for the billing service", User: "ann"},
+		{ID: "bob-1", Timespan: "1h", Description: "sprint planning meeting", User: "bob"},
+	} {
+		if err := appendEntry(ctx, day, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	categorizeAs := func(name string) {
+		t.Helper()
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/categorize", nil)
+		request = request.WithContext(context.WithValue(request.Context(), userContextKey, findUser(name)))
+		recorder := httptest.NewRecorder()
+		categorizeHandler(recorder, request)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("categorizing as %s: status %d: %s", name, recorder.Code, recorder.Body)
+		}
+	}
+	categorized := func() map[string]bool {
+		t.Helper()
+		entries, err := readDayEntries(day)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := map[string]bool{}
+		for _, entry := range entries {
+			result[entry.ID] = entry.Confidence != ""
+		}
+		return result
+	}
+
+	categorizeAs("ann")
+	if got := categorized(); !got["ann-1"] || got["bob-1"] {
+		t.Errorf("after ann categorized, got %v, want only ann-1", got)
+	}
+
+	categorizeAs("root")
+	if got := categorized(); !got["bob-1"] {
+		t.Errorf("after an admin categorized, got %v, want bob-1 too", got)
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultMaintenanceRetry is the Retry-After, in seconds, sent while writes are rejected
+const defaultMaintenanceRetry = 30
+
+// MaintenanceStatus reports whether the server is rejecting writes for maintenance
+type MaintenanceStatus struct {
+	Active bool   `json:"active"`
+	Reason string `json:"reason,omitempty"`
+	// Since is when maintenance started
+	Since      *time.Time `json:"since,omitempty"`
+	RetryAfter int        `json:"retry_after_seconds,omitempty"`
+}
+
+// MaintenanceRequest puts the server in maintenance mode by hand, e.g. while backing up
+type MaintenanceRequest struct {
+	Reason     string `json:"reason"`
+	RetryAfter int    `json:"retry_after_seconds"`
+}
+
+// CompactionReport summarizes a storage compaction
+type CompactionReport struct {
+	FilesBefore int `json:"files_before"`
+	FilesAfter  int `json:"files_after"`
+	Entries     int `json:"entries"`
+	// Purged counts trashed entries past the retention period
+	Purged int `json:"purged"`
+	// Duplicates counts copies of an entry left in an old file by an interrupted compaction
+	Duplicates int `json:"duplicates"`
+	// Dated counts undated entries given the day of the daily file they were in
+	Dated int `json:"dated"`
+	// EmbeddingsPruned counts stored embeddings of entries that no longer exist
+	EmbeddingsPruned int    `json:"embeddings_pruned"`
+	TempFilesRemoved int    `json:"temp_files_removed"`
+	Duration         string `json:"duration"`
+}
+
+var (
+	maintenanceMu     sync.Mutex
+	maintenanceStatus MaintenanceStatus
+
+	// compactMu keeps two compactions from running at once
+	compactMu sync.Mutex
+)
+
+// errMaintenanceActive is returned when maintenance is started while it is already on
+var errMaintenanceActive = errors.New("the server is already in maintenance mode")
+
+// enterMaintenance starts rejecting writes
+func enterMaintenance(reason string, retryAfter int) error {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+
+	if maintenanceStatus.Active {
+		return errMaintenanceActive
+	}
+	if retryAfter <= 0 {
+		retryAfter = defaultMaintenanceRetry
+	}
+	now := time.Now().UTC()
+	maintenanceStatus = MaintenanceStatus{Active: true, Reason: reason, Since: &now, RetryAfter: retryAfter}
+	log.Printf("Entering maintenance mode: %s", reason)
+	return nil
+}
+
+// leaveMaintenance accepts writes again
+func leaveMaintenance() {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+
+	if maintenanceStatus.Active {
+		log.Println("Leaving maintenance mode")
+	}
+	maintenanceStatus = MaintenanceStatus{}
+}
+
+// currentMaintenance returns the maintenance status
+func currentMaintenance() MaintenanceStatus {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	return maintenanceStatus
+}
+
+// maintenanceMiddleware answers 503 with a Retry-After header to every write while
+// maintenance is on. Reads keep working, and so do the admin endpoints so
+// maintenance can be ended.
+func maintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/api/v1/admin/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		status := currentMaintenance()
+		if !status.Active {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Retry-After", strconv.Itoa(status.RetryAfter))
+		message := "The server is in maintenance mode"
+		if status.Reason != "" {
+			message += " (" + status.Reason + ")"
+		}
+		writeErrorCode(w, r, http.StatusServiceUnavailable, ErrCodeUnavailable,
+			fmt.Sprintf("%s, writes are rejected, retry in %ds", message, status.RetryAfter))
+	})
+}
+
+// filenameDay returns the day a daily data file covers, false for weekly and monthly files
+func filenameDay(filename string) (time.Time, bool) {
+	prefix, suffix, _ := strings.Cut(dataFilenameTemplate(), "{period}")
+	period, found := strings.CutPrefix(filename, prefix)
+	if !found {
+		return time.Time{}, false
+	}
+	period, found = strings.CutSuffix(period, suffix)
+	if !found || len(period) != 8 {
+		return time.Time{}, false
+	}
+	day, err := time.Parse("20060102", period)
+	return day, err == nil
+}
+
+// compactStorage rewrites the data files into one file per period of the current
+// rollover, merging files left from an earlier rollover, dropping trash past the
+// retention period and removing empty and leftover temporary files. The stored
+// entry embeddings are then pruned and the vector store synced.
+func compactStorage(ctx context.Context, now time.Time) (report CompactionReport, err error) {
+	_, span := startSpan(ctx, "storage.compact", spanKindInternal)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	ids, err := compactDataFiles(now, &report)
+	if err != nil {
+		return report, err
+	}
+
+	pruned, err := pruneEntryEmbeddings(ctx, ids)
+	if err != nil {
+		return report, fmt.Errorf("error pruning entry embeddings: %v", err)
+	}
+	report.EmbeddingsPruned = pruned
+
+	if err := reloadRules(); err != nil {
+		return report, fmt.Errorf("error reloading rules: %v", err)
+	}
+	syncVectorStore()
+
+	report.Duration = time.Since(now).Round(time.Millisecond).String()
+	return report, nil
+}
+
+// compactDataFiles merges and rewrites the data files, returning the IDs of the
+// entries kept, including the trash
+func compactDataFiles(now time.Time, report *CompactionReport) (map[string]bool, error) {
+	storageMu.Lock()
+	defer storageMu.Unlock()
+
+	filenames, err := dataFiles()
+	if err != nil {
+		return nil, err
+	}
+	report.FilesBefore = len(filenames)
+
+	// Every file is read before anything is written, so an unreadable file changes nothing
+	merged := make(map[string][]TimeEntry)
+	// found locates each entry ID in merged
+	type location struct {
+		filename string
+		index    int
+	}
+	found := make(map[string]location)
+	for _, filename := range filenames {
+		entries, err := readEntries(filename)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+
+		for _, entry := range entries {
+			if purge := purgeAt(entry); !purge.IsZero() && now.After(purge) {
+				report.Purged++
+				continue
+			}
+			if entry.Date == "" {
+				if day, ok := filenameDay(filename); ok {
+					entry.Date = entryDate(day)
+					report.Dated++
+				}
+			}
+
+			target := filename
+			if day, err := time.Parse("2006-01-02", entry.Date); err == nil {
+				target = dataFilename(day)
+			}
+
+			// A copy already in its target file is newer than one left in an old file
+			if previous, ok := found[entry.ID]; ok && entry.ID != "" {
+				report.Duplicates++
+				if filename == target {
+					merged[previous.filename][previous.index] = entry
+				}
+				continue
+			}
+			found[entry.ID] = location{filename: target, index: len(merged[target])}
+			merged[target] = append(merged[target], entry)
+		}
+	}
+
+	targets := make([]string, 0, len(merged))
+	for target := range merged {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	// Write the merged files before removing the old ones, an interrupted compaction
+	// leaves duplicates that the next one removes rather than losing entries
+	ids := make(map[string]bool)
+	for _, target := range targets {
+		entries := merged[target]
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Date < entries[j].Date })
+		if err := writeEntries(target, entries); err != nil {
+			return nil, fmt.Errorf("%s: %v", target, err)
+		}
+		for _, entry := range entries {
+			ids[entry.ID] = true
+		}
+		report.Entries += len(entries)
+	}
+	for _, filename := range filenames {
+		if _, ok := merged[filename]; ok {
+			continue
+		}
+		if err := os.Remove(filename); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+	}
+	report.FilesAfter = len(targets)
+
+	// Temporary files are left behind by a crash during writeEntries
+	leftovers, _ := filepath.Glob(strings.ReplaceAll(dataFilenameTemplate(), "{period}", "*") + ".tmp")
+	for _, leftover := range leftovers {
+		if os.Remove(leftover) == nil {
+			report.TempFilesRemoved++
+		}
+	}
+
+	return ids, nil
+}
+
+// pruneEntryEmbeddings drops stored embeddings of entries that no longer exist and
+// removes them from the vector store, reading the embeddings file again
+func pruneEntryEmbeddings(ctx context.Context, ids map[string]bool) (int, error) {
+	entryEmbeddingsMu.Lock()
+	defer entryEmbeddingsMu.Unlock()
+
+	entryEmbeddings = nil
+	if err := loadEntryEmbeddings(); err != nil {
+		return 0, err
+	}
+
+	removed := []string{}
+	for id := range entryEmbeddings {
+		if !ids[id] {
+			removed = append(removed, id)
+			delete(entryEmbeddings, id)
+		}
+	}
+	if len(removed) == 0 {
+		return 0, nil
+	}
+	if err := saveEntryEmbeddings(); err != nil {
+		return 0, err
+	}
+	if err := deleteVectors(ctx, vectorEntries, removed); err != nil {
+		log.Printf("Error removing pruned entries from the vector store: %v", err)
+	}
+	return len(removed), nil
+}
+
+// maintenanceHandler shows the maintenance status on GET, starts maintenance on PUT
+// and ends it on DELETE
+func maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		// Read request body
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+			return
+		}
+		defer r.Body.Close()
+
+		var request MaintenanceRequest
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &request); err != nil {
+				writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+				return
+			}
+		}
+		if request.RetryAfter < 0 {
+			writeValidationError(w, r, ErrorDetail{Field: "retry_after_seconds", Message: "must not be negative"})
+			return
+		}
+		if request.Reason == "" {
+			request.Reason = "maintenance"
+		}
+		if err := enterMaintenance(request.Reason, request.RetryAfter); err != nil {
+			writeError(w, r, http.StatusConflict, err.Error())
+			return
+		}
+	case http.MethodDelete:
+		leaveMaintenance()
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currentMaintenance())
+}
+
+// compactHandler compacts storage, rejecting writes while it runs. Maintenance
+// started by hand is left on afterwards.
+func compactHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if !compactMu.TryLock() {
+		writeError(w, r, http.StatusConflict, "A compaction is already running")
+		return
+	}
+	defer compactMu.Unlock()
+
+	if err := enterMaintenance("compacting storage", 0); err == nil {
+		defer leaveMaintenance()
+	}
+
+	report, err := compactStorage(r.Context(), time.Now())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error compacting storage: "+err.Error())
+		return
+	}
+	log.Printf("Compacted %d data files into %d, %d entries kept, %d purged", report.FilesBefore, report.FilesAfter, report.Entries, report.Purged)
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
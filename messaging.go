@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var trailingTimespanPattern = regexp.MustCompile(`^(?i)(\d+:\d{2}|(\d+(\.\d+)?\s*(hours?|hrs?|h|minutes?|mins?|m)\s*)+)$`)
+
+// splitTrailingTimespan separates a trailing duration such as "45m" or "1h 30m"
+// from a chat-style message like "fixed auth bug 45m"
+func splitTrailingTimespan(text string) (string, string) {
+	fields := strings.Fields(text)
+
+	// Try the last two tokens first so "1h 30m" is kept together
+	for n := 2; n >= 1; n-- {
+		if len(fields) <= n {
+			continue
+		}
+
+		candidate := strings.Join(fields[len(fields)-n:], " ")
+		if !trailingTimespanPattern.MatchString(candidate) {
+			continue
+		}
+
+		if _, err := parseTimespan(candidate); err == nil {
+			return strings.Join(fields[:len(fields)-n], " "), candidate
+		}
+	}
+
+	return strings.TrimSpace(text), ""
+}
+
+// logMessageEntry saves an entry from a chat or email message for a user, "" being
+// the local user, and categorizes it immediately. Results meeting the auto-accept
+// confidence are marked categorized, others are stored for review.
+func logMessageEntry(ctx context.Context, text, user string) (*TimeEntry, error) {
+	description, timespan := splitTrailingTimespan(text)
+	if description == "" {
+		return nil, fmt.Errorf("description is required")
+	}
+
+	day := storageToday()
+	entry := TimeEntry{
+		ID:          uuid.New().String(),
+		Timespan:    timespan,
+		Description: description,
+		Categorized: false,
+		User:        user,
+	}
+
+	if details := validateEntry(entry); len(details) > 0 {
+		return nil, fmt.Errorf("invalid entry: %s", details[0].Message)
+	}
+
+	if err := appendEntry(ctx, day, entry); err != nil {
+		return nil, fmt.Errorf("error saving data: %v", err)
+	}
+
+	// The entry is saved either way, /categorize can pick it up later
+	release, ok := reserveCategorization(1)
+	if !ok {
+		return &entry, nil
+	}
+	defer release()
+	categoryResp, err := categorizeDescription(ctx, description)
+	if err != nil {
+		return &entry, nil
+	}
+	question := clarifyingQuestion(ctx, description, categoryResp)
+
+	updated, err := updateEntry(ctx, day, entry.ID, func(e *TimeEntry) {
+		e.Task = categoryResp.Task
+		e.TaskReason = categoryResp.Reason
+		e.Jira = categoryResp.Jira
+		e.Confidence = categoryResp.Confidence
+		e.InputHash = categoryResp.InputHash
+		e.Labels = categoryResp.Labels
+		e.Question = question
+		if e.Timespan == "" {
+			e.Timespan = categoryResp.Timespan
+		}
+		if e.Timespan == "" {
+			e.Timespan = defaultTimespan(entryOwner(*e))
+		}
+		e.Categorized = autoAccepted(categoryResp.Confidence)
+	})
+	if err == nil {
+		updated = runCategorizedHooks(ctx, day, updated)
+		if err := recordExperimentOutcome(day, *updated, categoryResp); err != nil {
+			log.Printf("Error recording experiment outcome: %v", err)
+		}
+	}
+	return updated, err
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const (
+	schemaFile = "aidea_schema.json"
+	// migrationBackupDir keeps the files each migration changed, for rolling it back
+	migrationBackupDir = "aidea_migrations"
+)
+
+// migration is one versioned step of the data file schema. up rewrites a file's
+// header and rows, returning how many rows it changed, and is given the file's
+// name so steps can use the day it covers. Steps are never edited once released,
+// a later change to the layout is a new step.
+type migration struct {
+	version int
+	name    string
+	up      func(filename string, headers []string, rows [][]string) ([]string, [][]string, int, error)
+}
+
+// layoutV1 is the data file layout of schema version 1
+var layoutV1 = []string{"id", "date", "created_at", "timespan", "description", "task", "task_reason", "jira", "confidence", "categorized", "user", "input_hash", "deleted_at", "tags", "links", "labels", "question", "clarification"}
+
+// migrations are applied in order, the last one's version is the current schema
+var migrations = []migration{
+	{version: 1, name: "column_layout", up: migrateColumnLayout},
+	{version: 2, name: "date_undated_rows", up: migrateUndatedRows},
+	{version: 3, name: "canonical_confidence", up: migrateConfidenceGrades},
+}
+
+// migrateColumnLayout rewrites files written before newer columns existed into
+// layoutV1, leaving the new columns empty
+func migrateColumnLayout(filename string, headers []string, rows [][]string) ([]string, [][]string, int, error) {
+	if slices.Equal(headers, layoutV1) {
+		return headers, rows, 0, nil
+	}
+
+	columns := csvColumns(headers)
+	migrated := make([][]string, len(rows))
+	for i, row := range rows {
+		migrated[i] = make([]string, len(layoutV1))
+		for j, name := range layoutV1 {
+			if index, ok := columns[name]; ok && index < len(row) {
+				migrated[i][j] = row[index]
+			}
+		}
+	}
+	return slices.Clone(layoutV1), migrated, len(rows), nil
+}
+
+// migrateUndatedRows fills the date of rows that predate the date column, which
+// always lived in daily files
+func migrateUndatedRows(filename string, headers []string, rows [][]string) ([]string, [][]string, int, error) {
+	day, ok := filenameDay(filename)
+	index := slices.Index(headers, "date")
+	if !ok || index < 0 {
+		return headers, rows, 0, nil
+	}
+
+	changed := 0
+	for _, row := range rows {
+		if index < len(row) && row[index] == "" {
+			row[index] = entryDate(day)
+			changed++
+		}
+	}
+	return headers, rows, changed, nil
+}
+
+// migrateConfidenceGrades rewrites letter grades and scores in the confidence column
+// as "high", "medium" or "low"
+func migrateConfidenceGrades(filename string, headers []string, rows [][]string) ([]string, [][]string, int, error) {
+	index := slices.Index(headers, "confidence")
+	if index < 0 {
+		return headers, rows, 0, nil
+	}
+
+	changed := 0
+	for _, row := range rows {
+		if index >= len(row) {
+			continue
+		}
+		if confidence := normalizeConfidence(row[index]); confidence != row[index] {
+			row[index] = confidence
+			changed++
+		}
+	}
+	return headers, rows, changed, nil
+}
+
+// currentSchemaVersion is the version the data files are migrated to
+func currentSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// MigrationRecord is an applied migration
+type MigrationRecord struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+	// Backup is the directory holding the files as they were before the migration
+	Backup string   `json:"backup,omitempty"`
+	Files  []string `json:"files,omitempty"`
+	// Checksums are the SHA-256 of each file as the migration wrote it, for telling
+	// whether a file changed before it is rolled back
+	Checksums map[string]string `json:"checksums,omitempty"`
+}
+
+// SchemaState records the schema version of the data files and how they got there
+type SchemaState struct {
+	Version int               `json:"version"`
+	History []MigrationRecord `json:"history"`
+}
+
+// MigrationResult is what a migration changed, or would change in a dry run
+type MigrationResult struct {
+	Version int      `json:"version"`
+	Name    string   `json:"name"`
+	Files   []string `json:"files"`
+	Rows    int      `json:"rows"`
+}
+
+// readSchemaState reads the schema state, version 0 before any migration ran
+func readSchemaState() (SchemaState, error) {
+	state := SchemaState{History: []MigrationRecord{}}
+	data, err := os.ReadFile(schemaFile)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("couldn't read schema state: %v", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("couldn't parse schema state: %v", err)
+	}
+	return state, nil
+}
+
+// writeSchemaState saves the schema state
+func writeSchemaState(state SchemaState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't encode schema state: %v", err)
+	}
+	return os.WriteFile(schemaFile, data, 0644)
+}
+
+// upgradeRows applies the migrations newer than a file's schema version to its
+// rows in memory, for reading files the migrations haven't rewritten
+func upgradeRows(filename string, version int, headers []string, rows [][]string) ([]string, [][]string, error) {
+	for _, step := range migrations {
+		if step.version <= version {
+			continue
+		}
+		var err error
+		if headers, rows, _, err = step.up(filename, headers, rows); err != nil {
+			return nil, nil, fmt.Errorf("upgrading to schema version %d: %v", step.version, err)
+		}
+	}
+	return headers, rows, nil
+}
+
+// writeRawCSV replaces a data file with the given header and rows, stamped with a schema version
+func writeRawCSV(filename string, version int, headers []string, rows [][]string) error {
+	tmpName := filename + ".tmp"
+	file, err := os.Create(tmpName)
+	if err != nil {
+		return fmt.Errorf("couldn't open file: %v", err)
+	}
+	defer os.Remove(tmpName)
+	defer file.Close()
+
+	if err := writeSchemaStamp(file, version); err != nil {
+		return fmt.Errorf("error writing schema version: %v", err)
+	}
+	writer := csv.NewWriter(file)
+	writer.Write(headers)
+	writer.WriteAll(rows)
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing records: %v", err)
+	}
+	// The rename must not reach the disk before the rows do
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("error syncing file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error closing file: %v", err)
+	}
+	return os.Rename(tmpName, filename)
+}
+
+// copyFile copies a file, creating the destination's directory
+func copyFile(source, destination string) error {
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// fileChecksum returns the hex SHA-256 of a file's contents
+func fileChecksum(filename string) (string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// stagedFile is a data file as the earlier steps of a dry run would have left it
+type stagedFile struct {
+	version int
+	headers []string
+	rows    [][]string
+}
+
+// readMigrationFile reads a data file for a migration step. A dry run, given the
+// files it staged, reads them as the earlier steps left them and never quarantines
+// rows, so it writes nothing.
+func readMigrationFile(filename string, staged map[string]*stagedFile) (stagedFile, error) {
+	if staged == nil {
+		version, headers, rows, err := readDataFile(filename)
+		return stagedFile{version: version, headers: headers, rows: rows}, err
+	}
+	if file, ok := staged[filename]; ok {
+		return *file, nil
+	}
+	version, headers, rows, _, err := parseDataFile(filename)
+	return stagedFile{version: version, headers: headers, rows: rows}, err
+}
+
+// applyMigration runs one step over every data file, backing up each file before it
+// is rewritten. A dry run passes the files it staged instead, and the step's result
+// is staged for the next step rather than written.
+func applyMigration(step migration, staged map[string]*stagedFile, now time.Time) (MigrationResult, MigrationRecord, error) {
+	result := MigrationResult{Version: step.version, Name: step.name, Files: []string{}}
+	record := MigrationRecord{Version: step.version, Name: step.name, AppliedAt: now.UTC(), Checksums: map[string]string{}}
+	filenames, err := dataFiles()
+	if err != nil {
+		return result, record, err
+	}
+
+	backup := filepath.Join(migrationBackupDir, fmt.Sprintf("%03d-%s-%s", step.version, step.name, now.UTC().Format("20060102T150405")))
+	for _, filename := range filenames {
+		file, err := readMigrationFile(filename, staged)
+		if err != nil {
+			return result, record, fmt.Errorf("%s: %v", filename, err)
+		}
+		// Files written since the step was released are already in its layout
+		if file.headers == nil || file.version >= step.version {
+			continue
+		}
+
+		migratedHeaders, migratedRows, changed, err := step.up(filename, file.headers, file.rows)
+		if err != nil {
+			return result, record, fmt.Errorf("%s: %v", filename, err)
+		}
+		if changed == 0 && slices.Equal(file.headers, migratedHeaders) {
+			continue
+		}
+		result.Files = append(result.Files, filename)
+		result.Rows += changed
+		if staged != nil {
+			staged[filename] = &stagedFile{version: step.version, headers: migratedHeaders, rows: migratedRows}
+			continue
+		}
+
+		if err := copyFile(filename, filepath.Join(backup, filepath.Base(filename))); err != nil {
+			return result, record, fmt.Errorf("couldn't back up %s: %v", filename, err)
+		}
+		if err := writeRawCSV(filename, step.version, migratedHeaders, migratedRows); err != nil {
+			return result, record, fmt.Errorf("%s: %v", filename, err)
+		}
+		checksum, err := fileChecksum(filename)
+		if err != nil {
+			return result, record, fmt.Errorf("%s: %v", filename, err)
+		}
+		record.Checksums[filename] = checksum
+	}
+
+	record.Files = result.Files
+	if len(result.Files) > 0 {
+		record.Backup = backup
+	}
+	return result, record, nil
+}
+
+// migrateStorage applies the pending migrations in order, or only reports what they
+// would change in a dry run, each step seeing the files as the steps before it
+// would leave them. Writes are held off while files are rewritten.
+func migrateStorage(dryRun bool) ([]MigrationResult, error) {
+	storageMu.Lock()
+	defer storageMu.Unlock()
+
+	state, err := readSchemaState()
+	if err != nil {
+		return nil, err
+	}
+	if state.Version > currentSchemaVersion() {
+		return nil, fmt.Errorf("the data files are at schema version %d, newer than this version of aidea supports (%d)", state.Version, currentSchemaVersion())
+	}
+
+	var staged map[string]*stagedFile
+	if dryRun {
+		staged = map[string]*stagedFile{}
+	}
+
+	results := []MigrationResult{}
+	for _, step := range migrations {
+		if step.version <= state.Version {
+			continue
+		}
+
+		result, record, err := applyMigration(step, staged, time.Now())
+		results = append(results, result)
+		if err != nil {
+			return results, fmt.Errorf("migration %d %s: %v", step.version, step.name, err)
+		}
+		if dryRun {
+			continue
+		}
+
+		state.Version = step.version
+		state.History = append(state.History, record)
+		if err := writeSchemaState(state); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// rollbackMigration restores the files the last applied migration changed from
+// its backup and steps the schema version back. Restoring a file changed since the
+// migration ran would lose those entries, so the rollback is refused instead.
+func rollbackMigration(dryRun bool) (*MigrationRecord, error) {
+	storageMu.Lock()
+	defer storageMu.Unlock()
+
+	state, err := readSchemaState()
+	if err != nil {
+		return nil, err
+	}
+	if len(state.History) == 0 {
+		return nil, errors.New("no migration to roll back")
+	}
+
+	last := state.History[len(state.History)-1]
+	for _, filename := range last.Files {
+		checksum, err := fileChecksum(filename)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't check %s: %v", filename, err)
+		}
+		switch last.Checksums[filename] {
+		case checksum:
+		case "":
+			return nil, fmt.Errorf("can't tell whether %s changed since migration %d ran, restore it from %s by hand", filename, last.Version, last.Backup)
+		default:
+			return nil, fmt.Errorf("%s changed since migration %d ran, rolling back would lose those changes", filename, last.Version)
+		}
+	}
+	if dryRun {
+		return &last, nil
+	}
+	for _, filename := range last.Files {
+		if err := copyFile(filepath.Join(last.Backup, filepath.Base(filename)), filename); err != nil {
+			return nil, fmt.Errorf("couldn't restore %s: %v", filename, err)
+		}
+	}
+
+	state.History = state.History[:len(state.History)-1]
+	state.Version = 0
+	if len(state.History) > 0 {
+		state.Version = state.History[len(state.History)-1].Version
+	}
+	if err := writeSchemaState(state); err != nil {
+		return nil, err
+	}
+	return &last, nil
+}
+
+// runMigrate is the "aidea migrate [status|up|down] [--dry-run]" command
+func runMigrate(args []string, out io.Writer) error {
+	dryRun := slices.Contains(args, "--dry-run")
+	args = slices.DeleteFunc(slices.Clone(args), func(arg string) bool { return arg == "--dry-run" })
+	command := "status"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "status":
+		state, err := readSchemaState()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Schema version %d of %d\n", state.Version, currentSchemaVersion())
+		for _, record := range state.History {
+			fmt.Fprintf(out, "  %d %s, applied %s to %d files\n", record.Version, record.Name, record.AppliedAt.Format(time.RFC3339), len(record.Files))
+		}
+		for _, step := range migrations {
+			if step.version > state.Version {
+				fmt.Fprintf(out, "  %d %s, pending\n", step.version, step.name)
+			}
+		}
+		return nil
+
+	case "up":
+		results, err := migrateStorage(dryRun)
+		for _, result := range results {
+			verb := "Migrated"
+			if dryRun {
+				verb = "Would migrate"
+			}
+			fmt.Fprintf(out, "%d %s: %s %d rows in %d files\n", result.Version, result.Name, verb, result.Rows, len(result.Files))
+		}
+		if err == nil && len(results) == 0 {
+			fmt.Fprintf(out, "Already at schema version %d\n", currentSchemaVersion())
+		}
+		return err
+
+	case "down":
+		record, err := rollbackMigration(dryRun)
+		if err != nil {
+			return err
+		}
+		verb := "Rolled back"
+		if dryRun {
+			verb = "Would roll back"
+		}
+		fmt.Fprintf(out, "%s %d %s, restoring %d files from %s\n", verb, record.Version, record.Name, len(record.Files), record.Backup)
+		return nil
+	}
+	return errors.New("usage: aidea migrate [status|up|down] [--dry-run]")
+}
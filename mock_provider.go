@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+)
+
+// mockEmbeddingDimensions matches the size of the all-minilm embeddings
+const mockEmbeddingDimensions = 384
+
+// MockCategory is a canned categorization returned when a keyword appears in the description
+type MockCategory struct {
+	Keyword string `json:"keyword"`
+	Task    string `json:"task"`
+	Jira    string `json:"jira,omitempty"`
+}
+
+// mockProvider is a deterministic, in-memory stand-in for Ollama used in CI and demos
+type mockProvider struct {
+	categories []MockCategory
+}
+
+var defaultMockCategories = []MockCategory{
+	{Keyword: "meeting", Task: "Meetings"},
+	{Keyword: "standup", Task: "Meetings"},
+	{Keyword: "review", Task: "Code Review"},
+	{Keyword: "fix", Task: "Development"},
+	{Keyword: "bug", Task: "Development"},
+	{Keyword: "implement", Task: "Development"},
+	{Keyword: "email", Task: "Administration"},
+	{Keyword: "docs", Task: "Documentation"},
+}
+
+func newMockProvider(categories []MockCategory) *mockProvider {
+	if len(categories) == 0 {
+		categories = defaultMockCategories
+	}
+	return &mockProvider{categories: categories}
+}
+
+// Categorize returns the first canned category whose keyword appears in the
+// description, with the other matching categories as labels
+func (p *mockProvider) Categorize(ctx context.Context, description string) (*CategoryResponse, error) {
+	lower := strings.ToLower(description)
+	description, timespan := splitTrailingTimespan(description)
+
+	var result *CategoryResponse
+	for _, category := range p.categories {
+		if !strings.Contains(lower, strings.ToLower(category.Keyword)) {
+			continue
+		}
+		if result == nil {
+			result = &CategoryResponse{
+				Task:       category.Task,
+				Jira:       category.Jira,
+				Timespan:   timespan,
+				Confidence: "high",
+				Reason:     "Mock provider matched keyword \"" + category.Keyword + "\"",
+				InputHash:  inputHash(ctx, "mock", "", lower),
+			}
+		} else if category.Task != result.Task && !slices.ContainsFunc(result.Labels, func(label EntryLabel) bool { return label.Task == category.Task }) {
+			result.Labels = append(result.Labels, EntryLabel{Task: category.Task, Jira: category.Jira})
+		}
+	}
+	if result != nil {
+		return result, nil
+	}
+
+	return &CategoryResponse{
+		Task:       "General",
+		Timespan:   timespan,
+		Confidence: "low",
+		Reason:     "Mock provider found no matching keyword in \"" + description + "\"",
+		InputHash:  inputHash(ctx, "mock", "", lower),
+	}, nil
+}
+
+// ChooseRule picks the highest scoring candidate, with confidence following its score
+func (p *mockProvider) ChooseRule(ctx context.Context, description string, candidates []RuleCandidate) (*RuleChoice, error) {
+	_, timespan := splitTrailingTimespan(description)
+	best := candidates[0]
+
+	confidence := "low"
+	switch {
+	case best.Score >= 0.6:
+		confidence = "high"
+	case best.Score >= 0.4:
+		confidence = "medium"
+	}
+
+	return &RuleChoice{
+		RuleID:     best.Rule.ID,
+		Timespan:   timespan,
+		Confidence: confidence,
+		Reason:     fmt.Sprintf("Mock provider chose the closest rule (score %.2f)", best.Score),
+		InputHash:  inputHash(ctx, "mock", ruleChoicePrompt(candidates), description),
+	}, nil
+}
+
+// Translate returns the text unchanged, the mock provider has no language model
+func (p *mockProvider) Translate(ctx context.Context, text, language string) (string, error) {
+	return text, nil
+}
+
+// Retrospective echoes the first lines of the facts, the mock provider has no language model
+func (p *mockProvider) Retrospective(ctx context.Context, facts string) (*RetroNarrative, error) {
+	lines := strings.Split(facts, "\n")
+	themes := []string{}
+	for _, line := range lines {
+		if task, found := strings.CutPrefix(line, "- "); found && strings.Contains(task, "m / ") {
+			themes = append(themes, task[:strings.Index(task, ":")])
+		}
+		if len(themes) == 3 {
+			break
+		}
+	}
+
+	return &RetroNarrative{
+		Summary: "Mock retrospective. " + lines[0],
+		Themes:  themes,
+	}, nil
+}
+
+// Split divides the description at " and " and semicolons, categorizing each part
+// by keyword and giving them equal shares
+func (p *mockProvider) Split(ctx context.Context, description string) (*SplitResponse, error) {
+	description, _ = splitTrailingTimespan(description)
+	clauses := strings.FieldsFunc(strings.ReplaceAll(description, " and ", ";"), func(r rune) bool { return r == ';' })
+
+	response := &SplitResponse{Parts: []SplitPart{}, Reason: "Mock provider split the description at conjunctions"}
+	for _, clause := range clauses {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			continue
+		}
+		category, err := p.Categorize(ctx, clause)
+		if err != nil {
+			return nil, err
+		}
+		response.Parts = append(response.Parts, SplitPart{
+			Description: clause,
+			Task:        category.Task,
+			Jira:        jiraKeyFinder.FindString(clause),
+			Confidence:  category.Confidence,
+		})
+	}
+	for i := range response.Parts {
+		response.Parts[i].Share = 1 / float64(len(response.Parts))
+	}
+
+	return response, nil
+}
+
+// Clarify asks what the work was for, the mock provider has no language model
+func (p *mockProvider) Clarify(ctx context.Context, description string) (string, error) {
+	description, _, _ = strings.Cut(description, "\n")
+	description, _ = splitTrailingTimespan(description)
+	return fmt.Sprintf("What was %q for?", description), nil
+}
+
+// LabelTopic names a cluster after the words its descriptions share most, the
+// mock provider has no language model
+func (p *mockProvider) LabelTopic(ctx context.Context, descriptions string) (string, error) {
+	counts := make(map[string]int)
+	for _, line := range strings.Split(descriptions, "\n") {
+		seen := make(map[string]bool)
+		for _, word := range strings.Fields(strings.ToLower(strings.TrimPrefix(line, "- "))) {
+			word = strings.Trim(word, ".,;:!?()\"'")
+			if len(word) > 3 && !seen[word] {
+				seen[word] = true
+				counts[word]++
+			}
+		}
+	}
+
+	words := slices.Collect(maps.Keys(counts))
+	slices.SortFunc(words, func(a, b string) int {
+		if counts[a] != counts[b] {
+			return counts[b] - counts[a]
+		}
+		return strings.Compare(a, b)
+	})
+	return strings.Join(words[:min(2, len(words))], " "), nil
+}
+
+// Embed hashes each word into a fixed-size vector, so texts sharing words
+// get similar embeddings and identical texts always get identical ones
+func (p *mockProvider) Embed(ctx context.Context, text string) ([]float64, error) {
+	vector := make([]float64, mockEmbeddingDimensions)
+
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		word = strings.Trim(word, ".,;:!?()\"'")
+		if word == "" {
+			continue
+		}
+
+		hash := fnv.New64a()
+		hash.Write([]byte(word))
+		sum := hash.Sum64()
+
+		sign := 1.0
+		if sum&1 == 1 {
+			sign = -1.0
+		}
+		vector[(sum>>1)%mockEmbeddingDimensions] += sign
+	}
+
+	var norm float64
+	for _, value := range vector {
+		norm += value * value
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range vector {
+			vector[i] /= norm
+		}
+	}
+
+	return vector, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// NormalizationConfig controls the clean-up applied to descriptions before they
+// are embedded or sent to the LLM. Stored descriptions are never changed.
+type NormalizationConfig struct {
+	Lowercase bool `json:"lowercase"`
+	// TicketURLs replaces Jira and GitHub links with their keys, e.g. ABC-123 or owner/repo#42
+	TicketURLs bool `json:"ticket_urls"`
+	// Abbreviations expands whole words or phrases, e.g. "sec scan" to "security scan"
+	Abbreviations map[string]string `json:"abbreviations,omitempty"`
+}
+
+var (
+	jiraURLPattern   = regexp.MustCompile(`https?://\S+/browse/([A-Z][A-Z0-9]+-\d+)\S*`)
+	githubURLPattern = regexp.MustCompile(`https?://(?:www\.)?github\.com/([^/\s]+)/([^/\s]+)/(?:pull|issues)/(\d+)\S*`)
+)
+
+// abbreviationPatterns compiles the configured abbreviations, longest first so
+// "sec scan" wins over "sec"
+func abbreviationPatterns(abbreviations map[string]string) ([]*regexp.Regexp, []string) {
+	keys := make([]string, 0, len(abbreviations))
+	for key := range abbreviations {
+		if strings.TrimSpace(key) != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+
+	patterns := make([]*regexp.Regexp, 0, len(keys))
+	expansions := make([]string, 0, len(keys))
+	for _, key := range keys {
+		words := strings.Fields(regexp.QuoteMeta(key))
+		patterns = append(patterns, regexp.MustCompile(`(?i)\b`+strings.Join(words, `\s+`)+`\b`))
+		expansions = append(expansions, abbreviations[key])
+	}
+
+	return patterns, expansions
+}
+
+// normalizeDescription applies the configured normalization steps to the text
+// used for matching, leaving the stored description untouched
+func normalizeDescription(description string) string {
+	config := currentConfig().Normalization
+	text := description
+
+	if config.TicketURLs {
+		text = jiraURLPattern.ReplaceAllString(text, "$1")
+		text = githubURLPattern.ReplaceAllString(text, "$1/$2#$3")
+	}
+
+	patterns, expansions := abbreviationPatterns(config.Abbreviations)
+	for i, pattern := range patterns {
+		text = pattern.ReplaceAllLiteralString(text, expansions[i])
+	}
+
+	if config.Lowercase {
+		text = strings.ToLower(text)
+	}
+
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sessionCookieName = "aidea_session"
+	stateCookieName   = "aidea_oidc_state"
+	sessionLifetime   = 12 * time.Hour
+	introspectionTTL  = time.Minute
+)
+
+// OIDCConfig enables single sign-on against an OpenID Connect provider
+type OIDCConfig struct {
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+	// UsernameClaim names the claim used as the user name, e.g. "email" or "preferred_username"
+	UsernameClaim string `json:"username_claim"`
+	// RolesClaim names the claim holding group or role names, e.g. "groups"
+	RolesClaim string `json:"roles_claim"`
+	// RoleMapping maps provider group names to tracker roles
+	RoleMapping map[string]string `json:"role_mapping"`
+}
+
+// oidcProvider holds the endpoints published by the issuer's discovery document
+type oidcProvider struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	IntrospectionEndpoint string `json:"introspection_endpoint"`
+}
+
+type oidcSession struct {
+	user    *User
+	expires time.Time
+}
+
+var (
+	oidcMu         sync.Mutex
+	oidcDiscovered *oidcProvider
+	sessions       = make(map[string]oidcSession)
+	introspections = make(map[string]oidcSession)
+	oidcClient     = &http.Client{Timeout: 15 * time.Second}
+)
+
+func oidcConfigured() bool {
+	return currentConfig().OIDC.Issuer != "" && currentConfig().OIDC.ClientID != ""
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// discoverOIDC fetches and caches the issuer's discovery document
+func discoverOIDC() (*oidcProvider, error) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+
+	if oidcDiscovered != nil {
+		return oidcDiscovered, nil
+	}
+
+	discoveryURL := strings.TrimRight(currentConfig().OIDC.Issuer, "/") + "/.well-known/openid-configuration"
+	resp, err := oidcClient.Get(discoveryURL)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching OIDC discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OIDC discovery returned error: %s", resp.Status)
+	}
+
+	var provider oidcProvider
+	if err := json.NewDecoder(resp.Body).Decode(&provider); err != nil {
+		return nil, fmt.Errorf("error decoding OIDC discovery document: %w", err)
+	}
+
+	oidcDiscovered = &provider
+	return oidcDiscovered, nil
+}
+
+// postOIDCForm sends a client-authenticated form request to a provider endpoint
+func postOIDCForm(endpoint string, form url.Values, result interface{}) error {
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.SetBasicAuth(url.QueryEscape(currentConfig().OIDC.ClientID), url.QueryEscape(currentConfig().OIDC.ClientSecret))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request to OIDC provider: %w", err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("OIDC provider returned error: %s - %s", resp.Status, string(responseBody))
+	}
+
+	return json.Unmarshal(responseBody, result)
+}
+
+// userFromClaims maps provider claims to a tracker user and its roles
+func userFromClaims(claims map[string]interface{}) (*User, error) {
+	claimName := currentConfig().OIDC.UsernameClaim
+	if claimName == "" {
+		claimName = "email"
+	}
+
+	name, _ := claims[claimName].(string)
+	if name == "" {
+		return nil, fmt.Errorf("claim %q is missing", claimName)
+	}
+
+	user := &User{Name: name, Roles: []string{}}
+	if configured := findUser(name); configured != nil {
+		user.Roles = append(user.Roles, configured.Roles...)
+	}
+
+	var groups []string
+	switch value := claims[currentConfig().OIDC.RolesClaim].(type) {
+	case []interface{}:
+		for _, group := range value {
+			if s, ok := group.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	case string:
+		groups = strings.Fields(value)
+	}
+
+	for _, group := range groups {
+		if role, ok := currentConfig().OIDC.RoleMapping[group]; ok {
+			user.Roles = append(user.Roles, role)
+		}
+	}
+
+	return user, nil
+}
+
+// introspectToken validates a bearer token with the provider, caching results briefly
+func introspectToken(token string) (*User, bool) {
+	oidcMu.Lock()
+	cached, found := introspections[token]
+	oidcMu.Unlock()
+	if found && time.Now().Before(cached.expires) {
+		return cached.user, cached.user != nil
+	}
+
+	provider, err := discoverOIDC()
+	if err != nil || provider.IntrospectionEndpoint == "" {
+		return nil, false
+	}
+
+	var claims map[string]interface{}
+	if err := postOIDCForm(provider.IntrospectionEndpoint, url.Values{"token": {token}}, &claims); err != nil {
+		return nil, false
+	}
+
+	var user *User
+	if active, _ := claims["active"].(bool); active {
+		user, _ = userFromClaims(claims)
+	}
+
+	oidcMu.Lock()
+	introspections[token] = oidcSession{user: user, expires: time.Now().Add(introspectionTTL)}
+	oidcMu.Unlock()
+
+	return user, user != nil
+}
+
+// sessionUser returns the user of a valid browser session cookie
+func sessionUser(r *http.Request) (*User, bool) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return nil, false
+	}
+
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+
+	session, found := sessions[cookie.Value]
+	if !found || time.Now().After(session.expires) {
+		delete(sessions, cookie.Value)
+		return nil, false
+	}
+
+	return session.user, true
+}
+
+func oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := discoverOIDC()
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error generating state")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookieName,
+		Value:    state,
+		Path:     "/auth",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	scopes := currentConfig().OIDC.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {currentConfig().OIDC.ClientID},
+		"redirect_uri":  {currentConfig().OIDC.RedirectURL},
+		"scope":         {strings.Join(scopes, " ")},
+		"state":         {state},
+	}
+
+	http.Redirect(w, r, provider.AuthorizationEndpoint+"?"+query.Encode(), http.StatusFound)
+}
+
+func oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	stateCookie, err := r.Cookie(stateCookieName)
+	if err != nil || stateCookie.Value == "" || stateCookie.Value != r.URL.Query().Get("state") {
+		writeError(w, r, http.StatusBadRequest, "Invalid login state")
+		return
+	}
+
+	if errorCode := r.URL.Query().Get("error"); errorCode != "" {
+		writeError(w, r, http.StatusUnauthorized, "Login failed: "+errorCode)
+		return
+	}
+
+	provider, err := discoverOIDC()
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	// Exchange the authorization code for tokens
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+	}
+	err = postOIDCForm(provider.TokenEndpoint, url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {r.URL.Query().Get("code")},
+		"redirect_uri": {currentConfig().OIDC.RedirectURL},
+	}, &tokens)
+	if err != nil {
+		writeError(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	// Read the claims from the userinfo endpoint rather than verifying the ID token locally
+	req, err := http.NewRequest("GET", provider.UserinfoEndpoint, nil)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, "Error fetching user info: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	var claims map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		writeError(w, r, http.StatusBadGateway, "Error decoding user info: "+err.Error())
+		return
+	}
+
+	user, err := userFromClaims(claims)
+	if err != nil {
+		writeError(w, r, http.StatusForbidden, "Error mapping user: "+err.Error())
+		return
+	}
+
+	sessionID, err := randomToken()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error creating session")
+		return
+	}
+
+	oidcMu.Lock()
+	sessions[sessionID] = oidcSession{user: user, expires: time.Now().Add(sessionLifetime)}
+	oidcMu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    sessionID,
+		Path:     "/",
+		MaxAge:   int(sessionLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func oidcLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		oidcMu.Lock()
+		delete(sessions, cookie.Value)
+		oidcMu.Unlock()
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Value: "", Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
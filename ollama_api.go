@@ -2,22 +2,28 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
 )
 
 type OllamaRequest struct {
-	Model       string  `json:"model"`
-	Prompt      string  `json:"prompt"`
-	System      string  `json:"system"`
-	Stream      bool    `json:"stream"`
-	MaxTokens   int     `json:"max_tokens,omitempty"`
-	Temperature float64 `json:"temperature,omitempty"`
+	Model   string        `json:"model"`
+	Prompt  string        `json:"prompt"`
+	System  string        `json:"system"`
+	Stream  bool          `json:"stream"`
+	Options OllamaOptions `json:"options"`
+}
+
+// OllamaOptions are the sampling parameters Ollama reads from a request's options
+type OllamaOptions struct {
+	Temperature float64 `json:"temperature"`
+	NumPredict  int     `json:"num_predict,omitempty"`
+	TopP        float64 `json:"top_p,omitempty"`
+	Seed        int     `json:"seed"`
 }
 
 type OllamaResponse struct {
@@ -32,34 +38,203 @@ type CategoryResponse struct {
 	Timespan   string `json:"timespan"`
 	Confidence string `json:"confidence"`
 	Reason     string `json:"reason"`
+	// InputHash identifies the prompt, model and parameters in deterministic mode
+	InputHash string `json:"input_hash,omitempty"`
+	// Labels are the other categories the entry covers in multi-label mode
+	Labels []EntryLabel `json:"labels,omitempty"`
+	// Experiment is the variant that categorized the entry while an experiment runs
+	Experiment *ExperimentAssignment `json:"-"`
+}
+
+// ollamaProvider categorizes and embeds text using a local Ollama server
+type ollamaProvider struct {
+	baseURL        string
+	model          string
+	embeddingModel string
 }
 
-func categorizeDescription(description string) (*CategoryResponse, error) {
-	ollamaURL := "http://localhost:11434/api/generate"
-	modelName := "gemma3"
+type OllamaEmbeddingRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+type OllamaEmbeddingResponse struct {
+	Embedding []float64 `json:"embedding"`
+}
 
-	systemPrompt, err := readSystemPrompt()
+func (p ollamaProvider) Categorize(ctx context.Context, description string) (*CategoryResponse, error) {
+	systemPrompt, err := readSystemPrompt(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error reading system prompt: %w", err)
 	}
+	systemPrompt += taxonomyPrompt()
+	if currentConfig().Categorization.MultiLabel {
+		systemPrompt += multiLabelPrompt
+	}
+
+	response, err := p.generate(ctx, systemPrompt, description)
+	if err != nil {
+		return nil, err
+	}
+
+	var categoryResp CategoryResponse
+	if err := json.Unmarshal([]byte(response), &categoryResp); err != nil {
+		return nil, fmt.Errorf("error parsing category JSON: %w, raw response: %s", err, response)
+	}
+	categoryResp.InputHash = inputHash(ctx, p.modelFor(ctx), systemPrompt, description)
+
+	return &categoryResp, nil
+}
+
+// ChooseRule asks the model to pick one of the embedding candidates, keeping the prompt small
+func (p ollamaProvider) ChooseRule(ctx context.Context, description string, candidates []RuleCandidate) (*RuleChoice, error) {
+	systemPrompt := ruleChoicePrompt(candidates)
+	response, err := p.generate(ctx, systemPrompt, description)
+	if err != nil {
+		return nil, err
+	}
+
+	var choice RuleChoice
+	if err := json.Unmarshal([]byte(response), &choice); err != nil {
+		return nil, fmt.Errorf("error parsing rule choice JSON: %w, raw response: %s", err, response)
+	}
+	choice.InputHash = inputHash(ctx, p.modelFor(ctx), systemPrompt, description)
+
+	return &choice, nil
+}
+
+// Translate asks the model for an English translation of a description
+func (p ollamaProvider) Translate(ctx context.Context, text, language string) (string, error) {
+	systemPrompt := fmt.Sprintf("Translate the user's time tracking entry from %s to English. "+
+		"Keep ticket keys, names, product terms and durations unchanged. "+
+		"Respond only with JSON: {\"translation\": \"<English text>\"}", languageNames[language])
+
+	response, err := p.generate(ctx, systemPrompt, text)
+	if err != nil {
+		return "", err
+	}
+
+	var translation struct {
+		Translation string `json:"translation"`
+	}
+	if err := json.Unmarshal([]byte(response), &translation); err != nil {
+		return "", fmt.Errorf("error parsing translation JSON: %w, raw response: %s", err, response)
+	}
+
+	return translation.Translation, nil
+}
+
+// Retrospective asks the model to summarize a week from the facts it is given
+func (p ollamaProvider) Retrospective(ctx context.Context, facts string) (*RetroNarrative, error) {
+	response, err := p.generate(ctx, retroSystemPrompt, facts)
+	if err != nil {
+		return nil, err
+	}
+
+	var narrative RetroNarrative
+	if err := json.Unmarshal([]byte(response), &narrative); err != nil {
+		return nil, fmt.Errorf("error parsing retrospective JSON: %w, raw response: %s", err, response)
+	}
+
+	return &narrative, nil
+}
+
+// Split asks the model to divide an entry into the activities it describes
+func (p ollamaProvider) Split(ctx context.Context, description string) (*SplitResponse, error) {
+	response, err := p.generate(ctx, splitSystemPrompt+taxonomyPrompt(), description)
+	if err != nil {
+		return nil, err
+	}
+
+	var split SplitResponse
+	if err := json.Unmarshal([]byte(response), &split); err != nil {
+		return nil, fmt.Errorf("error parsing split JSON: %w, raw response: %s", err, response)
+	}
+
+	return &split, nil
+}
+
+// Clarify asks the model for a question that would settle an uncertain categorization
+func (p ollamaProvider) Clarify(ctx context.Context, description string) (string, error) {
+	response, err := p.generate(ctx, clarifySystemPrompt+taxonomyPrompt(), description)
+	if err != nil {
+		return "", err
+	}
+
+	var clarification struct {
+		Question string `json:"question"`
+	}
+	if err := json.Unmarshal([]byte(response), &clarification); err != nil {
+		return "", fmt.Errorf("error parsing clarification JSON: %w, raw response: %s", err, response)
+	}
+
+	return clarification.Question, nil
+}
+
+// LabelTopic asks the model to name the theme of a cluster of entries
+func (p ollamaProvider) LabelTopic(ctx context.Context, descriptions string) (string, error) {
+	response, err := p.generate(ctx, clusterLabelPrompt, descriptions)
+	if err != nil {
+		return "", err
+	}
+
+	var topic struct {
+		Label string `json:"label"`
+	}
+	if err := json.Unmarshal([]byte(response), &topic); err != nil {
+		return "", fmt.Errorf("error parsing topic JSON: %w, raw response: %s", err, response)
+	}
+
+	return topic.Label, nil
+}
+
+// modelFor returns the model to generate with, the challenger's in an experiment
+func (p ollamaProvider) modelFor(ctx context.Context) string {
+	if assignment := experimentAssignment(ctx); assignment != nil && assignment.Model != "" {
+		return assignment.Model
+	}
+	return p.model
+}
+
+// generate sends a prompt to Ollama and returns the JSON object in the model's answer
+func (p ollamaProvider) generate(ctx context.Context, systemPrompt, prompt string) (_ string, err error) {
+	ollamaURL := p.baseURL + "/api/generate"
+	modelName := p.modelFor(ctx)
+
+	options := generationOptions(ctx)
+
+	_, span := startSpan(ctx, "ollama.generate", spanKindClient)
+	span.SetAttribute("llm.model", modelName)
+	span.SetAttribute("llm.prompt_length", len(prompt))
+	span.SetAttribute("llm.temperature", options.Temperature)
+	span.SetAttribute("llm.seed", options.Seed)
+	span.SetAttribute("server.address", ollamaURL)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
 
 	request := OllamaRequest{
-		Model:       modelName,
-		Prompt:      description,
-		System:      systemPrompt,
-		Stream:      false,
-		MaxTokens:   2000,
-		Temperature: 0.7,
+		Model:  modelName,
+		Prompt: prompt,
+		System: systemPrompt,
+		Stream: false,
+		Options: OllamaOptions{
+			Temperature: options.Temperature,
+			NumPredict:  options.MaxTokens,
+			TopP:        options.TopP,
+			Seed:        options.Seed,
+		},
 	}
 
 	requestData, err := json.Marshal(request)
 	if err != nil {
-		return nil, fmt.Errorf("error marshalling request: %w", err)
+		return "", fmt.Errorf("error marshalling request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", ollamaURL, bytes.NewBuffer(requestData))
+	req, err := http.NewRequestWithContext(ctx, "POST", ollamaURL, bytes.NewBuffer(requestData))
 	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
+		return "", fmt.Errorf("error creating request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -67,19 +242,19 @@ func categorizeDescription(description string) (*CategoryResponse, error) {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error sending request to Ollama: %w", err)
+		return "", fmt.Errorf("error sending request to Ollama: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		responseBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Ollama API returned error: %s - %s", resp.Status, string(responseBody))
+		return "", fmt.Errorf("Ollama API returned error: %s - %s", resp.Status, string(responseBody))
 	}
 
 	// Read the complete response body
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %w", err)
+		return "", fmt.Errorf("error reading response body: %w", err)
 	}
 
 	// Log the raw response for debugging
@@ -87,7 +262,7 @@ func categorizeDescription(description string) (*CategoryResponse, error) {
 
 	var ollamaResp OllamaResponse
 	if err := json.Unmarshal(responseBody, &ollamaResp); err != nil {
-		return nil, fmt.Errorf("error decoding Ollama response: %w", err)
+		return "", fmt.Errorf("error decoding Ollama response: %w", err)
 	}
 
 	// Log the parsed response for debugging
@@ -108,36 +283,74 @@ func categorizeDescription(description string) (*CategoryResponse, error) {
 			if json.Valid([]byte(extractedJSON)) {
 				ollamaResp.Response = extractedJSON
 			} else {
-				return nil, fmt.Errorf("could not extract valid JSON from response")
+				return "", fmt.Errorf("could not extract valid JSON from response")
 			}
 		} else {
-			return nil, fmt.Errorf("response doesn't contain valid JSON: %s", ollamaResp.Response)
+			return "", fmt.Errorf("response doesn't contain valid JSON: %s", ollamaResp.Response)
 		}
 	}
 
-	var categoryResp CategoryResponse
-	if err := json.Unmarshal([]byte(ollamaResp.Response), &categoryResp); err != nil {
-		return nil, fmt.Errorf("error parsing category JSON: %w, raw response: %s", err, ollamaResp.Response)
+	return ollamaResp.Response, nil
+}
+
+func (p ollamaProvider) Embed(ctx context.Context, text string) (_ []float64, err error) {
+	ollamaURL := p.baseURL + "/api/embeddings"
+
+	_, span := startSpan(ctx, "ollama.embeddings", spanKindClient)
+	span.SetAttribute("llm.model", p.embeddingModel)
+	span.SetAttribute("llm.prompt_length", len(text))
+	span.SetAttribute("server.address", ollamaURL)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	requestData, err := json.Marshal(OllamaEmbeddingRequest{
+		Model:  p.embeddingModel,
+		Prompt: text,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling request: %w", err)
 	}
 
-	return &categoryResp, nil
-}
+	req, err := http.NewRequestWithContext(ctx, "POST", ollamaURL, bytes.NewBuffer(requestData))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
 
-func readSystemPrompt() (string, error) {
-	execPath, err := os.Executable()
+	client := &http.Client{}
+	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error getting executable path: %w", err)
+		return nil, fmt.Errorf("error sending request to Ollama: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Ollama API returned error: %s - %s", resp.Status, string(responseBody))
 	}
 
-	execDir := filepath.Dir(execPath)
-	promptFilePath := filepath.Join(execDir, "system_prompt.txt")
+	var embeddingResp OllamaEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embeddingResp); err != nil {
+		return nil, fmt.Errorf("error decoding Ollama response: %w", err)
+	}
 
-	if _, err := os.Stat(promptFilePath); os.IsNotExist(err) {
-		currentDir, _ := os.Getwd()
-		promptFilePath = filepath.Join(currentDir, "system_prompt.txt")
+	if len(embeddingResp.Embedding) == 0 {
+		return nil, fmt.Errorf("Ollama returned an empty embedding")
 	}
 
-	promptData, err := os.ReadFile(promptFilePath)
+	return embeddingResp.Embedding, nil
+}
+
+// readSystemPrompt reads system_prompt.txt, falling back to the built-in prompt
+func readSystemPrompt(ctx context.Context) (string, error) {
+	name := "system_prompt.txt"
+	if assignment := experimentAssignment(ctx); assignment != nil && assignment.Prompt != "" {
+		name = assignment.Prompt
+	}
+	promptData, err := readDefaultFile(name)
 	if err != nil {
 		return "", fmt.Errorf("error reading system prompt file: %w", err)
 	}
@@ -149,7 +362,7 @@ func readSystemPrompt() (string, error) {
 func TestCategorize(description string) {
 	fmt.Println("Testing categorization with description:", description)
 
-	result, err := categorizeDescription(description)
+	result, err := categorizeDescription(context.Background(), description)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		return
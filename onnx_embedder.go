@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// EmbedderONNX runs a sentence-transformer model in process instead of asking the provider
+const EmbedderONNX = "onnx"
+
+// maxWordChars is the longest word WordPiece splits, longer ones become [UNK] as in BERT
+const maxWordChars = 100
+
+// ONNXConfig points at a sentence-transformer exported to ONNX, e.g. all-MiniLM-L6-v2,
+// and the onnxruntime library that runs it
+type ONNXConfig struct {
+	// ModelPath is the .onnx file, taking input_ids, attention_mask and token_type_ids
+	// and returning last_hidden_state
+	ModelPath string `json:"model_path"`
+	// VocabPath is the model's WordPiece vocab.txt
+	VocabPath string `json:"vocab_path"`
+	// LibraryPath is the onnxruntime shared library, default the system's
+	LibraryPath string `json:"library_path,omitempty"`
+	// MaxTokens truncates long texts, default 256
+	MaxTokens int `json:"max_tokens,omitempty"`
+	// CaseSensitive keeps case for cased models, most sentence-transformers are uncased
+	CaseSensitive bool `json:"case_sensitive,omitempty"`
+}
+
+// localEmbedder embeds with an in-process model while the provider does the rest,
+// so the embedding path works offline and without the Ollama daemon
+type localEmbedder struct {
+	Provider
+	embedder Embedder
+}
+
+func (p localEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	return p.embedder.Embed(ctx, text)
+}
+
+// withLocalEmbedder replaces the provider's embeddings with the configured in-process embedder
+func withLocalEmbedder(config LLMConfig, provider Provider) (Provider, error) {
+	switch config.Embedder {
+	case "":
+		return provider, nil
+	case EmbedderONNX:
+		if config.ONNX.ModelPath == "" || config.ONNX.VocabPath == "" {
+			return nil, fmt.Errorf("the onnx embedder needs a model_path and a vocab_path")
+		}
+		embedder, err := newONNXEmbedder(config.ONNX)
+		if err != nil {
+			return nil, fmt.Errorf("error loading the onnx model: %w", err)
+		}
+		return localEmbedder{Provider: provider, embedder: embedder}, nil
+	default:
+		return nil, fmt.Errorf("unknown embedder %q", config.Embedder)
+	}
+}
+
+// wordPiece tokenizes text the way BERT models expect
+type wordPiece struct {
+	vocab     map[string]int64
+	lowercase bool
+	maxTokens int
+}
+
+// loadWordPiece reads a vocab.txt, one token per line with the line number as its ID
+func loadWordPiece(config ONNXConfig) (*wordPiece, error) {
+	file, err := os.Open(config.VocabPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tokenizer := &wordPiece{vocab: make(map[string]int64), lowercase: !config.CaseSensitive, maxTokens: config.MaxTokens}
+	if tokenizer.maxTokens <= 0 {
+		tokenizer.maxTokens = 256
+	}
+
+	scanner := bufio.NewScanner(file)
+	for id := int64(0); scanner.Scan(); id++ {
+		tokenizer.vocab[strings.TrimRight(scanner.Text(), "\r")] = id
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, special := range []string{"[CLS]", "[SEP]", "[UNK]"} {
+		if _, found := tokenizer.vocab[special]; !found {
+			return nil, fmt.Errorf("vocab has no %s token", special)
+		}
+	}
+	return tokenizer, nil
+}
+
+// words splits text on whitespace and around punctuation and CJK characters
+func (t *wordPiece) words(text string) []string {
+	if t.lowercase {
+		text = strings.ToLower(text)
+	}
+
+	var words []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			words = append(words, current.String())
+			current.Reset()
+		}
+	}
+	for _, r := range text {
+		switch {
+		case r == 0 || r == unicode.ReplacementChar || (unicode.IsControl(r) && !unicode.IsSpace(r)):
+		case unicode.IsSpace(r):
+			flush()
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.Is(unicode.Han, r):
+			flush()
+			words = append(words, string(r))
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return words
+}
+
+// encode returns the token IDs of text between [CLS] and [SEP], truncated to maxTokens
+func (t *wordPiece) encode(text string) []int64 {
+	unknown := t.vocab["[UNK]"]
+	ids := []int64{t.vocab["[CLS]"]}
+
+	for _, word := range t.words(text) {
+		runes := []rune(word)
+		if len(runes) > maxWordChars {
+			ids = append(ids, unknown)
+			continue
+		}
+
+		// Greedy longest-match-first, continuation pieces are prefixed with ##
+		pieces := []int64{}
+		for start := 0; start < len(runes); {
+			end := len(runes)
+			var id int64
+			found := false
+			for ; end > start; end-- {
+				piece := string(runes[start:end])
+				if start > 0 {
+					piece = "##" + piece
+				}
+				if id, found = t.vocab[piece]; found {
+					break
+				}
+			}
+			if !found {
+				pieces = []int64{unknown}
+				break
+			}
+			pieces = append(pieces, id)
+			start = end
+		}
+		ids = append(ids, pieces...)
+	}
+
+	if len(ids) > t.maxTokens-1 {
+		ids = ids[:t.maxTokens-1]
+	}
+	return append(ids, t.vocab["[SEP]"])
+}
+
+// meanPool averages the token states of a [1, tokens, dimensions] output into one
+// sentence embedding, as sentence-transformers do
+func meanPool(hidden []float32, tokens, dimensions int) []float64 {
+	embedding := make([]float64, dimensions)
+	if tokens == 0 {
+		return embedding
+	}
+	for token := 0; token < tokens; token++ {
+		for d := 0; d < dimensions; d++ {
+			embedding[d] += float64(hidden[token*dimensions+d])
+		}
+	}
+	for d := range embedding {
+		embedding[d] /= float64(tokens)
+	}
+	return embedding
+}
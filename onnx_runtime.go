@@ -0,0 +1,95 @@
+// Build with: go get github.com/yalue/onnxruntime_go && go build -tags onnx .
+// to run embeddings in process with onnxruntime, which must be installed
+//go:build onnx
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// onnxEmbedder runs a sentence-transformer with onnxruntime
+type onnxEmbedder struct {
+	tokenizer *wordPiece
+	session   *ort.DynamicAdvancedSession
+
+	// mu serializes runs, the model is small and one run keeps every core busy
+	mu sync.Mutex
+}
+
+func newONNXEmbedder(config ONNXConfig) (Embedder, error) {
+	tokenizer, err := loadWordPiece(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.LibraryPath != "" {
+		ort.SetSharedLibraryPath(config.LibraryPath)
+	}
+	if !ort.IsInitialized() {
+		if err := ort.InitializeEnvironment(); err != nil {
+			return nil, err
+		}
+	}
+
+	session, err := ort.NewDynamicAdvancedSession(config.ModelPath,
+		[]string{"input_ids", "attention_mask", "token_type_ids"},
+		[]string{"last_hidden_state"}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &onnxEmbedder{tokenizer: tokenizer, session: session}, nil
+}
+
+func (e *onnxEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := e.tokenizer.encode(text)
+	mask := make([]int64, len(ids))
+	for i := range mask {
+		mask[i] = 1
+	}
+	shape := ort.NewShape(1, int64(len(ids)))
+
+	inputIDs, err := ort.NewTensor(shape, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer inputIDs.Destroy()
+	attention, err := ort.NewTensor(shape, mask)
+	if err != nil {
+		return nil, err
+	}
+	defer attention.Destroy()
+	tokenTypes, err := ort.NewTensor(shape, make([]int64, len(ids)))
+	if err != nil {
+		return nil, err
+	}
+	defer tokenTypes.Destroy()
+
+	e.mu.Lock()
+	outputs := []ort.Value{nil}
+	err = e.session.Run([]ort.Value{inputIDs, attention, tokenTypes}, outputs)
+	e.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	defer outputs[0].Destroy()
+
+	hidden, ok := outputs[0].(*ort.Tensor[float32])
+	if !ok {
+		return nil, fmt.Errorf("unexpected model output %T", outputs[0])
+	}
+	dims := hidden.GetShape()
+	if len(dims) != 3 {
+		return nil, fmt.Errorf("unexpected model output shape %v", dims)
+	}
+	return meanPool(hidden.GetData(), int(dims[1]), int(dims[2])), nil
+}
@@ -0,0 +1,10 @@
+//go:build !onnx
+
+package main
+
+import "fmt"
+
+// newONNXEmbedder is unavailable without the onnxruntime bindings, see onnx_runtime.go
+func newONNXEmbedder(config ONNXConfig) (Embedder, error) {
+	return nil, fmt.Errorf("this build has no ONNX support, rebuild with -tags onnx")
+}
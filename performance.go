@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in milliseconds, of the latency histogram
+// buckets. Slower observations fall in a final overflow bucket.
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000}
+
+// Latency objective defaults
+const (
+	defaultSLOLatencyMS = 1000
+	defaultSLOTarget    = 0.99
+)
+
+// Pipeline stages timed alongside the endpoints
+const (
+	stageCategorization = "categorization"
+	stageLLMCategorize  = "llm.categorize"
+	stageLLMEmbed       = "llm.embed"
+)
+
+// PerformanceConfig sets the latency objectives reported by /api/v1/stats/performance
+type PerformanceConfig struct {
+	// LatencyMS is the objective of every endpoint and stage, default 1000
+	LatencyMS int `json:"latency_ms,omitempty"`
+	// Target is the share of requests that should finish within the objective, default 0.99
+	Target float64 `json:"target,omitempty"`
+	// Objectives overrides LatencyMS by route pattern, e.g. "/api/v1/categorize", by
+	// method and pattern, e.g. "POST /api/v1/rules", or by stage, e.g. "llm.categorize"
+	Objectives map[string]int `json:"objectives,omitempty"`
+}
+
+// latencyHistogram counts observations per bucket
+type latencyHistogram struct {
+	counts []int64
+	count  int64
+	errors int64
+	sum    float64
+	max    float64
+}
+
+// observe adds one observation in milliseconds
+func (h *latencyHistogram) observe(ms float64, failed bool) {
+	if h.counts == nil {
+		h.counts = make([]int64, len(latencyBuckets)+1)
+	}
+	bucket := sort.SearchFloat64s(latencyBuckets, ms)
+	h.counts[bucket]++
+	h.count++
+	h.sum += ms
+	h.max = max(h.max, ms)
+	if failed {
+		h.errors++
+	}
+}
+
+// bucketBounds returns the lower and upper bound of a bucket, the overflow bucket ends at the maximum
+func (h *latencyHistogram) bucketBounds(bucket int) (float64, float64) {
+	lower := 0.0
+	if bucket > 0 {
+		lower = latencyBuckets[bucket-1]
+	}
+	if bucket == len(latencyBuckets) {
+		return lower, h.max
+	}
+	return lower, latencyBuckets[bucket]
+}
+
+// quantile estimates the latency below which the given fraction of observations
+// fell, interpolating within the bucket it lands in
+func (h *latencyHistogram) quantile(fraction float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+	rank := fraction * float64(h.count)
+	var seen int64
+	for bucket, count := range h.counts {
+		if count == 0 || float64(seen+count) < rank {
+			seen += count
+			continue
+		}
+		lower, upper := h.bucketBounds(bucket)
+		estimate := lower + (upper-lower)*(rank-float64(seen))/float64(count)
+		return min(estimate, h.max)
+	}
+	return h.max
+}
+
+// within estimates the share of observations that took at most ms milliseconds
+func (h *latencyHistogram) within(ms float64) float64 {
+	if h.count == 0 {
+		return 1
+	}
+	if ms >= h.max {
+		return 1
+	}
+	var below float64
+	for bucket, count := range h.counts {
+		lower, upper := h.bucketBounds(bucket)
+		if upper <= ms {
+			below += float64(count)
+			continue
+		}
+		if lower < ms && upper > lower {
+			below += float64(count) * (ms - lower) / (upper - lower)
+		}
+		break
+	}
+	return below / float64(h.count)
+}
+
+// LatencySummary is the performance of one endpoint or stage
+type LatencySummary struct {
+	Name      string  `json:"name"`
+	Count     int64   `json:"count"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	MeanMS    float64 `json:"mean_ms"`
+	P50MS     float64 `json:"p50_ms"`
+	P95MS     float64 `json:"p95_ms"`
+	P99MS     float64 `json:"p99_ms"`
+	MaxMS     float64 `json:"max_ms"`
+	// ObjectiveMS is the latency objective, WithinObjective the share of requests meeting it
+	ObjectiveMS     int     `json:"objective_ms"`
+	WithinObjective float64 `json:"within_objective"`
+	// SLOMet reports whether WithinObjective reaches the target
+	SLOMet bool `json:"slo_met"`
+}
+
+// PerformanceReport is served by /api/v1/stats/performance. Percentiles are
+// estimated from histogram buckets, so they are approximate.
+type PerformanceReport struct {
+	Since     time.Time        `json:"since"`
+	Target    float64          `json:"target"`
+	Endpoints []LatencySummary `json:"endpoints"`
+	Stages    []LatencySummary `json:"stages"`
+}
+
+var (
+	latencyMu sync.Mutex
+	// endpointLatency is keyed by method and route pattern, stageLatency by stage.
+	// Both are cleared rather than replaced, so they can be passed without the lock.
+	endpointLatency = map[string]*latencyHistogram{}
+	stageLatency    = map[string]*latencyHistogram{}
+	latencySince    = time.Now().UTC()
+)
+
+// recordLatency adds an observation to a histogram, creating it on first use
+func recordLatency(histograms map[string]*latencyHistogram, name string, elapsed time.Duration, failed bool) {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+
+	histogram, ok := histograms[name]
+	if !ok {
+		histogram = &latencyHistogram{}
+		histograms[name] = histogram
+	}
+	histogram.observe(float64(elapsed)/float64(time.Millisecond), failed)
+}
+
+// recordStage times a pipeline stage, failed when it returned an error
+func recordStage(stage string, start time.Time, err error) {
+	recordLatency(stageLatency, stage, time.Since(start), err != nil)
+}
+
+// performanceMiddleware times every request by method and route pattern, counting
+// server errors. It wraps the mux directly so the request carries the matched
+// pattern, which it also reports to the tracing span. Paths no route matched share
+// one histogram.
+func performanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		reportRoute(r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		recordLatency(endpointLatency, r.Method+" "+route, time.Since(start), recorder.status >= 500)
+	})
+}
+
+// stageMean returns the mean duration of a pipeline stage in milliseconds, 0 before
+// it has run
+func stageMean(stage string) float64 {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+
+	histogram, ok := stageLatency[stage]
+	if !ok || histogram.count == 0 {
+		return 0
+	}
+	return histogram.sum / float64(histogram.count)
+}
+
+// latencyObjective returns the configured objective of an endpoint or stage
+func latencyObjective(config PerformanceConfig, name string) int {
+	if objective, ok := config.Objectives[name]; ok {
+		return objective
+	}
+	if _, route, found := strings.Cut(name, " "); found {
+		if objective, ok := config.Objectives[route]; ok {
+			return objective
+		}
+	}
+	if config.LatencyMS > 0 {
+		return config.LatencyMS
+	}
+	return defaultSLOLatencyMS
+}
+
+// roundMS rounds milliseconds to the microsecond
+func roundMS(ms float64) float64 {
+	return math.Round(ms*1000) / 1000
+}
+
+// summarizeLatency reports every histogram by name, callers must hold latencyMu
+func summarizeLatency(config PerformanceConfig, target float64, histograms map[string]*latencyHistogram) []LatencySummary {
+	summaries := make([]LatencySummary, 0, len(histograms))
+	for name, histogram := range histograms {
+		objective := latencyObjective(config, name)
+		summary := LatencySummary{
+			Name:            name,
+			Count:           histogram.count,
+			Errors:          histogram.errors,
+			MeanMS:          roundMS(histogram.sum / float64(histogram.count)),
+			P50MS:           roundMS(histogram.quantile(0.50)),
+			P95MS:           roundMS(histogram.quantile(0.95)),
+			P99MS:           roundMS(histogram.quantile(0.99)),
+			MaxMS:           roundMS(histogram.max),
+			ObjectiveMS:     objective,
+			WithinObjective: histogram.within(float64(objective)),
+		}
+		summary.ErrorRate = float64(summary.Errors) / float64(summary.Count)
+		summary.SLOMet = summary.WithinObjective >= target
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+	return summaries
+}
+
+// buildPerformanceReport summarizes the latency recorded since startup or the last reset
+func buildPerformanceReport(config PerformanceConfig) PerformanceReport {
+	target := config.Target
+	if target <= 0 || target > 1 {
+		target = defaultSLOTarget
+	}
+
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+	return PerformanceReport{
+		Since:     latencySince,
+		Target:    target,
+		Endpoints: summarizeLatency(config, target, endpointLatency),
+		Stages:    summarizeLatency(config, target, stageLatency),
+	}
+}
+
+// resetLatency starts the histograms over, e.g. after a deploy
+func resetLatency() {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+	clear(endpointLatency)
+	clear(stageLatency)
+	latencySince = time.Now().UTC()
+}
+
+// performanceHandler reports latency percentiles, error rates and objectives per
+// endpoint and pipeline stage on GET and resets them on DELETE
+func performanceHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		resetLatency()
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildPerformanceReport(currentConfig().Performance))
+}
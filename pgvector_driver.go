@@ -0,0 +1,7 @@
+// Build with: go get github.com/jackc/pgx/v5 && go build -tags pgvector .
+// to link the Postgres driver the pgvector vector store connects with
+//go:build pgvector
+
+package main
+
+import _ "github.com/jackc/pgx/v5/stdlib"
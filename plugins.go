@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Plugin stages relative to the built-in rules and LLM pipeline
+const (
+	// PluginBefore runs first, a plugin returning a task skips the built-in pipeline
+	PluginBefore = "before"
+	// PluginAfter receives the pipeline's result and may amend it
+	PluginAfter = "after"
+)
+
+// defaultPluginTimeout bounds a plugin call when no timeout is configured
+const defaultPluginTimeout = 10 * time.Second
+
+// PluginConfig describes a categorizer plugin: a long-running subprocess speaking
+// JSON-RPC 2.0 over stdin/stdout, one request or response per line
+type PluginConfig struct {
+	Name    string   `json:"name"`
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	// Stage is "before" or "after" the built-in pipeline
+	Stage          string `json:"stage"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+}
+
+// PluginRequest is the params of the "categorize" method
+type PluginRequest struct {
+	Description string `json:"description"`
+	Stage       string `json:"stage"`
+	// Result is the built-in pipeline's answer, only sent to "after" plugins
+	Result *CategoryResponse `json:"result,omitempty"`
+}
+
+// PluginResult is a plugin's answer. Empty fields keep the current value, and a
+// "before" plugin leaving Task empty passes the description on unchanged.
+type PluginResult struct {
+	Task       string `json:"task,omitempty"`
+	Jira       string `json:"jira,omitempty"`
+	Timespan   string `json:"timespan,omitempty"`
+	Confidence string `json:"confidence,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int64       `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	ID     int64           `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// categorizerPlugin is a running plugin process, started on first use and
+// restarted after it exits or times out
+type categorizerPlugin struct {
+	config PluginConfig
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	nextID int64
+}
+
+// preparePlugins validates the plugin configs and returns the plugins in order,
+// processes start on first use
+func preparePlugins(configs []PluginConfig) ([]*categorizerPlugin, error) {
+	plugins := []*categorizerPlugin{}
+	for _, config := range configs {
+		if config.Name == "" || config.Command == "" {
+			return nil, fmt.Errorf("plugins need a name and a command")
+		}
+		if config.Stage != PluginBefore && config.Stage != PluginAfter {
+			return nil, fmt.Errorf("plugin %s: unknown stage %q, expected before or after", config.Name, config.Stage)
+		}
+		plugins = append(plugins, &categorizerPlugin{config: config})
+	}
+	return plugins, nil
+}
+
+// start launches the plugin process, callers must hold p.mu
+func (p *categorizerPlugin) start() error {
+	cmd := exec.Command(p.config.Command, p.config.Args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = log.Writer()
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("couldn't start plugin: %v", err)
+	}
+
+	p.cmd, p.stdin, p.stdout = cmd, stdin, bufio.NewReader(stdout)
+	return nil
+}
+
+// close stops the plugin process once a reload has replaced the plugin
+func (p *categorizerPlugin) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stop()
+}
+
+// stop kills the plugin process so the next call starts a fresh one, callers must hold p.mu
+func (p *categorizerPlugin) stop() {
+	if p.cmd == nil {
+		return
+	}
+	p.stdin.Close()
+	p.cmd.Process.Kill()
+	p.cmd.Wait()
+	p.cmd = nil
+}
+
+// call sends one JSON-RPC request and decodes the result
+func (p *categorizerPlugin) call(ctx context.Context, method string, params, result interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cmd == nil {
+		if err := p.start(); err != nil {
+			return err
+		}
+	}
+
+	p.nextID++
+	request, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: p.nextID, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+
+	timeout := defaultPluginTimeout
+	if p.config.TimeoutSeconds > 0 {
+		timeout = time.Duration(p.config.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type reply struct {
+		line []byte
+		err  error
+	}
+	replies := make(chan reply, 1)
+	go func() {
+		if _, err := p.stdin.Write(append(request, '\n')); err != nil {
+			replies <- reply{err: err}
+			return
+		}
+		line, err := p.stdout.ReadBytes('\n')
+		replies <- reply{line: line, err: err}
+	}()
+
+	var answer reply
+	select {
+	case answer = <-replies:
+	case <-ctx.Done():
+		// The process may be stuck mid-answer, start over on the next call
+		p.stop()
+		if ctx.Err() == context.Canceled {
+			return fmt.Errorf("plugin %s canceled", p.config.Name)
+		}
+		return fmt.Errorf("plugin %s timed out", p.config.Name)
+	}
+	if answer.err != nil {
+		p.stop()
+		return fmt.Errorf("plugin %s stopped responding: %v", p.config.Name, answer.err)
+	}
+
+	var response rpcResponse
+	if err := json.Unmarshal(answer.line, &response); err != nil {
+		p.stop()
+		return fmt.Errorf("plugin %s sent invalid JSON: %v", p.config.Name, err)
+	}
+	if response.ID != p.nextID {
+		p.stop()
+		return fmt.Errorf("plugin %s answered request %d, expected %d", p.config.Name, response.ID, p.nextID)
+	}
+	if response.Error != nil {
+		return fmt.Errorf("plugin %s: %s", p.config.Name, response.Error.Message)
+	}
+
+	return json.Unmarshal(response.Result, result)
+}
+
+// apply copies the plugin's non-empty fields onto a result
+func (r PluginResult) apply(result *CategoryResponse, name string) {
+	if r.Task != "" {
+		result.Task = r.Task
+		// The recorded LLM inputs no longer explain a plugin's category
+		result.InputHash = ""
+	}
+	if r.Jira != "" {
+		result.Jira = r.Jira
+	}
+	if r.Timespan != "" {
+		result.Timespan = r.Timespan
+	}
+	if r.Confidence != "" {
+		result.Confidence = normalizeConfidence(r.Confidence)
+	}
+	if r.Reason != "" {
+		result.Reason = fmt.Sprintf("%s (plugin %s)", r.Reason, name)
+	}
+}
+
+// runBeforePlugins asks the "before" plugins in order, returning the first answer with a task.
+// Failing plugins are logged and skipped so they can't stop categorization.
+func runBeforePlugins(ctx context.Context, description string) *CategoryResponse {
+	for _, plugin := range active.Load().plugins {
+		if plugin.config.Stage != PluginBefore {
+			continue
+		}
+
+		var answer PluginResult
+		if err := plugin.call(ctx, "categorize", PluginRequest{Description: description, Stage: PluginBefore}, &answer); err != nil {
+			log.Printf("Error calling categorizer plugin: %v", err)
+			continue
+		}
+		if answer.Task == "" {
+			continue
+		}
+
+		result := &CategoryResponse{Confidence: "medium", Reason: "Categorized by plugin " + plugin.config.Name}
+		answer.apply(result, plugin.config.Name)
+		return result
+	}
+	return nil
+}
+
+// runAfterPlugins lets each "after" plugin amend the pipeline's result in turn
+func runAfterPlugins(ctx context.Context, description string, result *CategoryResponse) {
+	for _, plugin := range active.Load().plugins {
+		if plugin.config.Stage != PluginAfter {
+			continue
+		}
+
+		current := *result
+		var answer PluginResult
+		if err := plugin.call(ctx, "categorize", PluginRequest{Description: description, Stage: PluginAfter, Result: &current}, &answer); err != nil {
+			log.Printf("Error calling categorizer plugin: %v", err)
+			continue
+		}
+		answer.apply(result, plugin.config.Name)
+	}
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const pomodoroLogFile = "aidea_pomodoro_log.json"
+
+// pomodoroLogMu serializes reads and rewrites of the pomodoro log
+var pomodoroLogMu sync.Mutex
+
+// Pomodoro represents a single work interval on the timer
+type Pomodoro struct {
+	ID            string         `json:"id"`
+	Description   string         `json:"description"`
+	WorkMinutes   int            `json:"work_minutes"`
+	BreakMinutes  int            `json:"break_minutes"`
+	StartedAt     time.Time      `json:"started_at"`
+	EndsAt        time.Time      `json:"ends_at"`
+	CompletedAt   *time.Time     `json:"completed_at,omitempty"`
+	Status        string         `json:"status"`
+	Interruptions []Interruption `json:"interruptions"`
+	EntryID       string         `json:"entry_id,omitempty"`
+	User          string         `json:"user,omitempty"`
+}
+
+// Interruption records something that broke focus during a pomodoro
+type Interruption struct {
+	At   time.Time `json:"at"`
+	Note string    `json:"note,omitempty"`
+}
+
+// PomodoroStartRequest represents the JSON request for starting a pomodoro
+type PomodoroStartRequest struct {
+	Description  string `json:"description"`
+	WorkMinutes  int    `json:"work_minutes,omitempty"`
+	BreakMinutes int    `json:"break_minutes,omitempty"`
+}
+
+// PomodoroInterruptRequest represents the JSON request for logging an interruption
+type PomodoroInterruptRequest struct {
+	Note string `json:"note"`
+}
+
+// pomodoroTimer tracks a user's running pomodoro, if any
+type pomodoroTimer struct {
+	mu         sync.Mutex
+	current    *Pomodoro
+	timer      *time.Timer
+	breakUntil time.Time
+}
+
+var (
+	timersMu sync.Mutex
+	// timers holds each user's timer by user name
+	timers = map[string]*pomodoroTimer{}
+)
+
+// errPomodoroNotOwned is returned when a user acts on another user's pomodoro
+var errPomodoroNotOwned = errors.New("the running pomodoro belongs to another user")
+
+// userTimer returns the timer of the request's user, creating it on first use
+func userTimer(r *http.Request) *pomodoroTimer {
+	name := currentUser(r).Name
+
+	timersMu.Lock()
+	defer timersMu.Unlock()
+
+	t, ok := timers[name]
+	if !ok {
+		t = &pomodoroTimer{}
+		timers[name] = t
+	}
+	return t
+}
+
+// start begins a new pomodoro, failing if one is already running
+func (t *pomodoroTimer) start(request PomodoroStartRequest, user string) (*Pomodoro, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.current != nil {
+		return nil, fmt.Errorf("a pomodoro is already running (ID %s)", t.current.ID)
+	}
+
+	workMinutes := request.WorkMinutes
+	if workMinutes <= 0 {
+		workMinutes = currentConfig().Pomodoro.WorkMinutes
+	}
+
+	now := time.Now()
+	pomodoro := &Pomodoro{
+		ID:            uuid.New().String(),
+		Description:   request.Description,
+		WorkMinutes:   workMinutes,
+		BreakMinutes:  request.BreakMinutes,
+		StartedAt:     now,
+		EndsAt:        now.Add(time.Duration(workMinutes) * time.Minute),
+		Status:        "running",
+		Interruptions: []Interruption{},
+		User:          user,
+	}
+	if pomodoro.BreakMinutes <= 0 {
+		pomodoro.BreakMinutes = nextBreakMinutes(pomodoro.owner())
+	}
+
+	t.current = pomodoro
+	t.breakUntil = time.Time{}
+	t.timer = time.AfterFunc(time.Until(pomodoro.EndsAt), t.complete)
+
+	return pomodoro, nil
+}
+
+// complete is fired by the timer when the work interval ends and records the entry
+func (t *pomodoroTimer) complete() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pomodoro := t.current
+	if pomodoro == nil {
+		return
+	}
+
+	entry := TimeEntry{
+		ID:          uuid.New().String(),
+		Timespan:    fmt.Sprintf("%dm", pomodoro.WorkMinutes),
+		Description: pomodoro.Description,
+		Categorized: false,
+		User:        pomodoro.User,
+	}
+
+	if err := saveToCSV(context.Background(), entry); err != nil {
+		log.Printf("Error saving pomodoro entry %s: %v", pomodoro.ID, err)
+	} else {
+		pomodoro.EntryID = entry.ID
+	}
+
+	completedAt := time.Now()
+	pomodoro.CompletedAt = &completedAt
+	pomodoro.Status = "completed"
+
+	if err := appendPomodoroLog(*pomodoro); err != nil {
+		log.Printf("Error recording pomodoro %s: %v", pomodoro.ID, err)
+	}
+
+	t.breakUntil = completedAt.Add(time.Duration(pomodoro.BreakMinutes) * time.Minute)
+	t.current = nil
+	t.timer = nil
+}
+
+// interrupt records an interruption against the user's running pomodoro
+func (t *pomodoroTimer) interrupt(note, user string) (*Pomodoro, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.current == nil {
+		return nil, fmt.Errorf("no pomodoro is running")
+	}
+	if t.current.User != user {
+		return nil, errPomodoroNotOwned
+	}
+
+	t.current.Interruptions = append(t.current.Interruptions, Interruption{
+		At:   time.Now(),
+		Note: note,
+	})
+
+	return t.current, nil
+}
+
+// cancel abandons the user's running pomodoro without creating an entry
+func (t *pomodoroTimer) cancel(user string) (*Pomodoro, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.current == nil {
+		return nil, fmt.Errorf("no pomodoro is running")
+	}
+	if t.current.User != user {
+		return nil, errPomodoroNotOwned
+	}
+
+	t.timer.Stop()
+	pomodoro := t.current
+	pomodoro.Status = "cancelled"
+
+	if err := appendPomodoroLog(*pomodoro); err != nil {
+		log.Printf("Error recording pomodoro %s: %v", pomodoro.ID, err)
+	}
+
+	t.current = nil
+	t.timer = nil
+
+	return pomodoro, nil
+}
+
+// status returns a snapshot of the user's timer state
+func (t *pomodoroTimer) status(user string) map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := map[string]interface{}{
+		"state": "idle",
+	}
+
+	if t.current != nil {
+		status["state"] = "working"
+		status["pomodoro"] = t.current
+		status["remaining_seconds"] = int(time.Until(t.current.EndsAt).Seconds())
+	} else if time.Now().Before(t.breakUntil) {
+		status["state"] = "break"
+		status["break_until"] = t.breakUntil
+		status["remaining_seconds"] = int(time.Until(t.breakUntil).Seconds())
+	}
+
+	if count, err := countPomodoros(time.Now(), user); err == nil {
+		status["today_count"] = count
+	}
+
+	return status
+}
+
+// nextBreakMinutes returns the break length following the next pomodoro,
+// giving a long break after every LongBreakEvery pomodoros the user completed
+func nextBreakMinutes(user string) int {
+	config := currentConfig().Pomodoro
+	if config.LongBreakEvery > 0 {
+		count, err := countPomodoros(time.Now(), user)
+		if err == nil && (count+1)%config.LongBreakEvery == 0 {
+			return config.LongBreakMinutes
+		}
+	}
+	return config.BreakMinutes
+}
+
+// owner returns the user the pomodoro belongs to
+func (p Pomodoro) owner() string {
+	if p.User == "" {
+		return localUser.Name
+	}
+	return p.User
+}
+
+// readPomodoroLog reads the pomodoro log, callers hold pomodoroLogMu
+func readPomodoroLog() ([]Pomodoro, error) {
+	data, err := os.ReadFile(pomodoroLogFile)
+	if os.IsNotExist(err) {
+		return []Pomodoro{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read pomodoro log: %v", err)
+	}
+
+	var pomodoros []Pomodoro
+	if err := json.Unmarshal(data, &pomodoros); err != nil {
+		return nil, fmt.Errorf("couldn't parse pomodoro log: %v", err)
+	}
+
+	return pomodoros, nil
+}
+
+// appendPomodoroLog adds a pomodoro to the log, replacing the file through a
+// temporary file so a crash mid-write can't truncate it
+func appendPomodoroLog(pomodoro Pomodoro) error {
+	pomodoroLogMu.Lock()
+	defer pomodoroLogMu.Unlock()
+
+	pomodoros, err := readPomodoroLog()
+	if err != nil {
+		return err
+	}
+
+	pomodoros = append(pomodoros, pomodoro)
+
+	data, err := json.MarshalIndent(pomodoros, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't encode pomodoro log: %v", err)
+	}
+
+	tmpName := pomodoroLogFile + ".tmp"
+	file, err := os.Create(tmpName)
+	if err != nil {
+		return fmt.Errorf("couldn't open pomodoro log: %v", err)
+	}
+	defer os.Remove(tmpName)
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return fmt.Errorf("error writing pomodoro log: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("error syncing pomodoro log: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error closing pomodoro log: %v", err)
+	}
+
+	return os.Rename(tmpName, pomodoroLogFile)
+}
+
+// countPomodoros returns the number of pomodoros the user completed on the
+// given day of their own calendar, counting every user's when user is empty
+func countPomodoros(day time.Time, user string) (int, error) {
+	pomodoroLogMu.Lock()
+	pomodoros, err := readPomodoroLog()
+	pomodoroLogMu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	location := day.Location()
+	if user != "" {
+		location = userLocation(user)
+	}
+
+	count := 0
+	for _, pomodoro := range pomodoros {
+		if user != "" && pomodoro.owner() != user {
+			continue
+		}
+		if pomodoro.Status == "completed" && pomodoro.CompletedAt != nil && sameDay(*pomodoro.CompletedAt, day, location) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// sameDay reports whether two times fall on the same calendar day in a location
+func sameDay(a, b time.Time, location *time.Location) bool {
+	return a.In(location).Format("20060102") == b.In(location).Format("20060102")
+}
+
+func pomodoroStartHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	// Parse JSON request
+	var request PomodoroStartRequest
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+		return
+	}
+
+	// Validate required fields
+	v := &validator{}
+	v.text("description", request.Description, true, maxDescriptionLength)
+	if len(v.details) > 0 {
+		writeValidationError(w, r, v.details...)
+		return
+	}
+
+	pomodoro, err := userTimer(r).start(request, entryUserName(currentUser(r)))
+	if err != nil {
+		writeError(w, r, http.StatusConflict, err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(pomodoro)
+}
+
+func pomodoroInterruptHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// The body is optional, an interruption without a note is still counted
+	var request PomodoroInterruptRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &request); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+			return
+		}
+	}
+
+	pomodoro, err := userTimer(r).interrupt(request.Note, entryUserName(currentUser(r)))
+	if errors.Is(err, errPomodoroNotOwned) {
+		writeError(w, r, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusConflict, err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pomodoro)
+}
+
+func pomodoroCancelHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	pomodoro, err := userTimer(r).cancel(entryUserName(currentUser(r)))
+	if errors.Is(err, errPomodoroNotOwned) {
+		writeError(w, r, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusConflict, err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pomodoro)
+}
+
+func pomodoroStatusHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userTimer(r).status(currentUser(r).Name))
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const preferencesFile = "aidea_preferences.json"
+
+// Rounding modes for reported durations
+const (
+	RoundUp      = "up"
+	RoundDown    = "down"
+	RoundNearest = "nearest"
+)
+
+// RoundingPolicy rounds each entry's duration in reports to a multiple of Minutes
+type RoundingPolicy struct {
+	Minutes int    `json:"minutes"`
+	Mode    string `json:"mode"`
+}
+
+// ReminderSchedule sends a reminder at Time (HH:MM, the user's time zone) on Days
+// when nothing has been logged that day
+type ReminderSchedule struct {
+	Time string `json:"time"`
+	// Days are lowercase three-letter weekday names, default the user's working days
+	Days []string `json:"days,omitempty"`
+}
+
+// Preferences are a user's own settings, taking precedence over config.json
+type Preferences struct {
+	// Timezone is the IANA zone deciding the user's "today"
+	Timezone string `json:"timezone,omitempty"`
+	// DefaultDuration is the timespan given to entries the categorizer finds no duration for
+	DefaultDuration string          `json:"default_duration,omitempty"`
+	Rounding        *RoundingPolicy `json:"rounding,omitempty"`
+	// ReportFormat is the default format of the summary report, "json" or "text"
+	ReportFormat string            `json:"report_format,omitempty"`
+	Reminder     *ReminderSchedule `json:"reminder,omitempty"`
+	UpdatedAt    time.Time         `json:"updated_at,omitempty"`
+}
+
+var (
+	preferencesMu sync.Mutex
+	// preferences holds every user's preferences by user name
+	preferences map[string]Preferences
+	// preferenceLocations caches the loaded time zone of each user's preferences
+	preferenceLocations = map[string]*time.Location{}
+)
+
+// loadPreferences reads the preferences file once, callers must hold preferencesMu
+func loadPreferences() error {
+	if preferences != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(preferencesFile)
+	if os.IsNotExist(err) {
+		preferences = map[string]Preferences{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read preferences: %v", err)
+	}
+
+	var loaded map[string]Preferences
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("couldn't parse preferences: %v", err)
+	}
+
+	for name, prefs := range loaded {
+		if prefs.Timezone == "" {
+			continue
+		}
+		location, err := time.LoadLocation(prefs.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone in preferences of %s: %v", name, err)
+		}
+		preferenceLocations[name] = location
+	}
+
+	preferences = loaded
+	return nil
+}
+
+// savePreferences writes the preferences file, callers must hold preferencesMu
+func savePreferences() error {
+	data, err := json.MarshalIndent(preferences, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't encode preferences: %v", err)
+	}
+
+	// Rounding policies change the minutes of every daily aggregate
+	aggregateGeneration.Add(1)
+
+	return os.WriteFile(preferencesFile, data, 0644)
+}
+
+// userPreferences returns a user's preferences, empty when none are saved
+func userPreferences(name string) Preferences {
+	preferencesMu.Lock()
+	defer preferencesMu.Unlock()
+
+	if err := loadPreferences(); err != nil {
+		log.Printf("Error loading preferences: %v", err)
+		return Preferences{}
+	}
+	return preferences[name]
+}
+
+// preferredLocation returns the time zone from a user's preferences, if set
+func preferredLocation(name string) (*time.Location, bool) {
+	preferencesMu.Lock()
+	defer preferencesMu.Unlock()
+
+	if err := loadPreferences(); err != nil {
+		return nil, false
+	}
+	location, ok := preferenceLocations[name]
+	return location, ok
+}
+
+// roundMinutes applies a user's rounding policy to a duration
+func roundMinutes(user string, minutes int) int {
+	policy := userPreferences(user).Rounding
+	if policy == nil || policy.Minutes <= 1 || minutes == 0 {
+		return minutes
+	}
+
+	units := float64(minutes) / float64(policy.Minutes)
+	switch policy.Mode {
+	case RoundUp:
+		units = math.Ceil(units)
+	case RoundDown:
+		units = math.Floor(units)
+	default:
+		units = math.Round(units)
+	}
+	return int(units) * policy.Minutes
+}
+
+// defaultTimespan returns the timespan given to a user's entries without a duration
+func defaultTimespan(user string) string {
+	return userPreferences(user).DefaultDuration
+}
+
+// validatePreferences checks a preferences payload
+func validatePreferences(prefs Preferences) []ErrorDetail {
+	v := &validator{}
+
+	if prefs.Timezone != "" {
+		if _, err := time.LoadLocation(prefs.Timezone); err != nil {
+			v.add("timezone", "timezone must be an IANA time zone like Europe/Berlin")
+		}
+	}
+	v.timespan("default_duration", prefs.DefaultDuration)
+	v.oneOf("report_format", prefs.ReportFormat, []string{"json", "text"})
+
+	if prefs.Rounding != nil {
+		if prefs.Rounding.Minutes < 1 || prefs.Rounding.Minutes > 60 {
+			v.add("rounding.minutes", "rounding.minutes must be between 1 and 60")
+		}
+		v.oneOf("rounding.mode", prefs.Rounding.Mode, []string{RoundUp, RoundDown, RoundNearest})
+	}
+
+	if prefs.Reminder != nil {
+		if _, err := time.Parse("15:04", prefs.Reminder.Time); err != nil {
+			v.add("reminder.time", "reminder.time must be a time in HH:MM format")
+		}
+		for _, day := range prefs.Reminder.Days {
+			v.oneOf("reminder.days", day, weekdayNames)
+		}
+	}
+
+	return v.details
+}
+
+// reminderDue reports whether a user's reminder falls on the given minute
+func reminderDue(name string, schedule *ReminderSchedule, now time.Time) bool {
+	if schedule == nil || now.Format("15:04") != schedule.Time {
+		return false
+	}
+	if len(schedule.Days) == 0 {
+		return userWorkingHours(name).WorksOn(now.Weekday())
+	}
+	return slices.ContainsFunc(schedule.Days, func(day string) bool {
+		return strings.EqualFold(day, weekdayNames[now.Weekday()])
+	})
+}
+
+// sendReminders reminds users whose reminder is due and who haven't logged anything today.
+// Reminders go to the Teams webhook when one is configured and are logged otherwise.
+func sendReminders(now time.Time) {
+	preferencesMu.Lock()
+	err := loadPreferences()
+	schedules := make(map[string]*ReminderSchedule)
+	for name, prefs := range preferences {
+		schedules[name] = prefs.Reminder
+	}
+	preferencesMu.Unlock()
+	if err != nil {
+		log.Printf("Error loading preferences: %v", err)
+		return
+	}
+
+	for name, schedule := range schedules {
+		local := now.In(userLocation(name))
+		if !reminderDue(name, schedule, local) {
+			continue
+		}
+
+		entries, err := readDayEntries(local)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("Error reading entries for %s's reminder: %v", name, err)
+			continue
+		}
+		if slices.ContainsFunc(entries, func(entry TimeEntry) bool { return entryOwner(entry) == name }) {
+			continue
+		}
+
+		message := fmt.Sprintf("Reminder for %s: no time has been logged today.", name)
+		if currentConfig().Teams.WebhookURL == "" {
+			log.Println(message)
+			continue
+		}
+		if err := postTeams(map[string]string{"text": message}); err != nil {
+			log.Printf("Error sending reminder to %s: %v", name, err)
+		}
+	}
+}
+
+// startReminderScheduler checks every minute for due reminders
+func startReminderScheduler() {
+	go func() {
+		for now := range time.Tick(time.Minute) {
+			sendReminders(now)
+		}
+	}()
+}
+
+// preferencesHandler returns (GET) or replaces (PUT) the current user's preferences
+func preferencesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		requireScope(ScopeEntriesRead, getPreferencesHandler)(w, r)
+	case http.MethodPut:
+		requireScope(ScopeEntriesWrite, updatePreferencesHandler)(w, r)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func getPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userPreferences(currentUser(r).Name))
+}
+
+func updatePreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	// Parse JSON request
+	var prefs Preferences
+	if err := json.Unmarshal(body, &prefs); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+		return
+	}
+
+	if details := validatePreferences(prefs); len(details) > 0 {
+		writeValidationError(w, r, details...)
+		return
+	}
+
+	if prefs.Rounding != nil {
+		prefs.Rounding.Mode = strings.ToLower(prefs.Rounding.Mode)
+	}
+	prefs.ReportFormat = strings.ToLower(prefs.ReportFormat)
+	prefs.UpdatedAt = time.Now()
+	name := currentUser(r).Name
+
+	preferencesMu.Lock()
+	defer preferencesMu.Unlock()
+
+	if err := loadPreferences(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	preferences[name] = prefs
+	delete(preferenceLocations, name)
+	if prefs.Timezone != "" {
+		preferenceLocations[name], _ = time.LoadLocation(prefs.Timezone)
+	}
+	if err := savePreferences(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving preferences: "+err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// PromptLeakStats counts how often a model's answers echoed the system prompt's example
+type PromptLeakStats struct {
+	Answers int `json:"answers"`
+	Leaks   int `json:"leaks"`
+	// Recovered is how many leaks the re-prompt answered properly
+	Recovered int `json:"recovered"`
+}
+
+var (
+	promptLeaksMu sync.Mutex
+	// promptLeaks is keyed by model
+	promptLeaks = map[string]*PromptLeakStats{}
+)
+
+// categorizationModel names the model answering categorizations, for the per model
+// metrics, the challenger's in an experiment
+func categorizationModel(ctx context.Context) string {
+	if assignment := experimentAssignment(ctx); assignment != nil && assignment.Model != "" {
+		return assignment.Model
+	}
+	if currentConfig().LLM.Provider == "mock" {
+		return "mock"
+	}
+	return currentConfig().LLM.Model
+}
+
+// recordPromptLeak counts a checked answer for a model, whether it leaked and whether
+// the re-prompt recovered it
+func recordPromptLeak(model string, leaked, recovered bool) {
+	promptLeaksMu.Lock()
+	defer promptLeaksMu.Unlock()
+
+	stats, ok := promptLeaks[model]
+	if !ok {
+		stats = &PromptLeakStats{}
+		promptLeaks[model] = stats
+	}
+	stats.Answers++
+	if leaked {
+		stats.Leaks++
+	}
+	if recovered {
+		stats.Recovered++
+	}
+}
+
+// promptLeakStats returns a copy of the leak counts per model
+func promptLeakStats() map[string]PromptLeakStats {
+	promptLeaksMu.Lock()
+	defer promptLeaksMu.Unlock()
+
+	stats := make(map[string]PromptLeakStats, len(promptLeaks))
+	for model, counts := range promptLeaks {
+		stats[model] = *counts
+	}
+	return stats
+}
+
+// promptExampleLeak describes how an answer repeats the system prompt instead of
+// answering for the entry, or returns "". Smaller models sometimes copy the prompt's
+// example issue key or its placeholders like "<category>". The example categories
+// are real categories, so a task alone is never taken for a leak.
+func promptExampleLeak(systemPrompt, description string, result *CategoryResponse) string {
+	fields := []struct{ name, value string }{
+		{"task", result.Task},
+		{"jira", result.Jira},
+		{"timespan", result.Timespan},
+		{"confidence", result.Confidence},
+		{"reason", result.Reason},
+	}
+	for _, field := range fields {
+		value := strings.TrimSpace(field.value)
+		if strings.HasPrefix(value, "<") && strings.HasSuffix(value, ">") || value == "high|medium|low" {
+			return fmt.Sprintf("%s repeats the placeholder %q", field.name, value)
+		}
+	}
+
+	key := strings.ToUpper(strings.TrimSpace(result.Jira))
+	if key != "" && slices.Contains(jiraKeyFinder.FindAllString(systemPrompt, -1), key) &&
+		!slices.Contains(jiraKeyFinder.FindAllString(strings.ToUpper(description), -1), key) {
+		return fmt.Sprintf("jira %s is the prompt's example, not an issue in the entry", key)
+	}
+	return ""
+}
+
+// retryPromptLeak re-prompts once when the model's answer echoes the system prompt's
+// example. A second leaking answer is kept at low confidence for review.
+func retryPromptLeak(ctx context.Context, description string, result *CategoryResponse) (*CategoryResponse, error) {
+	model := categorizationModel(ctx)
+	systemPrompt, err := readSystemPrompt(ctx)
+	if err != nil {
+		return result, nil
+	}
+
+	leak := promptExampleLeak(systemPrompt, description, result)
+	if leak == "" {
+		recordPromptLeak(model, false, false)
+		return result, nil
+	}
+	log.Printf("Model %s repeated the prompt's example: %s", model, leak)
+
+	callCtx, cancel := llmContext(ctx)
+	defer cancel()
+	retry, err := llm().Categorize(callCtx, description+"\n\nA previous answer was rejected because it copied the example in the instructions ("+leak+"). Answer for this entry only.")
+	if err != nil {
+		recordPromptLeak(model, true, false)
+		return nil, err
+	}
+	if again := promptExampleLeak(systemPrompt, description, retry); again != "" {
+		recordPromptLeak(model, true, false)
+		retry.Confidence = "low"
+		retry.Reason = strings.TrimSpace(retry.Reason + " (" + again + ")")
+		return retry, nil
+	}
+	recordPromptLeak(model, true, true)
+	return retry, nil
+}
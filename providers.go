@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// LLMConfig selects and configures the categorization and embedding backend
+type LLMConfig struct {
+	// Provider is "ollama" (default) or "mock"
+	Provider       string `json:"provider"`
+	OllamaURL      string `json:"ollama_url"`
+	Model          string `json:"model"`
+	EmbeddingModel string `json:"embedding_model"`
+	// MockCategories are the canned answers of the mock provider
+	MockCategories []MockCategory `json:"mock_categories,omitempty"`
+	// Cassette records or replays provider interactions for reproducible runs
+	Cassette CassetteConfig `json:"cassette"`
+	// Breaker fails fast while the backend keeps failing
+	Breaker BreakerConfig `json:"breaker"`
+	// Generation holds the sampling parameters for categorization
+	Generation GenerationOptions `json:"generation"`
+	// Multilingual translates descriptions the English-centric embedding model would miss
+	Multilingual MultilingualConfig `json:"multilingual"`
+	// Deterministic forces temperature 0 and records a hash of each categorization's
+	// inputs so audits can check a category is reproducible
+	Deterministic bool `json:"deterministic"`
+	// Embedder is "onnx" to embed in process instead of through the provider.
+	// Set embedding_model to the ONNX model's name so switching re-embeds rules and entries.
+	Embedder string     `json:"embedder,omitempty"`
+	ONNX     ONNXConfig `json:"onnx"`
+	// TimeoutSeconds cancels a categorization or embedding request the provider
+	// hasn't answered in time, 0 waits for as long as the client does
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+	// Experiment compares a challenger model or prompt against the configured ones
+	Experiment ExperimentConfig `json:"experiment"`
+}
+
+// GenerationOptions are the sampling parameters sent with each generation request.
+// Categorization wants a temperature near 0 and a fixed seed so results are reproducible.
+type GenerationOptions struct {
+	Temperature float64 `json:"temperature"`
+	MaxTokens   int     `json:"max_tokens"`
+	TopP        float64 `json:"top_p"`
+	Seed        int     `json:"seed"`
+}
+
+// GenerationOverrides replace the configured generation options for one request,
+// nil fields keep the configured value
+type GenerationOverrides struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   *int     `json:"max_tokens,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+}
+
+// maxGenerationTokens bounds max_tokens in config and overrides
+const maxGenerationTokens = 8192
+
+type generationContextKey struct{}
+
+// validate checks overrides against the ranges Ollama accepts
+func (o GenerationOverrides) validate(v *validator, field string) {
+	if o.Temperature != nil && (*o.Temperature < 0 || *o.Temperature > 2) {
+		v.add(field+".temperature", "temperature must be between 0 and 2")
+	}
+	if o.MaxTokens != nil && (*o.MaxTokens < 1 || *o.MaxTokens > maxGenerationTokens) {
+		v.add(field+".max_tokens", "max_tokens must be between 1 and %d", maxGenerationTokens)
+	}
+	if o.TopP != nil && (*o.TopP <= 0 || *o.TopP > 1) {
+		v.add(field+".top_p", "top_p must be greater than 0 and at most 1")
+	}
+}
+
+// withGenerationOverrides attaches per-request generation overrides to a context
+func withGenerationOverrides(ctx context.Context, overrides GenerationOverrides) context.Context {
+	return context.WithValue(ctx, generationContextKey{}, overrides)
+}
+
+// generationOptions returns the configured generation options with any overrides from the context applied
+func generationOptions(ctx context.Context) GenerationOptions {
+	options := currentConfig().LLM.Generation
+	overrides, _ := ctx.Value(generationContextKey{}).(GenerationOverrides)
+	if overrides.Temperature != nil {
+		options.Temperature = *overrides.Temperature
+	}
+	if overrides.MaxTokens != nil {
+		options.MaxTokens = *overrides.MaxTokens
+	}
+	if overrides.TopP != nil {
+		options.TopP = *overrides.TopP
+	}
+	if overrides.Seed != nil {
+		options.Seed = *overrides.Seed
+	}
+	if currentConfig().LLM.Deterministic {
+		options.Temperature = 0
+	}
+	return options
+}
+
+// inputHash is the SHA-256 of everything deciding a generation: model, prompts and
+// sampling options. It is only recorded in deterministic mode, where the same hash
+// should always produce the same answer.
+func inputHash(ctx context.Context, model, systemPrompt, prompt string) string {
+	if !currentConfig().LLM.Deterministic {
+		return ""
+	}
+
+	options, _ := json.Marshal(generationOptions(ctx))
+	hash := sha256.New()
+	for _, part := range []string{model, systemPrompt, prompt, string(options)} {
+		// Length prefixes keep the boundaries between parts unambiguous
+		fmt.Fprintf(hash, "%d:%s", len(part), part)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Categorizer assigns a task, Jira issue and confidence to a description
+type Categorizer interface {
+	Categorize(ctx context.Context, description string) (*CategoryResponse, error)
+}
+
+// Embedder converts text into a vector for similarity matching
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float64, error)
+}
+
+// RuleChooser picks the best matching rule among embedding candidates
+type RuleChooser interface {
+	ChooseRule(ctx context.Context, description string, candidates []RuleCandidate) (*RuleChoice, error)
+}
+
+// Translator translates a description from the given language into English
+type Translator interface {
+	Translate(ctx context.Context, text, language string) (string, error)
+}
+
+// Provider is a backend offering every LLM capability the tracker uses
+type Provider interface {
+	Categorizer
+	Embedder
+	RuleChooser
+	Translator
+	Reporter
+	Splitter
+	Clarifier
+	TopicLabeler
+}
+
+// llm is the active provider
+func llm() Provider {
+	return active.Load().provider
+}
+
+// newProvider builds the provider named in the config, with the circuit breakers
+// it sits behind, nil when breakers are disabled
+func newProvider(config LLMConfig) (Provider, *breakerProvider, error) {
+	generation := config.Generation
+	v := &validator{}
+	GenerationOverrides{
+		Temperature: &generation.Temperature,
+		MaxTokens:   &generation.MaxTokens,
+		TopP:        &generation.TopP,
+	}.validate(v, "llm.generation")
+	if len(v.details) > 0 {
+		return nil, nil, fmt.Errorf("invalid %s: %s", v.details[0].Field, v.details[0].Message)
+	}
+
+	if err := validateExperimentConfig(config.Experiment); err != nil {
+		return nil, nil, fmt.Errorf("invalid llm.experiment: %v", err)
+	}
+
+	var provider Provider
+	switch config.Provider {
+	case "", "ollama":
+		provider = ollamaProvider{
+			baseURL:        strings.TrimRight(config.OllamaURL, "/"),
+			model:          config.Model,
+			embeddingModel: config.EmbeddingModel,
+		}
+	case "mock":
+		provider = newMockProvider(config.MockCategories)
+	default:
+		return nil, nil, fmt.Errorf("unknown LLM provider %q", config.Provider)
+	}
+
+	// Replayed cassettes never reach the backend, so the breaker sits beneath the cassette
+	var breakers *breakerProvider
+	if config.Breaker.FailureThreshold > 0 {
+		breakers = newBreakerProvider(config.Breaker, provider)
+		provider = breakers
+	}
+
+	if config.Cassette.Mode != "" {
+		cassette, err := newCassetteProvider(config.Cassette, provider)
+		if err != nil {
+			return nil, nil, err
+		}
+		provider = cassette
+	}
+
+	// An in-process embedder needs neither the backend nor its breaker
+	provider, err := withLocalEmbedder(config, provider)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return provider, breakers, nil
+}
+
+// categorizeDescription categorizes a description and maps the result onto the
+// managed category taxonomy. When rules exist the LLM chooses among the closest
+// rules first, falling back to open categorization when none fits. Descriptions
+// are normalized, and translated from other languages when configured, first.
+func categorizeDescription(ctx context.Context, description string) (*CategoryResponse, error) {
+	start := time.Now()
+	assignment := assignExperiment(description)
+	result, err := categorizePipeline(withExperiment(ctx, assignment), description)
+	recordStage(stageCategorization, start, err)
+	if err != nil {
+		return nil, err
+	}
+	result.Experiment = assignment
+	return result, nil
+}
+
+// categorizePipeline runs the steps of categorizeDescription
+func categorizePipeline(ctx context.Context, description string) (*CategoryResponse, error) {
+	text, language := translateDescription(ctx, normalizeDescription(description))
+	text, matched := expandAliases(text)
+
+	// Explicitly ticketed work takes its category from the Jira issue, and a
+	// "before" plugin answering with a task replaces the built-in pipeline
+	result := categorizeFromJira(ctx, text)
+	if result == nil {
+		result = runBeforePlugins(ctx, text)
+	}
+	if result == nil {
+		var err error
+		result, err = categorizeWithRules(ctx, text)
+		if err != nil {
+			log.Printf("Error matching rules, using open categorization: %v", err)
+		}
+		if result == nil {
+			start := time.Now()
+			callCtx, cancel := llmContext(ctx)
+			result, err = llm().Categorize(callCtx, text)
+			cancel()
+			recordStage(stageLLMCategorize, start, err)
+			if err != nil {
+				return nil, err
+			}
+			if result, err = retryPromptLeak(ctx, text, result); err != nil {
+				return nil, err
+			}
+
+			// Without a similar rule a low-confidence guess yields to the schedule. The
+			// model's Jira issues are checked after, so dropping an invented one sends
+			// the entry to review rather than to the schedule.
+			var scheduled *CategoryResponse
+			if normalizeConfidence(result.Confidence) == "low" {
+				scheduled = scheduledCategory(ctx)
+			}
+			if scheduled != nil {
+				scheduled.Timespan = result.Timespan
+				result = scheduled
+			} else {
+				checkModelJira(text, result)
+			}
+		}
+		runAfterPlugins(ctx, text, result)
+	}
+
+	applyAliasJira(result, matched)
+	if language != "" {
+		result.Reason = fmt.Sprintf("Translated from %s as %q. %s", languageNames[language], text, result.Reason)
+	}
+
+	result = enforceTaxonomy(ctx, text, result)
+	result.Labels = cleanLabels(result)
+	result.Confidence = normalizeConfidence(result.Confidence)
+	return result, nil
+}
+
+// llmContext bounds one provider call by the configured timeout. The request's own
+// context still applies, so a client that disconnects cancels the call too.
+func llmContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if currentConfig().LLM.TimeoutSeconds <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, time.Duration(currentConfig().LLM.TimeoutSeconds)*time.Second)
+}
+
+// embedText embeds text with the configured provider
+func embedText(ctx context.Context, text string) (Vector, error) {
+	start := time.Now()
+	ctx, cancel := llmContext(ctx)
+	defer cancel()
+	embedding, err := llm().Embed(ctx, text)
+	recordStage(stageLLMEmbed, start, err)
+	if err != nil {
+		return nil, err
+	}
+	return toVector(embedding), nil
+}
+
+// cosineSimilarity scores how closely two embeddings point the same way, from -1 to 1.
+// Embeddings of different dimensions, e.g. from different models, can't be compared
+// and score 0; callers that can name the culprit check with checkDimensions first.
+func cosineSimilarity(a, b Vector) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	// Vectors are unit length, rounding can still put the product a hair outside the range
+	return max(-1, min(1, float64(dotProduct(a, b))))
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var (
+	jiraBrowsePattern = regexp.MustCompile(`/browse/(` + jiraKeyExpr + `)`)
+	githubPathPattern = regexp.MustCompile(`^/([^/]+)/([^/]+)/(pull|issues)/(\d+)`)
+)
+
+// maxSelectionLength limits how much selected page text ends up in a description
+const maxSelectionLength = 200
+
+// QuickEntryRequest represents the JSON request sent by the browser extension
+type QuickEntryRequest struct {
+	URL       string `json:"url"`
+	Title     string `json:"title"`
+	Selection string `json:"selection,omitempty"`
+	Timespan  string `json:"timespan,omitempty"`
+}
+
+// inferDescription builds an entry description from the page the user was looking at
+func inferDescription(request QuickEntryRequest) string {
+	title := strings.TrimSpace(request.Title)
+	description := title
+
+	if parsed, err := url.Parse(request.URL); err == nil {
+		host := strings.ToLower(parsed.Host)
+
+		switch {
+		case jiraBrowsePattern.MatchString(parsed.Path):
+			key := jiraBrowsePattern.FindStringSubmatch(parsed.Path)[1]
+			// Jira page titles usually already start with the key
+			if !strings.Contains(title, key) {
+				description = fmt.Sprintf("%s %s", key, title)
+			}
+		case host == "github.com" && githubPathPattern.MatchString(parsed.Path):
+			match := githubPathPattern.FindStringSubmatch(parsed.Path)
+			kind := "PR"
+			if match[3] == "issues" {
+				kind = "issue"
+			}
+			description = fmt.Sprintf("GitHub %s %s/%s#%s: %s", kind, match[1], match[2], match[4], title)
+		case description == "":
+			description = parsed.Host
+		}
+	}
+
+	// Cut by characters so a multi-byte character isn't split
+	selection := strings.Join(strings.Fields(request.Selection), " ")
+	if runes := []rune(selection); len(runes) > maxSelectionLength {
+		selection = string(runes[:maxSelectionLength]) + "..."
+	}
+	if selection != "" {
+		description = fmt.Sprintf("%s (%s)", description, selection)
+	}
+
+	return strings.TrimSpace(description)
+}
+
+// setCORSHeaders allows the configured extension origins to call the quick endpoint
+func setCORSHeaders(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+
+	for _, allowed := range currentConfig().Quick.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.Header().Add("Vary", "Origin")
+			return
+		}
+	}
+}
+
+func quickEntryHandler(w http.ResponseWriter, r *http.Request) {
+	setCORSHeaders(w, r)
+
+	// Answer CORS preflight requests without authentication
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	user, scopes, ok := authenticateToken(r)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "Invalid or missing API token")
+		return
+	}
+	if !hasScope(scopes, ScopeEntriesWrite) {
+		writeError(w, r, http.StatusForbidden, "Forbidden: token lacks the "+ScopeEntriesWrite+" scope")
+		return
+	}
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	// Parse JSON request
+	var request QuickEntryRequest
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+		return
+	}
+
+	// Validate required fields
+	if request.URL == "" && request.Title == "" {
+		writeValidationError(w, r, ErrorDetail{Field: "url", Message: "URL or title is required"})
+		return
+	}
+
+	entry := TimeEntry{
+		ID:          uuid.New().String(),
+		Timespan:    request.Timespan,
+		Description: inferDescription(request),
+		Categorized: false,
+		User:        entryUserName(user),
+	}
+
+	// A long page title can still make the description too long
+	v := &validator{}
+	v.text("description", entry.Description, true, maxDescriptionLength)
+	v.timespan("timespan", entry.Timespan)
+	if len(v.details) > 0 {
+		writeValidationError(w, r, v.details...)
+		return
+	}
+
+	// The page itself is kept as a link when it's a web URL
+	if request.URL != "" {
+		v := &validator{}
+		v.links("url", []string{request.URL})
+		if len(v.details) == 0 {
+			entry.Links = []string{request.URL}
+		}
+	}
+
+	// Save to CSV
+	err = saveToCSV(r.Context(), entry)
+	if errors.Is(err, errWeekFrozen) {
+		writeErrorCode(w, r, http.StatusConflict, ErrCodeWeekFrozen, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving data: "+err.Error())
+		return
+	}
+
+	// Create JSON response
+	response := map[string]string{
+		"id":          entry.ID,
+		"description": entry.Description,
+		"message":     "Time entry saved successfully",
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
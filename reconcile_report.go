@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Reconciliation report statuses, from the tracker's point of view
+const (
+	ReconcileMatched  = "matched"
+	ReconcileMismatch = "mismatch"
+	// ReconcileMissing is local time not yet in the external system
+	ReconcileMissing = "missing"
+	// ReconcileExtra is external time with no local counterpart
+	ReconcileExtra = "extra"
+)
+
+// ReconcileItem compares one day's time on an issue (Jira) or project (Harvest)
+type ReconcileItem struct {
+	Date          string   `json:"date"`
+	Key           string   `json:"key"`
+	Name          string   `json:"name,omitempty"`
+	Status        string   `json:"status"`
+	LocalMinutes  int      `json:"local_minutes"`
+	RemoteMinutes int      `json:"remote_minutes"`
+	EntryIDs      []string `json:"entry_ids,omitempty"`
+	RemoteIDs     []string `json:"remote_ids,omitempty"`
+}
+
+// ReconcileReport lists the differences between local categorized entries and an external system
+type ReconcileReport struct {
+	Target string          `json:"target"`
+	From   string          `json:"from"`
+	To     string          `json:"to"`
+	Counts map[string]int  `json:"counts"`
+	Items  []ReconcileItem `json:"items"`
+	// Unmapped lists categorized entries that can't be compared, e.g. without a Harvest mapping
+	Unmapped []string `json:"unmapped,omitempty"`
+}
+
+// reconcileStatus compares local and remote minutes
+func reconcileStatus(local, remote int) string {
+	difference := local - remote
+	switch {
+	case remote == 0:
+		return ReconcileMissing
+	case local == 0:
+		return ReconcileExtra
+	case difference > worklogToleranceMinutes || difference < -worklogToleranceMinutes:
+		return ReconcileMismatch
+	default:
+		return ReconcileMatched
+	}
+}
+
+// reconcileJira compares categorized entries with the Jira (or Tempo) worklogs per day and issue
+func reconcileJira(ctx context.Context, entries []TimeEntry, from, to time.Time, location *time.Location, report *ReconcileReport) error {
+	worklogs, _, err := fetchWorklogs(ctx, from, to, location)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Jira == "" {
+			report.Unmapped = append(report.Unmapped, entry.ID)
+		}
+	}
+
+	for _, reconciliation := range reconcileWorklogs(worklogs, entries, location) {
+		report.Items = append(report.Items, ReconcileItem{
+			Date:          reconciliation.Date,
+			Key:           reconciliation.Jira,
+			Status:        reconcileStatus(reconciliation.LocalMinutes, reconciliation.JiraMinutes),
+			LocalMinutes:  reconciliation.LocalMinutes,
+			RemoteMinutes: reconciliation.JiraMinutes,
+			EntryIDs:      reconciliation.EntryIDs,
+			RemoteIDs:     reconciliation.WorklogIDs,
+		})
+	}
+	return nil
+}
+
+// reconcileHarvest compares categorized entries with Harvest time entries per day and
+// project, using the Harvest mappings to place each local entry
+func reconcileHarvest(entries []TimeEntry, from, to time.Time, report *ReconcileReport) error {
+	remote, err := harvestTimeEntries(from, to)
+	if err != nil {
+		return err
+	}
+
+	byKey := make(map[string]*ReconcileItem)
+	item := func(date string, project int64) *ReconcileItem {
+		key := date + " " + fmt.Sprint(project)
+		if byKey[key] == nil {
+			byKey[key] = &ReconcileItem{Date: date, Key: fmt.Sprint(project)}
+		}
+		return byKey[key]
+	}
+
+	for _, entry := range entries {
+		mapping := harvestMapping(entry)
+		if mapping == nil {
+			report.Unmapped = append(report.Unmapped, entry.ID)
+			continue
+		}
+		reconciled := item(entry.Date, mapping.ProjectID)
+		reconciled.LocalMinutes += entryMinutes(entry)
+		reconciled.EntryIDs = append(reconciled.EntryIDs, entry.ID)
+	}
+
+	for _, timeEntry := range remote {
+		reconciled := item(timeEntry.SpentDate, timeEntry.Project.ID)
+		reconciled.Name = timeEntry.Project.Name
+		reconciled.RemoteMinutes += int(math.Round(timeEntry.Hours * 60))
+		reconciled.RemoteIDs = append(reconciled.RemoteIDs, fmt.Sprint(timeEntry.ID))
+	}
+
+	for _, reconciled := range byKey {
+		reconciled.Status = reconcileStatus(reconciled.LocalMinutes, reconciled.RemoteMinutes)
+		report.Items = append(report.Items, *reconciled)
+	}
+	return nil
+}
+
+// reconcileReportHandler compares the current user's categorized entries for
+// ?from=YYYYMMDD&to=YYYYMMDD (default this week) with ?target=jira or harvest,
+// listing time missing remotely, extra remote time and mismatched durations
+func reconcileReportHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	target := strings.ToLower(r.URL.Query().Get("target"))
+	v := &validator{}
+	v.oneOf("target", target, []string{"jira", "harvest"})
+	if target == "" {
+		v.add("target", "target is required")
+	}
+	if len(v.details) > 0 {
+		writeValidationError(w, r, v.details...)
+		return
+	}
+
+	if (target == "jira" && !jiraConfigured()) || (target == "harvest" && !harvestConfigured()) {
+		writeError(w, r, http.StatusServiceUnavailable, target+" is not configured")
+		return
+	}
+
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	all, err := readEntriesBetween(r.Context(), from, to)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error reading entries: "+err.Error())
+		return
+	}
+
+	// Only categorized entries are ready to be synced
+	owner := currentUser(r).Name
+	entries := []TimeEntry{}
+	for _, entry := range all {
+		if entryOwner(entry) == owner && entry.Categorized {
+			entries = append(entries, entry)
+		}
+	}
+
+	report := ReconcileReport{
+		Target: target,
+		From:   from.Format("2006-01-02"),
+		To:     to.Format("2006-01-02"),
+		Counts: make(map[string]int),
+		Items:  []ReconcileItem{},
+	}
+
+	if target == "jira" {
+		err = reconcileJira(r.Context(), entries, from, to, userLocation(owner), &report)
+	} else {
+		err = reconcileHarvest(entries, from, to, &report)
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, "Error reading "+target+": "+err.Error())
+		return
+	}
+
+	sort.Slice(report.Items, func(i, j int) bool {
+		if report.Items[i].Date != report.Items[j].Date {
+			return report.Items[i].Date < report.Items[j].Date
+		}
+		return report.Items[i].Key < report.Items[j].Key
+	})
+	for _, item := range report.Items {
+		report.Counts[item.Status]++
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const defaultRescueTimeURL = "https://www.rescuetime.com/anapi/data"
+
+// RescueTimeConfig holds the key for pulling data from the RescueTime analytic data API
+type RescueTimeConfig struct {
+	APIKey  string `json:"api_key"`
+	BaseURL string `json:"base_url,omitempty"`
+}
+
+// rescueTimeData mirrors the analytic data API response, CSV exports have the same columns
+type rescueTimeData struct {
+	RowHeaders []string        `json:"row_headers"`
+	Rows       [][]interface{} `json:"rows"`
+}
+
+// rescueTimeEvents turns interval rows (Date, Time Spent (seconds), ..., Activity, Category)
+// into window events whose app is the RescueTime category and title the app or site.
+// RescueTime reports dates in the account's local time, read in the given location.
+func rescueTimeEvents(data rescueTimeData, location *time.Location) ([]WindowEvent, error) {
+	columns := make(map[string]int)
+	for i, header := range data.RowHeaders {
+		columns[strings.ToLower(header)] = i
+	}
+
+	dateColumn, hasDate := columns["date"]
+	secondsColumn, hasSeconds := columns["time spent (seconds)"]
+	activityColumn, hasActivity := columns["activity"]
+	if !hasDate || !hasSeconds || !hasActivity {
+		return nil, fmt.Errorf("RescueTime data needs Date, Time Spent (seconds) and Activity columns, export it with the interval perspective")
+	}
+	categoryColumn, hasCategory := columns["category"]
+
+	events := []WindowEvent{}
+	for i, row := range data.Rows {
+		if len(row) <= max(dateColumn, secondsColumn, activityColumn) {
+			return nil, fmt.Errorf("row %d is missing columns", i+1)
+		}
+
+		timestamp, err := time.ParseInLocation("2006-01-02T15:04:05", fmt.Sprint(row[dateColumn]), location)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid date %v", i+1, row[dateColumn])
+		}
+		seconds, err := strconv.ParseFloat(fmt.Sprint(row[secondsColumn]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid time spent %v", i+1, row[secondsColumn])
+		}
+
+		event := WindowEvent{Timestamp: timestamp, Duration: seconds}
+		event.Data.Title = fmt.Sprint(row[activityColumn])
+		event.Data.App = event.Data.Title
+		if hasCategory && categoryColumn < len(row) {
+			event.Data.App = fmt.Sprint(row[categoryColumn])
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// parseRescueTimeData accepts the API's JSON response or a CSV export
+func parseRescueTimeData(body []byte) (rescueTimeData, error) {
+	var data rescueTimeData
+	if strings.HasPrefix(strings.TrimSpace(string(body)), "{") {
+		if err := json.Unmarshal(body, &data); err != nil {
+			return data, fmt.Errorf("error parsing RescueTime data: %v", err)
+		}
+		return data, nil
+	}
+
+	records, err := csv.NewReader(strings.NewReader(string(body))).ReadAll()
+	if err != nil {
+		return data, fmt.Errorf("error parsing RescueTime export: %v", err)
+	}
+	if len(records) == 0 {
+		return data, fmt.Errorf("RescueTime export is empty")
+	}
+
+	data.RowHeaders = records[0]
+	for _, record := range records[1:] {
+		row := make([]interface{}, len(record))
+		for i, value := range record {
+			row[i] = value
+		}
+		data.Rows = append(data.Rows, row)
+	}
+	return data, nil
+}
+
+// fetchRescueTimeData pulls one day of 5-minute interval data from the RescueTime API
+func fetchRescueTimeData(day time.Time) ([]byte, error) {
+	baseURL := currentConfig().RescueTime.BaseURL
+	if baseURL == "" {
+		baseURL = defaultRescueTimeURL
+	}
+
+	query := url.Values{}
+	query.Set("key", currentConfig().RescueTime.APIKey)
+	query.Set("format", "json")
+	query.Set("perspective", "interval")
+	query.Set("resolution_time", "minute")
+	query.Set("restrict_kind", "activity")
+	query.Set("restrict_begin", day.Format("2006-01-02"))
+	query.Set("restrict_end", day.Format("2006-01-02"))
+
+	resp, err := http.Get(baseURL + "?" + query.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("error sending request to RescueTime: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("RescueTime API returned error: %s - %s", resp.Status, string(body))
+	}
+	return body, nil
+}
+
+// clusterRescueTimeEvents clusters each category separately, RescueTime reports
+// every activity in a 5-minute interval so categories interleave in time
+func clusterRescueTimeEvents(events []WindowEvent) []ActivityCandidate {
+	byCategory := make(map[string][]WindowEvent)
+	for _, event := range events {
+		byCategory[event.Data.App] = append(byCategory[event.Data.App], event)
+	}
+
+	candidates := []ActivityCandidate{}
+	for _, categoryEvents := range byCategory {
+		candidates = append(candidates, clusterWindowEvents(categoryEvents)...)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Start.Before(candidates[j].Start)
+	})
+	return candidates
+}
+
+// entryWindow returns the time an entry covers, ending when it was logged
+func entryWindow(entry TimeEntry) (time.Time, time.Time, bool) {
+	end, err := time.Parse(time.RFC3339, entry.CreatedAt)
+	if err != nil {
+		return end, end, false
+	}
+	duration, err := parseTimespan(entry.Timespan)
+	if err != nil {
+		return end, end, false
+	}
+	return end.Add(-duration), end, true
+}
+
+// overlappingEntry returns the ID of an entry covering at least half of the
+// candidate's window, meaning the time has already been logged
+func overlappingEntry(entries []TimeEntry, candidate ActivityCandidate) string {
+	length := candidate.End.Sub(candidate.Start)
+	for _, entry := range entries {
+		start, end, ok := entryWindow(entry)
+		if !ok {
+			continue
+		}
+
+		if candidate.End.Before(end) {
+			end = candidate.End
+		}
+		if candidate.Start.After(start) {
+			start = candidate.Start
+		}
+		overlap := end.Sub(start)
+		if overlap > 0 && overlap*2 >= length {
+			return entry.ID
+		}
+	}
+	return ""
+}
+
+// rescueTimeImportHandler turns RescueTime productivity blocks into uncategorized
+// entries. The body is an analytic data API response or CSV export; with an empty
+// body and a configured API key the day given as ?date=YYYYMMDD (default today) is
+// fetched. Blocks already covered by an entry are skipped, ?dry_run=true only lists candidates.
+func rescueTimeImportHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	user := entryUserName(currentUser(r))
+	owner := currentUser(r).Name
+	location := userLocation(owner)
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	if len(strings.TrimSpace(string(body))) == 0 {
+		if currentConfig().RescueTime.APIKey == "" {
+			writeError(w, r, http.StatusBadRequest, "Send a RescueTime export or configure a RescueTime API key")
+			return
+		}
+
+		day, err := resolveEntryDay(r.URL.Query().Get("date"), owner)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		body, err = fetchRescueTimeData(day)
+		if err != nil {
+			writeError(w, r, http.StatusBadGateway, err.Error())
+			return
+		}
+	}
+
+	data, err := parseRescueTimeData(body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	events, err := rescueTimeEvents(data, location)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	candidates := clusterRescueTimeEvents(events)
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	existing := []TimeEntry{}
+	if len(candidates) > 0 {
+		all, err := readEntriesBetween(r.Context(), candidates[0].Start.In(location), candidates[len(candidates)-1].End.In(location))
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "Error reading entries: "+err.Error())
+			return
+		}
+		for _, entry := range all {
+			if entryOwner(entry) == owner {
+				existing = append(existing, entry)
+			}
+		}
+	}
+
+	// Submit each new candidate as an uncategorized entry logged when the block ended
+	imported := []ActivityCandidate{}
+	duplicates := []ActivityCandidate{}
+	errors := []string{}
+	for _, candidate := range candidates {
+		if candidate.DuplicateOf = overlappingEntry(existing, candidate); candidate.DuplicateOf != "" {
+			duplicates = append(duplicates, candidate)
+			continue
+		}
+
+		if !dryRun {
+			entry := TimeEntry{
+				ID:          uuid.New().String(),
+				CreatedAt:   candidate.End.UTC().Format(time.RFC3339),
+				Timespan:    candidate.Timespan,
+				Description: candidate.Description,
+				Categorized: false,
+				User:        user,
+			}
+
+			if err := appendEntry(r.Context(), candidate.Start.In(location), entry); err != nil {
+				errors = append(errors, fmt.Sprintf("Error saving candidate starting %s: %v", candidate.Start.Format(time.RFC3339), err))
+				continue
+			}
+			candidate.EntryID = entry.ID
+			existing = append(existing, entry)
+		}
+
+		imported = append(imported, candidate)
+	}
+
+	// Create response
+	response := map[string]interface{}{
+		"row_count":       len(data.Rows),
+		"candidate_count": len(candidates),
+		"candidates":      imported,
+		"duplicates":      duplicates,
+		"dry_run":         dryRun,
+	}
+
+	if len(errors) > 0 {
+		response["errors"] = errors
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxRetroEntries limits how many entries are quoted to the LLM as context
+const maxRetroEntries = 150
+
+// RetroTask compares a task's time this week with the week before
+type RetroTask struct {
+	Task            string `json:"task"`
+	Minutes         int    `json:"minutes"`
+	PreviousMinutes int    `json:"previous_minutes"`
+}
+
+// RetroTimeSink is a piece of work that took a large share of the week
+type RetroTimeSink struct {
+	Description string `json:"description"`
+	Task        string `json:"task,omitempty"`
+	Jira        string `json:"jira,omitempty"`
+	Minutes     int    `json:"minutes"`
+	Entries     int    `json:"entries"`
+}
+
+// RetroNarrative is the LLM's reading of the week, grounded in the report's figures
+type RetroNarrative struct {
+	Summary string   `json:"summary"`
+	Themes  []string `json:"themes"`
+}
+
+// RetroReport is a weekly retrospective: computed figures plus an LLM narrative
+type RetroReport struct {
+	User            string          `json:"user"`
+	Week            string          `json:"week"`
+	TotalMinutes    int             `json:"total_minutes"`
+	PreviousMinutes int             `json:"previous_minutes"`
+	Tasks           []RetroTask     `json:"tasks"`
+	TimeSinks       []RetroTimeSink `json:"time_sinks"`
+	Deviations      []string        `json:"deviations"`
+	// Categories holds the color and icon of the styled tasks
+	Categories map[string]CategoryStyle `json:"categories,omitempty"`
+	Narrative  *RetroNarrative          `json:"narrative,omitempty"`
+	// NarrativeError explains a missing narrative, the figures are still returned
+	NarrativeError string `json:"narrative_error,omitempty"`
+}
+
+// Reporter writes a narrative retrospective from a week's facts
+type Reporter interface {
+	Retrospective(ctx context.Context, facts string) (*RetroNarrative, error)
+}
+
+// retroSystemPrompt keeps the model to the facts it is given
+const retroSystemPrompt = "You write short weekly retrospectives from time tracking data. " +
+	"Use only the facts provided, do not invent work. " +
+	"Respond only with JSON: {\"summary\": \"<3-5 sentences covering what the week was spent on, the biggest time sinks and changes from the previous week>\", \"themes\": [\"<recurring theme>\", ...]}"
+
+// buildRetroReport computes the figures of a user's week against the week before
+func buildRetroReport(user string, week time.Time, entries []TimeEntry) *RetroReport {
+	start, end := entryDate(week), entryDate(week.AddDate(0, 0, 6))
+	previousStart := entryDate(week.AddDate(0, 0, -7))
+
+	report := &RetroReport{
+		User:       user,
+		Week:       week.Format("20060102"),
+		Tasks:      []RetroTask{},
+		TimeSinks:  []RetroTimeSink{},
+		Deviations: []string{},
+	}
+
+	tasks := make(map[string]*RetroTask)
+	sinks := make(map[string]*RetroTimeSink)
+	for _, entry := range entries {
+		if entryOwner(entry) != user || entry.Date < previousStart || entry.Date > end {
+			continue
+		}
+
+		minutes := entryMinutes(entry)
+		task := entry.Task
+		if task == "" {
+			task = "Uncategorized"
+		}
+		if tasks[task] == nil {
+			tasks[task] = &RetroTask{Task: task}
+		}
+
+		if entry.Date < start {
+			report.PreviousMinutes += minutes
+			tasks[task].PreviousMinutes += minutes
+			continue
+		}
+
+		report.TotalMinutes += minutes
+		tasks[task].Minutes += minutes
+
+		// Group repeated work by its Jira issue, or by description without one
+		key := entry.Jira
+		if key == "" {
+			key = strings.ToLower(strings.TrimSpace(entry.Description))
+		}
+		if sinks[key] == nil {
+			sinks[key] = &RetroTimeSink{Description: entry.Description, Task: entry.Task, Jira: entry.Jira}
+		}
+		sinks[key].Minutes += minutes
+		sinks[key].Entries++
+	}
+
+	// Entries without a usable duration don't take time
+	for _, task := range tasks {
+		if task.Minutes > 0 || task.PreviousMinutes > 0 {
+			report.Tasks = append(report.Tasks, *task)
+		}
+	}
+	sort.Slice(report.Tasks, func(i, j int) bool {
+		if report.Tasks[i].Minutes != report.Tasks[j].Minutes {
+			return report.Tasks[i].Minutes > report.Tasks[j].Minutes
+		}
+		return report.Tasks[i].Task < report.Tasks[j].Task
+	})
+
+	for _, sink := range sinks {
+		if sink.Minutes > 0 {
+			report.TimeSinks = append(report.TimeSinks, *sink)
+		}
+	}
+	sort.Slice(report.TimeSinks, func(i, j int) bool {
+		return report.TimeSinks[i].Minutes > report.TimeSinks[j].Minutes
+	})
+	if len(report.TimeSinks) > 5 {
+		report.TimeSinks = report.TimeSinks[:5]
+	}
+
+	names := make([]string, 0, len(report.Tasks))
+	for _, task := range report.Tasks {
+		names = append(names, task.Task)
+	}
+	report.Categories = categoryStyles(names)
+
+	report.Deviations = retroDeviations(report)
+	return report
+}
+
+// retroDeviations lists tasks whose share of the week moved noticeably from the week before
+func retroDeviations(report *RetroReport) []string {
+	deviations := []string{}
+	if report.TotalMinutes == 0 || report.PreviousMinutes == 0 {
+		return deviations
+	}
+
+	for _, task := range report.Tasks {
+		share := float64(task.Minutes) / float64(report.TotalMinutes)
+		previousShare := float64(task.PreviousMinutes) / float64(report.PreviousMinutes)
+
+		switch {
+		case task.PreviousMinutes == 0 && task.Minutes >= 60:
+			deviations = append(deviations, fmt.Sprintf("%s is new this week (%dm, %.0f%% of the week)", task.Task, task.Minutes, share*100))
+		case task.Minutes == 0 && task.PreviousMinutes >= 60:
+			deviations = append(deviations, fmt.Sprintf("%s stopped this week (%dm the week before)", task.Task, task.PreviousMinutes))
+		case task.Minutes > 0 && task.PreviousMinutes > 0 && (share >= previousShare*1.5 || share <= previousShare/1.5) && math.Abs(share-previousShare) >= 0.1:
+			deviations = append(deviations, fmt.Sprintf("%s went from %.0f%% to %.0f%% of the week", task.Task, previousShare*100, share*100))
+		}
+	}
+
+	return deviations
+}
+
+// retroFacts renders the report and the week's entries as the grounded context for the LLM
+func retroFacts(report *RetroReport, week time.Time, entries []TimeEntry) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "Week starting %s. Logged %dm this week, %dm the week before.\n\nTime by task (this week / previous week):\n", report.Week, report.TotalMinutes, report.PreviousMinutes)
+	for _, task := range report.Tasks {
+		fmt.Fprintf(&builder, "- %s: %dm / %dm\n", task.Task, task.Minutes, task.PreviousMinutes)
+	}
+
+	builder.WriteString("\nBiggest time sinks:\n")
+	for _, sink := range report.TimeSinks {
+		fmt.Fprintf(&builder, "- %s (%s %s): %dm over %d entries\n", sink.Description, sink.Task, sink.Jira, sink.Minutes, sink.Entries)
+	}
+
+	if len(report.Deviations) > 0 {
+		builder.WriteString("\nChanges from the previous week:\n")
+		for _, deviation := range report.Deviations {
+			fmt.Fprintf(&builder, "- %s\n", deviation)
+		}
+	}
+
+	builder.WriteString("\nEntries this week:\n")
+	quoted := 0
+	start := entryDate(week)
+	for _, entry := range entries {
+		if entryOwner(entry) != report.User || entry.Date < start {
+			continue
+		}
+		if quoted == maxRetroEntries {
+			builder.WriteString("- ...\n")
+			break
+		}
+		fmt.Fprintf(&builder, "- %s %dm [%s %s] %s\n", entry.Date, entryMinutes(entry), entry.Task, entry.Jira, entry.Description)
+		quoted++
+	}
+
+	return builder.String()
+}
+
+// retroReportHandler summarizes a week (?week=YYYYMMDD, any day of it, default this week)
+// for the current user, managers may pass ?user= to see someone else's
+func retroReportHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	current := currentUser(r)
+	user := current.Name
+	if requested := r.URL.Query().Get("user"); requested != "" && requested != user {
+		if !current.HasRole(RoleManager) {
+			writeError(w, r, http.StatusForbidden, "Forbidden")
+			return
+		}
+		user = requested
+	}
+
+	week, err := parseWeek(r.URL.Query().Get("week"), user)
+	if err != nil {
+		writeValidationError(w, r, ErrorDetail{Field: "week", Message: err.Error()})
+		return
+	}
+
+	entries, err := readEntriesBetween(r.Context(), week.AddDate(0, 0, -7), week.AddDate(0, 0, 6))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error reading entries: %v", err))
+		return
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Date < entries[j].Date })
+
+	report := buildRetroReport(user, week, entries)
+	if report.TotalMinutes == 0 {
+		report.NarrativeError = "No time logged this week"
+	} else {
+		narrative, err := llm().Retrospective(r.Context(), retroFacts(report, week, entries))
+		if err != nil {
+			report.NarrativeError = err.Error()
+		} else {
+			report.Narrative = narrative
+		}
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
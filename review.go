@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CategorizationConfig controls when categorizer results are trusted without review
+type CategorizationConfig struct {
+	// AutoAcceptConfidence is the lowest confidence ("low", "medium" or "high")
+	// written as categorized, anything below is kept as a suggestion for review
+	AutoAcceptConfidence string `json:"auto_accept_confidence"`
+	// Workers is how many entries are categorized in parallel, keep it at or
+	// below the Ollama server's OLLAMA_NUM_PARALLEL
+	Workers int `json:"workers"`
+	// MaxQueueDepth is the most entries waiting on the LLM across all requests,
+	// beyond it LLM-bound endpoints answer 429. Default 256, negative for no limit.
+	MaxQueueDepth int `json:"max_queue_depth,omitempty"`
+	// Schedules give recurring time windows a default category
+	Schedules []CategorySchedule `json:"schedules,omitempty"`
+	// SplitEntries proposes splitting entries that describe several activities,
+	// e.g. two Jira issues, into one entry per activity once reviewed
+	SplitEntries bool `json:"split_entries,omitempty"`
+	// MultiLabel lets the categorizer give an entry further categories and Jira
+	// issues besides its primary one
+	MultiLabel bool `json:"multi_label,omitempty"`
+	// LabelAttribution is how reports count entries with several labels: "primary"
+	// (the default) gives the primary label all the time, "proportional" divides
+	// it by the label weights. Reports take ?attribution= to override it.
+	LabelAttribution string `json:"label_attribution,omitempty"`
+}
+
+// AcceptRequest optionally corrects a suggestion while accepting it
+type AcceptRequest struct {
+	Task string `json:"task,omitempty"`
+	Jira string `json:"jira,omitempty"`
+	// Labels replaces the entry's further labels, an empty list removes them
+	Labels []EntryLabel `json:"labels,omitempty"`
+}
+
+var confidenceRank = map[string]int{"low": 1, "medium": 2, "high": 3}
+
+// maxUnknownConfidences bounds how many distinct unrecognized confidences are
+// remembered and logged, model answers can hold any text
+const maxUnknownConfidences = 100
+
+var (
+	unknownConfidencesMu sync.Mutex
+	// unknownConfidences are the unrecognized values already logged
+	unknownConfidences = map[string]bool{}
+)
+
+// normalizeConfidence maps the confidences found in data files, model and plugin
+// answers and imports onto the canonical "high", "medium" and "low" that are stored
+// and served. Letter grades "A" to "F" and scores between 0 and 1 or percentages
+// are translated. Anything unrecognized is treated as low, so the entry goes to
+// review, and logged once for the first maxUnknownConfidences distinct values.
+// Empty stays empty.
+func normalizeConfidence(confidence string) string {
+	value := strings.ToLower(strings.TrimSpace(confidence))
+	value = strings.TrimSpace(strings.TrimSuffix(value, "confidence"))
+	switch value {
+	case "":
+		return ""
+	case "high", "very high", "certain":
+		return "high"
+	case "medium", "med", "moderate":
+		return "medium"
+	case "low", "very low", "none":
+		return "low"
+	}
+
+	switch strings.TrimRight(value, "+-") {
+	case "a", "b":
+		return "high"
+	case "c":
+		return "medium"
+	case "d", "e", "f":
+		return "low"
+	}
+
+	percent := strings.HasSuffix(value, "%")
+	if score, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64); err == nil {
+		if percent || score > 1 {
+			score /= 100
+		}
+		switch {
+		case score >= 0.75:
+			return "high"
+		case score >= 0.5:
+			return "medium"
+		}
+		return "low"
+	}
+
+	unknownConfidencesMu.Lock()
+	defer unknownConfidencesMu.Unlock()
+	if !unknownConfidences[value] && len(unknownConfidences) < maxUnknownConfidences {
+		unknownConfidences[value] = true
+		log.Printf("Unrecognized confidence %q, treating it as low", confidence)
+		if len(unknownConfidences) == maxUnknownConfidences {
+			log.Printf("Logged %d unrecognized confidences, further ones are treated as low without logging", maxUnknownConfidences)
+		}
+	}
+	return "low"
+}
+
+// autoAccepted reports whether a confidence meets the configured auto-accept threshold
+func autoAccepted(confidence string) bool {
+	rank := confidenceRank[normalizeConfidence(confidence)]
+	return rank > 0 && rank >= confidenceRank[currentConfig().Categorization.AutoAcceptConfidence]
+}
+
+// isSuggestion reports whether an entry holds a categorization awaiting review
+func isSuggestion(entry TimeEntry) bool {
+	return !entry.Categorized && entry.Confidence != ""
+}
+
+// suggestionsHandler lists the current user's entries awaiting review between from and to (YYYYMMDD),
+// optionally narrowed by the task, jira and tag filters
+func suggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter, details := parseEntryFilter(r)
+	if len(details) > 0 {
+		writeValidationError(w, r, details...)
+		return
+	}
+
+	entries, err := readEntriesBetween(r.Context(), from, to)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error reading entries: %v", err))
+		return
+	}
+
+	user := currentUser(r)
+	suggestions := []TimeEntry{}
+	for _, entry := range entries {
+		if entryOwner(entry) == user.Name && isSuggestion(entry) && filter.matches(entry) {
+			suggestions = append(suggestions, localizeEntry(entry, userLocation(user.Name)))
+		}
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestions)
+}
+
+// lookupEntry finds the entry named by the {id} path value on the ?date=YYYYMMDD
+// day (default today), writing the error response if it isn't the user's to see
+func lookupEntry(w http.ResponseWriter, r *http.Request) (time.Time, *TimeEntry, bool) {
+	user := currentUser(r)
+	day, err := resolveEntryDay(r.URL.Query().Get("date"), user.Name)
+	if err != nil {
+		writeValidationError(w, r, ErrorDetail{Field: "date", Message: err.Error()})
+		return day, nil, false
+	}
+
+	id := r.PathValue("id")
+	entries, err := readDayEntries(day)
+	if err != nil && !os.IsNotExist(err) {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error reading entries: %v", err))
+		return day, nil, false
+	}
+
+	for _, entry := range entries {
+		if entry.ID == id && (entryOwner(entry) == user.Name || user.HasRole(RoleAdmin)) {
+			return day, &entry, true
+		}
+	}
+
+	writeError(w, r, http.StatusNotFound, "Entry not found")
+	return day, nil, false
+}
+
+// acceptEntryHandler marks a suggested categorization as reviewed, applying any correction.
+// The entry's day is given as ?date=YYYYMMDD and defaults to today.
+func acceptEntryHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var request AcceptRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &request); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+			return
+		}
+	}
+
+	v := &validator{}
+	v.text("task", request.Task, false, maxTaskLength)
+	v.jiraKey("jira", request.Jira)
+	v.labels("labels", request.Labels)
+	if len(v.details) > 0 {
+		writeValidationError(w, r, v.details...)
+		return
+	}
+
+	user := currentUser(r)
+	day, _, ok := lookupEntry(w, r)
+	if !ok {
+		return
+	}
+
+	entry, err := updateEntry(r.Context(), day, r.PathValue("id"), func(e *TimeEntry) {
+		if request.Task != "" {
+			e.Task, _ = canonicalCategory(request.Task)
+			e.TaskReason = "Corrected by " + user.Name
+			// A corrected task no longer comes from the recorded LLM inputs
+			e.InputHash = ""
+		}
+		if request.Jira != "" {
+			e.Jira = request.Jira
+		}
+		if request.Labels != nil {
+			e.Labels = request.Labels
+		}
+		e.Categorized = true
+	})
+	if errors.Is(err, errWeekFrozen) {
+		writeErrorCode(w, r, http.StatusConflict, ErrCodeWeekFrozen, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving entry: "+err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(localizeEntry(*entry, userLocation(user.Name)))
+}
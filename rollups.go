@@ -0,0 +1,492 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rollupsFile = "aidea_rollups.json"
+
+// defaultRollupHours is how often the rollup tables are refreshed when rollup_hours isn't set
+const defaultRollupHours = 6
+
+// Rollup granularities
+const (
+	RollupWeekly  = "weekly"
+	RollupMonthly = "monthly"
+)
+
+var rollupGranularities = []string{RollupWeekly, RollupMonthly}
+
+// RollupSource is a file a rolled up period was summed from, as it was then
+type RollupSource struct {
+	File    string    `json:"file"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// RollupRow is one user's time on a task and Jira issue over a period
+type RollupRow struct {
+	User                string `json:"user"`
+	Task                string `json:"task"`
+	Jira                string `json:"jira,omitempty"`
+	Minutes             int    `json:"minutes"`
+	ProportionalMinutes int    `json:"proportional_minutes"`
+}
+
+// RollupPeriod is the rolled up time of one week or month. Sources are the data
+// files and preferences it was summed from, a change to any of them makes it stale.
+type RollupPeriod struct {
+	Period  string         `json:"period"`
+	From    string         `json:"from"`
+	To      string         `json:"to"`
+	Rows    []RollupRow    `json:"rows"`
+	Sources []RollupSource `json:"sources"`
+}
+
+// RollupTables holds the finished weeks and months by period, e.g. "2026-W41" and "2026-10"
+type RollupTables struct {
+	GeneratedAt time.Time               `json:"generated_at"`
+	Weekly      map[string]RollupPeriod `json:"weekly"`
+	Monthly     map[string]RollupPeriod `json:"monthly"`
+}
+
+// table returns the periods of a granularity
+func (t *RollupTables) table(granularity string) map[string]RollupPeriod {
+	if granularity == RollupMonthly {
+		return t.Monthly
+	}
+	return t.Weekly
+}
+
+var (
+	rollupsMu sync.Mutex
+	rollups   *RollupTables
+	// rollupRunMu keeps a scheduled refresh from overlapping a slow one
+	rollupRunMu sync.Mutex
+)
+
+// loadRollups reads the rollups file once, callers must hold rollupsMu
+func loadRollups() error {
+	if rollups != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(rollupsFile)
+	if os.IsNotExist(err) {
+		rollups = &RollupTables{Weekly: map[string]RollupPeriod{}, Monthly: map[string]RollupPeriod{}}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read rollups: %v", err)
+	}
+
+	var loaded RollupTables
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("couldn't parse rollups: %v", err)
+	}
+	if loaded.Weekly == nil {
+		loaded.Weekly = map[string]RollupPeriod{}
+	}
+	if loaded.Monthly == nil {
+		loaded.Monthly = map[string]RollupPeriod{}
+	}
+
+	rollups = &loaded
+	return nil
+}
+
+// saveRollups writes the rollups file, callers must hold rollupsMu
+func saveRollups() error {
+	data, err := json.Marshal(rollups)
+	if err != nil {
+		return fmt.Errorf("couldn't encode rollups: %v", err)
+	}
+
+	return os.WriteFile(rollupsFile, data, 0644)
+}
+
+// rollupPeriod returns the first and last day and the name of the week or month containing day
+func rollupPeriod(granularity string, day time.Time) (time.Time, time.Time, string) {
+	if granularity == RollupMonthly {
+		first := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+		return first, first.AddDate(0, 1, -1), first.Format("2006-01")
+	}
+	start := weekStart(day)
+	year, week := start.ISOWeek()
+	return start, start.AddDate(0, 0, 6), fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// rollupSources stats the data files covering a period and the preferences file,
+// whose rounding policies change the minutes
+func rollupSources(from, to time.Time) ([]RollupSource, error) {
+	names := []string{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if filename := dataFilename(day); !slices.Contains(names, filename) {
+			names = append(names, filename)
+		}
+	}
+	names = append(names, preferencesFile)
+
+	sources := []RollupSource{}
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, RollupSource{File: name, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	return sources, nil
+}
+
+// sameSources reports whether a period's files are unchanged since it was rolled up
+func sameSources(stored, current []RollupSource) bool {
+	return slices.EqualFunc(stored, current, func(a, b RollupSource) bool {
+		return a.File == b.File && a.Size == b.Size && a.ModTime.Equal(b.ModTime)
+	})
+}
+
+// sumRollupRows totals the daily aggregates of a date range per user, task and Jira issue
+func sumRollupRows(ctx context.Context, from, to time.Time) ([]RollupRow, error) {
+	totals := make(map[aggregateKey]*RollupRow)
+	row := func(key aggregateKey) *RollupRow {
+		if _, ok := totals[key]; !ok {
+			totals[key] = &RollupRow{User: key.User, Task: key.Task, Jira: key.Jira}
+		}
+		return totals[key]
+	}
+
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		aggregate, err := dailyAggregate(day)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", entryDate(day), err)
+		}
+		for key, minutes := range aggregate.Primary {
+			row(key).Minutes += minutes
+		}
+		for key, minutes := range aggregate.Proportional {
+			row(key).ProportionalMinutes += minutes
+		}
+	}
+
+	rows := make([]RollupRow, 0, len(totals))
+	for _, key := range slices.SortedFunc(maps.Keys(totals), func(a, b aggregateKey) int {
+		return strings.Compare(a.User+"\x00"+a.Task+"\x00"+a.Jira, b.User+"\x00"+b.Task+"\x00"+b.Jira)
+	}) {
+		rows = append(rows, *totals[key])
+	}
+	return rows, nil
+}
+
+// earliestDataDay returns the first day covered by a data file
+func earliestDataDay() (time.Time, bool) {
+	filenames, err := dataFiles()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	prefix, suffix, _ := strings.Cut(dataFilenameTemplate(), "{period}")
+	var earliest time.Time
+	for _, filename := range filenames {
+		period := strings.TrimSuffix(strings.TrimPrefix(filename, prefix), suffix)
+		var day time.Time
+		switch {
+		case len(period) == 8:
+			day, err = time.ParseInLocation("20060102", period, storageLocation())
+		case len(period) == 6:
+			day, err = time.ParseInLocation("200601", period, storageLocation())
+		case len(period) == 7 && period[4] == 'W':
+			// The Monday of ISO week 1 is in the week of January 4th
+			var week int
+			week, err = strconv.Atoi(period[5:])
+			if year, yearErr := strconv.Atoi(period[:4]); yearErr == nil && err == nil {
+				day = weekStart(time.Date(year, 1, 4, 0, 0, 0, 0, storageLocation())).AddDate(0, 0, 7*(week-1))
+			}
+		default:
+			continue
+		}
+		if err == nil && !day.IsZero() && (earliest.IsZero() || day.Before(earliest)) {
+			earliest = day
+		}
+	}
+	return earliest, !earliest.IsZero()
+}
+
+// refreshRollups rolls up every finished week and month whose files changed since
+// it was last rolled up, returning how many periods were summed
+func refreshRollups(ctx context.Context, now time.Time) (int, error) {
+	rollupRunMu.Lock()
+	defer rollupRunMu.Unlock()
+
+	rollupsMu.Lock()
+	if err := loadRollups(); err != nil {
+		rollupsMu.Unlock()
+		return 0, err
+	}
+	updated := RollupTables{Weekly: maps.Clone(rollups.Weekly), Monthly: maps.Clone(rollups.Monthly)}
+	rollupsMu.Unlock()
+
+	earliest, ok := earliestDataDay()
+	if !ok {
+		return 0, nil
+	}
+	today := now.In(storageLocation())
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, storageLocation())
+
+	built := 0
+	for _, granularity := range rollupGranularities {
+		table := updated.table(granularity)
+		// Only finished periods are materialized, the current one still changes
+		for from, to, name := rollupPeriod(granularity, earliest); to.Before(today); from, to, name = rollupPeriod(granularity, to.AddDate(0, 0, 1)) {
+			sources, err := rollupSources(from, to)
+			if err != nil {
+				return built, err
+			}
+			if stored, ok := table[name]; ok && sameSources(stored.Sources, sources) {
+				continue
+			}
+
+			rows, err := sumRollupRows(ctx, from, to)
+			if err != nil {
+				return built, err
+			}
+			table[name] = RollupPeriod{Period: name, From: from.Format("20060102"), To: to.Format("20060102"), Rows: rows, Sources: sources}
+			built++
+		}
+	}
+
+	rollupsMu.Lock()
+	defer rollupsMu.Unlock()
+	updated.GeneratedAt = now.UTC()
+	rollups = &updated
+	return built, saveRollups()
+}
+
+// startRollups refreshes the rollup tables at startup and then every RollupHours
+func startRollups(config ReportsConfig) {
+	hours := config.RollupHours
+	if hours < 0 {
+		return
+	}
+	if hours == 0 {
+		hours = defaultRollupHours
+	}
+
+	refresh := func() {
+		start := time.Now()
+		built, err := refreshRollups(context.Background(), start)
+		if err != nil {
+			log.Printf("Error refreshing rollups: %v", err)
+			return
+		}
+		if built > 0 {
+			log.Printf("Rolled up %d weeks and months in %s", built, time.Since(start).Round(time.Millisecond))
+		}
+	}
+
+	go func() {
+		refresh()
+		for range time.Tick(time.Duration(hours) * time.Hour) {
+			refresh()
+		}
+	}()
+}
+
+// rollupRows returns the rows of the period from..to, a whole week or month or part
+// of one. A whole period comes from the rollup tables when its files are unchanged,
+// anything else is summed from the daily aggregates.
+func rollupRows(ctx context.Context, granularity, name string, from, to time.Time, whole bool) ([]RollupRow, bool, error) {
+	if whole {
+		rollupsMu.Lock()
+		err := loadRollups()
+		stored, ok := rollups.table(granularity)[name]
+		rollupsMu.Unlock()
+		if err != nil {
+			return nil, false, err
+		}
+
+		if ok {
+			sources, err := rollupSources(from, to)
+			if err != nil {
+				return nil, false, err
+			}
+			if sameSources(stored.Sources, sources) {
+				return stored.Rows, true, nil
+			}
+		}
+	}
+
+	rows, err := sumRollupRows(ctx, from, to)
+	return rows, false, err
+}
+
+// RollupReportPeriod is one week or month of a rollup report. Materialized is set
+// when it came from the rollup tables rather than being summed for the request.
+type RollupReportPeriod struct {
+	Period        string         `json:"period"`
+	From          string         `json:"from"`
+	To            string         `json:"to"`
+	TotalMinutes  int            `json:"total_minutes"`
+	MinutesByTask map[string]int `json:"minutes_by_task"`
+	MinutesByJira map[string]int `json:"minutes_by_jira,omitempty"`
+	Materialized  bool           `json:"materialized"`
+
+	// rows are the user's rows with canonical tasks, for the CSV export
+	rows []RollupRow
+}
+
+// RollupReport totals a user's time per week or month over a date range
+type RollupReport struct {
+	User        string               `json:"user"`
+	Granularity string               `json:"granularity"`
+	From        string               `json:"from"`
+	To          string               `json:"to"`
+	Periods     []RollupReportPeriod `json:"periods"`
+}
+
+// buildRollupReport totals a user's time per period, trimming the first and last
+// period to the date range
+func buildRollupReport(ctx context.Context, granularity, user string, from, to time.Time) (*RollupReport, error) {
+	report := &RollupReport{User: user, Granularity: granularity, From: from.Format("20060102"), To: to.Format("20060102"), Periods: []RollupReportPeriod{}}
+	proportional := attribution(ctx) == AttributeProportional
+
+	for start, end, name := rollupPeriod(granularity, from); !start.After(to); start, end, name = rollupPeriod(granularity, end.AddDate(0, 0, 1)) {
+		overlapFrom, overlapTo := start, end
+		if overlapFrom.Before(from) {
+			overlapFrom = from
+		}
+		if overlapTo.After(to) {
+			overlapTo = to
+		}
+
+		rows, materialized, err := rollupRows(ctx, granularity, name, overlapFrom, overlapTo, overlapFrom.Equal(start) && overlapTo.Equal(end))
+		if err != nil {
+			return nil, err
+		}
+
+		merged := make(map[string]int)
+		period := RollupReportPeriod{
+			Period:        name,
+			From:          overlapFrom.Format("20060102"),
+			To:            overlapTo.Format("20060102"),
+			MinutesByTask: make(map[string]int),
+			MinutesByJira: make(map[string]int),
+			Materialized:  materialized,
+		}
+		for _, row := range rows {
+			if row.User != user {
+				continue
+			}
+			minutes := row.Minutes
+			if proportional {
+				minutes = row.ProportionalMinutes
+			}
+			task := canonicalTask(row.Task)
+			if task == "" {
+				task = "Uncategorized"
+			}
+
+			period.TotalMinutes += minutes
+			period.MinutesByTask[task] += minutes
+			if row.Jira != "" {
+				period.MinutesByJira[row.Jira] += minutes
+			}
+
+			// Tasks stored under an alias merge into their category's row
+			key := task + "\x00" + row.Jira
+			if index, ok := merged[key]; ok {
+				period.rows[index].Minutes += minutes
+				continue
+			}
+			merged[key] = len(period.rows)
+			period.rows = append(period.rows, RollupRow{User: row.User, Task: task, Jira: row.Jira, Minutes: minutes})
+		}
+		report.Periods = append(report.Periods, period)
+	}
+
+	return report, nil
+}
+
+// rollupReportHandler reports the current user's time per week or month, managers
+// may pass ?user= to see someone else's. ?format=csv exports one row per period,
+// task and Jira issue.
+func rollupReportHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	current := currentUser(r)
+	user := current.Name
+	if requested := r.URL.Query().Get("user"); requested != "" && requested != user {
+		if !current.HasRole(RoleManager) {
+			writeError(w, r, http.StatusForbidden, "Forbidden")
+			return
+		}
+		user = requested
+	}
+
+	query := r.URL.Query()
+	granularity, format := query.Get("granularity"), query.Get("format")
+	if granularity == "" {
+		granularity = RollupWeekly
+	}
+	v := &validator{}
+	v.oneOf("granularity", granularity, rollupGranularities)
+	if format != "" && format != "json" && format != "csv" {
+		v.add("format", "format must be one of json, csv")
+	}
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		v.add("from", "%s", err.Error())
+	}
+	ctx, details := attributionContext(r)
+	v.details = append(v.details, details...)
+	if len(v.details) > 0 {
+		writeValidationError(w, r, v.details...)
+		return
+	}
+
+	report, err := buildRollupReport(ctx, granularity, user, from, to)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error reading entries: %v", err))
+		return
+	}
+
+	if format == "csv" {
+		records := [][]string{{"period", "from", "to", "user", "task", "jira", "minutes"}}
+		for _, period := range report.Periods {
+			for _, row := range period.rows {
+				records = append(records, []string{period.Period, period.From, period.To, row.User, row.Task, row.Jira, strconv.Itoa(row.Minutes)})
+			}
+		}
+
+		filename := fmt.Sprintf("aidea_%s_%s_%s.csv", granularity, report.From, report.To)
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		csv.NewWriter(w).WriteAll(records)
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
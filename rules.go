@@ -0,0 +1,783 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const rulesFile = "aidea_rules.json"
+
+// keywordBoost is added to a rule's similarity for each of its keywords found in a description
+const keywordBoost = 0.05
+
+// RulesConfig controls the embedding and re-ranking pipeline
+type RulesConfig struct {
+	// TopK is how many embedding candidates are passed to the LLM
+	TopK int `json:"top_k"`
+	// MinScore drops candidates less similar than this
+	MinScore float64 `json:"min_score"`
+	// Drift warns when recent entries are increasingly far from every rule
+	Drift DriftConfig `json:"drift"`
+}
+
+// ActivityRule maps a kind of work to a task and Jira issue. Entries are matched
+// against rules by embedding similarity before the LLM picks the best candidate.
+type ActivityRule struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	Keywords       []string  `json:"keywords,omitempty"`
+	Task           string    `json:"task"`
+	Jira           string    `json:"jira,omitempty"`
+	Embedding      Vector    `json:"embedding,omitempty"`
+	EmbeddingModel string    `json:"embedding_model,omitempty"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// RuleRequest represents the JSON request for creating or updating a rule
+type RuleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Keywords    []string `json:"keywords"`
+	Task        string   `json:"task"`
+	Jira        string   `json:"jira"`
+}
+
+// RuleCandidate is a rule scored against a description
+type RuleCandidate struct {
+	Rule        ActivityRule `json:"rule"`
+	Similarity  float64      `json:"similarity"`
+	KeywordHits []string     `json:"keyword_hits,omitempty"`
+	Score       float64      `json:"score"`
+}
+
+// RuleChoice is the LLM's pick among the candidates, an empty RuleID means none fit
+type RuleChoice struct {
+	RuleID     string `json:"rule_id"`
+	Timespan   string `json:"timespan"`
+	Confidence string `json:"confidence"`
+	Reason     string `json:"reason"`
+	InputHash  string `json:"input_hash,omitempty"`
+}
+
+var (
+	rulesMu sync.Mutex
+	rules   []ActivityRule
+	// rulesBuiltIn is set while the rules are the built-in ones, not yet saved
+	rulesBuiltIn bool
+)
+
+// loadRules reads the rules file once, callers must hold rulesMu
+func loadRules() error {
+	if rules != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(rulesFile)
+	if os.IsNotExist(err) {
+		builtIn, err := builtInRules()
+		if err != nil {
+			return err
+		}
+		rules = builtIn
+		rulesBuiltIn = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read rules: %v", err)
+	}
+
+	var loaded []ActivityRule
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("couldn't parse rules: %v", err)
+	}
+
+	warnRuleDimensions(loaded)
+	rules = loaded
+	rulesBuiltIn = false
+	return nil
+}
+
+// warnRuleDimensions logs the rules whose embedding has a different dimension
+// than most, they can't be matched until they are re-embedded
+func warnRuleDimensions(all []ActivityRule) {
+	counts := make(map[int]int)
+	for _, rule := range all {
+		if len(rule.Embedding) > 0 {
+			counts[len(rule.Embedding)]++
+		}
+	}
+	if len(counts) < 2 {
+		return
+	}
+
+	common := 0
+	for dimensions, count := range counts {
+		if count > counts[common] || (count == counts[common] && dimensions > common) {
+			common = dimensions
+		}
+	}
+	for _, rule := range all {
+		if len(rule.Embedding) > 0 && len(rule.Embedding) != common {
+			log.Printf("Rule %q (%s) has a %d-dimension embedding from %q, most rules have %d; re-embed it with POST /api/v1/rules/reembed",
+				rule.Name, rule.ID, len(rule.Embedding), rule.EmbeddingModel, common)
+		}
+	}
+}
+
+// ruleDimensionError names a rule whose embedding can't be compared with a description's
+func ruleDimensionError(rule ActivityRule, target Vector) error {
+	err := checkDimensions(rule.Embedding, target)
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("rule %q (%s) was embedded with %q and can't be compared with %q embeddings (%w), re-embed it with POST /api/v1/rules/reembed",
+		rule.Name, rule.ID, rule.EmbeddingModel, currentConfig().LLM.EmbeddingModel, err)
+}
+
+// saveRules writes the rules file, callers must hold rulesMu
+func saveRules() error {
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't encode rules: %v", err)
+	}
+
+	if err := os.WriteFile(rulesFile, data, 0644); err != nil {
+		return err
+	}
+	rulesBuiltIn = false
+	return nil
+}
+
+// listRules returns a copy of the rules
+func listRules() ([]ActivityRule, error) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	if err := loadRules(); err != nil {
+		return nil, err
+	}
+	return slices.Clone(rules), nil
+}
+
+// ruleText is the text embedded for a rule
+func ruleText(rule ActivityRule) string {
+	text := rule.Name + ": " + rule.Description
+	if len(rule.Keywords) > 0 {
+		text += " (" + strings.Join(rule.Keywords, ", ") + ")"
+	}
+	return text
+}
+
+// embedRule fills in a rule's embedding with the configured embedding model
+func embedRule(ctx context.Context, rule *ActivityRule) error {
+	embedding, err := embedText(ctx, ruleText(*rule))
+	if err != nil {
+		return err
+	}
+	rule.Embedding = embedding
+	rule.EmbeddingModel = currentConfig().LLM.EmbeddingModel
+	return nil
+}
+
+// keywordHits returns the rule keywords that appear in a description
+func keywordHits(rule ActivityRule, description string) []string {
+	lower := strings.ToLower(description)
+	hits := []string{}
+	for _, keyword := range rule.Keywords {
+		if keyword != "" && strings.Contains(lower, strings.ToLower(keyword)) {
+			hits = append(hits, keyword)
+		}
+	}
+	return hits
+}
+
+// nearestRuleLimit is how many of the nearest rules a vector store search returns
+const nearestRuleLimit = 50
+
+// scoreRules scores every rule against a description, best first. Rules missing
+// an embedding are embedded on the fly without being saved. With a vector store
+// only its nearest rules and those with keyword hits are scored.
+func scoreRules(ctx context.Context, description string) ([]RuleCandidate, error) {
+	all, err := listRules()
+	if err != nil || len(all) == 0 {
+		return nil, err
+	}
+
+	target, err := embedText(ctx, description)
+	if err != nil {
+		return nil, err
+	}
+
+	var nearest map[string]float64
+	if store := vectorStore(); store != nil {
+		searchCtx, cancel := context.WithTimeout(ctx, vectorStoreTimeout)
+		matches, err := store.Search(searchCtx, vectorRules, target, max(nearestRuleLimit, currentConfig().Rules.TopK), "")
+		cancel()
+		if err != nil {
+			log.Printf("Error searching the vector store, scoring every rule: %v", err)
+		} else {
+			nearest = make(map[string]float64, len(matches))
+			for _, match := range matches {
+				nearest[match.ID] = match.Score
+			}
+		}
+	}
+
+	candidates := make([]RuleCandidate, 0, len(all))
+	for _, rule := range all {
+		hits := keywordHits(rule, description)
+		similarity, found := nearest[rule.ID]
+		if nearest != nil && !found && len(hits) == 0 && len(rule.Embedding) > 0 {
+			continue
+		}
+
+		if !found {
+			if len(rule.Embedding) == 0 {
+				if err := embedRule(ctx, &rule); err != nil {
+					return nil, err
+				}
+			}
+			if err := ruleDimensionError(rule, target); err != nil {
+				return nil, err
+			}
+			similarity = cosineSimilarity(target, rule.Embedding)
+		}
+
+		candidate := RuleCandidate{
+			Rule:        rule,
+			Similarity:  similarity,
+			KeywordHits: hits,
+		}
+		candidate.Score = candidate.Similarity + keywordBoost*float64(len(candidate.KeywordHits))
+		candidate.Rule.Embedding = nil
+		candidates = append(candidates, candidate)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+
+	return candidates, nil
+}
+
+// topCandidates keeps the configured number of candidates above the minimum score
+func topCandidates(scored []RuleCandidate) []RuleCandidate {
+	config := currentConfig().Rules
+	candidates := []RuleCandidate{}
+	for _, candidate := range scored {
+		if len(candidates) >= config.TopK {
+			break
+		}
+		if candidate.Score >= config.MinScore {
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+// ruleChoicePrompt is the system prompt asking the model to choose among candidates
+func ruleChoicePrompt(candidates []RuleCandidate) string {
+	var builder strings.Builder
+	builder.WriteString("You categorize time tracking entries. Choose the rule below that best describes the work in the user's entry.\n")
+	builder.WriteString("Respond only with JSON: {\"rule_id\": \"<id or empty if none fit>\", \"timespan\": \"<duration mentioned, e.g. 45m, or empty>\", \"confidence\": \"high|medium|low\", \"reason\": \"<one sentence>\"}\n\nRules:\n")
+	for _, candidate := range candidates {
+		fmt.Fprintf(&builder, "- id: %s\n  name: %s\n  description: %s\n  task: %s\n", candidate.Rule.ID, candidate.Rule.Name, candidate.Rule.Description, candidate.Rule.Task)
+		if candidate.Rule.Jira != "" {
+			fmt.Fprintf(&builder, "  jira: %s\n", candidate.Rule.Jira)
+		}
+	}
+	return builder.String()
+}
+
+// matchRule runs the two-stage pipeline: embeddings shortlist rules, then the LLM
+// chooses among the shortlist. The returned rule is nil when none applies.
+func matchRule(ctx context.Context, description string) (*ActivityRule, *RuleChoice, []RuleCandidate, error) {
+	scored, err := scoreRules(ctx, description)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	candidates := topCandidates(scored)
+	if len(candidates) == 0 {
+		return nil, nil, candidates, nil
+	}
+
+	choice, err := llm().ChooseRule(ctx, description, candidates)
+	if err != nil {
+		return nil, nil, candidates, err
+	}
+	choice.Confidence = normalizeConfidence(choice.Confidence)
+
+	for _, candidate := range candidates {
+		if candidate.Rule.ID == choice.RuleID {
+			return &candidate.Rule, choice, candidates, nil
+		}
+	}
+
+	return nil, choice, candidates, nil
+}
+
+// categorizeWithRules categorizes a description from its matching rule, it returns
+// nil when no rule applies
+func categorizeWithRules(ctx context.Context, description string) (*CategoryResponse, error) {
+	rule, choice, _, err := matchRule(ctx, description)
+	if err != nil || rule == nil {
+		return nil, err
+	}
+
+	return &CategoryResponse{
+		Task:       rule.Task,
+		Jira:       rule.Jira,
+		Timespan:   choice.Timespan,
+		Confidence: choice.Confidence,
+		Reason:     fmt.Sprintf("Rule %q: %s", rule.Name, choice.Reason),
+		InputHash:  choice.InputHash,
+	}, nil
+}
+
+// validateRule checks a rule payload
+func validateRule(request RuleRequest) []ErrorDetail {
+	v := &validator{}
+	v.text("name", request.Name, true, maxTaskLength)
+	v.text("description", request.Description, true, maxDescriptionLength)
+	v.text("task", request.Task, true, maxTaskLength)
+	v.jiraKey("jira", request.Jira)
+	for _, keyword := range request.Keywords {
+		v.text("keywords", keyword, true, maxTaskLength)
+	}
+	if currentConfig().Taxonomy.Enforcement == TaxonomyStrict && request.Task != "" {
+		if _, known := canonicalCategory(request.Task); !known {
+			v.add("task", "task %q is not in the taxonomy", request.Task)
+		}
+	}
+	return v.details
+}
+
+func parseRuleRequest(w http.ResponseWriter, r *http.Request) (RuleRequest, bool) {
+	var request RuleRequest
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return request, false
+	}
+	defer r.Body.Close()
+
+	// Parse JSON request
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+		return request, false
+	}
+
+	if details := validateRule(request); len(details) > 0 {
+		writeValidationError(w, r, details...)
+		return request, false
+	}
+
+	return request, true
+}
+
+// rulesHandler lists (GET) or creates (POST) rules
+func rulesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		requireScope(ScopeEntriesRead, listRulesHandler)(w, r)
+	case http.MethodPost:
+		requireScope(ScopeRulesWrite, createRuleHandler)(w, r)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// ruleHandler updates (PUT) or deletes (DELETE) a rule
+func ruleHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		requireScope(ScopeRulesWrite, updateRuleHandler)(w, r)
+	case http.MethodDelete:
+		requireScope(ScopeRulesWrite, deleteRuleHandler)(w, r)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func listRulesHandler(w http.ResponseWriter, r *http.Request) {
+	all, err := listRules()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Embeddings are large and only useful internally
+	for i := range all {
+		all[i].Embedding = nil
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(all)
+}
+
+func createRuleHandler(w http.ResponseWriter, r *http.Request) {
+	request, ok := parseRuleRequest(w, r)
+	if !ok {
+		return
+	}
+
+	rule := ActivityRule{
+		ID:          uuid.New().String(),
+		Name:        request.Name,
+		Description: request.Description,
+		Keywords:    request.Keywords,
+		Task:        request.Task,
+		Jira:        request.Jira,
+		UpdatedAt:   time.Now(),
+	}
+	rule.Task, _ = canonicalCategory(rule.Task)
+
+	// A rule without an embedding still works, it is embedded on use until regenerated
+	if err := embedRule(r.Context(), &rule); err != nil {
+		log.Printf("Error embedding rule %s: %v", rule.Name, err)
+	}
+
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	if err := loadRules(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rules = append(rules, rule)
+	if err := saveRules(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving rule: "+err.Error())
+		return
+	}
+	indexRuleVector(r.Context(), rule)
+
+	rule.Embedding = nil
+	publishEvent(EventRuleCreated, rule)
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+func updateRuleHandler(w http.ResponseWriter, r *http.Request) {
+	request, ok := parseRuleRequest(w, r)
+	if !ok {
+		return
+	}
+
+	id := r.PathValue("id")
+	rule := ActivityRule{
+		ID:          id,
+		Name:        request.Name,
+		Description: request.Description,
+		Keywords:    request.Keywords,
+		Task:        request.Task,
+		Jira:        request.Jira,
+		UpdatedAt:   time.Now(),
+	}
+	rule.Task, _ = canonicalCategory(rule.Task)
+
+	if err := embedRule(r.Context(), &rule); err != nil {
+		log.Printf("Error embedding rule %s: %v", rule.Name, err)
+	}
+
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	if err := loadRules(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	index := slices.IndexFunc(rules, func(existing ActivityRule) bool { return existing.ID == id })
+	if index == -1 {
+		writeError(w, r, http.StatusNotFound, "Rule not found")
+		return
+	}
+
+	rules[index] = rule
+	if err := saveRules(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving rule: "+err.Error())
+		return
+	}
+	indexRuleVector(r.Context(), rule)
+
+	rule.Embedding = nil
+	publishEvent(EventRuleUpdated, rule)
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+func deleteRuleHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	if err := loadRules(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	index := slices.IndexFunc(rules, func(existing ActivityRule) bool { return existing.ID == id })
+	if index == -1 {
+		writeError(w, r, http.StatusNotFound, "Rule not found")
+		return
+	}
+
+	deleted := rules[index]
+	deleted.Embedding = nil
+	rules = slices.Delete(rules, index, index+1)
+	if err := saveRules(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving rules: "+err.Error())
+		return
+	}
+	unindexRuleVector(r.Context(), deleted.ID)
+
+	publishEvent(EventRuleDeleted, deleted)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// maxRuleTestDescriptions limits how many samples a single rule test may run
+const maxRuleTestDescriptions = 50
+
+// RuleTestRequest represents the JSON request for trying rules against sample text
+type RuleTestRequest struct {
+	Descriptions []string `json:"descriptions"`
+}
+
+// RuleTestResult is the rule a sample description would match, if any
+type RuleTestResult struct {
+	Description string          `json:"description"`
+	Normalized  string          `json:"normalized"`
+	RuleID      string          `json:"rule_id,omitempty"`
+	RuleName    string          `json:"rule_name,omitempty"`
+	Task        string          `json:"task,omitempty"`
+	Jira        string          `json:"jira,omitempty"`
+	Confidence  string          `json:"confidence,omitempty"`
+	Reason      string          `json:"reason,omitempty"`
+	Candidates  []RuleCandidate `json:"candidates"`
+	Error       string          `json:"error,omitempty"`
+}
+
+// testRulesHandler reports which rule each sample description would match without saving anything
+func testRulesHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	// Parse JSON request
+	var request RuleTestRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+		return
+	}
+
+	v := &validator{}
+	if len(request.Descriptions) == 0 {
+		v.add("descriptions", "descriptions is required")
+	}
+	if len(request.Descriptions) > maxRuleTestDescriptions {
+		v.add("descriptions", "at most %d descriptions may be tested at once", maxRuleTestDescriptions)
+	}
+	for _, description := range request.Descriptions {
+		v.text("descriptions", description, true, maxDescriptionLength)
+	}
+	if len(v.details) > 0 {
+		writeValidationError(w, r, v.details...)
+		return
+	}
+
+	results := make([]RuleTestResult, 0, len(request.Descriptions))
+	for _, description := range request.Descriptions {
+		result := RuleTestResult{
+			Description: description,
+			Normalized:  normalizeDescription(description),
+			Candidates:  []RuleCandidate{},
+		}
+
+		rule, choice, candidates, err := matchRule(r.Context(), result.Normalized)
+		if candidates != nil {
+			result.Candidates = candidates
+		}
+		switch {
+		case err != nil:
+			result.Error = err.Error()
+		case rule != nil:
+			result.RuleID = rule.ID
+			result.RuleName = rule.Name
+			result.Task = rule.Task
+			result.Jira = rule.Jira
+		}
+		if choice != nil {
+			result.Confidence = choice.Confidence
+			result.Reason = choice.Reason
+		}
+
+		results = append(results, result)
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// ReembedRequest selects the rules to re-embed, all rules when IDs is empty
+type ReembedRequest struct {
+	IDs []string `json:"ids,omitempty"`
+}
+
+// ReembedProgress is streamed as one JSON line per rule, followed by a final line with Finished set
+type ReembedProgress struct {
+	RuleID    string `json:"rule_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Done      int    `json:"done"`
+	Total     int    `json:"total"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	Finished  bool   `json:"finished,omitempty"`
+}
+
+// storeRuleEmbedding saves a regenerated embedding unless the rule changed or was deleted meanwhile
+func storeRuleEmbedding(embedded ActivityRule) error {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	if err := loadRules(); err != nil {
+		return err
+	}
+
+	index := slices.IndexFunc(rules, func(existing ActivityRule) bool { return existing.ID == embedded.ID })
+	if index == -1 || !rules[index].UpdatedAt.Equal(embedded.UpdatedAt) {
+		return nil
+	}
+
+	rules[index].Embedding = embedded.Embedding
+	rules[index].EmbeddingModel = embedded.EmbeddingModel
+	if err := saveRules(); err != nil {
+		return err
+	}
+	indexRuleVector(context.Background(), rules[index])
+	return nil
+}
+
+// reembedRulesHandler regenerates rule embeddings with the configured embedding model,
+// streaming progress as newline-delimited JSON. Each embedding is saved as soon as it
+// is generated so an interrupted run keeps its progress.
+func reembedRulesHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// The body is optional, without one every rule is re-embedded
+	var request ReembedRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &request); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+			return
+		}
+	}
+
+	all, err := listRules()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	selected := all
+	if len(request.IDs) > 0 {
+		selected = []ActivityRule{}
+		v := &validator{}
+		for _, id := range request.IDs {
+			index := slices.IndexFunc(all, func(rule ActivityRule) bool { return rule.ID == id })
+			if index == -1 {
+				v.add("ids", "rule %q not found", id)
+				continue
+			}
+			selected = append(selected, all[index])
+		}
+		if len(v.details) > 0 {
+			writeValidationError(w, r, v.details...)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	controller := http.NewResponseController(w)
+
+	progress := ReembedProgress{Total: len(selected)}
+	for _, rule := range selected {
+		if r.Context().Err() != nil {
+			break
+		}
+
+		progress.RuleID = rule.ID
+		progress.Name = rule.Name
+		progress.Error = ""
+
+		err := embedRule(r.Context(), &rule)
+		if err == nil {
+			err = storeRuleEmbedding(rule)
+		}
+		if err != nil {
+			log.Printf("Error re-embedding rule %s: %v", rule.Name, err)
+			progress.Error = err.Error()
+			progress.Failed++
+		} else {
+			progress.Succeeded++
+		}
+		progress.Done++
+
+		encoder.Encode(progress)
+		controller.Flush()
+	}
+
+	progress.RuleID = ""
+	progress.Name = ""
+	progress.Error = ""
+	progress.Finished = true
+	encoder.Encode(progress)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// CategorySchedule is a recurring time window whose work defaults to a category,
+// e.g. Friday 13:00-17:00 is Admin. Schedules are only consulted when no rule is
+// similar to the description and the LLM has low confidence.
+type CategorySchedule struct {
+	WorkingHours
+	Category string `json:"category"`
+}
+
+// workTimeContextKey carries when the work being categorized happened
+type workTimeContextKey struct{}
+
+// withWorkTime attaches the time the work happened, in its owner's time zone, to a context
+func withWorkTime(ctx context.Context, at time.Time) context.Context {
+	return context.WithValue(ctx, workTimeContextKey{}, at)
+}
+
+// workTime returns the time the work being categorized happened, default now
+func workTime(ctx context.Context) time.Time {
+	if at, ok := ctx.Value(workTimeContextKey{}).(time.Time); ok {
+		return at
+	}
+	return storageToday()
+}
+
+// entryWorkTime returns when an entry was logged in its owner's time zone
+func entryWorkTime(entry TimeEntry) time.Time {
+	location := userLocation(entryOwner(entry))
+	if createdAt, err := time.Parse(time.RFC3339, entry.CreatedAt); err == nil {
+		return createdAt.In(location)
+	}
+	return time.Now().In(location)
+}
+
+// validateSchedules checks every schedule's window and category
+func validateSchedules(schedules []CategorySchedule) error {
+	for i, schedule := range schedules {
+		if schedule.Category == "" {
+			return fmt.Errorf("schedule %d: category is required", i+1)
+		}
+		if err := schedule.validate(); err != nil {
+			return fmt.Errorf("schedule %d: %v", i+1, err)
+		}
+		if len(schedule.Days) == 0 {
+			return fmt.Errorf("schedule %d: days are required", i+1)
+		}
+	}
+	return nil
+}
+
+// covers reports whether a time falls within the schedule's window
+func (s CategorySchedule) covers(at time.Time) bool {
+	if !s.WorksOn(at.Weekday()) {
+		return false
+	}
+	start, _ := time.Parse("15:04", s.Start)
+	end, _ := time.Parse("15:04", s.End)
+	minute := at.Hour()*60 + at.Minute()
+	return minute >= start.Hour()*60+start.Minute() && minute < end.Hour()*60+end.Minute()
+}
+
+// scheduledCategory returns the category scheduled for the time the work happened, if any
+func scheduledCategory(ctx context.Context) *CategoryResponse {
+	at := workTime(ctx)
+	for _, schedule := range currentConfig().Categorization.Schedules {
+		if schedule.covers(at) {
+			return &CategoryResponse{
+				Task:       schedule.Category,
+				Confidence: "medium",
+				Reason:     fmt.Sprintf("No similar rule and a low-confidence guess, %s %s-%s is scheduled as %s", at.Format("Monday"), schedule.Start, schedule.End, schedule.Category),
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// setupClient probes Ollama with a short timeout so setup doesn't hang on a wrong URL
+var setupClient = &http.Client{Timeout: 5 * time.Second}
+
+// embeddingModelHints pick out embedding models among the models Ollama has pulled
+var embeddingModelHints = []string{"embed", "minilm", "bge", "e5"}
+
+// errAlreadyConfigured is returned when setup would overwrite an existing config.json
+var errAlreadyConfigured = errors.New("config.json already exists, set overwrite to replace it")
+
+// OllamaProbe reports whether Ollama answered and which models it has
+type OllamaProbe struct {
+	URL       string   `json:"url"`
+	Reachable bool     `json:"reachable"`
+	Error     string   `json:"error,omitempty"`
+	Models    []string `json:"models"`
+}
+
+// SetupStatus describes the current installation for the setup wizard
+type SetupStatus struct {
+	Configured              bool        `json:"configured"`
+	ConfigPath              string      `json:"config_path"`
+	Rules                   int         `json:"rules"`
+	Ollama                  OllamaProbe `json:"ollama"`
+	SuggestedModel          string      `json:"suggested_model,omitempty"`
+	SuggestedEmbeddingModel string      `json:"suggested_embedding_model,omitempty"`
+}
+
+// SetupRequest holds the wizard's answers
+type SetupRequest struct {
+	// Provider is "ollama" (default) or "mock" to run without a model
+	Provider       string `json:"provider"`
+	OllamaURL      string `json:"ollama_url"`
+	Model          string `json:"model"`
+	EmbeddingModel string `json:"embedding_model"`
+	// Categories become starter activity rules, e.g. "Development", "Meetings"
+	Categories      []string `json:"categories"`
+	JiraProjectKeys []string `json:"jira_project_keys"`
+	Timezone        string   `json:"timezone"`
+	// Overwrite replaces an existing config.json
+	Overwrite bool `json:"overwrite"`
+}
+
+// SetupResult reports what setup wrote
+type SetupResult struct {
+	ConfigPath   string `json:"config_path"`
+	RulesCreated int    `json:"rules_created"`
+	// RulesSkipped is set when existing rules were kept instead of the starter rules
+	RulesSkipped bool `json:"rules_skipped,omitempty"`
+}
+
+// probeOllama lists the models pulled on an Ollama server
+func probeOllama(ctx context.Context, baseURL string) OllamaProbe {
+	probe := OllamaProbe{URL: baseURL, Models: []string{}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(baseURL, "/")+"/api/tags", nil)
+	if err != nil {
+		probe.Error = err.Error()
+		return probe
+	}
+
+	resp, err := setupClient.Do(req)
+	if err != nil {
+		probe.Error = err.Error()
+		return probe
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		probe.Error = "Ollama returned " + resp.Status
+		return probe
+	}
+
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		probe.Error = fmt.Sprintf("error decoding Ollama response: %v", err)
+		return probe
+	}
+
+	probe.Reachable = true
+	for _, model := range tags.Models {
+		probe.Models = append(probe.Models, model.Name)
+	}
+	return probe
+}
+
+// isEmbeddingModel guesses from its name whether a model produces embeddings
+func isEmbeddingModel(name string) bool {
+	lower := strings.ToLower(name)
+	for _, hint := range embeddingModelHints {
+		if strings.Contains(lower, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestModels picks a generation and an embedding model among the pulled models,
+// preferring the defaults when they are available
+func suggestModels(models []string) (string, string) {
+	defaults := defaultConfig().LLM
+	model, embeddingModel := "", ""
+
+	for _, name := range models {
+		base, _, _ := strings.Cut(name, ":")
+		if isEmbeddingModel(name) {
+			if embeddingModel == "" || base == defaults.EmbeddingModel {
+				embeddingModel = base
+			}
+		} else if model == "" || base == defaults.Model {
+			model = base
+		}
+	}
+
+	return model, embeddingModel
+}
+
+// starterRules turns the wizard's categories into activity rules to refine later
+func starterRules(categories []string) []ActivityRule {
+	starter := []ActivityRule{}
+	for _, category := range categories {
+		category = strings.TrimSpace(category)
+		if category == "" {
+			continue
+		}
+		starter = append(starter, ActivityRule{
+			ID:          uuid.New().String(),
+			Name:        category,
+			Description: "Time spent on " + strings.ToLower(category),
+			Keywords:    strings.Fields(strings.ToLower(category)),
+			Task:        category,
+			UpdatedAt:   time.Now(),
+		})
+	}
+	return starter
+}
+
+// currentSetupStatus probes the installation for the setup wizard
+func currentSetupStatus(ctx context.Context) SetupStatus {
+	configPath := locateFile("config.json")
+	_, err := os.Stat(configPath)
+
+	status := SetupStatus{
+		Configured: err == nil,
+		ConfigPath: configPath,
+		Ollama:     probeOllama(ctx, currentConfig().LLM.OllamaURL),
+	}
+	if existing, err := listRules(); err == nil {
+		status.Rules = len(existing)
+	}
+	status.SuggestedModel, status.SuggestedEmbeddingModel = suggestModels(status.Ollama.Models)
+
+	return status
+}
+
+// validateSetupRequest checks the wizard's answers
+func validateSetupRequest(request SetupRequest) []ErrorDetail {
+	v := &validator{}
+	v.oneOf("provider", request.Provider, []string{"ollama", "mock"})
+	if request.Provider != "mock" {
+		v.text("model", request.Model, true, maxTaskLength)
+		v.text("embedding_model", request.EmbeddingModel, true, maxTaskLength)
+	}
+	for _, category := range request.Categories {
+		v.text("categories", category, true, maxTaskLength)
+	}
+	for _, key := range request.JiraProjectKeys {
+		if !jiraProjectPattern.MatchString(key) {
+			v.add("jira_project_keys", "%q is not a Jira project key like PROJ", key)
+		}
+	}
+	if request.Timezone != "" {
+		if _, err := time.LoadLocation(request.Timezone); err != nil {
+			v.add("timezone", "timezone must be an IANA time zone like Europe/Berlin")
+		}
+	}
+	return v.details
+}
+
+// applySetup writes config.json and, when no rules exist yet, the starter rules.
+// Only the answered settings are written, everything else keeps its default.
+func applySetup(request SetupRequest) (*SetupResult, error) {
+	result := &SetupResult{ConfigPath: locateFile("config.json")}
+	if _, err := os.Stat(result.ConfigPath); err == nil && !request.Overwrite {
+		return nil, errAlreadyConfigured
+	}
+
+	llmConfig := map[string]interface{}{"provider": "mock"}
+	if request.Provider != "mock" {
+		ollamaURL := request.OllamaURL
+		if ollamaURL == "" {
+			ollamaURL = defaultConfig().LLM.OllamaURL
+		}
+		llmConfig = map[string]interface{}{
+			"provider":        "ollama",
+			"ollama_url":      ollamaURL,
+			"model":           request.Model,
+			"embedding_model": request.EmbeddingModel,
+		}
+	}
+
+	config := map[string]interface{}{"llm": llmConfig}
+	if len(request.JiraProjectKeys) > 0 {
+		config["jira"] = map[string]interface{}{"project_keys": request.JiraProjectKeys}
+	}
+	if request.Timezone != "" {
+		config["storage"] = map[string]interface{}{"timezone": request.Timezone}
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encode config: %v", err)
+	}
+	if err := os.WriteFile(result.ConfigPath, data, 0644); err != nil {
+		return nil, fmt.Errorf("couldn't write config: %v", err)
+	}
+
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	if err := loadRules(); err != nil {
+		return nil, err
+	}
+	starter := starterRules(request.Categories)
+	// The wizard's categories replace the built-in rules
+	if len(rules) > 0 && !(rulesBuiltIn && len(starter) > 0) {
+		result.RulesSkipped = len(starter) > 0
+		return result, nil
+	}
+	if len(starter) > 0 {
+		rules = starter
+		if err := saveRules(); err != nil {
+			return nil, err
+		}
+		result.RulesCreated = len(starter)
+	}
+
+	return result, nil
+}
+
+// reloadMu keeps a SIGHUP and a setup from reloading at the same time
+var reloadMu sync.Mutex
+
+// reloadConfig re-reads config.json and, when every setting checks out, swaps it in
+// with everything built from it. An invalid config leaves the running one in place.
+func reloadConfig() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	state, err := prepareConfig(config)
+	if err != nil {
+		return err
+	}
+
+	previous := currentConfig()
+	// The sinks' delivery loops run for the life of the process
+	if !reflect.DeepEqual(config.Events, previous.Events) || !reflect.DeepEqual(config.Stream, previous.Stream) {
+		log.Println("Changes to event sinks and the entry stream take effect after a restart")
+	}
+	storeChanged := !reflect.DeepEqual(config.VectorStore, previous.VectorStore)
+
+	activateConfig(state)
+	if storeChanged {
+		syncVectorStore()
+	}
+	return nil
+}
+
+// setupHandler reports the installation status (GET) or applies the wizard's answers (POST)
+func setupHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// Send JSON response
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(currentSetupStatus(r.Context()))
+	case http.MethodPost:
+		applySetupHandler(w, r)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func applySetupHandler(w http.ResponseWriter, r *http.Request) {
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	// Parse JSON request
+	var request SetupRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+		return
+	}
+	request.Provider = strings.ToLower(request.Provider)
+
+	if details := validateSetupRequest(request); len(details) > 0 {
+		writeValidationError(w, r, details...)
+		return
+	}
+
+	result, err := applySetup(request)
+	if errors.Is(err, errAlreadyConfigured) {
+		writeError(w, r, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error writing setup: "+err.Error())
+		return
+	}
+
+	if err := reloadConfig(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Setup written but couldn't be applied: "+err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(result)
+}
+
+// prompt asks a question on the terminal, returning the default for an empty answer
+func prompt(in *bufio.Scanner, out io.Writer, question, fallback string) string {
+	if fallback != "" {
+		fmt.Fprintf(out, "%s [%s]: ", question, fallback)
+	} else {
+		fmt.Fprintf(out, "%s: ", question)
+	}
+
+	if !in.Scan() {
+		return fallback
+	}
+	if answer := strings.TrimSpace(in.Text()); answer != "" {
+		return answer
+	}
+	return fallback
+}
+
+// splitList splits a comma separated answer, dropping empty items
+func splitList(answer string) []string {
+	items := []string{}
+	for _, item := range strings.Split(answer, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// runInit is the interactive "aidea init" wizard
+func runInit(input io.Reader, out io.Writer) error {
+	in := bufio.NewScanner(input)
+	request := SetupRequest{Provider: "ollama"}
+
+	configPath := locateFile("config.json")
+	if _, err := os.Stat(configPath); err == nil {
+		if !strings.HasPrefix(strings.ToLower(prompt(in, out, configPath+" exists, overwrite it? (y/n)", "n")), "y") {
+			fmt.Fprintln(out, "Keeping the existing configuration.")
+			return nil
+		}
+		request.Overwrite = true
+	}
+
+	request.OllamaURL = prompt(in, out, "Ollama URL", currentConfig().LLM.OllamaURL)
+	probe := probeOllama(context.Background(), request.OllamaURL)
+	if probe.Reachable {
+		fmt.Fprintf(out, "Ollama is running with %d models: %s\n", len(probe.Models), strings.Join(probe.Models, ", "))
+		model, embeddingModel := suggestModels(probe.Models)
+		if model == "" {
+			model = currentConfig().LLM.Model
+		}
+		if embeddingModel == "" {
+			embeddingModel = currentConfig().LLM.EmbeddingModel
+		}
+		request.Model = prompt(in, out, "Model for categorization", model)
+		request.EmbeddingModel = prompt(in, out, "Embedding model", embeddingModel)
+		for _, name := range []string{request.Model, request.EmbeddingModel} {
+			if !strings.Contains(strings.Join(probe.Models, " "), name) {
+				fmt.Fprintf(out, "%s isn't pulled yet, run: ollama pull %s\n", name, name)
+			}
+		}
+	} else {
+		fmt.Fprintf(out, "Ollama isn't reachable at %s (%s)\n", request.OllamaURL, probe.Error)
+		if strings.HasPrefix(strings.ToLower(prompt(in, out, "Use the mock provider until Ollama is running? (y/n)", "y")), "y") {
+			request.Provider = "mock"
+		} else {
+			request.Model = prompt(in, out, "Model for categorization", currentConfig().LLM.Model)
+			request.EmbeddingModel = prompt(in, out, "Embedding model", currentConfig().LLM.EmbeddingModel)
+		}
+	}
+
+	request.Categories = splitList(prompt(in, out, "What kinds of work do you track? (comma separated)", "Development, Meetings, Code review, Documentation"))
+	request.JiraProjectKeys = splitList(strings.ToUpper(prompt(in, out, "Jira project keys you log time against (comma separated, optional)", "")))
+	request.Timezone = prompt(in, out, "Time zone (IANA name, optional)", "")
+
+	if details := validateSetupRequest(request); len(details) > 0 {
+		for _, detail := range details {
+			fmt.Fprintf(out, "%s: %s\n", detail.Field, detail.Message)
+		}
+		return fmt.Errorf("setup answers are invalid")
+	}
+
+	result, err := applySetup(request)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Wrote %s\n", result.ConfigPath)
+	switch {
+	case result.RulesCreated > 0:
+		fmt.Fprintf(out, "Created %d starter rules in %s\n", result.RulesCreated, rulesFile)
+	case result.RulesSkipped:
+		fmt.Fprintf(out, "Kept the existing rules in %s\n", rulesFile)
+	}
+	fmt.Fprintln(out, "Start the server to begin tracking time.")
+	return nil
+}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const splitsFile = "aidea_splits.json"
+
+// Split proposal statuses
+const (
+	SplitPending  = "pending"
+	SplitApplied  = "applied"
+	SplitRejected = "rejected"
+)
+
+// splitSystemPrompt asks for the activities in an entry and how its time divides between them
+const splitSystemPrompt = "The user's time tracking entry may describe more than one activity, " +
+	"e.g. \"fixed FEDS-101 and reviewed FEDS-202\". List each distinct activity as a part with a short description, " +
+	"its task category, its Jira issue if one is named, the share of the time it likely took (the shares add up to 1) " +
+	"and your confidence (low, medium or high). An entry about a single activity has one part. " +
+	"Respond only with JSON: {\"parts\": [{\"description\": \"...\", \"task\": \"...\", \"jira\": \"...\", " +
+	"\"share\": 0.5, \"confidence\": \"...\"}], \"reason\": \"...\"}"
+
+// multiActivitySeparators are the conjunctions that usually join two activities
+var multiActivitySeparators = []string{" and ", " & ", ";", " then ", " plus ", " as well as "}
+
+// SplitPart is one activity of an entry describing several
+type SplitPart struct {
+	Description string `json:"description"`
+	Task        string `json:"task"`
+	Jira        string `json:"jira,omitempty"`
+	// Share is the model's estimate of the fraction of the entry's time spent on this part
+	Share      float64 `json:"share"`
+	Confidence string  `json:"confidence"`
+	// Timespan is the part's duration once the entry's time is allocated
+	Timespan string `json:"timespan,omitempty"`
+}
+
+// SplitResponse is the model's division of an entry into activities
+type SplitResponse struct {
+	Parts  []SplitPart `json:"parts"`
+	Reason string      `json:"reason"`
+}
+
+// Splitter divides a description covering several activities into parts
+type Splitter interface {
+	Split(ctx context.Context, description string) (*SplitResponse, error)
+}
+
+// SplitProposal is a suggested split of an entry, applied only once reviewed
+type SplitProposal struct {
+	ID          string      `json:"id"`
+	EntryID     string      `json:"entry_id"`
+	Date        string      `json:"date"` // YYYYMMDD
+	User        string      `json:"user"`
+	Description string      `json:"description"`
+	Timespan    string      `json:"timespan"`
+	Parts       []SplitPart `json:"parts"`
+	Reason      string      `json:"reason"`
+	Status      string      `json:"status"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+var (
+	splitsMu sync.Mutex
+	splits   []SplitProposal
+
+	// errSplitStale is returned when the entry changed after its split was proposed
+	errSplitStale = errors.New("the entry changed since the split was proposed")
+)
+
+// loadSplits reads the split proposals file once, callers must hold splitsMu
+func loadSplits() error {
+	if splits != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(splitsFile)
+	if os.IsNotExist(err) {
+		splits = []SplitProposal{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read split proposals: %v", err)
+	}
+
+	var loaded []SplitProposal
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("couldn't parse split proposals: %v", err)
+	}
+
+	splits = loaded
+	return nil
+}
+
+// saveSplits writes the split proposals file, callers must hold splitsMu
+func saveSplits() error {
+	data, err := json.MarshalIndent(splits, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't encode split proposals: %v", err)
+	}
+
+	return os.WriteFile(splitsFile, data, 0644)
+}
+
+// mayDescribeSeveral reports whether a description names two Jira issues or joins
+// clauses, the only entries worth asking the model to split
+func mayDescribeSeveral(description string) bool {
+	keys := jiraKeyFinder.FindAllString(description, -1)
+	slices.Sort(keys)
+	if len(slices.Compact(keys)) > 1 {
+		return true
+	}
+
+	lower := strings.ToLower(description)
+	for _, conjunction := range multiActivitySeparators {
+		if strings.Contains(lower, conjunction) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTrust is how far a part's share is trusted at each confidence, the rest of
+// its weight comes from an equal split so unsure estimates stay near even
+var splitTrust = map[string]float64{"high": 1, "medium": 0.75, "low": 0.5}
+
+// allocateMinutes divides an entry's minutes between the parts by their shares,
+// each pulled toward an equal split by the part's confidence. Shares that don't
+// add up to anything usable fall back to equal parts.
+func allocateMinutes(total int, parts []SplitPart) []int {
+	var sum float64
+	for _, part := range parts {
+		sum += part.Share
+	}
+	usable := sum > 0 && !slices.ContainsFunc(parts, func(part SplitPart) bool { return part.Share <= 0 })
+
+	even := 1 / float64(len(parts))
+	weights := make([]float64, len(parts))
+	for i, part := range parts {
+		weights[i] = even
+		if usable {
+			trust := splitTrust[normalizeConfidence(part.Confidence)]
+			weights[i] = trust*part.Share/sum + (1-trust)*even
+		}
+	}
+	return apportion(total, weights)
+}
+
+// apportion divides whole minutes in proportion to the weights, giving rounding
+// leftovers to the largest remainders so the parts add up to the total
+func apportion(total int, weights []float64) []int {
+	var sum float64
+	for _, weight := range weights {
+		sum += weight
+	}
+
+	minutes := make([]int, len(weights))
+	remainders := make([]float64, len(weights))
+	allocated := 0
+	for i, weight := range weights {
+		exact := float64(total) * weight / sum
+		minutes[i] = int(math.Floor(exact))
+		remainders[i] = exact - float64(minutes[i])
+		allocated += minutes[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		switch {
+		case remainders[a] > remainders[b]:
+			return -1
+		case remainders[a] < remainders[b]:
+			return 1
+		}
+		return 0
+	})
+	for i := 0; allocated < total; i++ {
+		minutes[order[i%len(order)]]++
+		allocated++
+	}
+
+	return minutes
+}
+
+// proposeSplit asks the model how an entry divides into activities and saves the
+// proposal for review. It returns nil when the entry covers a single activity.
+func proposeSplit(ctx context.Context, day time.Time, entry TimeEntry) (*SplitProposal, error) {
+	duration, err := parseTimespan(entry.Timespan)
+	if err != nil {
+		return nil, fmt.Errorf("entry has no duration to split: %v", err)
+	}
+	total := int(duration.Minutes())
+
+	response, err := llm().Split(ctx, categorizationText(entry))
+	if err != nil {
+		return nil, err
+	}
+
+	parts := slices.DeleteFunc(response.Parts, func(part SplitPart) bool {
+		return strings.TrimSpace(part.Description) == ""
+	})
+	if len(parts) < 2 || total < len(parts) {
+		return nil, nil
+	}
+
+	for i, minutes := range allocateMinutes(total, parts) {
+		parts[i].Timespan = fmt.Sprintf("%dm", minutes)
+		parts[i].Confidence = normalizeConfidence(parts[i].Confidence)
+		if parts[i].Jira != "" && modelJiraProblem(categorizationText(entry), parts[i].Jira) != "" {
+			parts[i].Jira = ""
+		}
+	}
+
+	proposal := SplitProposal{
+		ID:          uuid.New().String(),
+		EntryID:     entry.ID,
+		Date:        day.Format("20060102"),
+		User:        entryOwner(entry),
+		Description: entry.Description,
+		Timespan:    entry.Timespan,
+		Parts:       parts,
+		Reason:      response.Reason,
+		Status:      SplitPending,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	splitsMu.Lock()
+	defer splitsMu.Unlock()
+
+	if err := loadSplits(); err != nil {
+		return nil, err
+	}
+
+	// A new proposal replaces one still pending for the same entry
+	splits = slices.DeleteFunc(splits, func(existing SplitProposal) bool {
+		return existing.EntryID == entry.ID && existing.Status == SplitPending
+	})
+	splits = append(splits, proposal)
+	if err := saveSplits(); err != nil {
+		return nil, err
+	}
+
+	return &proposal, nil
+}
+
+// autoProposeSplit proposes a split for a freshly categorized entry when splitting
+// is enabled and its description looks like it covers several activities
+func autoProposeSplit(ctx context.Context, day time.Time, entry TimeEntry) bool {
+	if !currentConfig().Categorization.SplitEntries || !mayDescribeSeveral(entry.Description) {
+		return false
+	}
+
+	proposal, err := proposeSplit(ctx, day, entry)
+	if err != nil {
+		log.Printf("Error proposing split for entry %s: %v", entry.ID, err)
+		return false
+	}
+	return proposal != nil
+}
+
+// findSplit returns a user's proposal by ID
+func findSplit(user, id string) (*SplitProposal, error) {
+	splitsMu.Lock()
+	defer splitsMu.Unlock()
+
+	if err := loadSplits(); err != nil {
+		return nil, err
+	}
+
+	for _, proposal := range splits {
+		if proposal.ID == id && proposal.User == user {
+			return &proposal, nil
+		}
+	}
+	return nil, nil
+}
+
+// setSplitStatus records the outcome of a reviewed proposal
+func setSplitStatus(id, status string) error {
+	splitsMu.Lock()
+	defer splitsMu.Unlock()
+
+	if err := loadSplits(); err != nil {
+		return err
+	}
+
+	for i := range splits {
+		if splits[i].ID == id {
+			splits[i].Status = status
+			return saveSplits()
+		}
+	}
+	return fmt.Errorf("split proposal %s not found", id)
+}
+
+// applySplit rewrites the original entry as the first part and adds an entry for
+// each other part, all marked categorized since the split has been reviewed
+func applySplit(ctx context.Context, proposal SplitProposal) ([]TimeEntry, error) {
+	day, err := time.ParseInLocation("20060102", proposal.Date, userLocation(proposal.User))
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := readDayEntries(day)
+	if err != nil {
+		return nil, err
+	}
+	index := slices.IndexFunc(entries, func(entry TimeEntry) bool {
+		return entry.ID == proposal.EntryID && entry.DeletedAt == ""
+	})
+	if index < 0 || entries[index].Description != proposal.Description || entries[index].Timespan != proposal.Timespan {
+		return nil, errSplitStale
+	}
+	original := entries[index]
+	reason := fmt.Sprintf("Split from %q: %s", proposal.Description, proposal.Reason)
+
+	first := proposal.Parts[0]
+	updated, err := updateEntry(ctx, day, original.ID, func(e *TimeEntry) {
+		e.Description = first.Description
+		e.Timespan = first.Timespan
+		e.Task = first.Task
+		e.Jira = first.Jira
+		e.Confidence = first.Confidence
+		e.TaskReason = reason
+		e.InputHash = ""
+		e.Labels = nil
+		e.Categorized = true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	created := []TimeEntry{*updated}
+	for _, part := range proposal.Parts[1:] {
+		entry := TimeEntry{
+			ID:          uuid.New().String(),
+			CreatedAt:   original.CreatedAt,
+			Timespan:    part.Timespan,
+			Description: part.Description,
+			Task:        part.Task,
+			TaskReason:  reason,
+			Jira:        part.Jira,
+			Confidence:  part.Confidence,
+			Categorized: true,
+			User:        original.User,
+			Tags:        original.Tags,
+			Links:       original.Links,
+		}
+		if err := appendEntry(ctx, day, entry); err != nil {
+			return created, err
+		}
+		entry.Date = entryDate(day)
+		created = append(created, entry)
+	}
+
+	return created, nil
+}
+
+// splitEntryHandler asks the model to split an entry covering several activities
+// into a proposal for review. The entry's day is given as ?date=YYYYMMDD and
+// defaults to today.
+func splitEntryHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if !currentConfig().Categorization.SplitEntries {
+		writeError(w, r, http.StatusForbidden, "Entry splitting is not enabled")
+		return
+	}
+
+	day, entry, ok := lookupEntry(w, r)
+	if !ok {
+		return
+	}
+	if err := checkWeekOpen(entryOwner(*entry), day); err != nil {
+		writeErrorCode(w, r, http.StatusConflict, ErrCodeWeekFrozen, err.Error())
+		return
+	}
+	if _, err := parseTimespan(entry.Timespan); err != nil {
+		writeValidationError(w, r, ErrorDetail{Field: "timespan", Message: "the entry needs a timespan to split"})
+		return
+	}
+
+	// Fail fast while the LLM backend is down
+	if llmUnavailable() {
+		writeCircuitOpen(w, r)
+		return
+	}
+	release, ok := reserveCategorization(1)
+	if !ok {
+		writeQueueFull(w, r)
+		return
+	}
+	defer release()
+
+	proposal, err := proposeSplit(r.Context(), day, *entry)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error splitting entry: "+err.Error())
+		return
+	}
+	if proposal == nil {
+		writeError(w, r, http.StatusUnprocessableEntity, "The entry describes a single activity")
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(proposal)
+}
+
+// splitsHandler lists the current user's split proposals awaiting review
+func splitsHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	splitsMu.Lock()
+	if err := loadSplits(); err != nil {
+		splitsMu.Unlock()
+		writeError(w, r, http.StatusInternalServerError, "Error reading split proposals: "+err.Error())
+		return
+	}
+	user := currentUser(r).Name
+	pending := []SplitProposal{}
+	for _, proposal := range splits {
+		if proposal.User == user && proposal.Status == SplitPending {
+			pending = append(pending, proposal)
+		}
+	}
+	splitsMu.Unlock()
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pending)
+}
+
+// reviewSplitHandler applies (POST .../accept) or discards (POST .../reject) a split proposal
+func reviewSplitHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	action := r.PathValue("action")
+	if action != "accept" && action != "reject" {
+		writeError(w, r, http.StatusNotFound, "Not found")
+		return
+	}
+
+	proposal, err := findSplit(currentUser(r).Name, r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error reading split proposals: "+err.Error())
+		return
+	}
+	if proposal == nil {
+		writeError(w, r, http.StatusNotFound, "Split proposal not found")
+		return
+	}
+	if proposal.Status != SplitPending {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("Split proposal is already %s", proposal.Status))
+		return
+	}
+
+	if action == "reject" {
+		if err := setSplitStatus(proposal.ID, SplitRejected); err != nil {
+			writeError(w, r, http.StatusInternalServerError, "Error saving split proposal: "+err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	entries, err := applySplit(r.Context(), *proposal)
+	if errors.Is(err, errWeekFrozen) {
+		writeErrorCode(w, r, http.StatusConflict, ErrCodeWeekFrozen, err.Error())
+		return
+	}
+	if errors.Is(err, errSplitStale) {
+		writeError(w, r, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error splitting entry: "+err.Error())
+		return
+	}
+	if err := setSplitStatus(proposal.ID, SplitApplied); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving split proposal: "+err.Error())
+		return
+	}
+
+	location := userLocation(proposal.User)
+	for i := range entries {
+		entries[i] = localizeEntry(entries[i], location)
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,621 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StorageConfig controls how entries are split across data files
+type StorageConfig struct {
+	// Rollover is "daily" (default), "weekly" or "monthly"
+	Rollover string `json:"rollover"`
+	// Timezone is the IANA zone whose day boundaries decide an entry's file, default server local time
+	Timezone string `json:"timezone"`
+	// FilenameTemplate names data files, {period} expands to 20060102, 2006W01 or 200601 by rollover
+	FilenameTemplate string `json:"filename_template"`
+}
+
+// storageMu serializes writes to the data files from handlers and background integrations
+var storageMu sync.Mutex
+
+// storageLocation is the time zone of the storage day boundaries
+func storageLocation() *time.Location {
+	return active.Load().storageLocation
+}
+
+// csvHeaders is the column layout written to new data files
+var csvHeaders = []string{"id", "date", "created_at", "timespan", "description", "task", "task_reason", "jira", "confidence", "categorized", "user", "input_hash", "deleted_at", "tags", "links", "labels", "question", "clarification"}
+
+// legacyHeaders is the layout of the first data files, assumed for a file whose
+// first row is an entry rather than a header
+var legacyHeaders = []string{"id", "timespan", "description", "task", "task_reason", "jira", "confidence", "categorized"}
+
+// schemaStampPrefix starts the first line of a data file, followed by the schema
+// version it was written at. CSV readers skip it as a comment.
+const schemaStampPrefix = "# aidea schema "
+
+// writeSchemaStamp writes the version line that starts a data file
+func writeSchemaStamp(w io.Writer, version int) error {
+	_, err := fmt.Fprintf(w, "%s%d\n", schemaStampPrefix, version)
+	return err
+}
+
+// prepareStorage validates the rollover policy and loads its time zone, the local
+// one when none is set
+func prepareStorage(config StorageConfig) (*time.Location, error) {
+	switch config.Rollover {
+	case "", "daily", "weekly", "monthly":
+	default:
+		return nil, fmt.Errorf("unknown rollover %q, expected daily, weekly or monthly", config.Rollover)
+	}
+
+	if config.FilenameTemplate != "" && !strings.Contains(config.FilenameTemplate, "{period}") {
+		return nil, fmt.Errorf("filename template %q must contain {period}", config.FilenameTemplate)
+	}
+
+	if config.Timezone == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage timezone: %v", err)
+	}
+	return location, nil
+}
+
+// useStorageConfig makes a config active with its storage settings, for commands
+// that only work on the data files
+func useStorageConfig(config Config) error {
+	location, err := prepareStorage(config.Storage)
+	if err != nil {
+		return err
+	}
+	updateActive(func(state *activeState) {
+		state.config = config
+		state.storageLocation = location
+	})
+	return nil
+}
+
+// prepareUserTimezones loads the time zone of every configured user by name
+func prepareUserTimezones(users []User) (map[string]*time.Location, error) {
+	locations := make(map[string]*time.Location)
+	for _, user := range users {
+		if user.Timezone == "" {
+			continue
+		}
+		location, err := time.LoadLocation(user.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone for user %s: %v", user.Name, err)
+		}
+		locations[user.Name] = location
+	}
+	return locations, nil
+}
+
+// userLocation returns a user's time zone from their preferences or config.json,
+// falling back to the storage time zone
+func userLocation(name string) *time.Location {
+	if location, ok := preferredLocation(name); ok {
+		return location
+	}
+	if location, ok := active.Load().userLocations[name]; ok {
+		return location
+	}
+	return storageLocation()
+}
+
+// storageToday returns the current time in the storage time zone
+func storageToday() time.Time {
+	return time.Now().In(storageLocation())
+}
+
+// userToday returns the current time in a user's time zone, so entries land on the user's calendar day
+func userToday(name string) time.Time {
+	return time.Now().In(userLocation(name))
+}
+
+// entryDate formats the calendar day an entry belongs to, as stored in the date column.
+// The day is taken in its own location, which is the owner's time zone.
+func entryDate(day time.Time) string {
+	return day.Format("2006-01-02")
+}
+
+// localizeEntry renders an entry's UTC creation timestamp in the given time zone
+func localizeEntry(entry TimeEntry, location *time.Location) TimeEntry {
+	if createdAt, err := time.Parse(time.RFC3339, entry.CreatedAt); err == nil {
+		entry.CreatedAt = createdAt.In(location).Format(time.RFC3339)
+	}
+	return entry
+}
+
+// dataPeriod returns the rollover period key of the file holding a given calendar day
+func dataPeriod(day time.Time) string {
+	switch currentConfig().Storage.Rollover {
+	case "weekly":
+		year, week := day.ISOWeek()
+		return fmt.Sprintf("%dW%02d", year, week)
+	case "monthly":
+		return day.Format("200601")
+	default:
+		return day.Format("20060102") // Format for YYYYMMDD
+	}
+}
+
+// dataFilenameTemplate returns the configured data file name template
+func dataFilenameTemplate() string {
+	if currentConfig().Storage.FilenameTemplate == "" {
+		return "aidea_time_tracking_{period}.csv"
+	}
+	return currentConfig().Storage.FilenameTemplate
+}
+
+// dataFilename returns the CSV file name holding the entries for a given day
+func dataFilename(day time.Time) string {
+	return strings.ReplaceAll(dataFilenameTemplate(), "{period}", dataPeriod(day))
+}
+
+// readDayEntries loads the entries of a single day from the file covering it, leaving out
+// the trash. Entries without a date predate the date column and always lived in daily files.
+func readDayEntries(day time.Time) ([]TimeEntry, error) {
+	entries, err := readEntries(dataFilename(day))
+	if err != nil {
+		return nil, err
+	}
+
+	date := entryDate(day)
+	dayEntries := make([]TimeEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Date == "" {
+			entry.Date = date
+		}
+		if entry.Date == date && entry.DeletedAt == "" {
+			dayEntries = append(dayEntries, entry)
+		}
+	}
+
+	return dayEntries, nil
+}
+
+// readDataFile reads a data file's schema version, header and rows. Files written
+// before the version stamp are version 0, and a file without a header row is read
+// in the legacy layout. Rows that can't be parsed, like hand edits with a stray
+// quote or extra commas, are moved to the file's errors file and the rest are read.
+func readDataFile(filename string) (int, []string, [][]string, error) {
+	version, headers, rows, malformed, err := parseDataFile(filename)
+	if err != nil {
+		return version, nil, nil, err
+	}
+	if len(malformed) > 0 {
+		if err := quarantineRows(filename, malformed); err != nil {
+			return version, nil, nil, err
+		}
+	}
+	return version, headers, rows, nil
+}
+
+// parseDataFile reads a data file like readDataFile but returns the rows that can't
+// be parsed instead of quarantining them, so it never writes
+func parseDataFile(filename string) (int, []string, [][]string, []malformedRow, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, nil, nil, nil, err
+	}
+
+	// lines counts the stamp line, so reported line numbers match the file
+	version, lines := 0, 0
+	if rest, found := bytes.CutPrefix(data, []byte(schemaStampPrefix)); found {
+		stamp, body, _ := bytes.Cut(rest, []byte("\n"))
+		if version, err = strconv.Atoi(strings.TrimSpace(string(stamp))); err != nil {
+			return 0, nil, nil, nil, fmt.Errorf("invalid schema version line %q", schemaStampPrefix+strings.TrimSpace(string(stamp)))
+		}
+		data = body
+		lines = 1
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+
+	var headers []string
+	rows := [][]string{}
+	malformed := []malformedRow{}
+	for {
+		offset := reader.InputOffset()
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		raw := data[offset:reader.InputOffset()]
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			malformed = append(malformed, malformedRow{Line: lines + parseErr.StartLine, Problem: parseErr.Err.Error(), Raw: raw})
+			continue
+		}
+		if err != nil {
+			return version, nil, nil, nil, fmt.Errorf("error reading CSV: %v", err)
+		}
+		// Only a parsed row has field positions
+		line, _ := reader.FieldPos(0)
+
+		if headers == nil {
+			headers = record
+			// Without a header row the first row is an entry
+			if !slices.Contains(headers, "description") && !slices.Contains(headers, "timespan") {
+				headers = slices.Clone(legacyHeaders)
+				rows = append(rows, record)
+			}
+			continue
+		}
+		// Extra fields shift every value after them, so the row can't be trusted
+		if len(record) > len(headers) {
+			malformed = append(malformed, malformedRow{Line: lines + line, Problem: fmt.Sprintf("%d fields, the header has %d", len(record), len(headers)), Raw: raw})
+			continue
+		}
+		rows = append(rows, record)
+	}
+	return version, headers, rows, malformed, nil
+}
+
+// malformedRow is a row of a data file that couldn't be parsed, as written
+type malformedRow struct {
+	Line    int
+	Problem string
+	Raw     []byte
+}
+
+// quarantineMu keeps concurrent reads of a file from quarantining its rows twice
+var quarantineMu sync.Mutex
+
+// errorsFilename is where the malformed rows of a data file are kept. It doesn't end
+// in .csv, so it never matches the data file pattern.
+func errorsFilename(filename string) string {
+	return filename + ".errors"
+}
+
+// quarantineRows appends malformed rows to the data file's errors file, skipping
+// rows already quarantined by an earlier read. Once the data file is rewritten the
+// rows are only in the errors file, to be fixed and imported again by hand.
+func quarantineRows(filename string, rows []malformedRow) error {
+	quarantineMu.Lock()
+	defer quarantineMu.Unlock()
+
+	errorsFile := errorsFilename(filename)
+	existing, err := os.ReadFile(errorsFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("couldn't read %s: %v", errorsFile, err)
+	}
+
+	var added bytes.Buffer
+	count := 0
+	for _, row := range rows {
+		if bytes.Contains(existing, row.Raw) {
+			continue
+		}
+		fmt.Fprintf(&added, "# line %d: %s\n", row.Line, row.Problem)
+		added.Write(row.Raw)
+		if !bytes.HasSuffix(row.Raw, []byte("\n")) {
+			added.WriteByte('\n')
+		}
+		count++
+	}
+	if count == 0 {
+		return nil
+	}
+
+	file, err := os.OpenFile(errorsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("couldn't open %s: %v", errorsFile, err)
+	}
+	defer file.Close()
+	if _, err := file.Write(added.Bytes()); err != nil {
+		return fmt.Errorf("couldn't write %s: %v", errorsFile, err)
+	}
+	log.Printf("Skipped %d malformed rows of %s, they are kept in %s", count, filename, errorsFile)
+	return nil
+}
+
+// readEntriesFile parses every time entry from a CSV file, locating columns by header
+// name. Files from an older schema are upgraded as they are read, so old layouts
+// read like current ones with the missing columns left empty.
+func readEntriesFile(filename string) ([]TimeEntry, error) {
+	version, headers, rows, err := readDataFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if headers == nil {
+		return []TimeEntry{}, nil
+	}
+
+	if version < currentSchemaVersion() {
+		if headers, rows, err = upgradeRows(filename, version, headers, rows); err != nil {
+			return nil, err
+		}
+	}
+
+	columns := csvColumns(headers)
+	entries := make([]TimeEntry, 0, len(rows))
+	for _, record := range rows {
+		entries = append(entries, recordEntry(columns, record))
+	}
+
+	return entries, nil
+}
+
+// csvColumns indexes a header row by column name
+func csvColumns(headers []string) map[string]int {
+	columns := make(map[string]int)
+	for i, header := range headers {
+		columns[header] = i
+	}
+	return columns
+}
+
+// recordEntry converts a CSV record into an entry, locating fields by column name
+func recordEntry(columns map[string]int, record []string) TimeEntry {
+	field := func(name string) string {
+		if idx, ok := columns[name]; ok && idx < len(record) {
+			return record[idx]
+		}
+		return ""
+	}
+
+	return TimeEntry{
+		ID:            field("id"),
+		Date:          field("date"),
+		CreatedAt:     field("created_at"),
+		Timespan:      field("timespan"),
+		Description:   field("description"),
+		Task:          field("task"),
+		TaskReason:    field("task_reason"),
+		Jira:          field("jira"),
+		Confidence:    normalizeConfidence(field("confidence")),
+		Categorized:   field("categorized") == "true",
+		User:          field("user"),
+		InputHash:     field("input_hash"),
+		DeletedAt:     field("deleted_at"),
+		Tags:          splitTags(field("tags")),
+		Links:         strings.Fields(field("links")),
+		Labels:        decodeLabels(field("labels")),
+		Question:      field("question"),
+		Clarification: field("clarification"),
+	}
+}
+
+// readEntriesBetween loads the entries of every day from start to end inclusive, leaving out the trash
+func readEntriesBetween(ctx context.Context, start, end time.Time) ([]TimeEntry, error) {
+	_, span := startSpan(ctx, "storage.read_range", spanKindInternal)
+	span.SetAttribute("storage.from", start.Format("20060102"))
+	span.SetAttribute("storage.to", end.Format("20060102"))
+	defer span.End()
+
+	entries := []TimeEntry{}
+	from, to := entryDate(start), entryDate(end)
+
+	// Weekly and monthly files cover several days, read each file once
+	filenames := []string{}
+	fileDays := make(map[string]time.Time)
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		if filename := dataFilename(day); !slices.Contains(filenames, filename) {
+			filenames = append(filenames, filename)
+			fileDays[filename] = day
+		}
+	}
+
+	for _, filename := range filenames {
+		// Long ranges stop reading once the client has gone away
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		fileEntries, err := readEntries(filename)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+
+		for _, entry := range fileEntries {
+			// Undated entries predate the date column and always lived in daily files
+			if entry.Date == "" {
+				entry.Date = entryDate(fileDays[filename])
+			}
+			if entry.Date >= from && entry.Date <= to && entry.DeletedAt == "" {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// tagSeparator joins an entry's tags in the tags column
+const tagSeparator = ";"
+
+// splitTags parses the tags column
+func splitTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, tagSeparator) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// entryRecord converts an entry into a CSV record matching csvHeaders
+func entryRecord(entry TimeEntry) []string {
+	categorizedStr := "false"
+	if entry.Categorized {
+		categorizedStr = "true"
+	}
+
+	return []string{
+		entry.ID,
+		entry.Date,
+		entry.CreatedAt,
+		entry.Timespan,
+		entry.Description,
+		entry.Task,
+		entry.TaskReason,
+		entry.Jira,
+		entry.Confidence,
+		categorizedStr,
+		entry.User,
+		entry.InputHash,
+		entry.DeletedAt,
+		strings.Join(entry.Tags, tagSeparator),
+		// URLs can't contain unescaped spaces, so links are space separated
+		strings.Join(entry.Links, " "),
+		encodeLabels(entry.Labels),
+		entry.Question,
+		entry.Clarification,
+	}
+}
+
+// writeEntries replaces the contents of a CSV file with the given entries. The
+// entries are written to a temporary file renamed over the original, so a crash
+// mid-write leaves the previous contents intact.
+func writeEntries(filename string, entries []TimeEntry) error {
+	tmpName := filename + ".tmp"
+	file, err := os.Create(tmpName)
+	if err != nil {
+		return fmt.Errorf("couldn't open file: %v", err)
+	}
+	defer os.Remove(tmpName)
+	defer file.Close()
+
+	if err := writeSchemaStamp(file, currentSchemaVersion()); err != nil {
+		return fmt.Errorf("error writing schema version: %v", err)
+	}
+	writer := csv.NewWriter(file)
+	if err := writer.Write(csvHeaders); err != nil {
+		return fmt.Errorf("error writing headers: %v", err)
+	}
+
+	for _, entry := range entries {
+		if err := writer.Write(entryRecord(entry)); err != nil {
+			return fmt.Errorf("error writing record: %v", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing records: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("error syncing file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error closing file: %v", err)
+	}
+
+	if err := os.Rename(tmpName, filename); err != nil {
+		return err
+	}
+	cacheWrittenEntries(filename, entries)
+	aggregateWrittenEntries(filename, entries)
+	return nil
+}
+
+// updateEntry applies an update to the entry with the given ID and rewrites the day's file,
+// entries in the trash are not found
+func updateEntry(ctx context.Context, day time.Time, id string, update func(*TimeEntry)) (updated *TimeEntry, err error) {
+	_, span := startSpan(ctx, "storage.update_entry", spanKindInternal)
+	span.SetAttribute("storage.day", day.Format("20060102"))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	storageMu.Lock()
+	defer storageMu.Unlock()
+
+	filename := dataFilename(day)
+	entries, err := readEntries(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		if entries[i].ID == id && entries[i].DeletedAt == "" {
+			if err := checkWeekOpen(entryOwner(entries[i]), day); err != nil {
+				return nil, err
+			}
+			before := entries[i]
+			update(&entries[i])
+			if err := writeEntries(filename, entries); err != nil {
+				return nil, err
+			}
+			publishEvent(entryEvent(before, entries[i]), entries[i])
+			streamEntryChange(before, entries[i])
+			queueEntryEmbedding(entries[i])
+			return &entries[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("entry %s not found", id)
+}
+
+// upgradeHeaders rewrites a data file from an older schema or whose header row
+// differs from csvHeaders
+func upgradeHeaders(filename string) error {
+	version, headers, err := readDataHeader(filename)
+	if err != nil {
+		return err
+	}
+
+	if version == currentSchemaVersion() && slices.Equal(headers, csvHeaders) {
+		return nil
+	}
+
+	entries, err := readEntries(filename)
+	if err != nil {
+		return err
+	}
+
+	return writeEntries(filename, entries)
+}
+
+// readDataHeader reads a data file's schema version and header row without reading its entries
+func readDataHeader(filename string) (int, []string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, nil, fmt.Errorf("couldn't open file: %v", err)
+	}
+	defer file.Close()
+
+	buffered := bufio.NewReader(file)
+	version := 0
+	first, err := buffered.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, nil, fmt.Errorf("error reading headers: %v", err)
+	}
+	if stamp, found := strings.CutPrefix(first, schemaStampPrefix); found {
+		if version, err = strconv.Atoi(strings.TrimSpace(stamp)); err != nil {
+			return 0, nil, fmt.Errorf("invalid schema version line %q", strings.TrimSpace(first))
+		}
+		if first, err = buffered.ReadString('\n'); err != nil && err != io.EOF {
+			return 0, nil, fmt.Errorf("error reading headers: %v", err)
+		}
+	}
+
+	headers, err := csv.NewReader(strings.NewReader(first)).Read()
+	if err != nil && err != io.EOF {
+		return 0, nil, fmt.Errorf("error reading headers: %v", err)
+	}
+	return version, headers, nil
+}
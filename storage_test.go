@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadDataFileQuarantinesMalformedFirstField(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "aidea_time_tracking_20261015.csv")
+	data := "# aidea schema 3\n" +
+		"id,date,timespan,description\n" +
+		"a1,2026-10-15,30m,standup\n" +
+		"ab\"c,x\n" +
+		"a2,2026-10-15,1h,review\n" +
+		"\"a3,2026-10-15,1h,unterminated\n"
+	if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	version, headers, rows, err := readDataFile(filename)
+	if err != nil {
+		t.Fatalf("readDataFile: %v", err)
+	}
+	if version != 3 {
+		t.Errorf("version = %d, want 3", version)
+	}
+	if len(headers) != 4 {
+		t.Errorf("headers = %v, want 4 columns", headers)
+	}
+	if len(rows) != 2 || rows[0][0] != "a1" || rows[1][0] != "a2" {
+		t.Errorf("rows = %v, want a1 and a2", rows)
+	}
+
+	quarantined, err := os.ReadFile(errorsFilename(filename))
+	if err != nil {
+		t.Fatalf("reading errors file: %v", err)
+	}
+	if !strings.Contains(string(quarantined), "ab\"c,x") {
+		t.Errorf("errors file doesn't hold the malformed row:\n%s", quarantined)
+	}
+}
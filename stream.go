@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const outboxFile = "aidea_outbox.jsonl"
+
+// streamSchema versions StreamEntry, consumers should reject versions they don't know
+const streamSchema = "aidea.entry/v1"
+
+// StreamConfig sends categorized entries to a Kafka topic or NATS subject for
+// central aggregation. Records wait in a local outbox until the broker has
+// acknowledged them, so delivery is at least once: a record may be sent again
+// after a crash or a lost acknowledgement, and consumers should dedupe by ID.
+type StreamConfig struct {
+	// Type is nats or kafka, empty disables the stream
+	Type string `json:"type"`
+	// URL is the NATS server (nats://host:4222) or the Kafka REST proxy
+	URL string `json:"url"`
+	// Subject prefixes the NATS subject, records go to "<subject>.entry.categorized"
+	// and "<subject>.entry.deleted"
+	Subject string `json:"subject,omitempty"`
+	Topic   string `json:"topic,omitempty"`
+	// RetrySeconds is the wait before retrying after the broker can't be reached
+	RetrySeconds int `json:"retry_seconds"`
+}
+
+// StreamEntry is the streamed record schema. Each record is the full current
+// state of the entry, so consumers can upsert by EntryID and drop deleted ones.
+//
+//	{
+//	  "schema": "aidea.entry/v1",
+//	  "entry_id": "…", "user": "alice", "date": "2026-10-15",
+//	  "timespan": "1h 30m", "minutes": 90,
+//	  "description": "…", "task": "Development", "jira": "ABC-12",
+//	  "confidence": "high", "tags": ["billable"], "links": ["https://…"],
+//	  "deleted": false, "changed_at": "2026-10-15T09:00:00Z"
+//	}
+//
+// Records are wrapped in the event envelope ({"id", "type", "time", "data"}),
+// the envelope ID is unique per record and the type is entry.categorized or entry.deleted.
+type StreamEntry struct {
+	Schema      string    `json:"schema"`
+	EntryID     string    `json:"entry_id"`
+	User        string    `json:"user"`
+	Date        string    `json:"date"`
+	Timespan    string    `json:"timespan"`
+	Minutes     int       `json:"minutes"`
+	Description string    `json:"description"`
+	Task        string    `json:"task"`
+	Jira        string    `json:"jira,omitempty"`
+	Confidence  string    `json:"confidence,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Links       []string  `json:"links,omitempty"`
+	Deleted     bool      `json:"deleted"`
+	ChangedAt   time.Time `json:"changed_at"`
+	// Labels are the entry's further categories in multi-label mode
+	Labels []EntryLabel `json:"labels,omitempty"`
+}
+
+// entryStream delivers the outbox to the broker in order
+type entryStream struct {
+	sink  EventSink
+	retry time.Duration
+	// wake is signalled when a record is added to the outbox
+	wake chan struct{}
+}
+
+var (
+	outboxMu sync.Mutex
+	stream   *entryStream
+)
+
+// newStreamSink creates the broker sink of the entry stream, nil when streaming is off
+func newStreamSink(config StreamConfig) (EventSink, error) {
+	if config.Type == "" {
+		return nil, nil
+	}
+	if config.Type != SinkNATS && config.Type != SinkKafka {
+		return nil, fmt.Errorf("unknown stream type %q, expected nats or kafka", config.Type)
+	}
+
+	return newEventSink(EventSinkConfig{
+		Type:    config.Type,
+		URL:     config.URL,
+		Subject: config.Subject,
+		Topic:   config.Topic,
+	})
+}
+
+// startEntryStream creates the broker sink and starts draining the outbox,
+// including records left over from a previous run
+func startEntryStream(config StreamConfig) error {
+	sink, err := newStreamSink(config)
+	if err != nil || sink == nil {
+		return err
+	}
+
+	retry := time.Duration(config.RetrySeconds) * time.Second
+	if retry <= 0 {
+		retry = 30 * time.Second
+	}
+
+	stream = &entryStream{sink: sink, retry: retry, wake: make(chan struct{}, 1)}
+	go stream.run()
+	log.Printf("Streaming categorized entries to %s", config.Type)
+	return nil
+}
+
+// streamEntryChange adds a record to the outbox when a change affects a
+// categorized entry. It's called after the change has been saved.
+func streamEntryChange(before, after TimeEntry) {
+	if stream == nil || (!before.Categorized && !after.Categorized) {
+		return
+	}
+
+	eventType := EventEntryCategorized
+	if after.DeletedAt != "" {
+		// Entries that were never categorized weren't streamed, so there's nothing to delete
+		if !before.Categorized {
+			return
+		}
+		eventType = EventEntryDeleted
+	}
+
+	date := after.Date
+	if date == "" {
+		date = after.CreatedAt
+	}
+
+	record := Event{
+		ID:   uuid.New().String(),
+		Type: eventType,
+		Time: time.Now().UTC(),
+		Data: StreamEntry{
+			Schema:      streamSchema,
+			EntryID:     after.ID,
+			User:        entryOwner(after),
+			Date:        date,
+			Timespan:    after.Timespan,
+			Minutes:     entryMinutes(after),
+			Description: after.Description,
+			Task:        after.Task,
+			Jira:        after.Jira,
+			Confidence:  after.Confidence,
+			Tags:        after.Tags,
+			Links:       after.Links,
+			Labels:      after.Labels,
+			Deleted:     after.DeletedAt != "",
+			ChangedAt:   time.Now().UTC(),
+		},
+	}
+
+	if err := appendOutbox(record); err != nil {
+		log.Printf("Error adding entry %s to the outbox: %v", after.ID, err)
+		return
+	}
+
+	select {
+	case stream.wake <- struct{}{}:
+	default:
+	}
+}
+
+func appendOutbox(record Event) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+
+	file, err := os.OpenFile(outboxFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	// The record must survive a crash before the change counts as streamed
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// readOutbox returns the raw records waiting in the outbox, callers must hold outboxMu
+func readOutbox() ([][]byte, error) {
+	data, err := os.ReadFile(outboxFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records := [][]byte{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			records = append(records, append([]byte{}, line...))
+		}
+	}
+	return records, scanner.Err()
+}
+
+// dropOutbox removes the first n records, which the broker has acknowledged
+func dropOutbox(n int) error {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+
+	records, err := readOutbox()
+	if err != nil {
+		return err
+	}
+	remaining := records[min(n, len(records)):]
+	if len(remaining) == 0 {
+		return os.Remove(outboxFile)
+	}
+
+	tmpName := outboxFile + ".tmp"
+	if err := os.WriteFile(tmpName, append(bytes.Join(remaining, []byte("\n")), '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, outboxFile)
+}
+
+// flush sends the outbox in order, stopping at the first failure so records
+// aren't reordered. It returns whether the outbox was emptied.
+func (s *entryStream) flush() bool {
+	outboxMu.Lock()
+	records, err := readOutbox()
+	outboxMu.Unlock()
+	if err != nil {
+		log.Printf("Error reading the outbox: %v", err)
+		return false
+	}
+
+	sent := 0
+	defer func() {
+		if sent > 0 {
+			if err := dropOutbox(sent); err != nil {
+				log.Printf("Error removing streamed records from the outbox: %v", err)
+			}
+		}
+	}()
+
+	for _, line := range records {
+		// The data is kept as written so records are sent exactly as they were queued
+		var record struct {
+			ID   string          `json:"id"`
+			Type string          `json:"type"`
+			Time time.Time       `json:"time"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(line, &record); err != nil {
+			// A damaged record would block the stream forever
+			log.Printf("Dropping unreadable outbox record: %v", err)
+			sent++
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), sinkTimeout)
+		err := s.sink.Send(ctx, Event{ID: record.ID, Type: record.Type, Time: record.Time, Data: record.Data})
+		cancel()
+		if err != nil {
+			log.Printf("Error streaming entries, %d waiting in the outbox: %v", len(records)-sent, err)
+			return false
+		}
+		sent++
+	}
+	return true
+}
+
+func (s *entryStream) run() {
+	for {
+		if s.flush() {
+			<-s.wake
+			continue
+		}
+
+		// Retry after a while, or sooner if new records arrive
+		select {
+		case <-s.wake:
+		case <-time.After(s.retry):
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timespanPartPattern = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*(hours|hour|hrs|hr|h|minutes|minute|mins|min|m)`)
+
+// parseTimespan converts timespans like "45m", "1h30m", "1.5 hours" or "1:30" into a duration
+func parseTimespan(timespan string) (time.Duration, error) {
+	value := strings.ToLower(strings.TrimSpace(timespan))
+	if value == "" {
+		return 0, fmt.Errorf("empty timespan")
+	}
+
+	// Clock style "1:30"
+	if hours, minutes, found := strings.Cut(value, ":"); found {
+		h, errH := strconv.Atoi(hours)
+		m, errM := strconv.Atoi(minutes)
+		if errH != nil || errM != nil {
+			return 0, fmt.Errorf("invalid timespan: %s", timespan)
+		}
+		return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+	}
+
+	// A bare number is treated as minutes
+	if minutes, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(minutes * float64(time.Minute)), nil
+	}
+
+	matches := timespanPartPattern.FindAllStringSubmatch(value, -1)
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("invalid timespan: %s", timespan)
+	}
+
+	var total time.Duration
+	for _, match := range matches {
+		amount, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timespan: %s", timespan)
+		}
+		if strings.HasPrefix(match[2], "h") {
+			total += time.Duration(amount * float64(time.Hour))
+		} else {
+			total += time.Duration(amount * float64(time.Minute))
+		}
+	}
+
+	return total, nil
+}
+
+// DailySummary aggregates a day's entries
+type DailySummary struct {
+	Date             string         `json:"date"`
+	TotalEntries     int            `json:"total_entries"`
+	CategorizedCount int            `json:"categorized_count"`
+	TotalMinutes     int            `json:"total_minutes"`
+	MinutesByTask    map[string]int `json:"minutes_by_task"`
+	MinutesByEpic    map[string]int `json:"minutes_by_epic,omitempty"`
+	// Categories holds the color and icon of the styled tasks in MinutesByTask
+	Categories    map[string]CategoryStyle `json:"categories,omitempty"`
+	PomodoroCount int                      `json:"pomodoro_count"`
+	Errors        []string                 `json:"errors,omitempty"`
+}
+
+// summarizeDay totals a user's entries of a day by task from its daily aggregate,
+// an empty user totals every user's
+func summarizeDay(ctx context.Context, day time.Time, user string) (*DailySummary, error) {
+	_, span := startSpan(ctx, "storage.read_day", spanKindInternal)
+	span.SetAttribute("storage.day", day.Format("20060102"))
+	aggregate, err := dailyAggregate(day)
+	if err != nil {
+		span.RecordError(err)
+		span.End()
+		return nil, fmt.Errorf("error reading entries: %v", err)
+	}
+	span.End()
+	aggregate = aggregate.forUser(user)
+
+	summary := &DailySummary{
+		Date:             day.Format("20060102"),
+		TotalEntries:     aggregate.Entries,
+		CategorizedCount: aggregate.Categorized,
+		TotalMinutes:     aggregate.TotalMinutes(),
+		MinutesByTask:    make(map[string]int),
+	}
+
+	// Epic rollups need the Jira integration to look up each issue's parent
+	var epics *epicRollup
+	if jiraConfigured() {
+		epics = newEpicRollup()
+	}
+
+	for key, minutes := range aggregate.shares(ctx) {
+		task, _ := canonicalCategory(key.Task)
+		if task == "" {
+			task = "Uncategorized"
+		}
+		summary.MinutesByTask[task] += minutes
+
+		if epics != nil {
+			epics.add(ctx, key.Jira, minutes)
+		}
+	}
+
+	tasks := make([]string, 0, len(summary.MinutesByTask))
+	for task := range summary.MinutesByTask {
+		tasks = append(tasks, task)
+	}
+	summary.Categories = categoryStyles(tasks)
+
+	if epics != nil {
+		summary.MinutesByEpic = epics.minutes
+		summary.Errors = epics.errors
+	}
+
+	summary.PomodoroCount, err = countPomodoros(day, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// formatSummary renders a summary as plain text for chat integrations
+func formatSummary(summary *DailySummary) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "Summary for %s\n", summary.Date)
+	fmt.Fprintf(&builder, "Entries: %d (%d categorized)\n", summary.TotalEntries, summary.CategorizedCount)
+	fmt.Fprintf(&builder, "Total: %dh%02dm\n", summary.TotalMinutes/60, summary.TotalMinutes%60)
+
+	tasks := make([]string, 0, len(summary.MinutesByTask))
+	for task := range summary.MinutesByTask {
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return summary.MinutesByTask[tasks[i]] > summary.MinutesByTask[tasks[j]]
+	})
+	for _, task := range tasks {
+		label := task
+		if icon := summary.Categories[task].Icon; icon != "" {
+			label = icon + " " + task
+		}
+		fmt.Fprintf(&builder, "- %s: %dm\n", label, summary.MinutesByTask[task])
+	}
+
+	if len(summary.MinutesByEpic) > 0 {
+		epics := make([]string, 0, len(summary.MinutesByEpic))
+		for epic := range summary.MinutesByEpic {
+			epics = append(epics, epic)
+		}
+		sort.Slice(epics, func(i, j int) bool {
+			return summary.MinutesByEpic[epics[i]] > summary.MinutesByEpic[epics[j]]
+		})
+		fmt.Fprintf(&builder, "By epic:\n")
+		for _, epic := range epics {
+			fmt.Fprintf(&builder, "- %s: %dm\n", epic, summary.MinutesByEpic[epic])
+		}
+	}
+
+	if summary.PomodoroCount > 0 {
+		fmt.Fprintf(&builder, "Pomodoros: %d\n", summary.PomodoroCount)
+	}
+
+	return builder.String()
+}
+
+// summaryUser returns the user a summary request covers: the current user, or
+// every user ("") when an admin passes ?all_users=true
+func summaryUser(r *http.Request) (string, bool) {
+	user := currentUser(r)
+	if r.URL.Query().Get("all_users") != "true" {
+		return user.Name, true
+	}
+	return "", user.HasRole(RoleAdmin)
+}
+
+func summaryHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	user, ok := summaryUser(r)
+	if !ok {
+		writeError(w, r, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	// Default to today, or use the date query parameter (YYYYMMDD)
+	location := userLocation(currentUser(r).Name)
+	day := time.Now().In(location)
+	if dateParam := r.URL.Query().Get("date"); dateParam != "" {
+		parsed, err := time.ParseInLocation("20060102", dateParam, location)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "date must be in YYYYMMDD format")
+			return
+		}
+		day = parsed
+	}
+
+	// ?format= overrides the user's preferred report format
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = userPreferences(currentUser(r).Name).ReportFormat
+	}
+	if format != "" && format != "json" && format != "text" {
+		writeValidationError(w, r, ErrorDetail{Field: "format", Message: "format must be one of json, text"})
+		return
+	}
+
+	ctx, details := attributionContext(r)
+	if len(details) > 0 {
+		writeValidationError(w, r, details...)
+		return
+	}
+
+	summary, err := summarizeDay(ctx, day, user)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if format == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, formatSummary(summary))
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
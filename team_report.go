@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// TeamReport aggregates every user's time over a date range
+type TeamReport struct {
+	From         string                    `json:"from"`
+	To           string                    `json:"to"`
+	TotalMinutes int                       `json:"total_minutes"`
+	ByPerson     map[string]int            `json:"by_person"`
+	ByProject    map[string]int            `json:"by_project"`
+	ByEpic       map[string]int            `json:"by_epic,omitempty"`
+	People       map[string]map[string]int `json:"people"`
+	Errors       []string                  `json:"errors,omitempty"`
+}
+
+// parseDateRange reads from/to (YYYYMMDD) query parameters, defaulting to the current week
+func parseDateRange(r *http.Request) (time.Time, time.Time, error) {
+	location := userLocation(currentUser(r).Name)
+	from := weekStart(time.Now().In(location))
+	to := from.AddDate(0, 0, 6)
+
+	if value := r.URL.Query().Get("from"); value != "" {
+		parsed, err := time.ParseInLocation("20060102", value, location)
+		if err != nil {
+			return from, to, fmt.Errorf("from must be in YYYYMMDD format")
+		}
+		from = parsed
+	}
+
+	if value := r.URL.Query().Get("to"); value != "" {
+		parsed, err := time.ParseInLocation("20060102", value, location)
+		if err != nil {
+			return from, to, fmt.Errorf("to must be in YYYYMMDD format")
+		}
+		to = parsed
+	}
+
+	if to.Before(from) {
+		return from, to, fmt.Errorf("to must not be before from")
+	}
+
+	return from, to, nil
+}
+
+// entryMinutes returns an entry's duration in minutes rounded by its owner's
+// preferences, or 0 if it can't be parsed
+func entryMinutes(entry TimeEntry) int {
+	duration, err := parseTimespan(entry.Timespan)
+	if err != nil {
+		return 0
+	}
+	return roundMinutes(entryOwner(entry), int(duration.Minutes()))
+}
+
+func teamReportHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx, details := attributionContext(r)
+	if len(details) > 0 {
+		writeValidationError(w, r, details...)
+		return
+	}
+
+	entries, err := readEntriesBetween(r.Context(), from, to)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error reading entries: %v", err))
+		return
+	}
+
+	report := TeamReport{
+		From:      from.Format("20060102"),
+		To:        to.Format("20060102"),
+		ByPerson:  make(map[string]int),
+		ByProject: make(map[string]int),
+		People:    make(map[string]map[string]int),
+	}
+	var epics *epicRollup
+	if jiraConfigured() {
+		epics = newEpicRollup()
+	}
+
+	for _, entry := range entries {
+		minutes := entryMinutes(entry)
+		if minutes == 0 {
+			continue
+		}
+
+		person := entryOwner(entry)
+		report.TotalMinutes += minutes
+		report.ByPerson[person] += minutes
+		if report.People[person] == nil {
+			report.People[person] = make(map[string]int)
+		}
+
+		for _, share := range attributeMinutes(ctx, entry, minutes) {
+			project := jiraProject(share.Jira)
+			if project == "" {
+				project = "No project"
+			}
+			report.ByProject[project] += share.Minutes
+			report.People[person][project] += share.Minutes
+
+			if epics != nil {
+				epics.add(r.Context(), share.Jira, share.Minutes)
+			}
+		}
+	}
+
+	if epics != nil {
+		report.ByEpic = epics.minutes
+		report.Errors = epics.errors
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	teamsMentionPattern = regexp.MustCompile(`(?s)<at>.*?</at>`)
+	teamsTagPattern     = regexp.MustCompile(`<[^>]+>`)
+)
+
+// TeamsConfig holds the Microsoft Teams webhook settings
+type TeamsConfig struct {
+	// WebhookURL is the incoming webhook the daily summary card is posted to
+	WebhookURL string `json:"webhook_url"`
+	// OutgoingSecret is the base64 security token of the Teams outgoing webhook
+	OutgoingSecret string `json:"outgoing_secret"`
+	// SummaryTime is the local time (HH:MM) the daily summary is posted
+	SummaryTime string `json:"summary_time"`
+	// SenderUsers maps a sender's Azure AD object ID to the user their entries belong
+	// to, unmapped senders log as the local user
+	SenderUsers map[string]string `json:"sender_users,omitempty"`
+}
+
+// teamsActivity is the subset of the Bot Framework activity sent by outgoing webhooks
+type teamsActivity struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+	From struct {
+		Name        string `json:"name"`
+		AADObjectID string `json:"aadObjectId"`
+	} `json:"from"`
+}
+
+// verifyTeamsSignature checks the HMAC Teams sends in the Authorization header
+func verifyTeamsSignature(secret string, body []byte, header string) bool {
+	signature, found := strings.CutPrefix(header, "HMAC ")
+	if !found {
+		return false
+	}
+
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// teamsMessageText strips the bot mention and HTML markup from a Teams message
+func teamsMessageText(text string) string {
+	text = teamsMentionPattern.ReplaceAllString(text, "")
+	text = teamsTagPattern.ReplaceAllString(text, " ")
+	text = strings.ReplaceAll(text, "&nbsp;", " ")
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func writeTeamsReply(w http.ResponseWriter, text string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"type": "message",
+		"text": text,
+	})
+}
+
+func teamsMessageHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	if !verifyTeamsSignature(currentConfig().Teams.OutgoingSecret, body, r.Header.Get("Authorization")) {
+		writeError(w, r, http.StatusUnauthorized, "Invalid signature")
+		return
+	}
+
+	// Parse JSON request
+	var activity teamsActivity
+	err = json.Unmarshal(body, &activity)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+		return
+	}
+
+	user := currentConfig().Teams.SenderUsers[activity.From.AADObjectID]
+	text := teamsMessageText(activity.Text)
+	switch {
+	case text == "" || strings.EqualFold(text, "help"):
+		writeTeamsReply(w, "Send what you worked on, e.g. \"fixed auth bug 45m\", or \"report\" for today's summary.")
+		return
+	case strings.EqualFold(text, "report"):
+		summary, err := summarizeDay(r.Context(), storageToday(), entryOwner(TimeEntry{User: user}))
+		if err != nil {
+			writeTeamsReply(w, "Error building report: "+err.Error())
+			return
+		}
+		writeTeamsReply(w, strings.ReplaceAll(formatSummary(summary), "\n", "<br>"))
+		return
+	}
+
+	entry, err := logMessageEntry(r.Context(), text, user)
+	if err != nil {
+		writeTeamsReply(w, "Error logging entry: "+err.Error())
+		return
+	}
+
+	switch {
+	case entry.Task == "":
+		writeTeamsReply(w, fmt.Sprintf("Logged \"%s\", it will be categorized later.", entry.Description))
+	case entry.Categorized:
+		writeTeamsReply(w, fmt.Sprintf("Logged \"%s\" as %s %s (%s)", entry.Description, entry.Task, entry.Jira, entry.Timespan))
+	default:
+		writeTeamsReply(w, fmt.Sprintf("Logged \"%s\". Best guess: %s %s (%s confidence), review it before submitting.", entry.Description, entry.Task, entry.Jira, entry.Confidence))
+	}
+}
+
+// summaryCard builds an Adaptive Card message for an incoming webhook
+func summaryCard(summary *DailySummary) map[string]interface{} {
+	tasks := make([]string, 0, len(summary.MinutesByTask))
+	for task := range summary.MinutesByTask {
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return summary.MinutesByTask[tasks[i]] > summary.MinutesByTask[tasks[j]]
+	})
+
+	facts := []map[string]string{}
+	for _, task := range tasks {
+		facts = append(facts, map[string]string{
+			"title": task,
+			"value": fmt.Sprintf("%dm", summary.MinutesByTask[task]),
+		})
+	}
+
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{
+			{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]interface{}{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body": []map[string]interface{}{
+						{
+							"type":   "TextBlock",
+							"size":   "Medium",
+							"weight": "Bolder",
+							"text":   "Time summary for " + summary.Date,
+						},
+						{
+							"type": "TextBlock",
+							"wrap": true,
+							"text": fmt.Sprintf("%d entries (%d categorized), %dh%02dm total", summary.TotalEntries, summary.CategorizedCount, summary.TotalMinutes/60, summary.TotalMinutes%60),
+						},
+						{
+							"type":  "FactSet",
+							"facts": facts,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// postTeamsSummary sends the day's summary card of every user to the configured incoming webhook
+func postTeamsSummary(day time.Time) error {
+	summary, err := summarizeDay(context.Background(), day, "")
+	if err != nil {
+		return err
+	}
+
+	return postTeams(summaryCard(summary))
+}
+
+// postTeams sends a message payload to the configured incoming webhook
+func postTeams(payload interface{}) error {
+	requestData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshalling message: %w", err)
+	}
+
+	resp, err := http.Post(currentConfig().Teams.WebhookURL, "application/json", bytes.NewBuffer(requestData))
+	if err != nil {
+		return fmt.Errorf("error sending message to Teams: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		responseBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Teams webhook returned error: %s - %s", resp.Status, string(responseBody))
+	}
+
+	return nil
+}
+
+// nextDailyRun returns the next occurrence of an HH:MM local time after now
+func nextDailyRun(now time.Time, clock string) (time.Time, error) {
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+
+	next := time.Date(now.Year(), now.Month(), now.Day(), parsed.Hour(), parsed.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next, nil
+}
+
+// startTeamsSummaryScheduler posts the summary card every day at the configured time
+func startTeamsSummaryScheduler(config TeamsConfig) {
+	if _, err := nextDailyRun(time.Now(), config.SummaryTime); err != nil {
+		log.Printf("Teams summary disabled: %v", err)
+		return
+	}
+
+	go func() {
+		for {
+			next, _ := nextDailyRun(time.Now(), config.SummaryTime)
+			time.Sleep(time.Until(next))
+
+			if err := postTeamsSummary(next); err != nil {
+				log.Printf("Error posting Teams summary: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const telegramAPIURL = "https://api.telegram.org/bot%s/%s"
+
+// TelegramConfig holds the bot token and the chats allowed to log time. Without
+// allowed chats the bot answers no one.
+type TelegramConfig struct {
+	BotToken       string  `json:"bot_token"`
+	AllowedChatIDs []int64 `json:"allowed_chat_ids"`
+	// ChatUsers maps a chat to the user its entries belong to, chats without one log as the local user
+	ChatUsers map[int64]string `json:"chat_users,omitempty"`
+}
+
+type telegramUpdate struct {
+	UpdateID      int64                  `json:"update_id"`
+	Message       *telegramMessage       `json:"message"`
+	CallbackQuery *telegramCallbackQuery `json:"callback_query"`
+}
+
+type telegramMessage struct {
+	MessageID int64  `json:"message_id"`
+	Text      string `json:"text"`
+	Chat      struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+}
+
+type telegramCallbackQuery struct {
+	ID      string           `json:"id"`
+	Data    string           `json:"data"`
+	Message *telegramMessage `json:"message"`
+}
+
+type telegramInlineButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+// telegramBot long-polls the Bot API and turns messages into entries
+type telegramBot struct {
+	token  string
+	client *http.Client
+	// chatUsers maps a chat to the user name its entries are logged under
+	chatUsers map[int64]string
+
+	mu sync.Mutex
+	// corrections maps a chat to the entry waiting for a corrected task
+	corrections map[int64]string
+}
+
+func startTelegramBot(config TelegramConfig) {
+	bot := &telegramBot{
+		token:       config.BotToken,
+		client:      &http.Client{Timeout: 60 * time.Second},
+		chatUsers:   config.ChatUsers,
+		corrections: make(map[int64]string),
+	}
+
+	if len(config.AllowedChatIDs) == 0 {
+		log.Println("Warning: telegram.allowed_chat_ids is empty, the bot ignores every chat until chats are allowed")
+	}
+	log.Println("Telegram bot listening for updates...")
+	go bot.poll(config.AllowedChatIDs)
+}
+
+// call invokes a Bot API method and decodes the result field
+func (b *telegramBot) call(method string, payload interface{}, result interface{}) error {
+	requestData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshalling request: %w", err)
+	}
+
+	resp, err := b.client.Post(fmt.Sprintf(telegramAPIURL, b.token, method), "application/json", bytes.NewBuffer(requestData))
+	if err != nil {
+		return fmt.Errorf("error sending request to Telegram: %w", err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+
+	var envelope struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(responseBody, &envelope); err != nil {
+		return fmt.Errorf("error decoding Telegram response: %w", err)
+	}
+	if !envelope.OK {
+		return fmt.Errorf("Telegram API returned error: %s", envelope.Description)
+	}
+
+	if result != nil {
+		return json.Unmarshal(envelope.Result, result)
+	}
+	return nil
+}
+
+func (b *telegramBot) poll(allowedChatIDs []int64) {
+	allowed := make(map[int64]bool)
+	for _, id := range allowedChatIDs {
+		allowed[id] = true
+	}
+
+	var offset int64
+	for {
+		var updates []telegramUpdate
+		err := b.call("getUpdates", map[string]interface{}{
+			"offset":  offset,
+			"timeout": 50,
+		}, &updates)
+		if err != nil {
+			log.Printf("Error polling Telegram: %v", err)
+			time.Sleep(10 * time.Second)
+			continue
+		}
+
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+
+			var chatID int64
+			switch {
+			case update.Message != nil:
+				chatID = update.Message.Chat.ID
+			case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+				chatID = update.CallbackQuery.Message.Chat.ID
+			default:
+				continue
+			}
+
+			// Only allowed chats may use the bot, an empty allow-list admits none
+			if !allowed[chatID] {
+				log.Printf("Ignoring Telegram chat %d, it isn't in telegram.allowed_chat_ids", chatID)
+				continue
+			}
+
+			if update.CallbackQuery != nil {
+				b.handleCallback(chatID, update.CallbackQuery)
+			} else {
+				b.handleMessage(chatID, strings.TrimSpace(update.Message.Text))
+			}
+		}
+	}
+}
+
+func (b *telegramBot) send(chatID int64, text string, buttons []telegramInlineButton) {
+	payload := map[string]interface{}{
+		"chat_id": chatID,
+		"text":    text,
+	}
+	if len(buttons) > 0 {
+		payload["reply_markup"] = map[string]interface{}{
+			"inline_keyboard": [][]telegramInlineButton{buttons},
+		}
+	}
+
+	if err := b.call("sendMessage", payload, nil); err != nil {
+		log.Printf("Error sending Telegram message: %v", err)
+	}
+}
+
+func (b *telegramBot) handleMessage(chatID int64, text string) {
+	if text == "" {
+		return
+	}
+
+	switch {
+	case text == "/start" || text == "/help":
+		b.send(chatID, "Send what you worked on, e.g. \"fixed auth bug 45m\". Use /report for today's summary.", nil)
+		return
+	case strings.HasPrefix(text, "/report"):
+		summary, err := summarizeDay(context.Background(), storageToday(), b.chatOwner(chatID))
+		if err != nil {
+			b.send(chatID, "Error building report: "+err.Error(), nil)
+			return
+		}
+		b.send(chatID, formatSummary(summary), nil)
+		return
+	}
+
+	// A pending correction turns the next message into the corrected task
+	b.mu.Lock()
+	entryID, correcting := b.corrections[chatID]
+	delete(b.corrections, chatID)
+	b.mu.Unlock()
+
+	if correcting {
+		v := &validator{}
+		v.text("task", text, true, maxTaskLength)
+		if len(v.details) > 0 {
+			b.send(chatID, "Invalid task: "+v.details[0].Message, nil)
+			return
+		}
+
+		entry, err := updateEntry(context.Background(), storageToday(), entryID, func(e *TimeEntry) {
+			e.Task = text
+			e.TaskReason = "Corrected via Telegram"
+			e.InputHash = ""
+			e.Categorized = true
+		})
+		if err != nil {
+			b.send(chatID, "Error saving correction: "+err.Error(), nil)
+			return
+		}
+		b.send(chatID, fmt.Sprintf("Updated: %s → %s", entry.Description, entry.Task), nil)
+		return
+	}
+
+	entry, err := logMessageEntry(context.Background(), text, b.chatUsers[chatID])
+	if err != nil {
+		b.send(chatID, "Error logging entry: "+err.Error(), nil)
+		return
+	}
+
+	switch {
+	case entry.Task == "":
+		b.send(chatID, fmt.Sprintf("Logged \"%s\", it will be categorized later.", entry.Description), nil)
+	case entry.Categorized:
+		b.send(chatID, fmt.Sprintf("Logged \"%s\" as %s %s (%s)", entry.Description, entry.Task, entry.Jira, entry.Timespan), nil)
+	default:
+		b.send(chatID, fmt.Sprintf("Logged \"%s\". Best guess: %s %s (%s confidence)", entry.Description, entry.Task, entry.Jira, entry.Confidence),
+			[]telegramInlineButton{
+				{Text: "Accept", CallbackData: "accept:" + entry.ID},
+				{Text: "Correct", CallbackData: "correct:" + entry.ID},
+			})
+	}
+}
+
+// chatOwner returns the name of the user a chat acts as
+func (b *telegramBot) chatOwner(chatID int64) string {
+	return entryOwner(TimeEntry{User: b.chatUsers[chatID]})
+}
+
+// ownsEntry reports whether an entry of today was logged by the chat's user
+func (b *telegramBot) ownsEntry(chatID int64, entryID string) bool {
+	entries, err := readDayEntries(storageToday())
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if entry.ID == entryID && entry.DeletedAt == "" {
+			return entry.User == b.chatUsers[chatID]
+		}
+	}
+	return false
+}
+
+func (b *telegramBot) handleCallback(chatID int64, query *telegramCallbackQuery) {
+	if err := b.call("answerCallbackQuery", map[string]string{"callback_query_id": query.ID}, nil); err != nil {
+		log.Printf("Error answering Telegram callback: %v", err)
+	}
+
+	action, entryID, found := strings.Cut(query.Data, ":")
+	if !found {
+		return
+	}
+
+	// Chats only act on the entries their user logged
+	if !b.ownsEntry(chatID, entryID) {
+		b.send(chatID, "That entry wasn't found among today's entries.", nil)
+		return
+	}
+
+	switch action {
+	case "accept":
+		entry, err := updateEntry(context.Background(), storageToday(), entryID, func(e *TimeEntry) {
+			e.Categorized = true
+		})
+		if err != nil {
+			b.send(chatID, "Error accepting categorization: "+err.Error(), nil)
+			return
+		}
+		b.send(chatID, fmt.Sprintf("Accepted: %s → %s", entry.Description, entry.Task), nil)
+	case "correct":
+		b.mu.Lock()
+		b.corrections[chatID] = entryID
+		b.mu.Unlock()
+		b.send(chatID, "Reply with the correct task for this entry.", nil)
+	}
+}
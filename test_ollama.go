@@ -1,4 +1,4 @@
-// Build with: go build -o test_ollama test_ollama.go ollama_api.go
+// Build with: go build -o test_ollama . (main.go runs TestCategorize when invoked as test_ollama)
 //go:build ignore
 // +build ignore
 
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const timesheetsFile = "aidea_timesheets.json"
+
+// Timesheet statuses
+const (
+	TimesheetSubmitted = "submitted"
+	TimesheetApproved  = "approved"
+	TimesheetRejected  = "rejected"
+)
+
+// errWeekFrozen is returned when changing entries in a submitted or approved week
+var errWeekFrozen = errors.New("entries for this week are frozen by a submitted timesheet")
+
+// Timesheet is a user's week of entries submitted for review
+type Timesheet struct {
+	User        string             `json:"user"`
+	Week        string             `json:"week"` // Monday of the week, YYYYMMDD
+	Status      string             `json:"status"`
+	SubmittedAt time.Time          `json:"submitted_at"`
+	ReviewedBy  string             `json:"reviewed_by,omitempty"`
+	ReviewedAt  *time.Time         `json:"reviewed_at,omitempty"`
+	Comments    []TimesheetComment `json:"comments"`
+}
+
+// TimesheetComment is a note left by the submitter or a reviewer
+type TimesheetComment struct {
+	Author string    `json:"author"`
+	At     time.Time `json:"at"`
+	Text   string    `json:"text"`
+}
+
+// TimesheetRequest represents the JSON request for submitting or reviewing a timesheet
+type TimesheetRequest struct {
+	Week    string `json:"week,omitempty"`
+	Comment string `json:"comment,omitempty"`
+}
+
+var timesheetsMu sync.Mutex
+
+// weekStart returns the Monday starting the week containing day
+func weekStart(day time.Time) time.Time {
+	offset := (int(day.Weekday()) + 6) % 7
+	return time.Date(day.Year(), day.Month(), day.Day()-offset, 0, 0, 0, 0, day.Location())
+}
+
+func weekKey(day time.Time) string {
+	return weekStart(day).Format("20060102")
+}
+
+func readTimesheets() ([]Timesheet, error) {
+	data, err := os.ReadFile(timesheetsFile)
+	if os.IsNotExist(err) {
+		return []Timesheet{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read timesheets: %v", err)
+	}
+
+	var timesheets []Timesheet
+	if err := json.Unmarshal(data, &timesheets); err != nil {
+		return nil, fmt.Errorf("couldn't parse timesheets: %v", err)
+	}
+
+	return timesheets, nil
+}
+
+func writeTimesheets(timesheets []Timesheet) error {
+	data, err := json.MarshalIndent(timesheets, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't encode timesheets: %v", err)
+	}
+
+	return os.WriteFile(timesheetsFile, data, 0644)
+}
+
+// findTimesheet returns the timesheet for a user and week, if one was submitted
+func findTimesheet(user string, day time.Time) (*Timesheet, error) {
+	timesheetsMu.Lock()
+	defer timesheetsMu.Unlock()
+
+	timesheets, err := readTimesheets()
+	if err != nil {
+		return nil, err
+	}
+
+	week := weekKey(day)
+	for i := range timesheets {
+		if timesheets[i].User == user && timesheets[i].Week == week {
+			return &timesheets[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// checkWeekOpen fails with errWeekFrozen while a user's week is submitted or approved
+func checkWeekOpen(user string, day time.Time) error {
+	timesheet, err := findTimesheet(user, day)
+	if err != nil {
+		return err
+	}
+
+	if timesheet != nil && timesheet.Status != TimesheetRejected {
+		return errWeekFrozen
+	}
+
+	return nil
+}
+
+// requireApprovedTimesheet must pass before a user's entries are synced to an external system
+func requireApprovedTimesheet(user string, day time.Time) error {
+	timesheet, err := findTimesheet(user, day)
+	if err != nil {
+		return err
+	}
+
+	if timesheet == nil || timesheet.Status != TimesheetApproved {
+		return fmt.Errorf("timesheet for %s week of %s is not approved", user, weekKey(day))
+	}
+
+	return nil
+}
+
+// parseTimesheetRequest reads the optional JSON body of timesheet actions
+func parseTimesheetRequest(r *http.Request) (TimesheetRequest, error) {
+	var request TimesheetRequest
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return request, fmt.Errorf("Error reading request body: %v", err)
+	}
+	defer r.Body.Close()
+
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &request); err != nil {
+			return request, fmt.Errorf("Error parsing JSON: %v", err)
+		}
+	}
+
+	return request, nil
+}
+
+// parseWeek returns the Monday of the week containing a YYYYMMDD date in a user's time zone
+func parseWeek(value string, userName string) (time.Time, error) {
+	if value == "" {
+		return weekStart(userToday(userName)), nil
+	}
+
+	day, err := time.ParseInLocation("20060102", value, userLocation(userName))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("week must be a date in YYYYMMDD format")
+	}
+
+	return weekStart(day), nil
+}
+
+func submitTimesheetHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	request, err := parseTimesheetRequest(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user := currentUser(r)
+
+	week, err := parseWeek(request.Week, user.Name)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	timesheetsMu.Lock()
+	defer timesheetsMu.Unlock()
+
+	timesheets, err := readTimesheets()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var timesheet *Timesheet
+	for i := range timesheets {
+		if timesheets[i].User == user.Name && timesheets[i].Week == weekKey(week) {
+			timesheet = &timesheets[i]
+		}
+	}
+
+	// Only rejected timesheets can be submitted again
+	if timesheet != nil && timesheet.Status != TimesheetRejected {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("Timesheet for week of %s is already %s", timesheet.Week, timesheet.Status))
+		return
+	}
+
+	if timesheet == nil {
+		timesheets = append(timesheets, Timesheet{
+			User:     user.Name,
+			Week:     weekKey(week),
+			Comments: []TimesheetComment{},
+		})
+		timesheet = &timesheets[len(timesheets)-1]
+	}
+
+	timesheet.Status = TimesheetSubmitted
+	timesheet.SubmittedAt = time.Now()
+	timesheet.ReviewedBy = ""
+	timesheet.ReviewedAt = nil
+	if request.Comment != "" {
+		timesheet.Comments = append(timesheet.Comments, TimesheetComment{Author: user.Name, At: time.Now(), Text: request.Comment})
+	}
+
+	if err := writeTimesheets(timesheets); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(timesheet)
+}
+
+func listTimesheetsHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	timesheetsMu.Lock()
+	timesheets, err := readTimesheets()
+	timesheetsMu.Unlock()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	user := currentUser(r)
+	status := r.URL.Query().Get("status")
+	filterUser := r.URL.Query().Get("user")
+
+	// Reviewers see everyone's timesheets, other users only their own
+	results := []Timesheet{}
+	for _, timesheet := range timesheets {
+		if !user.HasRole(RoleReviewer) && timesheet.User != user.Name {
+			continue
+		}
+		if status != "" && timesheet.Status != status {
+			continue
+		}
+		if filterUser != "" && timesheet.User != filterUser {
+			continue
+		}
+		results = append(results, timesheet)
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// reviewTimesheetHandler approves or rejects /api/v1/timesheets/{user}/{week}/{action}
+func reviewTimesheetHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var newStatus string
+	switch r.PathValue("action") {
+	case "approve":
+		newStatus = TimesheetApproved
+	case "reject":
+		newStatus = TimesheetRejected
+	default:
+		writeError(w, r, http.StatusNotFound, "Action must be approve or reject")
+		return
+	}
+
+	request, err := parseTimesheetRequest(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if newStatus == TimesheetRejected && request.Comment == "" {
+		writeValidationError(w, r, ErrorDetail{Field: "comment", Message: "A comment is required when rejecting a timesheet"})
+		return
+	}
+
+	week, err := parseWeek(r.PathValue("week"), r.PathValue("user"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	reviewer := currentUser(r)
+
+	timesheetsMu.Lock()
+	defer timesheetsMu.Unlock()
+
+	timesheets, err := readTimesheets()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var timesheet *Timesheet
+	for i := range timesheets {
+		if timesheets[i].User == r.PathValue("user") && timesheets[i].Week == weekKey(week) {
+			timesheet = &timesheets[i]
+		}
+	}
+
+	if timesheet == nil {
+		writeError(w, r, http.StatusNotFound, "Timesheet not found")
+		return
+	}
+
+	if timesheet.Status != TimesheetSubmitted {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("Timesheet is %s, only submitted timesheets can be reviewed", timesheet.Status))
+		return
+	}
+
+	now := time.Now()
+	timesheet.Status = newStatus
+	timesheet.ReviewedBy = reviewer.Name
+	timesheet.ReviewedAt = &now
+	if request.Comment != "" {
+		timesheet.Comments = append(timesheet.Comments, TimesheetComment{Author: reviewer.Name, At: now, Text: request.Comment})
+	}
+
+	if err := writeTimesheets(timesheets); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(timesheet)
+}
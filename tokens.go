@@ -0,0 +1,326 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const tokensFile = "aidea_tokens.json"
+
+// tokenPrefix makes managed tokens recognizable in logs and secret scanners
+const tokenPrefix = "aidea_"
+
+// knownScopes lists every scope a managed token may be granted
+var knownScopes = []string{
+	ScopeEntriesRead,
+	ScopeEntriesWrite,
+	ScopeReportsRead,
+	ScopeTimesheetsWrite,
+	ScopeTimesheetsReview,
+	ScopeRulesWrite,
+	ScopeAdmin,
+}
+
+// ManagedToken is an API token created through the token API. Only a hash
+// of the secret is stored, the secret itself is returned once on creation.
+type ManagedToken struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	User string `json:"user"`
+	// Roles are the creator's roles when the token was created, used when the
+	// creator isn't a configured user, e.g. an SSO user
+	Roles     []string   `json:"roles,omitempty"`
+	Scopes    []string   `json:"scopes"`
+	TokenHash string     `json:"token_hash,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// TokenRequest represents the JSON request for creating a token
+type TokenRequest struct {
+	Name          string     `json:"name"`
+	Scopes        []string   `json:"scopes"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	ExpiresInDays int        `json:"expires_in_days,omitempty"`
+}
+
+var (
+	tokensMu      sync.Mutex
+	managedTokens []ManagedToken
+)
+
+// owner resolves the user who created the token, which the token acts as. The
+// token's name is only a label and never an identity.
+func (t ManagedToken) owner() *User {
+	if user := findUser(t.User); user != nil {
+		return user
+	}
+	if singleUserMode() {
+		return localUser
+	}
+	return &User{Name: t.User, Roles: slices.Clone(t.Roles)}
+}
+
+// Active reports whether the token is neither revoked nor expired
+func (t ManagedToken) Active(now time.Time) bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || now.Before(*t.ExpiresAt)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadManagedTokens reads the token file once, callers must hold tokensMu
+func loadManagedTokens() error {
+	if managedTokens != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(tokensFile)
+	if os.IsNotExist(err) {
+		managedTokens = []ManagedToken{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read tokens: %v", err)
+	}
+
+	var tokens []ManagedToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return fmt.Errorf("couldn't parse tokens: %v", err)
+	}
+
+	managedTokens = tokens
+	return nil
+}
+
+// saveManagedTokens writes the token file, callers must hold tokensMu
+func saveManagedTokens() error {
+	data, err := json.MarshalIndent(managedTokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't encode tokens: %v", err)
+	}
+
+	return os.WriteFile(tokensFile, data, 0600)
+}
+
+// lookupManagedToken finds the managed token matching a presented secret
+func lookupManagedToken(token string) (ManagedToken, bool) {
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+
+	if err := loadManagedTokens(); err != nil {
+		return ManagedToken{}, false
+	}
+
+	hash := hashToken(token)
+	for _, managed := range managedTokens {
+		if managed.TokenHash == hash {
+			return managed, true
+		}
+	}
+
+	return ManagedToken{}, false
+}
+
+// tokensHandler lists (GET) or creates (POST) managed tokens
+func tokensHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		listTokens(w, r)
+	case http.MethodPost:
+		createToken(w, r)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func listTokens(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	status := r.URL.Query().Get("status")
+	now := time.Now()
+
+	tokensMu.Lock()
+	err := loadManagedTokens()
+	tokens := slices.Clone(managedTokens)
+	tokensMu.Unlock()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Admins see every token, other users only their own
+	results := []ManagedToken{}
+	for _, token := range tokens {
+		if !user.HasRole(RoleAdmin) && token.User != user.Name {
+			continue
+		}
+
+		switch status {
+		case "active":
+			if !token.Active(now) {
+				continue
+			}
+		case "revoked":
+			if token.RevokedAt == nil {
+				continue
+			}
+		case "expired":
+			if token.ExpiresAt == nil || now.Before(*token.ExpiresAt) {
+				continue
+			}
+		}
+
+		token.TokenHash = ""
+		results = append(results, token)
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+func createToken(w http.ResponseWriter, r *http.Request) {
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	// Parse JSON request
+	var request TokenRequest
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+		return
+	}
+
+	// Validate required fields
+	details := []ErrorDetail{}
+	if request.Name == "" {
+		details = append(details, ErrorDetail{Field: "name", Message: "Name is required"})
+	}
+	if len(request.Scopes) == 0 {
+		details = append(details, ErrorDetail{Field: "scopes", Message: "At least one scope is required"})
+	}
+	for _, scope := range request.Scopes {
+		if !slices.Contains(knownScopes, scope) {
+			details = append(details, ErrorDetail{Field: "scopes", Message: fmt.Sprintf("Unknown scope %q", scope)})
+		}
+	}
+
+	expiresAt := request.ExpiresAt
+	if expiresAt == nil && request.ExpiresInDays > 0 {
+		expiry := time.Now().AddDate(0, 0, request.ExpiresInDays)
+		expiresAt = &expiry
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		details = append(details, ErrorDetail{Field: "expires_at", Message: "Expiry must be in the future"})
+	}
+
+	if len(details) > 0 {
+		writeValidationError(w, r, details...)
+		return
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error generating token")
+		return
+	}
+	secret = tokenPrefix + secret
+
+	token := ManagedToken{
+		ID:        uuid.New().String(),
+		Name:      request.Name,
+		User:      currentUser(r).Name,
+		Roles:     slices.Clone(currentUser(r).Roles),
+		Scopes:    request.Scopes,
+		TokenHash: hashToken(secret),
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	tokensMu.Lock()
+	err = loadManagedTokens()
+	if err == nil {
+		managedTokens = append(managedTokens, token)
+		err = saveManagedTokens()
+	}
+	tokensMu.Unlock()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving token: "+err.Error())
+		return
+	}
+
+	token.TokenHash = ""
+
+	// The secret is only ever returned here
+	response := map[string]interface{}{
+		"token":   secret,
+		"details": token,
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// revokeTokenHandler revokes a managed token, keeping it on the revocation list
+func revokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow DELETE method
+	if r.Method != http.MethodDelete {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	user := currentUser(r)
+	id := r.PathValue("id")
+
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+
+	if err := loadManagedTokens(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for i := range managedTokens {
+		token := &managedTokens[i]
+		if token.ID != id || (!user.HasRole(RoleAdmin) && token.User != user.Name) {
+			continue
+		}
+
+		if token.RevokedAt == nil {
+			now := time.Now()
+			token.RevokedAt = &now
+			if err := saveManagedTokens(); err != nil {
+				writeError(w, r, http.StatusInternalServerError, "Error saving token: "+err.Error())
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeError(w, r, http.StatusNotFound, "Token not found")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestManagedTokenNamedAfterAnotherUserActsAsItsCreator(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	previous := active.Load()
+	t.Cleanup(func() { active.Store(previous) })
+	config := defaultConfig()
+	config.LLM.Provider = "mock"
+	config.OIDC = OIDCConfig{Issuer: "https://sso.example.com", ClientID: "aidea"}
+	config.Users = []User{{Name: "bob", Roles: []string{RoleReviewer}}}
+	state, err := prepareConfig(config)
+	if err != nil {
+		t.Fatalf("prepareConfig: %v", err)
+	}
+	activateConfig(state)
+
+	tokensMu.Lock()
+	managedTokens = nil
+	tokensMu.Unlock()
+	t.Cleanup(func() {
+		tokensMu.Lock()
+		managedTokens = nil
+		tokensMu.Unlock()
+	})
+
+	if err := appendEntry(context.Background(), storageToday(), TimeEntry{ID: "bob-1", Timespan: "1h", Description: "bob's planning", User: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// carol signed in through SSO and isn't a configured user
+	carol := &User{Name: "carol", Roles: []string{RoleManager}}
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/tokens", strings.NewReader(`{"name":"bob","scopes":["entries:read"]}`))
+	request = request.WithContext(context.WithValue(request.Context(), userContextKey, carol))
+	recorder := httptest.NewRecorder()
+	tokensHandler(recorder, request)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("creating the token: status %d: %s", recorder.Code, recorder.Body)
+	}
+	var created struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	request = httptest.NewRequest(http.MethodGet, "/api/v2/activity", nil)
+	request.Header.Set("Authorization", "Bearer "+created.Token)
+	user, _, ok := authenticateToken(request)
+	if !ok {
+		t.Fatal("the token wasn't accepted")
+	}
+	if user.Name != "carol" || !user.HasRole(RoleManager) {
+		t.Errorf("token acts as %s with roles %v, want carol with her manager role", user.Name, user.Roles)
+	}
+
+	recorder = httptest.NewRecorder()
+	activityV2Handler(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("listing entries: status %d: %s", recorder.Code, recorder.Body)
+	}
+	if strings.Contains(recorder.Body.String(), "bob-1") {
+		t.Errorf("a token named bob listed bob's entries: %s", recorder.Body)
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TracingConfig enables exporting spans to an OpenTelemetry collector over OTLP/HTTP
+type TracingConfig struct {
+	Enabled bool `json:"enabled"`
+	// Endpoint is the collector's OTLP/HTTP traces URL
+	Endpoint    string `json:"endpoint"`
+	ServiceName string `json:"service_name"`
+}
+
+// Span kinds as defined by OTLP
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+)
+
+// Span is a single timed operation within a trace
+type Span struct {
+	traceID    [16]byte
+	spanID     [8]byte
+	parentID   [8]byte
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	errMessage string
+}
+
+type spanContextKey struct{}
+
+// routeContextKey holds where the innermost middleware reports the matched route
+// pattern, since the middlewares in between pass copies of the request on
+type routeContextKey struct{}
+
+// spanQueue feeds finished spans to the exporter, nil when tracing is disabled
+var spanQueue chan *Span
+
+// startSpan begins a span as a child of the span in ctx, if any.
+// When tracing is disabled it returns a nil span whose methods are no-ops.
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	if spanQueue == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: make(map[string]interface{}),
+	}
+
+	if parent, ok := ctx.Value(spanContextKey{}).(*Span); ok && parent != nil {
+		span.traceID = parent.traceID
+		span.parentID = parent.spanID
+	} else {
+		rand.Read(span.traceID[:])
+	}
+	rand.Read(span.spanID[:])
+
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// SetAttribute records a key/value on the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.attributes[key] = value
+}
+
+// RecordError marks the span as failed
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.errMessage = err.Error()
+}
+
+// End finishes the span and queues it for export, dropping it if the queue is full
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+
+	select {
+	case spanQueue <- s:
+	default:
+	}
+}
+
+// parseTraceparent continues a trace from a W3C traceparent header
+func parseTraceparent(ctx context.Context, header string) context.Context {
+	parts := strings.Split(header, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return ctx
+	}
+
+	remote := &Span{}
+	if _, err := hex.Decode(remote.traceID[:], []byte(parts[1])); err != nil {
+		return ctx
+	}
+	if _, err := hex.Decode(remote.spanID[:], []byte(parts[2])); err != nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, spanContextKey{}, remote)
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush streamed responses
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// reportRoute passes the route pattern the mux matched to the request's server span
+func reportRoute(r *http.Request) {
+	if route, ok := r.Context().Value(routeContextKey{}).(*string); ok {
+		*route = r.Pattern
+	}
+}
+
+// tracingMiddleware wraps every request in a server span
+func tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if spanQueue == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := parseTraceparent(r.Context(), r.Header.Get("traceparent"))
+		ctx, span := startSpan(ctx, r.Method+" "+r.URL.Path, spanKindServer)
+		defer span.End()
+
+		var route string
+		ctx = context.WithValue(ctx, routeContextKey{}, &route)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		if route != "" {
+			span.name = route
+			span.SetAttribute("http.route", route)
+		}
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("url.path", r.URL.Path)
+		span.SetAttribute("http.response.status_code", recorder.status)
+		if recorder.status >= 500 {
+			span.RecordError(fmt.Errorf("HTTP %d", recorder.status))
+		}
+	})
+}
+
+// otlpAttribute converts a Go value into an OTLP JSON attribute
+func otlpAttribute(key string, value interface{}) map[string]interface{} {
+	var encoded map[string]interface{}
+	switch v := value.(type) {
+	case int:
+		encoded = map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case int64:
+		encoded = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		encoded = map[string]interface{}{"doubleValue": v}
+	case bool:
+		encoded = map[string]interface{}{"boolValue": v}
+	default:
+		encoded = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+	return map[string]interface{}{"key": key, "value": encoded}
+}
+
+func otlpSpan(span *Span) map[string]interface{} {
+	attributes := []map[string]interface{}{}
+	for key, value := range span.attributes {
+		attributes = append(attributes, otlpAttribute(key, value))
+	}
+
+	encoded := map[string]interface{}{
+		"traceId":           hex.EncodeToString(span.traceID[:]),
+		"spanId":            hex.EncodeToString(span.spanID[:]),
+		"name":              span.name,
+		"kind":              span.kind,
+		"startTimeUnixNano": strconv.FormatInt(span.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(span.end.UnixNano(), 10),
+		"attributes":        attributes,
+	}
+
+	if span.parentID != [8]byte{} {
+		encoded["parentSpanId"] = hex.EncodeToString(span.parentID[:])
+	}
+	if span.errMessage != "" {
+		encoded["status"] = map[string]interface{}{"code": 2, "message": span.errMessage}
+	}
+
+	return encoded
+}
+
+// exportSpans posts a batch of spans to the collector as OTLP JSON
+func exportSpans(config TracingConfig, spans []*Span) error {
+	encoded := make([]map[string]interface{}, 0, len(spans))
+	for _, span := range spans {
+		encoded = append(encoded, otlpSpan(span))
+	}
+
+	payload := map[string]interface{}{
+		"resourceSpans": []map[string]interface{}{
+			{
+				"resource": map[string]interface{}{
+					"attributes": []map[string]interface{}{otlpAttribute("service.name", config.ServiceName)},
+				},
+				"scopeSpans": []map[string]interface{}{
+					{
+						"scope": map[string]string{"name": "aidea-time-tracker"},
+						"spans": encoded,
+					},
+				},
+			},
+		},
+	}
+
+	requestData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshalling spans: %w", err)
+	}
+
+	resp, err := http.Post(config.Endpoint, "application/json", bytes.NewBuffer(requestData))
+	if err != nil {
+		return fmt.Errorf("error sending spans: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned error: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// startTraceExporter enables tracing and exports spans in batches
+func startTraceExporter(config TracingConfig) {
+	if config.Endpoint == "" {
+		config.Endpoint = "http://localhost:4318/v1/traces"
+	}
+	if config.ServiceName == "" {
+		config.ServiceName = "aidea-time-tracker"
+	}
+
+	spanQueue = make(chan *Span, 2048)
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+
+		batch := []*Span{}
+		flush := func() {
+			if len(batch) == 0 {
+				return
+			}
+			if err := exportSpans(config, batch); err != nil {
+				log.Printf("Error exporting traces: %v", err)
+			}
+			batch = []*Span{}
+		}
+
+		for {
+			select {
+			case span := <-spanQueue:
+				batch = append(batch, span)
+				if len(batch) >= 256 {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TrashEntry is a deleted entry with the time it will be purged
+type TrashEntry struct {
+	TimeEntry
+	PurgeAt string `json:"purge_at,omitempty"`
+}
+
+// dataFiles returns every data file matching the configured filename template
+func dataFiles() ([]string, error) {
+	return filepath.Glob(strings.ReplaceAll(dataFilenameTemplate(), "{period}", "*"))
+}
+
+// purgeAt returns when a deleted entry leaves the trash, zero if it is kept forever
+func purgeAt(entry TimeEntry) time.Time {
+	deletedAt, err := time.Parse(time.RFC3339, entry.DeletedAt)
+	if err != nil || currentConfig().Entries.TrashDays <= 0 {
+		return time.Time{}
+	}
+	return deletedAt.AddDate(0, 0, currentConfig().Entries.TrashDays)
+}
+
+// listTrash returns a user's deleted entries, most recently deleted first
+func listTrash(user string) ([]TrashEntry, error) {
+	filenames, err := dataFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	trash := []TrashEntry{}
+	for _, filename := range filenames {
+		entries, err := readEntries(filename)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+
+		for _, entry := range entries {
+			if entry.DeletedAt == "" || entryOwner(entry) != user {
+				continue
+			}
+			item := TrashEntry{TimeEntry: entry}
+			if purge := purgeAt(entry); !purge.IsZero() {
+				item.PurgeAt = purge.Format(time.RFC3339)
+			}
+			trash = append(trash, item)
+		}
+	}
+
+	sort.Slice(trash, func(i, j int) bool { return trash[i].DeletedAt > trash[j].DeletedAt })
+	return trash, nil
+}
+
+// restoreEntry takes an entry out of the trash. Only its owner or an admin may restore it,
+// and not into a week that has been submitted.
+func restoreEntry(ctx context.Context, id string, user *User) (restored *TimeEntry, err error) {
+	_, span := startSpan(ctx, "storage.restore_entry", spanKindInternal)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	storageMu.Lock()
+	defer storageMu.Unlock()
+
+	filenames, err := dataFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, filename := range filenames {
+		entries, err := readEntries(filename)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+
+		for i := range entries {
+			entry := &entries[i]
+			if entry.ID != id || entry.DeletedAt == "" {
+				continue
+			}
+			if entryOwner(*entry) != user.Name && !user.HasRole(RoleAdmin) {
+				return nil, nil
+			}
+
+			owner := entryOwner(*entry)
+			if day, err := time.ParseInLocation("2006-01-02", entry.Date, userLocation(owner)); err == nil {
+				if err := checkWeekOpen(owner, day); err != nil {
+					return nil, err
+				}
+			}
+
+			before := *entry
+			entry.DeletedAt = ""
+			if err := writeEntries(filename, entries); err != nil {
+				return nil, err
+			}
+			publishEvent(EventEntryRestored, *entry)
+			streamEntryChange(before, *entry)
+			queueEntryEmbedding(*entry)
+			return entry, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// purgeTrash permanently removes entries deleted more than TrashDays ago
+func purgeTrash(now time.Time) (int, error) {
+	if currentConfig().Entries.TrashDays <= 0 {
+		return 0, nil
+	}
+
+	storageMu.Lock()
+	defer storageMu.Unlock()
+
+	filenames, err := dataFiles()
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, filename := range filenames {
+		entries, err := readEntries(filename)
+		if err != nil {
+			return purged, fmt.Errorf("%s: %v", filename, err)
+		}
+
+		kept := make([]TimeEntry, 0, len(entries))
+		for _, entry := range entries {
+			if purge := purgeAt(entry); !purge.IsZero() && now.After(purge) {
+				continue
+			}
+			kept = append(kept, entry)
+		}
+
+		if len(kept) == len(entries) {
+			continue
+		}
+		if err := writeEntries(filename, kept); err != nil {
+			return purged, fmt.Errorf("%s: %v", filename, err)
+		}
+		purged += len(entries) - len(kept)
+	}
+
+	return purged, nil
+}
+
+// startTrashPurge empties expired entries from the trash at startup and then hourly
+func startTrashPurge(config EntriesConfig) {
+	if config.TrashDays <= 0 {
+		return
+	}
+
+	purge := func() {
+		purged, err := purgeTrash(time.Now())
+		if err != nil {
+			log.Printf("Error purging trash: %v", err)
+			return
+		}
+		if purged > 0 {
+			log.Printf("Purged %d entries from the trash", purged)
+		}
+	}
+
+	purge()
+	go func() {
+		for range time.Tick(time.Hour) {
+			purge()
+		}
+	}()
+}
+
+// deleteEntryHandler moves an entry to the trash. The entry's day is given as
+// ?date=YYYYMMDD and defaults to today.
+func deleteEntryHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow DELETE method
+	if r.Method != http.MethodDelete {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	day, entry, ok := lookupEntry(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := updateEntry(r.Context(), day, entry.ID, func(e *TimeEntry) {
+		// Undated entries get their day so they can be restored and purged from any file
+		if e.Date == "" {
+			e.Date = entryDate(day)
+		}
+		e.DeletedAt = time.Now().UTC().Format(time.RFC3339)
+	})
+	if errors.Is(err, errWeekFrozen) {
+		writeErrorCode(w, r, http.StatusConflict, ErrCodeWeekFrozen, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error deleting entry: "+err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// trashHandler lists the current user's deleted entries
+func trashHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	trash, err := listTrash(currentUser(r).Name)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error reading entries: %v", err))
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trash)
+}
+
+// restoreEntryHandler takes an entry out of the trash
+func restoreEntryHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	entry, err := restoreEntry(r.Context(), r.PathValue("id"), currentUser(r))
+	if errors.Is(err, errWeekFrozen) {
+		writeErrorCode(w, r, http.StatusConflict, ErrCodeWeekFrozen, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error restoring entry: "+err.Error())
+		return
+	}
+	if entry == nil {
+		writeError(w, r, http.StatusNotFound, "Entry not found in trash")
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
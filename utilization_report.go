@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// UtilizationDay compares a day's logged time with the time expected from the user
+type UtilizationDay struct {
+	Date            string `json:"date"`
+	ExpectedMinutes int    `json:"expected_minutes"`
+	LoggedMinutes   int    `json:"logged_minutes"`
+	MissingMinutes  int    `json:"missing_minutes"`
+	DayOff          string `json:"day_off,omitempty"`
+}
+
+// UtilizationReport summarizes logged versus expected time for one user over a date range
+type UtilizationReport struct {
+	User            string           `json:"user"`
+	From            string           `json:"from"`
+	To              string           `json:"to"`
+	ExpectedMinutes int              `json:"expected_minutes"`
+	LoggedMinutes   int              `json:"logged_minutes"`
+	MissingMinutes  int              `json:"missing_minutes"`
+	Utilization     float64          `json:"utilization"`
+	Days            []UtilizationDay `json:"days"`
+}
+
+// expectedMinutes returns the working time expected of a user on a day,
+// zero outside their working days and on holidays or PTO
+func expectedMinutes(user string, day time.Time) (int, string) {
+	hours := userWorkingHours(user)
+	if !hours.WorksOn(day.Weekday()) {
+		return 0, ""
+	}
+
+	if dayOff, found := findDayOff(user, day); found {
+		name := dayOff.Name
+		if name == "" {
+			name = "Day off"
+		}
+		return 0, name
+	}
+
+	return hours.DailyMinutes(), ""
+}
+
+// utilizationReportHandler reports logged time and gaps per day for the current
+// user, managers may pass ?user= to see someone else's
+func utilizationReportHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	current := currentUser(r)
+	user := current.Name
+	if requested := r.URL.Query().Get("user"); requested != "" && requested != user {
+		if !current.HasRole(RoleManager) {
+			writeError(w, r, http.StatusForbidden, "Forbidden")
+			return
+		}
+		user = requested
+	}
+
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report := UtilizationReport{
+		User: user,
+		From: from.Format("20060102"),
+		To:   to.Format("20060102"),
+		Days: []UtilizationDay{},
+	}
+
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		// Daily aggregates keep each user's logged time, so no entries are summed here
+		aggregate, err := dailyAggregate(day)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error reading entries: %v", err))
+			return
+		}
+		expected, dayOff := expectedMinutes(user, day)
+		logged := aggregate.MinutesByUser[user]
+
+		result := UtilizationDay{
+			Date:            day.Format("20060102"),
+			ExpectedMinutes: expected,
+			LoggedMinutes:   logged,
+			MissingMinutes:  max(expected-logged, 0),
+			DayOff:          dayOff,
+		}
+
+		report.ExpectedMinutes += result.ExpectedMinutes
+		report.LoggedMinutes += result.LoggedMinutes
+		report.MissingMinutes += result.MissingMinutes
+		report.Days = append(report.Days, result)
+	}
+
+	if report.ExpectedMinutes > 0 {
+		report.Utilization = float64(report.LoggedMinutes) / float64(report.ExpectedMinutes)
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Field limits for entry payloads
+const (
+	maxDescriptionLength = 1000
+	maxTaskLength        = 100
+	maxTimespanLength    = 32
+	maxTimespan          = 24 * time.Hour
+	maxLinks             = 10
+	maxLinkLength        = 2000
+	maxLabels            = 5
+)
+
+// Jira project keys like FEDS and issue keys like FEDS-101, the one definition
+// both validation and finding keys in free text are built from
+const (
+	jiraProjectExpr = `[A-Z][A-Z0-9_]+`
+	jiraKeyExpr     = jiraProjectExpr + `-[1-9][0-9]*`
+)
+
+var (
+	// jiraKeyPattern matches issue keys like FEDS-101
+	jiraKeyPattern = regexp.MustCompile(`^` + jiraKeyExpr + `$`)
+	// jiraProjectPattern matches project keys like FEDS
+	jiraProjectPattern = regexp.MustCompile(`^` + jiraProjectExpr + `$`)
+	// jiraKeyFinder finds issue keys mentioned in descriptions, titles, branches and commit messages
+	jiraKeyFinder = regexp.MustCompile(`\b` + jiraKeyExpr + `\b`)
+)
+
+// tagPattern matches entry tags like billable or client:acme
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:-]{0,49}$`)
+
+// confidenceLevels are the confidence values the categorizer may assign
+var confidenceLevels = []string{"high", "medium", "low"}
+
+// validator collects every failing field of a payload so they are reported together
+type validator struct {
+	details []ErrorDetail
+}
+
+func (v *validator) add(field, format string, args ...interface{}) {
+	v.details = append(v.details, ErrorDetail{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// text checks a free-text field's length and rejects control characters
+func (v *validator) text(field, value string, required bool, maxLength int) {
+	if strings.TrimSpace(value) == "" {
+		if required {
+			v.add(field, "%s is required", field)
+		}
+		return
+	}
+
+	if !utf8.ValidString(value) {
+		v.add(field, "%s must be valid UTF-8", field)
+		return
+	}
+	if length := utf8.RuneCountInString(value); length > maxLength {
+		v.add(field, "%s must be at most %d characters, got %d", field, maxLength, length)
+	}
+	if strings.ContainsFunc(value, func(r rune) bool { return unicode.IsControl(r) && r != '\t' }) {
+		v.add(field, "%s must not contain control characters", field)
+	}
+}
+
+// jiraKey checks an optional Jira issue key, which must be in an allowed project
+func (v *validator) jiraKey(field, value string) {
+	if value == "" {
+		return
+	}
+	if !jiraKeyPattern.MatchString(value) {
+		v.add(field, "%s must be a Jira issue key like PROJ-123", field)
+		return
+	}
+	v.jiraProject(field, jiraProject(value))
+}
+
+// jiraReference checks an optional Jira issue or project key
+func (v *validator) jiraReference(field, value string) {
+	switch {
+	case value == "":
+	case jiraKeyPattern.MatchString(value):
+		v.jiraProject(field, jiraProject(value))
+	case jiraProjectPattern.MatchString(value):
+		v.jiraProject(field, value)
+	default:
+		v.add(field, "%s must be a Jira issue key like PROJ-123 or a project key like PROJ", field)
+	}
+}
+
+// jiraProject checks a project against the configured project keys
+func (v *validator) jiraProject(field, project string) {
+	if projects := allowedJiraProjects(); len(projects) > 0 && !slices.Contains(projects, project) {
+		v.add(field, "%s must be in one of the Jira projects %s", field, strings.Join(projects, ", "))
+	}
+}
+
+// tag checks an optional entry tag
+func (v *validator) tag(field, value string) {
+	if value != "" && !tagPattern.MatchString(value) {
+		v.add(field, "%s must be up to 50 letters, digits or _.:- like billable or client:acme", field)
+	}
+}
+
+// links checks an entry's reference links, which must be absolute http(s) URLs
+func (v *validator) links(field string, links []string) {
+	if len(links) > maxLinks {
+		v.add(field, "%s must list at most %d links", field, maxLinks)
+	}
+	for _, link := range links {
+		if len(link) > maxLinkLength {
+			v.add(field, "%s must be at most %d characters each", field, maxLinkLength)
+			continue
+		}
+		parsed, err := url.Parse(link)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || strings.ContainsFunc(link, unicode.IsSpace) {
+			v.add(field, "%s must be http or https URLs, got %q", field, link)
+		}
+	}
+}
+
+// labels checks an entry's further labels and that their weights leave time for the primary one
+func (v *validator) labels(field string, labels []EntryLabel) {
+	if len(labels) > maxLabels {
+		v.add(field, "%s must list at most %d labels", field, maxLabels)
+	}
+	var total float64
+	for i, label := range labels {
+		v.text(fmt.Sprintf("%s[%d].task", field, i), label.Task, true, maxTaskLength)
+		v.jiraKey(fmt.Sprintf("%s[%d].jira", field, i), label.Jira)
+		if label.Weight < 0 || label.Weight >= 1 {
+			v.add(fmt.Sprintf("%s[%d].weight", field, i), "weight must be at least 0 and below 1")
+		}
+		total += label.Weight
+	}
+	if total >= 1 {
+		v.add(field, "%s weights must add up to less than 1", field)
+	}
+}
+
+// timespan checks an optional duration such as "45m", "1h30m" or "1:30"
+func (v *validator) timespan(field, value string) {
+	if value == "" {
+		return
+	}
+	if len(value) > maxTimespanLength {
+		v.add(field, "%s must be at most %d characters", field, maxTimespanLength)
+		return
+	}
+
+	duration, err := parseTimespan(value)
+	if err != nil {
+		v.add(field, "%s must be a duration like 45m, 1h30m or 1:30", field)
+		return
+	}
+	if duration <= 0 || duration > maxTimespan {
+		v.add(field, "%s must be between 1m and 24h", field)
+	}
+}
+
+// oneOf checks an optional value against an enumeration, ignoring case
+func (v *validator) oneOf(field, value string, allowed []string) {
+	if value == "" {
+		return
+	}
+	if !slices.ContainsFunc(allowed, func(a string) bool { return strings.EqualFold(a, value) }) {
+		v.add(field, "%s must be one of %s", field, strings.Join(allowed, ", "))
+	}
+}
+
+// validateEntryRequest checks a new entry payload
+func validateEntryRequest(request TimeEntryRequest) []ErrorDetail {
+	v := &validator{}
+	v.text("description", request.Description, true, maxDescriptionLength)
+	v.timespan("timespan", request.Timespan)
+	v.jiraKey("jira", request.Jira)
+	v.links("links", request.Links)
+	if request.Date != "" {
+		if _, err := time.Parse("20060102", request.Date); err != nil {
+			v.add("date", "date must be in YYYYMMDD format")
+		}
+	}
+	return v.details
+}
+
+// validateEntry checks the fields of an entry before it is stored, e.g. after a correction
+func validateEntry(entry TimeEntry) []ErrorDetail {
+	v := &validator{}
+	v.text("description", entry.Description, true, maxDescriptionLength)
+	v.text("task", entry.Task, false, maxTaskLength)
+	v.timespan("timespan", entry.Timespan)
+	v.jiraKey("jira", entry.Jira)
+	v.oneOf("confidence", entry.Confidence, confidenceLevels)
+	v.links("links", entry.Links)
+	v.labels("labels", entry.Labels)
+	return v.details
+}
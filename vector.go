@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// errDimensionMismatch reports embeddings of different lengths, usually made by different models
+var errDimensionMismatch = errors.New("embedding dimensions don't match")
+
+// Vector is an embedding held as float32, half the memory of the float64 values
+// providers return and precise enough for similarity scores. Vectors are scaled
+// to unit length when created or read, so their cosine similarity is a plain dot
+// product. It is stored as base64 of little-endian float32 values, and still
+// reads the JSON number arrays written before.
+type Vector []float32
+
+// toVector narrows a provider's embedding to a unit length Vector. An all-zero
+// embedding stays zero and is similar to nothing.
+func toVector(values []float64) Vector {
+	if values == nil {
+		return nil
+	}
+
+	var norm float64
+	for _, value := range values {
+		norm += value * value
+	}
+	norm = math.Sqrt(norm)
+
+	vector := make(Vector, len(values))
+	for i, value := range values {
+		if norm > 0 {
+			vector[i] = float32(value / norm)
+		}
+	}
+	return vector
+}
+
+// values widens the vector back to float64, e.g. for APIs taking JSON number arrays
+func (v Vector) values() []float64 {
+	values := make([]float64, len(v))
+	for i, value := range v {
+		values[i] = float64(value)
+	}
+	return values
+}
+
+// MarshalJSON encodes the vector as a base64 string
+func (v Vector) MarshalJSON() ([]byte, error) {
+	data := make([]byte, 4*len(v))
+	for i, value := range v {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(value))
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(data))
+}
+
+// UnmarshalJSON decodes a base64 string or a JSON array of numbers
+func (v *Vector) UnmarshalJSON(data []byte) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		var values []float64
+		if err := json.Unmarshal(data, &values); err != nil {
+			return fmt.Errorf("embedding is neither base64 nor a number array")
+		}
+		*v = toVector(values)
+		return nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("invalid embedding encoding: %v", err)
+	}
+	if len(raw)%4 != 0 {
+		return fmt.Errorf("invalid embedding length %d", len(raw))
+	}
+
+	values := make([]float64, len(raw)/4)
+	for i := range values {
+		values[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(raw[4*i:])))
+	}
+	*v = toVector(values)
+	return nil
+}
+
+// checkDimensions returns errDimensionMismatch when two vectors can't be compared
+func checkDimensions(a, b Vector) error {
+	if len(a) != len(b) {
+		return fmt.Errorf("%w: %d and %d", errDimensionMismatch, len(a), len(b))
+	}
+	return nil
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Vector store backends
+const (
+	VectorStoreLocal    = "local"
+	VectorStoreQdrant   = "qdrant"
+	VectorStorePgvector = "pgvector"
+)
+
+// Vector store collections
+const (
+	vectorRules   = "rules"
+	vectorEntries = "entries"
+)
+
+// vectorStoreTimeout bounds each call to the vector store
+const vectorStoreTimeout = 15 * time.Second
+
+// VectorStoreConfig selects where rule and entry embeddings are indexed. The local
+// files stay the source of truth, an external store is kept in sync with them and
+// answers nearest-neighbour searches.
+type VectorStoreConfig struct {
+	// Backend is "local" (default, searched in process), "qdrant" or "pgvector"
+	Backend string `json:"backend"`
+	// URL is the Qdrant base URL, e.g. http://localhost:6333
+	URL    string `json:"url,omitempty"`
+	APIKey string `json:"api_key,omitempty"`
+	// DSN is the Postgres connection string for pgvector
+	DSN string `json:"dsn,omitempty"`
+	// Driver is the database/sql driver pgvector connects with, default "pgx"
+	Driver string `json:"driver,omitempty"`
+	// Prefix names the Qdrant collections or Postgres tables, default "aidea"
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// VectorPoint is an embedding indexed in a vector store
+type VectorPoint struct {
+	ID     string
+	User   string
+	Vector Vector
+}
+
+// VectorMatch is a search result, Score is the cosine similarity
+type VectorMatch struct {
+	ID    string
+	Score float64
+}
+
+// VectorStore indexes embeddings outside the process for approximate nearest-neighbour search
+type VectorStore interface {
+	Upsert(ctx context.Context, collection string, points []VectorPoint) error
+	Delete(ctx context.Context, collection string, ids []string) error
+	// Search returns the closest points, best first, only a user's when user isn't empty
+	Search(ctx context.Context, collection string, vector Vector, limit int, user string) ([]VectorMatch, error)
+	// Close releases the store's connections once a reload replaced it
+	Close() error
+}
+
+// vectorStore is the configured external store, nil when embeddings are searched in process
+func vectorStore() VectorStore {
+	return active.Load().vectorStore
+}
+
+// vectorPrefixPattern keeps the prefix usable as part of a table name
+var vectorPrefixPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// newVectorStore connects the configured vector store, nil for the in-process search
+func newVectorStore(config VectorStoreConfig) (VectorStore, error) {
+	prefix := config.Prefix
+	if prefix == "" {
+		prefix = "aidea"
+	}
+	if !vectorPrefixPattern.MatchString(prefix) {
+		return nil, fmt.Errorf("vector store prefix %q may only contain lowercase letters, digits and underscores", prefix)
+	}
+
+	var store VectorStore
+	switch config.Backend {
+	case "", VectorStoreLocal:
+		return nil, nil
+	case VectorStoreQdrant:
+		if config.URL == "" {
+			return nil, fmt.Errorf("the qdrant vector store needs a url")
+		}
+		store = &qdrantStore{
+			url:     strings.TrimRight(config.URL, "/"),
+			apiKey:  config.APIKey,
+			prefix:  prefix,
+			client:  &http.Client{Timeout: vectorStoreTimeout},
+			created: make(map[string]bool),
+		}
+	case VectorStorePgvector:
+		if config.DSN == "" {
+			return nil, fmt.Errorf("the pgvector vector store needs a dsn")
+		}
+		driver := config.Driver
+		if driver == "" {
+			driver = "pgx"
+		}
+		if !slices.Contains(sql.Drivers(), driver) {
+			return nil, fmt.Errorf("the pgvector vector store needs the %q database driver, build with -tags pgvector to include it", driver)
+		}
+		db, err := sql.Open(driver, config.DSN)
+		if err != nil {
+			return nil, err
+		}
+		store = &pgvectorStore{db: db, prefix: prefix, created: make(map[string]bool)}
+	default:
+		return nil, fmt.Errorf("unknown vector store backend %q", config.Backend)
+	}
+
+	log.Printf("Indexing embeddings in %s", config.Backend)
+	return store, nil
+}
+
+// syncVectorStore copies the rule and entry embeddings to the vector store in
+// the background, filling a new store and catching up on changes made while it
+// was unreachable
+func syncVectorStore() {
+	if vectorStore() == nil {
+		return
+	}
+
+	go func() {
+		ctx := context.Background()
+
+		all, err := listRules()
+		if err != nil {
+			log.Printf("Error syncing rules to the vector store: %v", err)
+			return
+		}
+		for _, rule := range all {
+			indexRuleVector(ctx, rule)
+		}
+
+		embeddings, err := listEntryEmbeddings("")
+		if err != nil {
+			log.Printf("Error syncing entries to the vector store: %v", err)
+			return
+		}
+		points := make([]VectorPoint, 0, len(embeddings))
+		for _, embedding := range embeddings {
+			points = append(points, VectorPoint{ID: embedding.EntryID, User: embedding.User, Vector: embedding.Embedding})
+		}
+		for start := 0; start < len(points); start += 100 {
+			if err := upsertVectors(ctx, vectorEntries, points[start:min(start+100, len(points))]); err != nil {
+				log.Printf("Error syncing entries to the vector store: %v", err)
+				return
+			}
+		}
+		log.Printf("Synced %d rule and %d entry embeddings to the vector store", len(all), len(points))
+	}()
+}
+
+// upsertVectors indexes points in the vector store, if one is configured
+func upsertVectors(ctx context.Context, collection string, points []VectorPoint) error {
+	store := vectorStore()
+	if store == nil || len(points) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, vectorStoreTimeout)
+	defer cancel()
+	return store.Upsert(ctx, collection, points)
+}
+
+// deleteVectors removes points from the vector store, if one is configured
+func deleteVectors(ctx context.Context, collection string, ids []string) error {
+	store := vectorStore()
+	if store == nil || len(ids) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, vectorStoreTimeout)
+	defer cancel()
+	return store.Delete(ctx, collection, ids)
+}
+
+// indexRuleVector indexes a rule's embedding, logging failures since the rules file
+// stays authoritative and the next sync repairs the store
+func indexRuleVector(ctx context.Context, rule ActivityRule) {
+	if len(rule.Embedding) == 0 {
+		return
+	}
+	if err := upsertVectors(ctx, vectorRules, []VectorPoint{{ID: rule.ID, Vector: rule.Embedding}}); err != nil {
+		log.Printf("Error indexing rule %s in the vector store: %v", rule.Name, err)
+	}
+}
+
+// unindexRuleVector removes a deleted rule from the vector store
+func unindexRuleVector(ctx context.Context, id string) {
+	if err := deleteVectors(ctx, vectorRules, []string{id}); err != nil {
+		log.Printf("Error removing rule %s from the vector store: %v", id, err)
+	}
+}
+
+// qdrantStore keeps embeddings in Qdrant collections through its REST API
+type qdrantStore struct {
+	url    string
+	apiKey string
+	prefix string
+	client *http.Client
+
+	mu sync.Mutex
+	// created remembers the collections known to exist
+	created map[string]bool
+}
+
+// qdrantPointID maps an ID onto the UUIDs Qdrant accepts, the original ID is kept in the payload
+func qdrantPointID(id string) string {
+	if _, err := uuid.Parse(id); err == nil {
+		return id
+	}
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte("aidea:"+id)).String()
+}
+
+func (s *qdrantStore) do(ctx context.Context, method, path string, body interface{}, result interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.url+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("api-key", s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("qdrant returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	if result != nil {
+		if err := json.Unmarshal(data, result); err != nil {
+			return resp.StatusCode, fmt.Errorf("couldn't parse qdrant response: %v", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// ensureCollection creates a collection sized for the vectors the first time it is written
+func (s *qdrantStore) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func (s *qdrantStore) ensureCollection(ctx context.Context, name string, dimensions int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.created[name] {
+		return nil
+	}
+
+	status, err := s.do(ctx, http.MethodGet, "/collections/"+name, nil, nil)
+	if status == http.StatusNotFound {
+		_, err = s.do(ctx, http.MethodPut, "/collections/"+name, map[string]interface{}{
+			"vectors": map[string]interface{}{"size": dimensions, "distance": "Cosine"},
+		}, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.created[name] = true
+	return nil
+}
+
+func (s *qdrantStore) Upsert(ctx context.Context, collection string, points []VectorPoint) error {
+	name := s.prefix + "_" + collection
+	if err := s.ensureCollection(ctx, name, len(points[0].Vector)); err != nil {
+		return err
+	}
+
+	body := make([]map[string]interface{}, 0, len(points))
+	for _, point := range points {
+		body = append(body, map[string]interface{}{
+			"id":      qdrantPointID(point.ID),
+			"vector":  point.Vector.values(),
+			"payload": map[string]string{"id": point.ID, "user": point.User},
+		})
+	}
+	_, err := s.do(ctx, http.MethodPut, "/collections/"+name+"/points?wait=true", map[string]interface{}{"points": body}, nil)
+	return err
+}
+
+func (s *qdrantStore) Delete(ctx context.Context, collection string, ids []string) error {
+	pointIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		pointIDs = append(pointIDs, qdrantPointID(id))
+	}
+	status, err := s.do(ctx, http.MethodPost, "/collections/"+s.prefix+"_"+collection+"/points/delete?wait=true", map[string]interface{}{"points": pointIDs}, nil)
+	// Nothing was indexed yet
+	if status == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+func (s *qdrantStore) Search(ctx context.Context, collection string, vector Vector, limit int, user string) ([]VectorMatch, error) {
+	body := map[string]interface{}{
+		"vector":       vector.values(),
+		"limit":        limit,
+		"with_payload": true,
+	}
+	if user != "" {
+		body["filter"] = map[string]interface{}{
+			"must": []map[string]interface{}{{"key": "user", "match": map[string]string{"value": user}}},
+		}
+	}
+
+	var response struct {
+		Result []struct {
+			Score   float64           `json:"score"`
+			Payload map[string]string `json:"payload"`
+		} `json:"result"`
+	}
+	status, err := s.do(ctx, http.MethodPost, "/collections/"+s.prefix+"_"+collection+"/points/search", body, &response)
+	if status == http.StatusNotFound {
+		return []VectorMatch{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]VectorMatch, 0, len(response.Result))
+	for _, result := range response.Result {
+		matches = append(matches, VectorMatch{ID: result.Payload["id"], Score: result.Score})
+	}
+	return matches, nil
+}
+
+// pgvectorStore keeps embeddings in Postgres tables with the pgvector extension
+type pgvectorStore struct {
+	db     *sql.DB
+	prefix string
+
+	mu sync.Mutex
+	// created remembers the tables known to exist
+	created map[string]bool
+}
+
+// pgvectorLiteral formats a vector the way pgvector parses it, e.g. [0.1,0.2]
+func pgvectorLiteral(vector Vector) string {
+	var builder strings.Builder
+	builder.WriteByte('[')
+	for i, value := range vector {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteString(strconv.FormatFloat(float64(value), 'g', -1, 32))
+	}
+	builder.WriteByte(']')
+	return builder.String()
+}
+
+func (s *pgvectorStore) Close() error {
+	return s.db.Close()
+}
+
+// ensureTable creates a table and its HNSW index sized for the vectors the first time it is written
+func (s *pgvectorStore) ensureTable(ctx context.Context, table string, dimensions int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.created[table] {
+		return nil
+	}
+
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS vector",
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id text PRIMARY KEY, owner text NOT NULL DEFAULT '', embedding vector(%d) NOT NULL)", table, dimensions),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_embedding ON %s USING hnsw (embedding vector_cosine_ops)", table, table),
+	}
+	for _, statement := range statements {
+		if _, err := s.db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	s.created[table] = true
+	return nil
+}
+
+func (s *pgvectorStore) Upsert(ctx context.Context, collection string, points []VectorPoint) error {
+	table := s.prefix + "_" + collection
+	if err := s.ensureTable(ctx, table, len(points[0].Vector)); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statement := fmt.Sprintf("INSERT INTO %s (id, owner, embedding) VALUES ($1, $2, $3::vector) "+
+		"ON CONFLICT (id) DO UPDATE SET owner = excluded.owner, embedding = excluded.embedding", table)
+	for _, point := range points {
+		if _, err := tx.ExecContext(ctx, statement, point.ID, point.User, pgvectorLiteral(point.Vector)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *pgvectorStore) Delete(ctx context.Context, collection string, ids []string) error {
+	s.mu.Lock()
+	created := s.created[s.prefix+"_"+collection]
+	s.mu.Unlock()
+	if !created {
+		// The table may not exist yet, and a missing row needs no deleting
+		var exists bool
+		if err := s.db.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", s.prefix+"_"+collection).Scan(&exists); err != nil || !exists {
+			return err
+		}
+	}
+
+	statement := fmt.Sprintf("DELETE FROM %s_%s WHERE id = $1", s.prefix, collection)
+	for _, id := range ids {
+		if _, err := s.db.ExecContext(ctx, statement, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *pgvectorStore) Search(ctx context.Context, collection string, vector Vector, limit int, user string) ([]VectorMatch, error) {
+	query := fmt.Sprintf("SELECT id, 1 - (embedding <=> $1::vector) FROM %s_%s WHERE ($2 = '' OR owner = $2) ORDER BY embedding <=> $1::vector LIMIT $3", s.prefix, collection)
+	rows, err := s.db.QueryContext(ctx, query, pgvectorLiteral(vector), user, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []VectorMatch{}
+	for rows.Next() {
+		var match VectorMatch
+		if err := rows.Scan(&match.ID, &match.Score); err != nil {
+			return nil, err
+		}
+		matches = append(matches, match)
+	}
+	return matches, rows.Err()
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// version and commit are set at build time:
+// go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse --short HEAD)"
+var (
+	version = "dev"
+	commit  = ""
+)
+
+// updateCheckInterval is how long a release lookup is reused
+const updateCheckInterval = time.Hour
+
+// UpdatesConfig controls the check for newer releases on GitHub
+type UpdatesConfig struct {
+	Check bool `json:"check"`
+	// Repository is the GitHub owner/name whose releases are checked
+	Repository string `json:"repository"`
+}
+
+// VersionInfo describes the running build and, when checked, the latest release
+type VersionInfo struct {
+	Version         string `json:"version"`
+	Commit          string `json:"commit,omitempty"`
+	GoVersion       string `json:"go_version"`
+	LatestVersion   string `json:"latest_version,omitempty"`
+	UpdateAvailable bool   `json:"update_available"`
+	ReleaseURL      string `json:"release_url,omitempty"`
+	// UpdateError explains a failed update check
+	UpdateError string `json:"update_error,omitempty"`
+}
+
+// githubRelease is the subset of the GitHub release fields the update check uses
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	HTMLURL string `json:"html_url"`
+}
+
+var (
+	releaseClient = &http.Client{Timeout: 10 * time.Second}
+
+	releaseMu        sync.Mutex
+	latestRelease    *githubRelease
+	releaseCheckedAt time.Time
+)
+
+// buildInfo returns the version details of the running binary, falling back to
+// the VCS revision Go embeds when no commit was set at build time
+func buildInfo() VersionInfo {
+	info := VersionInfo{Version: version, Commit: commit}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		info.GoVersion = build.GoVersion
+		if info.Commit == "" {
+			for _, setting := range build.Settings {
+				if setting.Key == "vcs.revision" && len(setting.Value) >= 7 {
+					info.Commit = setting.Value[:7]
+				}
+			}
+		}
+	}
+
+	return info
+}
+
+// fetchLatestRelease looks up the latest GitHub release, reusing a recent answer
+func fetchLatestRelease(ctx context.Context, repository string) (*githubRelease, error) {
+	releaseMu.Lock()
+	defer releaseMu.Unlock()
+
+	if latestRelease != nil && time.Since(releaseCheckedAt) < updateCheckInterval {
+		return latestRelease, nil
+	}
+
+	url := fmt.Sprintf("https://api.github.com/repos/%s/releases/latest", repository)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := releaseClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error contacting GitHub: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub returned %s", resp.Status)
+	}
+
+	var release githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, fmt.Errorf("error decoding GitHub response: %w", err)
+	}
+
+	latestRelease = &release
+	releaseCheckedAt = time.Now()
+	return latestRelease, nil
+}
+
+// parseVersion splits a version like v1.2.3 into its numbers
+func parseVersion(value string) ([]int, bool) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "v")
+	value, _, _ = strings.Cut(value, "-")
+
+	parts := strings.Split(value, ".")
+	numbers := make([]int, 0, len(parts))
+	for _, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, false
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers, true
+}
+
+// newerVersion reports whether latest is a later release than current. Development
+// builds aren't compared since they don't correspond to a release.
+func newerVersion(current, latest string) bool {
+	currentParts, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+	latestParts, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+
+	for i := 0; i < max(len(currentParts), len(latestParts)); i++ {
+		var c, l int
+		if i < len(currentParts) {
+			c = currentParts[i]
+		}
+		if i < len(latestParts) {
+			l = latestParts[i]
+		}
+		if c != l {
+			return l > c
+		}
+	}
+	return false
+}
+
+// checkVersion returns the build details, with the latest release when check is set
+func checkVersion(ctx context.Context, check bool) VersionInfo {
+	info := buildInfo()
+	if !check {
+		return info
+	}
+
+	release, err := fetchLatestRelease(ctx, currentConfig().Updates.Repository)
+	if err != nil {
+		info.UpdateError = err.Error()
+		return info
+	}
+
+	info.LatestVersion = release.TagName
+	info.ReleaseURL = release.HTMLURL
+	info.UpdateAvailable = newerVersion(info.Version, release.TagName)
+	return info
+}
+
+// printVersion is the "aidea version" command
+func printVersion() {
+	info := checkVersion(context.Background(), currentConfig().Updates.Check)
+
+	fmt.Printf("aidea %s", info.Version)
+	if info.Commit != "" {
+		fmt.Printf(" (%s)", info.Commit)
+	}
+	fmt.Printf(" %s\n", info.GoVersion)
+
+	switch {
+	case info.UpdateError != "":
+		fmt.Printf("Couldn't check for updates: %s\n", info.UpdateError)
+	case info.UpdateAvailable:
+		fmt.Printf("%s is available: %s\n", info.LatestVersion, info.ReleaseURL)
+	case info.LatestVersion != "":
+		fmt.Println("This is the latest release.")
+	}
+}
+
+// versionHandler returns the build version, checking GitHub for a newer release
+// when update checks are enabled or ?check=true is passed
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	check := currentConfig().Updates.Check
+	if value := r.URL.Query().Get("check"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			writeValidationError(w, r, ErrorDetail{Field: "check", Message: "check must be true or false"})
+			return
+		}
+		check = parsed
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(checkVersion(r.Context(), check))
+}
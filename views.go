@@ -0,0 +1,437 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const viewsFile = "aidea_views.json"
+
+// viewParams are the query parameters a view may save
+var viewParams = []string{"period", "from", "to", "task", "jira", "tag", "type", "by", "group", "weeks", "week", "date", "user", "columns", "exclude", "attribution"}
+
+// viewPeriods are the relative date ranges a view may save instead of fixed dates
+var viewPeriods = []string{"today", "yesterday", "this_week", "last_week", "this_month", "last_month"}
+
+// View is a user's named set of query parameters, passed to list and report
+// endpoints as ?view=<id or name> so clients don't repeat long query strings
+type View struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	User      string            `json:"user"`
+	Query     map[string]string `json:"query"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// ViewRequest represents the JSON request for creating or updating a view
+type ViewRequest struct {
+	Name  string            `json:"name"`
+	Query map[string]string `json:"query"`
+}
+
+// EntryFilter narrows entry lists to a category, Jira issue or project, and tag
+type EntryFilter struct {
+	Task string
+	Jira string
+	Tag  string
+}
+
+var (
+	viewsMu sync.Mutex
+	views   []View
+)
+
+// loadViews reads the views file once, callers must hold viewsMu
+func loadViews() error {
+	if views != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(viewsFile)
+	if os.IsNotExist(err) {
+		views = []View{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read views: %v", err)
+	}
+
+	var loaded []View
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("couldn't parse views: %v", err)
+	}
+
+	views = loaded
+	return nil
+}
+
+// saveViews writes the views file, callers must hold viewsMu
+func saveViews() error {
+	data, err := json.MarshalIndent(views, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't encode views: %v", err)
+	}
+
+	return os.WriteFile(viewsFile, data, 0644)
+}
+
+// listViews returns a copy of a user's views
+func listViews(user string) ([]View, error) {
+	viewsMu.Lock()
+	defer viewsMu.Unlock()
+
+	if err := loadViews(); err != nil {
+		return nil, err
+	}
+
+	own := []View{}
+	for _, view := range views {
+		if view.User == user {
+			own = append(own, view)
+		}
+	}
+	return own, nil
+}
+
+// findView returns a user's view by ID or name
+func findView(user, ref string) (*View, error) {
+	own, err := listViews(user)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, view := range own {
+		if view.ID == ref || strings.EqualFold(view.Name, ref) {
+			return &view, nil
+		}
+	}
+	return nil, nil
+}
+
+// viewRange resolves a relative period to its first and last day
+func viewRange(period string, now time.Time) (time.Time, time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	switch period {
+	case "yesterday":
+		yesterday := today.AddDate(0, 0, -1)
+		return yesterday, yesterday
+	case "this_week":
+		start := weekStart(today)
+		return start, start.AddDate(0, 0, 6)
+	case "last_week":
+		start := weekStart(today).AddDate(0, 0, -7)
+		return start, start.AddDate(0, 0, 6)
+	case "this_month":
+		first := today.AddDate(0, 0, 1-today.Day())
+		return first, first.AddDate(0, 1, -1)
+	case "last_month":
+		first := today.AddDate(0, 0, 1-today.Day()).AddDate(0, -1, 0)
+		return first, first.AddDate(0, 1, -1)
+	default:
+		return today, today
+	}
+}
+
+// applyView expands ?view= into the view's saved parameters. Parameters given
+// on the request take precedence, and a saved period becomes from/to in the
+// date format of the API version being called.
+func applyView(r *http.Request) (*http.Request, bool, error) {
+	query := r.URL.Query()
+	ref := query.Get("view")
+	if ref == "" {
+		return r, true, nil
+	}
+
+	user := currentUser(r)
+	view, err := findView(user.Name, ref)
+	if err != nil {
+		return r, false, err
+	}
+	if view == nil {
+		return r, false, nil
+	}
+
+	layout := "20060102"
+	if strings.HasPrefix(r.URL.Path, "/api/v2/") {
+		layout = "2006-01-02"
+	}
+
+	query.Del("view")
+	for key, value := range view.Query {
+		if key == "period" {
+			if !query.Has("from") && !query.Has("to") {
+				from, to := viewRange(value, userToday(user.Name))
+				query.Set("from", from.Format(layout))
+				query.Set("to", to.Format(layout))
+			}
+			continue
+		}
+		if !query.Has(key) {
+			query.Set(key, value)
+		}
+	}
+
+	expanded := r.Clone(r.Context())
+	expanded.URL.RawQuery = query.Encode()
+	return expanded, true, nil
+}
+
+// withView lets a handler be called with ?view= in place of the view's parameters
+func withView(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		expanded, found, err := applyView(r)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !found {
+			writeError(w, r, http.StatusNotFound, "View not found")
+			return
+		}
+		next(w, expanded)
+	}
+}
+
+// parseEntryFilter reads the optional task, jira and tag filters from the query
+func parseEntryFilter(r *http.Request) (EntryFilter, []ErrorDetail) {
+	query := r.URL.Query()
+	filter := EntryFilter{Task: query.Get("task"), Jira: query.Get("jira"), Tag: query.Get("tag")}
+
+	v := &validator{}
+	v.text("task", filter.Task, false, maxTaskLength)
+	v.jiraReference("jira", filter.Jira)
+	v.tag("tag", filter.Tag)
+
+	return filter, v.details
+}
+
+// matches reports whether an entry passes the filter. Task matches the category
+// or its aliases, Jira an issue key or every issue of a project.
+func (f EntryFilter) matches(entry TimeEntry) bool {
+	if f.Task != "" {
+		current, _ := canonicalCategory(entry.Task)
+		wanted, _ := canonicalCategory(f.Task)
+		if !strings.EqualFold(current, wanted) {
+			return false
+		}
+	}
+	if f.Jira != "" && entry.Jira != f.Jira && jiraProject(entry.Jira) != f.Jira {
+		return false
+	}
+	if f.Tag != "" && !slices.Contains(entry.Tags, f.Tag) {
+		return false
+	}
+	return true
+}
+
+// validateView checks a view payload, keeping names unique per user
+func validateView(request ViewRequest, existing []View, user, id string) []ErrorDetail {
+	v := &validator{}
+	v.text("name", request.Name, true, maxTaskLength)
+	if len(request.Query) == 0 {
+		v.add("query", "query must set at least one parameter")
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(request.Query)) {
+		value := request.Query[key]
+		switch {
+		case !slices.Contains(viewParams, key):
+			v.add("query", "%q can't be saved in a view, expected one of %s", key, strings.Join(viewParams, ", "))
+		case key == "period":
+			v.oneOf("query.period", value, viewPeriods)
+		default:
+			v.text("query."+key, value, true, maxTaskLength)
+		}
+	}
+	if request.Query["period"] != "" && (request.Query["from"] != "" || request.Query["to"] != "") {
+		v.add("query.period", "period can't be combined with from or to")
+	}
+
+	for _, view := range existing {
+		if view.ID != id && view.User == user && strings.EqualFold(view.Name, strings.TrimSpace(request.Name)) {
+			v.add("name", "a view named %q already exists", view.Name)
+		}
+	}
+
+	return v.details
+}
+
+func parseViewRequest(w http.ResponseWriter, r *http.Request) (ViewRequest, bool) {
+	var request ViewRequest
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+		return request, false
+	}
+	defer r.Body.Close()
+
+	// Parse JSON request
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+		return request, false
+	}
+
+	if request.Query["period"] != "" {
+		request.Query["period"] = strings.ToLower(request.Query["period"])
+	}
+
+	return request, true
+}
+
+// viewsHandler lists (GET) or creates (POST) the current user's views
+func viewsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		requireScope(ScopeEntriesRead, listViewsHandler)(w, r)
+	case http.MethodPost:
+		requireScope(ScopeEntriesRead, createViewHandler)(w, r)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// viewHandler updates (PUT) or deletes (DELETE) one of the current user's views
+func viewHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		requireScope(ScopeEntriesRead, updateViewHandler)(w, r)
+	case http.MethodDelete:
+		requireScope(ScopeEntriesRead, deleteViewHandler)(w, r)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func listViewsHandler(w http.ResponseWriter, r *http.Request) {
+	own, err := listViews(currentUser(r).Name)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(own)
+}
+
+func createViewHandler(w http.ResponseWriter, r *http.Request) {
+	request, ok := parseViewRequest(w, r)
+	if !ok {
+		return
+	}
+
+	user := currentUser(r).Name
+
+	viewsMu.Lock()
+	defer viewsMu.Unlock()
+
+	if err := loadViews(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if details := validateView(request, views, user, ""); len(details) > 0 {
+		writeValidationError(w, r, details...)
+		return
+	}
+
+	view := View{
+		ID:        uuid.New().String(),
+		Name:      strings.TrimSpace(request.Name),
+		User:      user,
+		Query:     request.Query,
+		UpdatedAt: time.Now(),
+	}
+
+	views = append(views, view)
+	if err := saveViews(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving view: "+err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(view)
+}
+
+func updateViewHandler(w http.ResponseWriter, r *http.Request) {
+	request, ok := parseViewRequest(w, r)
+	if !ok {
+		return
+	}
+
+	id := r.PathValue("id")
+	user := currentUser(r).Name
+
+	viewsMu.Lock()
+	defer viewsMu.Unlock()
+
+	if err := loadViews(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	index := slices.IndexFunc(views, func(v View) bool { return v.ID == id && v.User == user })
+	if index == -1 {
+		writeError(w, r, http.StatusNotFound, "View not found")
+		return
+	}
+
+	if details := validateView(request, views, user, id); len(details) > 0 {
+		writeValidationError(w, r, details...)
+		return
+	}
+
+	views[index].Name = strings.TrimSpace(request.Name)
+	views[index].Query = request.Query
+	views[index].UpdatedAt = time.Now()
+	if err := saveViews(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving view: "+err.Error())
+		return
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views[index])
+}
+
+func deleteViewHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	user := currentUser(r).Name
+
+	viewsMu.Lock()
+	defer viewsMu.Unlock()
+
+	if err := loadViews(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	index := slices.IndexFunc(views, func(v View) bool { return v.ID == id && v.User == user })
+	if index == -1 {
+		writeError(w, r, http.StatusNotFound, "View not found")
+		return
+	}
+
+	views = slices.Delete(views, index, index+1)
+	if err := saveViews(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error saving views: "+err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// weekReportTemplate is the template file rendered for weekly reports
+const weekReportTemplate = "week_report.html"
+
+//go:embed templates/*.html
+var reportTemplates embed.FS
+
+// ReportsConfig controls the HTML reports
+type ReportsConfig struct {
+	// TemplateDir holds templates overriding the built-in ones by file name
+	TemplateDir string `json:"template_dir"`
+	// RollupHours is how often the weekly and monthly rollup tables are refreshed,
+	// default 6, negative to turn the refresh off
+	RollupHours int `json:"rollup_hours,omitempty"`
+}
+
+// WeekReportDay holds one day of a weekly report
+type WeekReportDay struct {
+	Date         string
+	Weekday      string
+	Entries      []TimeEntry
+	TotalMinutes int
+}
+
+// WeekReportTask is a task's total for the week
+type WeekReportTask struct {
+	Task    string
+	Minutes int
+}
+
+// WeekReport is the data behind the HTML weekly report
+type WeekReport struct {
+	User          string
+	WeekStart     string
+	WeekEnd       string
+	Days          []WeekReportDay
+	Tasks         []WeekReportTask
+	LowConfidence []TimeEntry
+	EntryCount    int
+	TotalMinutes  int
+	// Categories holds the color and icon of the styled tasks
+	Categories map[string]CategoryStyle
+}
+
+var reportFuncs = template.FuncMap{
+	"hours":      formatHours,
+	"entryHours": func(entry TimeEntry) string { return formatHours(entryMinutes(entry)) },
+}
+
+// loadReportTemplate parses a report template, preferring a copy in the
+// configured template directory so reports can be restyled without a rebuild
+func loadReportTemplate(name string) (*template.Template, error) {
+	if dir := currentConfig().Reports.TemplateDir; dir != "" {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return template.New(name).Funcs(reportFuncs).ParseFiles(path)
+		}
+	}
+	return template.New(name).Funcs(reportFuncs).ParseFS(reportTemplates, "templates/"+name)
+}
+
+// buildWeekReport groups a user's entries for the week starting on week by day and task
+func buildWeekReport(ctx context.Context, user string, week time.Time, entries []TimeEntry) *WeekReport {
+	report := &WeekReport{
+		User:          user,
+		WeekStart:     entryDate(week),
+		WeekEnd:       entryDate(week.AddDate(0, 0, 6)),
+		LowConfidence: []TimeEntry{},
+	}
+
+	days := make(map[string]*WeekReportDay)
+	for i := 0; i < 7; i++ {
+		day := week.AddDate(0, 0, i)
+		report.Days = append(report.Days, WeekReportDay{Date: entryDate(day), Weekday: day.Weekday().String()})
+	}
+	for i := range report.Days {
+		days[report.Days[i].Date] = &report.Days[i]
+	}
+
+	taskMinutes := make(map[string]int)
+	for _, entry := range entries {
+		day, ok := days[entry.Date]
+		if !ok || entryOwner(entry) != user {
+			continue
+		}
+
+		minutes := entryMinutes(entry)
+		day.Entries = append(day.Entries, entry)
+		day.TotalMinutes += minutes
+		report.EntryCount++
+		report.TotalMinutes += minutes
+
+		for _, share := range attributeMinutes(ctx, entry, minutes) {
+			task := share.Task
+			if task == "" {
+				task = "Uncategorized"
+			}
+			taskMinutes[task] += share.Minutes
+		}
+
+		if !entry.Categorized && entry.Confidence == "low" {
+			report.LowConfidence = append(report.LowConfidence, entry)
+		}
+	}
+
+	for task, minutes := range taskMinutes {
+		report.Tasks = append(report.Tasks, WeekReportTask{Task: task, Minutes: minutes})
+	}
+	sort.Slice(report.Tasks, func(i, j int) bool {
+		if report.Tasks[i].Minutes != report.Tasks[j].Minutes {
+			return report.Tasks[i].Minutes > report.Tasks[j].Minutes
+		}
+		return report.Tasks[i].Task < report.Tasks[j].Task
+	})
+
+	names := make([]string, 0, len(report.Tasks))
+	for _, task := range report.Tasks {
+		names = append(names, task.Task)
+	}
+	report.Categories = categoryStyles(names)
+
+	return report
+}
+
+// renderWeekReport writes the HTML report for a user's week, for the web page and email digests
+func renderWeekReport(ctx context.Context, out io.Writer, user string, week time.Time) error {
+	entries, err := readEntriesBetween(ctx, week, week.AddDate(0, 0, 6))
+	if err != nil {
+		return fmt.Errorf("error reading entries: %v", err)
+	}
+
+	tmpl, err := loadReportTemplate(weekReportTemplate)
+	if err != nil {
+		return fmt.Errorf("error loading report template: %v", err)
+	}
+
+	return tmpl.Execute(out, buildWeekReport(ctx, user, week, entries))
+}
+
+// weekReportHandler serves the HTML report for the week containing {date} (YYYYMMDD),
+// managers may pass ?user= to see someone else's week
+func weekReportHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET method
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	current := currentUser(r)
+	user := current.Name
+	if requested := r.URL.Query().Get("user"); requested != "" && requested != user {
+		if !current.HasRole(RoleManager) {
+			writeError(w, r, http.StatusForbidden, "Forbidden")
+			return
+		}
+		user = requested
+	}
+
+	week, err := parseWeek(r.PathValue("date"), user)
+	if err != nil {
+		writeValidationError(w, r, ErrorDetail{Field: "date", Message: err.Error()})
+		return
+	}
+	ctx, details := attributionContext(r)
+	if len(details) > 0 {
+		writeValidationError(w, r, details...)
+		return
+	}
+
+	// Render into a buffer so template errors still produce a proper error response
+	var page bytes.Buffer
+	if err := renderWeekReport(ctx, &page, user, week); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page.Bytes())
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// WorkingHours is a user's normal working window, e.g. 09:00-17:00 Monday to Friday
+type WorkingHours struct {
+	Start string `json:"start"` // HH:MM
+	End   string `json:"end"`   // HH:MM
+	// Days are lowercase three-letter weekday names, e.g. "mon"
+	Days []string `json:"days"`
+}
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// validate checks the window parses and ends after it starts
+func (h WorkingHours) validate() error {
+	start, err := time.Parse("15:04", h.Start)
+	if err != nil {
+		return fmt.Errorf("invalid start %q, expected HH:MM", h.Start)
+	}
+	end, err := time.Parse("15:04", h.End)
+	if err != nil {
+		return fmt.Errorf("invalid end %q, expected HH:MM", h.End)
+	}
+	if !end.After(start) {
+		return fmt.Errorf("end %s must be after start %s", h.End, h.Start)
+	}
+
+	for _, day := range h.Days {
+		if !slices.Contains(weekdayNames, strings.ToLower(day)) {
+			return fmt.Errorf("unknown day %q, expected one of %s", day, strings.Join(weekdayNames, ", "))
+		}
+	}
+
+	return nil
+}
+
+// WorksOn reports whether the weekday is a working day
+func (h WorkingHours) WorksOn(weekday time.Weekday) bool {
+	return slices.ContainsFunc(h.Days, func(day string) bool {
+		return strings.EqualFold(day, weekdayNames[weekday])
+	})
+}
+
+// DailyMinutes is the length of the working window
+func (h WorkingHours) DailyMinutes() int {
+	start, _ := time.Parse("15:04", h.Start)
+	end, _ := time.Parse("15:04", h.End)
+	return int(end.Sub(start).Minutes())
+}
+
+// userWorkingHours returns a user's own working hours or the configured default
+func userWorkingHours(name string) WorkingHours {
+	if user := findUser(name); user != nil && user.WorkingHours != nil {
+		return *user.WorkingHours
+	}
+	return currentConfig().WorkingHours
+}
+
+// configureWorkingHours validates the default and per-user working hours
+func configureWorkingHours(config Config) error {
+	if err := config.WorkingHours.validate(); err != nil {
+		return fmt.Errorf("working hours: %v", err)
+	}
+
+	for _, user := range config.Users {
+		if user.WorkingHours == nil {
+			continue
+		}
+		if err := user.WorkingHours.validate(); err != nil {
+			return fmt.Errorf("working hours for user %s: %v", user.Name, err)
+		}
+	}
+
+	return nil
+}
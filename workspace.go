@@ -0,0 +1,516 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Workspace archives are zip files identified by their manifest
+const (
+	workspaceFormat = "aidea-workspace"
+	// workspaceVersion is bumped when the archive layout changes, older archives
+	// are still read
+	workspaceVersion = 1
+)
+
+// Archive members besides the entries, each holding a JSON store as it is saved on disk
+const (
+	workspaceManifest    = "manifest.json"
+	workspaceEntries     = "entries.ndjson"
+	workspaceRules       = "rules.json"
+	workspaceCategories  = "categories.json"
+	workspaceAliases     = "aliases.json"
+	workspacePreferences = "preferences.json"
+	workspaceViews       = "views.json"
+)
+
+// WorkspaceManifest describes a workspace archive and counts what it holds
+type WorkspaceManifest struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	AppVersion string    `json:"app_version"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Entries includes the trash, so deleted entries can still be restored after a move
+	Entries     int `json:"entries"`
+	Rules       int `json:"rules"`
+	Categories  int `json:"categories"`
+	Aliases     int `json:"aliases"`
+	Preferences int `json:"preferences"`
+	Views       int `json:"views"`
+}
+
+// workspace is the contents of an archive, a nil store was missing from it
+type workspace struct {
+	entries     []TimeEntry
+	rules       []ActivityRule
+	categories  []Category
+	aliases     []Alias
+	preferences map[string]Preferences
+	views       []View
+}
+
+// errWorkspaceNotEmpty keeps an import from replacing existing data unless asked to
+var errWorkspaceNotEmpty = errors.New("this workspace already has entries, import with replace to overwrite them")
+
+// exportWorkspace writes every entry, rule, category, alias, preference and view as
+// a workspace archive. Entries are stored one JSON object per line, independent of
+// the rollover and file name template, so an archive moves between storage layouts.
+func exportWorkspace(w io.Writer) (WorkspaceManifest, error) {
+	manifest := WorkspaceManifest{Format: workspaceFormat, Version: workspaceVersion, AppVersion: version, CreatedAt: time.Now().UTC()}
+	archive := zip.NewWriter(w)
+
+	member, err := archive.Create(workspaceEntries)
+	if err != nil {
+		return manifest, err
+	}
+	if manifest.Entries, err = exportWorkspaceEntries(member); err != nil {
+		return manifest, err
+	}
+
+	rulesMu.Lock()
+	err = loadRules()
+	manifest.Rules = len(rules)
+	if err == nil {
+		err = writeWorkspaceMember(archive, workspaceRules, rules)
+	}
+	rulesMu.Unlock()
+	if err != nil {
+		return manifest, err
+	}
+
+	categoriesMu.Lock()
+	err = loadCategories()
+	manifest.Categories = len(categories)
+	if err == nil {
+		err = writeWorkspaceMember(archive, workspaceCategories, categories)
+	}
+	categoriesMu.Unlock()
+	if err != nil {
+		return manifest, err
+	}
+
+	aliasesMu.Lock()
+	err = loadAliases()
+	manifest.Aliases = len(aliases)
+	if err == nil {
+		err = writeWorkspaceMember(archive, workspaceAliases, aliases)
+	}
+	aliasesMu.Unlock()
+	if err != nil {
+		return manifest, err
+	}
+
+	preferencesMu.Lock()
+	err = loadPreferences()
+	manifest.Preferences = len(preferences)
+	if err == nil {
+		err = writeWorkspaceMember(archive, workspacePreferences, preferences)
+	}
+	preferencesMu.Unlock()
+	if err != nil {
+		return manifest, err
+	}
+
+	viewsMu.Lock()
+	err = loadViews()
+	manifest.Views = len(views)
+	if err == nil {
+		err = writeWorkspaceMember(archive, workspaceViews, views)
+	}
+	viewsMu.Unlock()
+	if err != nil {
+		return manifest, err
+	}
+
+	// The manifest is written last, once the counts are known
+	if err := writeWorkspaceMember(archive, workspaceManifest, manifest); err != nil {
+		return manifest, err
+	}
+	return manifest, archive.Close()
+}
+
+// exportWorkspaceEntries writes every entry of every data file as a JSON line,
+// giving undated entries the day of the daily file they are in
+func exportWorkspaceEntries(w io.Writer) (int, error) {
+	storageMu.Lock()
+	defer storageMu.Unlock()
+
+	filenames, err := dataFiles()
+	if err != nil {
+		return 0, err
+	}
+
+	encoder := json.NewEncoder(w)
+	count := 0
+	for _, filename := range filenames {
+		entries, err := readEntries(filename)
+		if err != nil {
+			return count, fmt.Errorf("%s: %v", filename, err)
+		}
+		for _, entry := range entries {
+			if entry.Date == "" {
+				if day, ok := filenameDay(filename); ok {
+					entry.Date = entryDate(day)
+				}
+			}
+			if err := encoder.Encode(entry); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// writeWorkspaceMember adds a JSON member to the archive
+func writeWorkspaceMember(archive *zip.Writer, name string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't encode %s: %v", name, err)
+	}
+	member, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = member.Write(data)
+	return err
+}
+
+// readWorkspace reads and checks every member of an archive before anything is imported
+func readWorkspace(r io.ReaderAt, size int64) (WorkspaceManifest, workspace, error) {
+	var manifest WorkspaceManifest
+	var contents workspace
+
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return manifest, contents, fmt.Errorf("not a workspace archive: %v", err)
+	}
+	members := make(map[string]*zip.File)
+	for _, file := range archive.File {
+		members[file.Name] = file
+	}
+
+	if err := readWorkspaceMember(members, workspaceManifest, &manifest); err != nil {
+		return manifest, contents, err
+	}
+	if manifest.Format != workspaceFormat {
+		return manifest, contents, fmt.Errorf("not a workspace archive: format %q", manifest.Format)
+	}
+	if manifest.Version < 1 || manifest.Version > workspaceVersion {
+		return manifest, contents, fmt.Errorf("workspace archive version %d isn't supported, this build reads up to version %d", manifest.Version, workspaceVersion)
+	}
+
+	if contents.entries, err = readWorkspaceEntries(members[workspaceEntries]); err != nil {
+		return manifest, contents, err
+	}
+
+	for name, target := range map[string]interface{}{
+		workspaceRules:       &contents.rules,
+		workspaceCategories:  &contents.categories,
+		workspaceAliases:     &contents.aliases,
+		workspacePreferences: &contents.preferences,
+		workspaceViews:       &contents.views,
+	} {
+		if _, ok := members[name]; !ok {
+			continue
+		}
+		if err := readWorkspaceMember(members, name, target); err != nil {
+			return manifest, contents, err
+		}
+	}
+
+	for name, prefs := range contents.preferences {
+		if prefs.Timezone == "" {
+			continue
+		}
+		if _, err := time.LoadLocation(prefs.Timezone); err != nil {
+			return manifest, contents, fmt.Errorf("%s: invalid timezone for %s: %v", workspacePreferences, name, err)
+		}
+	}
+	return manifest, contents, nil
+}
+
+// readWorkspaceMember decodes a JSON member of the archive
+func readWorkspaceMember(members map[string]*zip.File, name string, target interface{}) error {
+	file, ok := members[name]
+	if !ok {
+		return fmt.Errorf("workspace archive has no %s", name)
+	}
+	member, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	defer member.Close()
+
+	if err := json.NewDecoder(member).Decode(target); err != nil {
+		return fmt.Errorf("couldn't parse %s: %v", name, err)
+	}
+	return nil
+}
+
+// readWorkspaceEntries decodes the entries, every one needs an ID and a date
+func readWorkspaceEntries(file *zip.File) ([]TimeEntry, error) {
+	if file == nil {
+		return nil, nil
+	}
+	member, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", workspaceEntries, err)
+	}
+	defer member.Close()
+
+	entries := []TimeEntry{}
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(member)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry TimeEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", workspaceEntries, line, err)
+		}
+		if entry.ID == "" || seen[entry.ID] {
+			return nil, fmt.Errorf("%s line %d: missing or duplicate id %q", workspaceEntries, line, entry.ID)
+		}
+		if _, err := time.Parse("2006-01-02", entry.Date); err != nil {
+			return nil, fmt.Errorf("%s line %d: invalid date %q", workspaceEntries, line, entry.Date)
+		}
+		seen[entry.ID] = true
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", workspaceEntries, err)
+	}
+	return entries, nil
+}
+
+// importWorkspace replaces this workspace with an archive's. Entries are written
+// into files by the current rollover and file name template. Stores missing from
+// the archive are left as they are. Without replace, a workspace that has entries
+// is left untouched.
+func importWorkspace(ctx context.Context, r io.ReaderAt, size int64, replace bool) (WorkspaceManifest, error) {
+	manifest, contents, err := readWorkspace(r, size)
+	if err != nil {
+		return manifest, err
+	}
+
+	ids, err := importWorkspaceEntries(contents.entries, replace)
+	if err != nil {
+		return manifest, err
+	}
+
+	if contents.rules != nil {
+		rulesMu.Lock()
+		warnRuleDimensions(contents.rules)
+		rules = contents.rules
+		err = saveRules()
+		rulesMu.Unlock()
+		if err != nil {
+			return manifest, fmt.Errorf("error saving rules: %v", err)
+		}
+	}
+
+	if contents.categories != nil {
+		categoriesMu.Lock()
+		categories = contents.categories
+		err = saveCategories()
+		categoriesMu.Unlock()
+		if err != nil {
+			return manifest, fmt.Errorf("error saving categories: %v", err)
+		}
+	}
+
+	if contents.aliases != nil {
+		aliasesMu.Lock()
+		aliases = contents.aliases
+		err = saveAliases()
+		aliasesMu.Unlock()
+		if err != nil {
+			return manifest, fmt.Errorf("error saving aliases: %v", err)
+		}
+	}
+
+	if contents.preferences != nil {
+		preferencesMu.Lock()
+		preferences = contents.preferences
+		err = savePreferences()
+		// Reading the file again loads the time zones of the imported preferences
+		preferences = nil
+		clear(preferenceLocations)
+		if err == nil {
+			err = loadPreferences()
+		}
+		preferencesMu.Unlock()
+		if err != nil {
+			return manifest, fmt.Errorf("error saving preferences: %v", err)
+		}
+	}
+
+	if contents.views != nil {
+		viewsMu.Lock()
+		views = contents.views
+		err = saveViews()
+		viewsMu.Unlock()
+		if err != nil {
+			return manifest, fmt.Errorf("error saving views: %v", err)
+		}
+	}
+
+	// Embeddings of entries that weren't imported are stale, the rest stay valid
+	if _, err := pruneEntryEmbeddings(ctx, ids); err != nil {
+		return manifest, fmt.Errorf("error pruning entry embeddings: %v", err)
+	}
+	syncVectorStore()
+	return manifest, nil
+}
+
+// importWorkspaceEntries replaces the data files with the archive's entries,
+// returning their IDs
+func importWorkspaceEntries(entries []TimeEntry, replace bool) (map[string]bool, error) {
+	storageMu.Lock()
+	defer storageMu.Unlock()
+
+	existing, err := dataFiles()
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 && !replace {
+		return nil, errWorkspaceNotEmpty
+	}
+
+	files := make(map[string][]TimeEntry)
+	ids := make(map[string]bool)
+	for _, entry := range entries {
+		day, _ := time.Parse("2006-01-02", entry.Date)
+		filename := dataFilename(day)
+		files[filename] = append(files[filename], entry)
+		ids[entry.ID] = true
+	}
+
+	filenames := make([]string, 0, len(files))
+	for filename := range files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		entries := files[filename]
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Date < entries[j].Date })
+		if err := writeEntries(filename, entries); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+	}
+	for _, filename := range existing {
+		if _, ok := files[filename]; ok {
+			continue
+		}
+		if err := os.Remove(filename); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+	}
+	return ids, nil
+}
+
+// runWorkspace is the "aidea workspace export|import FILE [--replace]" command
+func runWorkspace(args []string, out io.Writer) error {
+	replace := slices.Contains(args, "--replace")
+	args = slices.DeleteFunc(slices.Clone(args), func(arg string) bool { return arg == "--replace" })
+	if len(args) != 2 || (args[0] != "export" && args[0] != "import") {
+		return errors.New("usage: aidea workspace export|import FILE [--replace]")
+	}
+	path := args[1]
+
+	if args[0] == "export" {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		manifest, err := exportWorkspace(file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+			return err
+		}
+		fmt.Fprintf(out, "Exported %d entries, %d rules, %d categories, %d aliases, %d preferences and %d views to %s\n",
+			manifest.Entries, manifest.Rules, manifest.Categories, manifest.Aliases, manifest.Preferences, manifest.Views, path)
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	manifest, err := importWorkspace(context.Background(), file, info.Size(), replace)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Imported %d entries, %d rules, %d categories, %d aliases, %d preferences and %d views from %s (exported by %s on %s)\n",
+		manifest.Entries, manifest.Rules, manifest.Categories, manifest.Aliases, manifest.Preferences, manifest.Views,
+		path, manifest.AppVersion, manifest.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintln(out, "Restart a running server to pick up the imported workspace")
+	return nil
+}
+
+// workspaceHandler downloads the workspace archive on GET and replaces the workspace
+// with an uploaded one on POST, rejecting other writes while it is imported.
+// ?replace=true overwrites existing entries.
+func workspaceHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// The archive is built in memory so a failure can still be reported as an error
+		var buffer bytes.Buffer
+		if _, err := exportWorkspace(&buffer); err != nil {
+			writeError(w, r, http.StatusInternalServerError, "Error exporting workspace: "+err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="aidea-workspace-%s.zip"`, time.Now().Format("20060102")))
+		w.Write(buffer.Bytes())
+	case http.MethodPost:
+		// Read request body
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+			return
+		}
+		defer r.Body.Close()
+
+		if err := enterMaintenance("importing a workspace", 0); err == nil {
+			defer leaveMaintenance()
+		}
+		manifest, err := importWorkspace(r.Context(), bytes.NewReader(body), int64(len(body)), r.URL.Query().Get("replace") == "true")
+		if errors.Is(err, errWorkspaceNotEmpty) {
+			writeError(w, r, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "Error importing workspace: "+err.Error())
+			return
+		}
+
+		// Send JSON response
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(manifest)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultZoomURL      = "https://api.zoom.us/v2"
+	defaultZoomTokenURL = "https://zoom.us/oauth/token"
+)
+
+// ZoomConfig holds the Server-to-Server OAuth app used to read meeting reports
+type ZoomConfig struct {
+	AccountID    string `json:"account_id"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	BaseURL      string `json:"base_url,omitempty"`
+	TokenURL     string `json:"token_url,omitempty"`
+	// Email is the Zoom user whose meetings are imported, Emails overrides it per tracker user
+	Email  string            `json:"email"`
+	Emails map[string]string `json:"emails,omitempty"`
+}
+
+// MeetingAttendance is the time a user actually spent in a meeting
+type MeetingAttendance struct {
+	Topic    string    `json:"topic"`
+	Joined   time.Time `json:"joined"`
+	Left     time.Time `json:"left"`
+	Minutes  int       `json:"minutes"`
+	Timespan string    `json:"timespan"`
+	// EntryID is the entry created or corrected, Updated tells which
+	EntryID string `json:"entry_id,omitempty"`
+	Updated bool   `json:"updated,omitempty"`
+	// Previous is the corrected entry's timespan before the import
+	Previous string `json:"previous_timespan,omitempty"`
+}
+
+type zoomMeeting struct {
+	UUID      string    `json:"uuid"`
+	Topic     string    `json:"topic"`
+	StartTime time.Time `json:"start_time"`
+}
+
+type zoomParticipant struct {
+	UserEmail string    `json:"user_email"`
+	JoinTime  time.Time `json:"join_time"`
+	LeaveTime time.Time `json:"leave_time"`
+	Duration  int       `json:"duration"`
+}
+
+var (
+	zoomClient    = &http.Client{Timeout: 30 * time.Second}
+	zoomTokenMu   sync.Mutex
+	zoomToken     string
+	zoomTokenTill time.Time
+)
+
+func zoomConfigured() bool {
+	config := currentConfig().Zoom
+	return config.AccountID != "" && config.ClientID != "" && config.ClientSecret != ""
+}
+
+// zoomEmail returns the Zoom user of a tracker user
+func zoomEmail(user string) string {
+	if email, found := currentConfig().Zoom.Emails[user]; found {
+		return email
+	}
+	return currentConfig().Zoom.Email
+}
+
+// zoomAccessToken returns a cached account credentials token, fetching a new one when it expires
+func zoomAccessToken() (string, error) {
+	zoomTokenMu.Lock()
+	defer zoomTokenMu.Unlock()
+
+	if zoomToken != "" && time.Now().Before(zoomTokenTill) {
+		return zoomToken, nil
+	}
+
+	tokenURL := currentConfig().Zoom.TokenURL
+	if tokenURL == "" {
+		tokenURL = defaultZoomTokenURL
+	}
+	query := url.Values{}
+	query.Set("grant_type", "account_credentials")
+	query.Set("account_id", currentConfig().Zoom.AccountID)
+
+	req, err := http.NewRequest("POST", tokenURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+	req.SetBasicAuth(currentConfig().Zoom.ClientID, currentConfig().Zoom.ClientSecret)
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := zoomDo(req, &token); err != nil {
+		return "", err
+	}
+
+	zoomToken = token.AccessToken
+	// Renew a minute early so a token never expires mid-import
+	zoomTokenTill = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return zoomToken, nil
+}
+
+// zoomGet calls the Zoom API and decodes the response into result
+func zoomGet(path string, query url.Values, result interface{}) error {
+	token, err := zoomAccessToken()
+	if err != nil {
+		return err
+	}
+
+	baseURL := currentConfig().Zoom.BaseURL
+	if baseURL == "" {
+		baseURL = defaultZoomURL
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimRight(baseURL, "/")+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return zoomDo(req, result)
+}
+
+func zoomDo(req *http.Request, result interface{}) error {
+	resp, err := zoomClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request to Zoom: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Zoom API returned error: %s - %s", resp.Status, string(body))
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+// zoomMeetingID escapes a meeting UUID for a path, UUIDs starting with "/" or
+// containing "//" must be encoded twice
+func zoomMeetingID(id string) string {
+	if strings.HasPrefix(id, "/") || strings.Contains(id, "//") {
+		return url.PathEscape(url.PathEscape(id))
+	}
+	return url.PathEscape(id)
+}
+
+// zoomAttendance returns the time the user spent in each meeting they attended on the day,
+// from Zoom's past meeting reports. Leaving and rejoining a meeting adds up.
+func zoomAttendance(email string, start, end time.Time) ([]MeetingAttendance, error) {
+	query := url.Values{}
+	query.Set("from", start.Format("2006-01-02"))
+	query.Set("to", start.Format("2006-01-02"))
+	query.Set("type", "past")
+	query.Set("page_size", "300")
+
+	var report struct {
+		Meetings []zoomMeeting `json:"meetings"`
+	}
+	if err := zoomGet("/report/users/"+url.PathEscape(email)+"/meetings", query, &report); err != nil {
+		return nil, err
+	}
+
+	attendance := []MeetingAttendance{}
+	for _, meeting := range report.Meetings {
+		if meeting.StartTime.Before(start) || !meeting.StartTime.Before(end) {
+			continue
+		}
+
+		var participants struct {
+			Participants []zoomParticipant `json:"participants"`
+		}
+		if err := zoomGet("/report/meetings/"+zoomMeetingID(meeting.UUID)+"/participants", url.Values{"page_size": {"300"}}, &participants); err != nil {
+			return nil, fmt.Errorf("meeting %s: %v", meeting.Topic, err)
+		}
+
+		attended := MeetingAttendance{Topic: meeting.Topic}
+		seconds := 0
+		for _, participant := range participants.Participants {
+			if !strings.EqualFold(participant.UserEmail, email) {
+				continue
+			}
+			if attended.Joined.IsZero() || participant.JoinTime.Before(attended.Joined) {
+				attended.Joined = participant.JoinTime
+			}
+			if participant.LeaveTime.After(attended.Left) {
+				attended.Left = participant.LeaveTime
+			}
+			seconds += participant.Duration
+		}
+		if seconds == 0 {
+			continue
+		}
+
+		attended.Minutes = max((seconds+30)/60, 1)
+		attended.Timespan = fmt.Sprintf("%dm", attended.Minutes)
+		attendance = append(attendance, attended)
+	}
+
+	return attendance, nil
+}
+
+// meetingEntry finds the user's entry for a meeting: one mentioning the topic in its description
+func meetingEntry(entries []TimeEntry, owner, topic string) *TimeEntry {
+	topic = strings.ToLower(strings.TrimSpace(topic))
+	if topic == "" {
+		return nil
+	}
+	for i := range entries {
+		if entryOwner(entries[i]) == owner && strings.Contains(strings.ToLower(entries[i].Description), topic) {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+// zoomImportHandler logs the time the current user actually attended Zoom meetings on
+// ?date=YYYYMMDD (default today). An entry already mentioning the meeting topic, e.g.
+// one logged from the scheduled slot, gets the attended duration; other meetings are
+// added as new entries. ?dry_run=true only reports the attendance.
+func zoomImportHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST method
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	owner := currentUser(r).Name
+	email := zoomEmail(owner)
+	if !zoomConfigured() || email == "" {
+		writeError(w, r, http.StatusServiceUnavailable, "Zoom is not configured for "+owner)
+		return
+	}
+
+	day, err := resolveEntryDay(r.URL.Query().Get("date"), owner)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	start, end := dayBounds(day)
+	attendance, err := zoomAttendance(email, start, end)
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	entries, err := readDayEntries(day)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Error reading entries: "+err.Error())
+		return
+	}
+
+	errors := []string{}
+	for i := range attendance {
+		attended := &attendance[i]
+
+		if existing := meetingEntry(entries, owner, attended.Topic); existing != nil {
+			attended.EntryID = existing.ID
+			attended.Updated = true
+			attended.Previous = existing.Timespan
+			if dryRun || existing.Timespan == attended.Timespan {
+				continue
+			}
+
+			_, err := updateEntry(r.Context(), day, existing.ID, func(e *TimeEntry) {
+				e.Timespan = attended.Timespan
+			})
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("Error updating entry ID %s: %v", existing.ID, err))
+			}
+			continue
+		}
+
+		if dryRun {
+			continue
+		}
+
+		entry := TimeEntry{
+			ID:          uuid.New().String(),
+			CreatedAt:   attended.Left.UTC().Format(time.RFC3339),
+			Timespan:    attended.Timespan,
+			Description: "Meeting: " + attended.Topic,
+			Categorized: false,
+			User:        entryUserName(currentUser(r)),
+		}
+		if err := appendEntry(r.Context(), day, entry); err != nil {
+			errors = append(errors, fmt.Sprintf("Error saving %s: %v", entry.Description, err))
+			continue
+		}
+		attended.EntryID = entry.ID
+		entries = append(entries, entry)
+	}
+
+	// Create response
+	response := map[string]interface{}{
+		"date":          day.Format("2006-01-02"),
+		"meeting_count": len(attendance),
+		"meetings":      attendance,
+		"dry_run":       dryRun,
+	}
+
+	if len(errors) > 0 {
+		response["errors"] = errors
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}